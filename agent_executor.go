@@ -0,0 +1,351 @@
+package anyi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jieliu2000/anyi/flow"
+	"github.com/jieliu2000/anyi/llm"
+	"github.com/jieliu2000/anyi/llm/chat"
+	"github.com/jieliu2000/anyi/llm/tools"
+)
+
+const (
+	// DefaultAgentMaxIterations is the maximum number of model calls of an agent step if MaxIterations is not set.
+	DefaultAgentMaxIterations = 10
+
+	// DefaultAgentTranscriptVariable is the name of the variable which receives the conversation of an agent step if TranscriptVariable is not set.
+	DefaultAgentTranscriptVariable = "agentTranscript"
+)
+
+// AgentExecutor is an executor that lets the model call Go functions in a loop.
+// It sends the prompt together with the definitions of its tools to the model. Whenever the model answers with tool calls, the executor invokes the tool handlers and sends the results back.
+// The loop stops when the model answers without calling any tool, or fails when MaxIterations model calls didn't produce a final answer.
+//
+// The final answer is written to the Text field of the flow context and the whole conversation is stored as []chat.Message in the variable named by TranscriptVariable. The conversation is also stored when the step fails, so an OnFailure step can inspect it.
+//
+// Example usage in configuration:
+//
+//	{
+//	  "type": "agent",
+//	  "withconfig": {
+//	    "template": "What's the weather in {{.Text}}?",
+//	    "tools": ["get_weather"],
+//	    "maxIterations": 5
+//	  }
+//	}
+type AgentExecutor struct {
+	Template          string                         `json:"template" yaml:"template" mapstructure:"template"`
+	TemplateFile      string                         `json:"templateFile" yaml:"templateFile" mapstructure:"templateFile"`
+	TemplateFormatter *chat.PromptyTemplateFormatter `json:"-" yaml:"-" mapstructure:"-"`
+	SystemMessage     string                         `json:"systemMessage" yaml:"systemMessage" mapstructure:"systemMessage"`
+
+	// Tools contains the names of tools registered with RegisterTool which the model can call.
+	Tools []string `json:"tools" yaml:"tools" mapstructure:"tools"`
+	// ToolImpls contains tools which are passed directly instead of being looked up in the registry.
+	ToolImpls []*tools.Tool `json:"-" yaml:"-" mapstructure:"-"`
+	// MCPServers contains MCP servers whose tools can be called by the model. The servers are connected when the step runs and closed when it ends.
+	MCPServers []*MCPServerConfig `json:"mcpServers" yaml:"mcpServers" mapstructure:"mcpServers"`
+	// ApproveMCPTool approves the calls of tools of MCP servers which don't have AutoApprove set.
+	ApproveMCPTool MCPToolApprover `json:"-" yaml:"-" mapstructure:"-"`
+	// MCPApprovalHandler is the name of a registered approval handler, for example "stdin", which asks a human to approve the calls of tools of MCP servers which don't have AutoApprove set. It's used if ApproveMCPTool is not set.
+	// Without both, these calls are denied.
+	MCPApprovalHandler string `json:"mcpApprovalHandler" yaml:"mcpApprovalHandler" mapstructure:"mcpApprovalHandler"`
+
+	MaxIterations      int    `json:"maxIterations" yaml:"maxIterations" mapstructure:"maxIterations"`
+	TranscriptVariable string `json:"transcriptVariable" yaml:"transcriptVariable" mapstructure:"transcriptVariable"`
+	Trim               string `json:"trim" yaml:"trim" mapstructure:"trim"`
+}
+
+// NewAgentExecutor creates an agent executor which uses the given tools.
+//
+// Parameters:
+//   - template: The prompt template. If empty, the text of the flow context is used as the prompt.
+//   - systemMessage: Optional system message to include in the conversation
+//   - agentTools: The tools the model can call
+//
+// Returns:
+//   - A new agent executor
+func NewAgentExecutor(template string, systemMessage string, agentTools ...*tools.Tool) *AgentExecutor {
+	return &AgentExecutor{
+		Template:      template,
+		SystemMessage: systemMessage,
+		ToolImpls:     agentTools,
+	}
+}
+
+// Init initializes the AgentExecutor by creating the template formatter and applying the default settings.
+// Tools referenced by name are resolved when the step runs, so they can be registered after the executor is created.
+//
+// Returns:
+//   - An error if the template cannot be parsed
+func (executor *AgentExecutor) Init() error {
+	formatter, err := executor.formatter()
+	if err != nil {
+		return err
+	}
+	executor.TemplateFormatter = formatter
+	if executor.MaxIterations <= 0 {
+		executor.MaxIterations = DefaultAgentMaxIterations
+	}
+	if executor.TranscriptVariable == "" {
+		executor.TranscriptVariable = DefaultAgentTranscriptVariable
+	}
+	return nil
+}
+
+// Run runs the agent loop. See RunContext for details.
+func (executor *AgentExecutor) Run(flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
+	return executor.RunContext(context.Background(), flowContext, step)
+}
+
+// RunContext runs the agent loop with the given context. The context is passed to the model requests and to the tool handlers.
+// Errors returned by tool handlers and calls of unknown tools don't stop the loop. They are reported to the model as the result of the call, so the model can react to them.
+//
+// Parameters:
+//   - ctx: The context of the execution
+//   - flowContext: The flow context containing data for prompt generation
+//   - step: The workflow step containing the client to use
+//
+// Returns:
+//   - Updated flow context with the final answer in the Text field
+//   - An error if a model call fails or no final answer is produced within MaxIterations calls. The flow context is returned together with the error, so the transcript variable can be inspected, for example by the OnFailure step
+func (executor *AgentExecutor) RunContext(ctx context.Context, flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
+	if step == nil {
+		return nil, errors.New("no step provided")
+	}
+
+	client := step.GetClient()
+	if client == nil && flowContext.Flow != nil {
+		client = flowContext.Flow.ClientImpl
+	}
+	if client == nil {
+		return nil, errors.New("no client set for flow step")
+	}
+
+	// The defaults are resolved into locals, so runs sharing the executor don't write to it
+	formatter, err := executor.formatter()
+	if err != nil {
+		return nil, err
+	}
+	maxIterations := executor.MaxIterations
+	if maxIterations <= 0 {
+		maxIterations = DefaultAgentMaxIterations
+	}
+	transcriptVariable := executor.TranscriptVariable
+	if transcriptVariable == "" {
+		transcriptVariable = DefaultAgentTranscriptVariable
+	}
+
+	mcpTools, closeServers, err := executor.connectMCPServers(ctx, flowContext, step)
+	if err != nil {
+		return nil, err
+	}
+	defer closeServers()
+
+	toolsByName, functions, err := executor.resolveTools(mcpTools)
+	if err != nil {
+		return nil, err
+	}
+
+	input := flowContext.Text
+	if formatter != nil {
+		input, err = formatter.Format(flowContext)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	messages := []chat.Message{}
+	if executor.SystemMessage != "" {
+		messages = append(messages, chat.NewSystemMessage(executor.SystemMessage))
+	}
+	messages = append(messages, newUserMessage(input, flowContext.ImageURLs))
+
+	for i := 0; i < maxIterations; i++ {
+		response, _, err := llm.ChatWithFunctionsContext(ctx, client, messages, functions, nil)
+		if err != nil {
+			flowContext.SetVariable(transcriptVariable, messages)
+			return &flowContext, err
+		}
+		if response.Role == "" {
+			response.Role = "assistant"
+		}
+		messages = append(messages, *response)
+
+		if len(response.ToolCalls) == 0 {
+			flowContext.Text = response.Content
+			if executor.Trim != "" {
+				flowContext.Text = strings.Trim(flowContext.Text, executor.Trim)
+			}
+			if response.Thinking != "" {
+				flowContext.Think = response.Thinking
+			}
+			flowContext.SetVariable(transcriptVariable, messages)
+			return &flowContext, nil
+		}
+
+		for _, call := range response.ToolCalls {
+			messages = append(messages, executor.callTool(ctx, toolsByName, call))
+		}
+	}
+
+	flowContext.SetVariable(transcriptVariable, messages)
+	return &flowContext, fmt.Errorf("agent didn't produce a final answer within %d iterations", maxIterations)
+}
+
+// formatter returns the template formatter set up by Init, or parses the template if Init wasn't called.
+func (executor *AgentExecutor) formatter() (*chat.PromptyTemplateFormatter, error) {
+	if executor.TemplateFormatter != nil {
+		return executor.TemplateFormatter, nil
+	}
+	if executor.Template != "" {
+		return chat.NewPromptTemplateFormatter(executor.Template)
+	}
+	if executor.TemplateFile != "" {
+		return chat.NewPromptTemplateFormatterFromFile(executor.TemplateFile)
+	}
+	return nil, nil
+}
+
+// connectMCPServers connects to the MCP servers of the executor and returns their tools together with a function which closes the connections.
+func (executor *AgentExecutor) connectMCPServers(ctx context.Context, flowContext flow.FlowContext, step *flow.Step) ([]*tools.Tool, func(), error) {
+	if len(executor.MCPServers) == 0 {
+		return nil, func() {}, nil
+	}
+	approver := executor.ApproveMCPTool
+	if approver == nil && executor.MCPApprovalHandler != "" {
+		handler, err := GetApprovalHandler(executor.MCPApprovalHandler)
+		if err != nil {
+			return nil, nil, err
+		}
+		approver = newMCPToolApprover(handler, flowContext, step)
+	}
+
+	clients := []MCPClient{}
+	closeServers := func() {
+		for _, client := range clients {
+			if err := client.Close(); err != nil {
+				log.Warnf("Failed to close MCP client: %v", err)
+			}
+		}
+	}
+
+	mcpTools := []*tools.Tool{}
+	for _, config := range executor.MCPServers {
+		if err := validateServerConfig(config); err != nil {
+			closeServers()
+			return nil, nil, fmt.Errorf("invalid MCP server configuration: %w", err)
+		}
+		config = resolveServerVariables(config)
+		client, err := NewMCPClient(config)
+		if err != nil {
+			closeServers()
+			return nil, nil, err
+		}
+		clients = append(clients, client)
+
+		if err := client.Initialize(ctx); err != nil {
+			closeServers()
+			return nil, nil, fmt.Errorf("failed to initialize MCP server %s: %w", config.Name, err)
+		}
+		serverTools, err := MCPTools(ctx, client, config, approver)
+		if err != nil {
+			closeServers()
+			return nil, nil, fmt.Errorf("failed to list tools of MCP server %s: %w", config.Name, err)
+		}
+		mcpTools = append(mcpTools, serverTools...)
+	}
+	return mcpTools, closeServers, nil
+}
+
+// newMCPToolApprover returns an approver which asks the approval handler whether a tool of an MCP server may be called. The arguments of the call are the text of the request. Edits of the text are ignored, and errors of the handler deny the call.
+func newMCPToolApprover(handler ApprovalHandler, flowContext flow.FlowContext, step *flow.Step) MCPToolApprover {
+	return func(ctx context.Context, server string, tool string, arguments map[string]any) bool {
+		text, err := json.MarshalIndent(arguments, "", "  ")
+		if err != nil {
+			text = []byte(fmt.Sprint(arguments))
+		}
+		request := ApprovalRequest{
+			RunID:   flowContext.RunID,
+			Prompt:  fmt.Sprintf("Allow the call of tool %s of MCP server %s?", tool, server),
+			Text:    string(text),
+			Context: flowContext,
+		}
+		if step != nil {
+			request.Step = step.Name
+		}
+		decision, err := handler.RequestApproval(ctx, request)
+		if err != nil {
+			log.Warnf("Failed to ask for the approval of tool %s of MCP server %s: %v", tool, server, err)
+			return false
+		}
+		return decision != nil && decision.Approved
+	}
+}
+
+// resolveTools collects the tools of the executor and the given extra tools and returns them indexed by name together with their function definitions.
+func (executor *AgentExecutor) resolveTools(extraTools []*tools.Tool) (map[string]*tools.Tool, []tools.FunctionConfig, error) {
+	toolsByName := map[string]*tools.Tool{}
+	functions := []tools.FunctionConfig{}
+
+	add := func(tool *tools.Tool) error {
+		name := tool.Name()
+		if _, exists := toolsByName[name]; exists {
+			return fmt.Errorf("duplicate tool %q", name)
+		}
+		toolsByName[name] = tool
+		functions = append(functions, tool.Function)
+		return nil
+	}
+
+	for _, tool := range executor.ToolImpls {
+		if tool == nil {
+			continue
+		}
+		if err := add(tool); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, tool := range extraTools {
+		if err := add(tool); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, name := range executor.Tools {
+		tool, err := GetTool(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := add(tool); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if len(functions) == 0 {
+		return nil, nil, errors.New("no tools provided for agent")
+	}
+	return toolsByName, functions, nil
+}
+
+// callTool invokes the tool requested by the call and returns the message sent back to the model. Failed calls are returned as tool error messages.
+func (executor *AgentExecutor) callTool(ctx context.Context, toolsByName map[string]*tools.Tool, call chat.ToolCall) chat.Message {
+	tool, ok := toolsByName[call.Function.Name]
+	if !ok {
+		log.Warnf("Model called unknown tool %s", call.Function.Name)
+		return chat.NewToolErrorMessage(call, fmt.Sprintf("Error: unknown tool %s", call.Function.Name))
+	}
+
+	log.Debugf("Calling tool %s with arguments %v", call.Function.Name, call.Function.Arguments)
+	result, err := tool.Call(ctx, call.Function.Arguments)
+	if err != nil {
+		log.Warnf("Tool %s failed: %v", call.Function.Name, err)
+		return chat.NewToolErrorMessage(call, "Error: "+err.Error())
+	}
+	return chat.NewToolResultMessage(call, result)
+}
@@ -0,0 +1,221 @@
+package anyi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/jieliu2000/anyi/flow"
+	"github.com/jieliu2000/anyi/llm/chat"
+	"github.com/jieliu2000/anyi/llm/tools"
+	"github.com/stretchr/testify/assert"
+)
+
+// scriptedClient returns the queued responses one after another and records the messages and functions of every call.
+type scriptedClient struct {
+	responses []*chat.Message
+	messages  [][]chat.Message
+	functions [][]tools.FunctionConfig
+}
+
+func (c *scriptedClient) Chat(messages []chat.Message, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
+	return c.ChatWithFunctions(messages, nil, options)
+}
+
+func (c *scriptedClient) ChatWithFunctions(messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
+	c.messages = append(c.messages, append([]chat.Message{}, messages...))
+	c.functions = append(c.functions, functions)
+	if len(c.responses) == 0 {
+		return nil, chat.ResponseInfo{}, errors.New("no more responses")
+	}
+	response := c.responses[0]
+	c.responses = c.responses[1:]
+	return response, chat.ResponseInfo{}, nil
+}
+
+func toolCallResponse(id string, name string, arguments map[string]any) *chat.Message {
+	return &chat.Message{
+		Role: "assistant",
+		ToolCalls: []chat.ToolCall{{
+			ID:       id,
+			Type:     "function",
+			Function: chat.FunctionCall{Name: name, Arguments: arguments},
+		}},
+	}
+}
+
+func weatherTool() *tools.Tool {
+	return tools.NewTool(tools.FunctionConfig{
+		Name:        "get_weather",
+		Description: "Get the weather of a city",
+		Params: []tools.ParameterConfig{
+			{Name: "city", Type: "string", Required: true},
+		},
+	}, func(ctx context.Context, arguments map[string]any) (string, error) {
+		city, _ := arguments["city"].(string)
+		if city == "" {
+			return "", errors.New("city is required")
+		}
+		return fmt.Sprintf("Sunny in %s", city), nil
+	})
+}
+
+func TestAgentExecutor_ToolCallThenAnswer(t *testing.T) {
+	client := &scriptedClient{responses: []*chat.Message{
+		toolCallResponse("call_1", "get_weather", map[string]any{"city": "Paris"}),
+		{Role: "assistant", Content: " It's sunny in Paris. "},
+	}}
+	executor := NewAgentExecutor("What's the weather in {{.Text}}?", "You are helpful.", weatherTool())
+	executor.Trim = " "
+	assert.NoError(t, executor.Init())
+
+	step := &flow.Step{Executor: executor}
+	step.ClientImpl = client
+
+	result, err := executor.Run(flow.FlowContext{Text: "Paris"}, step)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "It's sunny in Paris.", result.Text)
+
+	assert.Len(t, client.messages, 2)
+	assert.Len(t, client.functions[0], 1)
+	assert.Equal(t, "get_weather", client.functions[0][0].Name)
+	assert.Equal(t, "What's the weather in Paris?", client.messages[0][1].Content)
+
+	secondCall := client.messages[1]
+	assert.Len(t, secondCall, 4)
+	toolResult := secondCall[3]
+	assert.Equal(t, "tool", toolResult.Role)
+	assert.Equal(t, "call_1", toolResult.ToolCallID)
+	assert.Equal(t, "Sunny in Paris", toolResult.Content)
+
+	transcript, ok := result.GetVariable(DefaultAgentTranscriptVariable).([]chat.Message)
+	assert.True(t, ok)
+	assert.Len(t, transcript, 5)
+	assert.Equal(t, "system", transcript[0].Role)
+}
+
+func TestAgentExecutor_ToolErrorIsSentToModel(t *testing.T) {
+	client := &scriptedClient{responses: []*chat.Message{
+		toolCallResponse("call_1", "get_weather", map[string]any{}),
+		toolCallResponse("call_2", "unknown_tool", nil),
+		{Role: "assistant", Content: "Sorry, I can't tell."},
+	}}
+	executor := NewAgentExecutor("", "", weatherTool())
+	step := &flow.Step{Executor: executor}
+	step.ClientImpl = client
+
+	result, err := executor.Run(flow.FlowContext{Text: "Weather?"}, step)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Sorry, I can't tell.", result.Text)
+	assert.Equal(t, "Weather?", client.messages[0][0].Content)
+	assert.Equal(t, "Error: city is required", client.messages[1][2].Content)
+	assert.Equal(t, "Error: unknown tool unknown_tool", client.messages[2][4].Content)
+	assert.True(t, client.messages[1][2].ToolError)
+	assert.True(t, client.messages[2][4].ToolError)
+}
+
+func TestAgentExecutor_MaxIterations(t *testing.T) {
+	client := &scriptedClient{responses: []*chat.Message{
+		toolCallResponse("call_1", "get_weather", map[string]any{"city": "Paris"}),
+		toolCallResponse("call_2", "get_weather", map[string]any{"city": "Rome"}),
+		{Role: "assistant", Content: "Too late"},
+	}}
+	executor := NewAgentExecutor("", "", weatherTool())
+	executor.MaxIterations = 2
+	executor.TranscriptVariable = "history"
+	step := &flow.Step{Executor: executor}
+	step.ClientImpl = client
+
+	flowContext := flow.FlowContext{Text: "Weather?"}
+	result, err := executor.Run(flowContext, step)
+
+	assert.EqualError(t, err, "agent didn't produce a final answer within 2 iterations")
+	assert.Len(t, client.messages, 2)
+	assert.NotNil(t, result)
+	transcript, ok := result.GetVariable("history").([]chat.Message)
+	assert.True(t, ok)
+	assert.Len(t, transcript, 5)
+}
+
+func TestAgentExecutor_ModelErrorKeepsTranscript(t *testing.T) {
+	client := &scriptedClient{responses: []*chat.Message{
+		toolCallResponse("call_1", "get_weather", map[string]any{"city": "Paris"}),
+	}}
+	executor := NewAgentExecutor("", "", weatherTool())
+	step := &flow.Step{Executor: executor}
+	step.ClientImpl = client
+
+	result, err := executor.Run(flow.FlowContext{Text: "Weather?"}, step)
+
+	assert.EqualError(t, err, "no more responses")
+	assert.NotNil(t, result)
+	transcript, ok := result.GetVariable(DefaultAgentTranscriptVariable).([]chat.Message)
+	assert.True(t, ok)
+	assert.Len(t, transcript, 3)
+	assert.Equal(t, "tool", transcript[2].Role)
+}
+
+func TestAgentExecutor_RegisteredTools(t *testing.T) {
+	origRegistry := GlobalRegistry
+	defer func() { GlobalRegistry = origRegistry }()
+	GlobalRegistry = &anyiRegistry{}
+
+	assert.NoError(t, RegisterTool(weatherTool()))
+	assert.Error(t, RegisterTool(weatherTool()))
+	assert.Error(t, RegisterTool(tools.NewTool(tools.FunctionConfig{Name: "no_handler"}, nil)))
+
+	client := &scriptedClient{responses: []*chat.Message{
+		toolCallResponse("call_1", "get_weather", map[string]any{"city": "Oslo"}),
+		{Role: "assistant", Content: "Sunny"},
+	}}
+	executor := &AgentExecutor{Tools: []string{"get_weather"}}
+	assert.NoError(t, executor.Init())
+	step := &flow.Step{Executor: executor}
+	step.ClientImpl = client
+
+	result, err := executor.Run(flow.FlowContext{Text: "Weather in Oslo?"}, step)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Sunny", result.Text)
+	assert.Equal(t, "Sunny in Oslo", client.messages[1][2].Content)
+
+	executor = &AgentExecutor{Tools: []string{"missing"}}
+	_, err = executor.Run(flow.FlowContext{Text: "Hi"}, step)
+	assert.Error(t, err)
+}
+
+func TestAgentExecutor_NoTools(t *testing.T) {
+	executor := &AgentExecutor{}
+	step := &flow.Step{Executor: executor}
+	step.ClientImpl = &scriptedClient{}
+
+	_, err := executor.Run(flow.FlowContext{Text: "Hi"}, step)
+
+	assert.EqualError(t, err, "no tools provided for agent")
+}
+
+func TestAgentExecutor_RunDoesNotChangeExecutor(t *testing.T) {
+	executor := NewAgentExecutor("Weather in {{.Text}}?", "", weatherTool())
+
+	var wg sync.WaitGroup
+	for _, city := range []string{"Paris", "Rome"} {
+		wg.Add(1)
+		go func(city string) {
+			defer wg.Done()
+			step := &flow.Step{Executor: executor}
+			step.ClientImpl = &scriptedClient{responses: []*chat.Message{{Role: "assistant", Content: "Sunny"}}}
+			result, err := executor.Run(flow.FlowContext{Text: city}, step)
+			assert.NoError(t, err)
+			assert.NotNil(t, result.GetVariable(DefaultAgentTranscriptVariable))
+		}(city)
+	}
+	wg.Wait()
+
+	assert.Nil(t, executor.TemplateFormatter)
+	assert.Equal(t, 0, executor.MaxIterations)
+	assert.Equal(t, "", executor.TranscriptVariable)
+}
@@ -11,6 +11,8 @@ import (
 	"github.com/jieliu2000/anyi/flow"
 	"github.com/jieliu2000/anyi/llm"
 	"github.com/jieliu2000/anyi/llm/chat"
+	"github.com/jieliu2000/anyi/llm/tools"
+	"github.com/jieliu2000/anyi/rag"
 )
 
 // anyiRegistry is the central registry for all components in the Anyi framework.
@@ -22,6 +24,9 @@ type anyiRegistry struct {
 	Validators        map[string]flow.StepValidator
 	Executors         map[string]flow.StepExecutor
 	Formatters        map[string]chat.PromptFormatter
+	Tools             map[string]*tools.Tool
+	ApprovalHandlers  map[string]ApprovalHandler
+	Retrievers        map[string]*rag.Retriever
 	defaultClientName string
 }
 
@@ -33,6 +38,10 @@ var GlobalRegistry *anyiRegistry = &anyiRegistry{
 	Validators: make(map[string]flow.StepValidator),
 	Executors:  make(map[string]flow.StepExecutor),
 	Formatters: make(map[string]chat.PromptFormatter),
+	Tools:      make(map[string]*tools.Tool),
+
+	ApprovalHandlers: make(map[string]ApprovalHandler),
+	Retrievers:       make(map[string]*rag.Retriever),
 }
 
 // RegisterNewDefaultClient registers a client as the default client in the global registry.
@@ -131,15 +140,20 @@ func NewClient(name string, model llm.ModelConfig) (llm.Client, error) {
 	if err != nil {
 		return nil, err
 	}
-	// If name is not empty, Set the client to Anyi.Clients
-	if name != "" {
-		// Use mutex to protect access to the global registry
-		GlobalRegistry.mu.Lock()
-		defer GlobalRegistry.mu.Unlock()
+	setClient(name, client)
+	return client, nil
+}
 
-		GlobalRegistry.Clients[name] = client
+// setClient stores the client in the global registry under the name, replacing any client with the same name. Nothing is stored if the name is empty.
+func setClient(name string, client llm.Client) {
+	if name == "" {
+		return
 	}
-	return client, nil
+	// Use mutex to protect access to the global registry
+	GlobalRegistry.mu.Lock()
+	defer GlobalRegistry.mu.Unlock()
+
+	GlobalRegistry.Clients[name] = client
 }
 
 // RegisterFlow registers a flow in the global registry.
@@ -447,6 +461,97 @@ func RegisterFormatter(name string, formatter chat.PromptFormatter) error {
 	return nil
 }
 
+// RegisterApprovalHandler registers a handler which asks humans for approvals in the global registry.
+// Approval executors refer to the handler by name.
+//
+// Parameters:
+//   - name: Name to register the handler under
+//   - handler: The approval handler to register
+//
+// Returns:
+//   - Any error encountered during registration
+func RegisterApprovalHandler(name string, handler ApprovalHandler) error {
+	if name == "" {
+		return errors.New("name cannot be empty")
+	}
+	if handler == nil {
+		return errors.New("handler cannot be nil")
+	}
+
+	GlobalRegistry.mu.Lock()
+	defer GlobalRegistry.mu.Unlock()
+
+	if GlobalRegistry.ApprovalHandlers == nil {
+		GlobalRegistry.ApprovalHandlers = make(map[string]ApprovalHandler)
+	}
+	GlobalRegistry.ApprovalHandlers[name] = handler
+	return nil
+}
+
+// GetApprovalHandler retrieves an approval handler from the global registry by name.
+//
+// Parameters:
+//   - name: Name of the handler to retrieve
+//
+// Returns:
+//   - The requested approval handler
+//   - An error if no handler is registered under the name
+func GetApprovalHandler(name string) (ApprovalHandler, error) {
+	GlobalRegistry.mu.RLock()
+	defer GlobalRegistry.mu.RUnlock()
+
+	handler, ok := GlobalRegistry.ApprovalHandlers[name]
+	if !ok {
+		return nil, errors.New("no approval handler found with the given name: " + name)
+	}
+	return handler, nil
+}
+
+// RegisterRetriever registers a retriever in the global registry, so "retrieve" steps can use it by name.
+//
+// Parameters:
+//   - name: Name to register the retriever under
+//   - retriever: The retriever to register
+//
+// Returns:
+//   - An error if the name is empty or the retriever is nil
+func RegisterRetriever(name string, retriever *rag.Retriever) error {
+	if name == "" {
+		return errors.New("name cannot be empty")
+	}
+	if retriever == nil {
+		return errors.New("retriever cannot be nil")
+	}
+
+	GlobalRegistry.mu.Lock()
+	defer GlobalRegistry.mu.Unlock()
+
+	if GlobalRegistry.Retrievers == nil {
+		GlobalRegistry.Retrievers = make(map[string]*rag.Retriever)
+	}
+	GlobalRegistry.Retrievers[name] = retriever
+	return nil
+}
+
+// GetRetriever retrieves a retriever from the global registry by name.
+//
+// Parameters:
+//   - name: Name of the retriever to retrieve
+//
+// Returns:
+//   - The requested retriever
+//   - An error if no retriever is registered under the name
+func GetRetriever(name string) (*rag.Retriever, error) {
+	GlobalRegistry.mu.RLock()
+	defer GlobalRegistry.mu.RUnlock()
+
+	retriever, ok := GlobalRegistry.Retrievers[name]
+	if !ok {
+		return nil, errors.New("no retriever found with the given name: " + name)
+	}
+	return retriever, nil
+}
+
 // NewPromptTemplateFormatterFromFile creates a new template formatter from a file and registers it.
 // The file should contain a Go template for formatting prompts.
 //
@@ -573,6 +678,63 @@ func RegisterValidator(name string, validator flow.StepValidator) error {
 	return nil
 }
 
+// RegisterTool registers a tool in the global registry under the name of its function.
+// Registered tools can be referenced by name in the configuration of agent steps.
+//
+// Parameters:
+//   - tool: The tool to register
+//
+// Returns:
+//   - Any error encountered during registration
+func RegisterTool(tool *tools.Tool) error {
+	if tool == nil {
+		return errors.New("tool cannot be nil")
+	}
+	name := tool.Name()
+	if name == "" {
+		return errors.New("tool name cannot be empty")
+	}
+	if tool.Handler == nil {
+		return fmt.Errorf("tool %q has no handler", name)
+	}
+
+	GlobalRegistry.mu.Lock()
+	defer GlobalRegistry.mu.Unlock()
+
+	if GlobalRegistry.Tools == nil {
+		GlobalRegistry.Tools = make(map[string]*tools.Tool)
+	}
+	if _, exists := GlobalRegistry.Tools[name]; exists {
+		return fmt.Errorf("tool with name %q already exists", name)
+	}
+
+	GlobalRegistry.Tools[name] = tool
+	return nil
+}
+
+// GetTool retrieves a tool from the global registry by name.
+//
+// Parameters:
+//   - name: Name of the tool to retrieve
+//
+// Returns:
+//   - The requested tool
+//   - An error if the tool is not found
+func GetTool(name string) (*tools.Tool, error) {
+	if name == "" {
+		return nil, errors.New("name cannot be empty")
+	}
+
+	GlobalRegistry.mu.RLock()
+	defer GlobalRegistry.mu.RUnlock()
+
+	tool, ok := GlobalRegistry.Tools[name]
+	if !ok {
+		return nil, errors.New("no tool found with the given name: " + name)
+	}
+	return tool, nil
+}
+
 // NewLLMStepExecutorWithFormatter creates a new LLM step executor with a template formatter.
 // The executor is registered in the global registry.
 //
@@ -624,9 +786,28 @@ func Init() {
 	RegisterExecutor("setVariable", &SetVariablesExecutor{})
 	// Register MCP executor
 	RegisterExecutor("mcp", &MCPExecutor{})
+	RegisterExecutor("agent", &AgentExecutor{})
+	RegisterExecutor("foreach", &ForEachExecutor{})
+	// "map" is an alias of "foreach"
+	RegisterExecutor("map", &ForEachExecutor{})
+	RegisterExecutor("while", &WhileExecutor{})
+	RegisterExecutor("flow", &SubFlowExecutor{})
+	RegisterExecutor("approval", &ApprovalExecutor{})
+	RegisterExecutor("input", &ApprovalExecutor{Input: true})
+	RegisterExecutor("retrieve", &RetrieveExecutor{})
+
+	RegisterApprovalHandler("stdin", NewConsoleApprovalHandler())
+	RegisterApprovalHandler("pause", &PauseApprovalHandler{})
 
 	RegisterValidator("string", &StringValidator{})
 	RegisterValidator("json", &JsonValidator{})
+	RegisterValidator("llm", &LLMValidator{})
+	RegisterValidator("jsonschema", &JsonSchemaValidator{})
+	RegisterValidator("length", &LengthValidator{})
+	RegisterValidator("keyword", &KeywordValidator{})
+	RegisterValidator("gocode", &GoCodeValidator{})
+	RegisterValidator("all", &AllValidator{})
+	RegisterValidator("any", &AnyValidator{})
 
 	log.Debug("Anyi initialized successfully.")
 }
@@ -0,0 +1,439 @@
+package anyi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jieliu2000/anyi/flow"
+	"github.com/jieliu2000/anyi/llm/chat"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	// DefaultApprovalPrompt is the prompt of ApprovalExecutor if Prompt is not set.
+	DefaultApprovalPrompt = "Do you approve the following?"
+	// DefaultInputPrompt is the prompt of ApprovalExecutor in input mode if Prompt is not set.
+	DefaultInputPrompt = "Please provide the input:"
+	// DefaultApprovalVariable is the variable ApprovalExecutor stores the decision in if ResultVariable is not set.
+	DefaultApprovalVariable = "approved"
+)
+
+// ErrRejected is returned by ApprovalExecutor and by RunCommandExecutor with Confirm set when the human rejects. The comment of the human is appended to the error.
+var ErrRejected = errors.New("rejected")
+
+// ApprovalRequest is what a human is asked to approve or answer.
+type ApprovalRequest struct {
+	// RunID identifies the run of the flow, which is the token to resume the run with if it's paused.
+	RunID string `json:"runId,omitempty"`
+	// Step is the name of the step asking.
+	Step string `json:"step,omitempty"`
+	// Prompt is the question for the human.
+	Prompt string `json:"prompt"`
+	// Text is the text to approve or edit, usually the output of the previous step.
+	Text string `json:"text"`
+	// Input is true if the human is asked for text instead of a decision.
+	Input bool `json:"input"`
+	// Context is the flow context of the step.
+	Context flow.FlowContext `json:"-"`
+}
+
+// ApprovalDecision is the answer of a human.
+type ApprovalDecision struct {
+	// Approved is true if the human approved. It's ignored for input requests.
+	Approved bool `json:"approved" mapstructure:"approved"`
+	// Text replaces the text of the flow context if it's not empty, so the human can edit what was approved. For input requests it's the input.
+	Text string `json:"text,omitempty" mapstructure:"text"`
+	// Comment is an optional explanation, for example why the human rejected.
+	Comment string `json:"comment,omitempty" mapstructure:"comment"`
+}
+
+// ApprovalHandler presents an ApprovalRequest to a human and returns the answer.
+// Handlers which can't wait for the answer, like a web application notifying a reviewer, return a [*flow.PauseError]. The flow is paused then and continued with Flow.ResumeWithInput once the answer arrives. See [PauseApprovalHandler].
+type ApprovalHandler interface {
+	RequestApproval(ctx context.Context, request ApprovalRequest) (*ApprovalDecision, error)
+}
+
+// ApprovalExecutor lets a human approve, edit or provide the text of the flow before the flow continues.
+//
+// The prompt and the text are passed to the handler, which asks the human. In approval mode, the decision is stored in the variable named by ResultVariable, edited text replaces the flow text, and a rejection fails the step with ErrRejected unless ContinueOnReject is set. With Input set, the answer of the human replaces the flow text.
+//
+// If the handler pauses the flow (see [PauseApprovalHandler]), the answer passed to Flow.ResumeWithInput is used when the step runs again. It can be an ApprovalDecision, a bool, a map with the fields of ApprovalDecision, or a string. Strings are the input in input mode; in approval mode "yes", "y", "approve", "approved" and "true" approve, "edit: " followed by text approves with the edited text, and other strings reject.
+//
+// Example configuration:
+//
+//	executor:
+//	  type: "approval"
+//	  withconfig:
+//	    prompt: "Publish this answer to {{.Variables.customer}}?"
+//	    handler: "stdin"
+type ApprovalExecutor struct {
+	// The prompt shown to the human. It's a template which is formatted with the flow context. Defaults to DefaultApprovalPrompt or DefaultInputPrompt.
+	Prompt string `json:"prompt" yaml:"prompt" mapstructure:"prompt"`
+	// If true, the human is asked for text instead of a decision.
+	Input bool `json:"input" yaml:"input" mapstructure:"input"`
+	// The name of the handler asking the human, registered with RegisterApprovalHandler. The built-in handlers are "stdin" (the default) and "pause".
+	Handler string `json:"handler" yaml:"handler" mapstructure:"handler"`
+	// If set, the request is posted to this URL instead. See [WebhookApprovalHandler].
+	WebhookURL string `json:"webhookUrl" yaml:"webhookUrl" mapstructure:"webhookUrl"`
+	// The variable which is set to the decision. Defaults to DefaultApprovalVariable.
+	ResultVariable string `json:"resultVariable" yaml:"resultVariable" mapstructure:"resultVariable"`
+	// If true, a rejection doesn't fail the step. The decision is only stored in the result variable.
+	ContinueOnReject bool `json:"continueOnReject" yaml:"continueOnReject" mapstructure:"continueOnReject"`
+
+	HandlerImpl ApprovalHandler `json:"-" yaml:"-" mapstructure:"-"`
+
+	formatter *chat.PromptyTemplateFormatter
+}
+
+// Init sets the defaults, parses the prompt template and resolves the handler.
+func (executor *ApprovalExecutor) Init() error {
+	if executor.Prompt == "" {
+		executor.Prompt = DefaultApprovalPrompt
+		if executor.Input {
+			executor.Prompt = DefaultInputPrompt
+		}
+	}
+	if executor.ResultVariable == "" {
+		executor.ResultVariable = DefaultApprovalVariable
+	}
+	formatter, err := chat.NewPromptTemplateFormatter(executor.Prompt)
+	if err != nil {
+		return err
+	}
+	executor.formatter = formatter
+
+	if executor.HandlerImpl == nil {
+		handler, err := newApprovalHandler(executor.Handler, executor.WebhookURL)
+		if err != nil {
+			return err
+		}
+		executor.HandlerImpl = handler
+	}
+	return nil
+}
+
+// Run asks the human. See RunContext.
+func (executor *ApprovalExecutor) Run(flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
+	return executor.RunContext(context.Background(), flowContext, step)
+}
+
+// RunContext asks the human and applies the answer to the flow context.
+//
+// Parameters:
+//   - ctx: The context of the run. Handlers waiting for an answer stop waiting when it's done.
+//   - flowContext: The flow context with the text to approve
+//   - step: The current workflow step
+//
+// Returns:
+//   - The flow context with the edited text or the input, and the decision in the result variable
+//   - ErrRejected if the human rejected, a *flow.PauseError if the handler paused the flow, or the error of the handler
+func (executor *ApprovalExecutor) RunContext(ctx context.Context, flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
+	if executor.formatter == nil || executor.HandlerImpl == nil {
+		if err := executor.Init(); err != nil {
+			return nil, err
+		}
+	}
+	decision, err := executor.ask(ctx, flowContext, step)
+	if err != nil {
+		return nil, err
+	}
+
+	if executor.Input {
+		flowContext.Text = decision.Text
+		return &flowContext, nil
+	}
+
+	flowContext.SetVariable(executor.ResultVariable, decision.Approved)
+	if !decision.Approved {
+		if executor.ContinueOnReject {
+			return &flowContext, nil
+		}
+		return &flowContext, rejectedError(decision.Comment)
+	}
+	if decision.Text != "" {
+		flowContext.Text = decision.Text
+	}
+	return &flowContext, nil
+}
+
+// ask returns the answer passed to Flow.ResumeWithInput if the step runs after a pause, and asks the handler otherwise.
+func (executor *ApprovalExecutor) ask(ctx context.Context, flowContext flow.FlowContext, step *flow.Step) (*ApprovalDecision, error) {
+	if flowContext.ResumeInput != nil {
+		return decisionFromInput(flowContext.ResumeInput, executor.Input)
+	}
+
+	prompt, err := executor.formatter.Format(flowContext)
+	if err != nil {
+		return nil, err
+	}
+	request := ApprovalRequest{
+		RunID:   flowContext.RunID,
+		Prompt:  prompt,
+		Text:    flowContext.Text,
+		Input:   executor.Input,
+		Context: flowContext,
+	}
+	if step != nil {
+		request.Step = step.Name
+	}
+
+	decision, err := executor.HandlerImpl.RequestApproval(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if decision == nil {
+		return nil, errors.New("approval handler returned no decision")
+	}
+	return decision, nil
+}
+
+// rejectedError returns ErrRejected with the comment of the human.
+func rejectedError(comment string) error {
+	if comment == "" {
+		return ErrRejected
+	}
+	return fmt.Errorf("%w: %s", ErrRejected, comment)
+}
+
+// decisionFromInput converts the input passed to Flow.ResumeWithInput into a decision.
+func decisionFromInput(input any, inputMode bool) (*ApprovalDecision, error) {
+	switch value := input.(type) {
+	case ApprovalDecision:
+		return &value, nil
+	case *ApprovalDecision:
+		return value, nil
+	case bool:
+		return &ApprovalDecision{Approved: value}, nil
+	case string:
+		if inputMode {
+			return &ApprovalDecision{Approved: true, Text: value}, nil
+		}
+		return parseApprovalAnswer(value), nil
+	case map[string]any:
+		var decision ApprovalDecision
+		if err := mapstructure.Decode(value, &decision); err != nil {
+			return nil, fmt.Errorf("invalid approval decision: %w", err)
+		}
+		return &decision, nil
+	default:
+		return nil, fmt.Errorf("unsupported resume input of type %T", input)
+	}
+}
+
+// ApprovalEditPrefix starts a typed answer which approves with edited text, for example "edit: echo hello". The text after the prefix replaces the text of the flow context.
+const ApprovalEditPrefix = "edit:"
+
+// parseApprovalAnswer interprets a typed answer. Edited text is only accepted after ApprovalEditPrefix, so a mistyped answer like "cancel" is never approved or run as a command. Unknown answers reject.
+func parseApprovalAnswer(answer string) *ApprovalDecision {
+	answer = strings.TrimSpace(answer)
+	if len(answer) >= len(ApprovalEditPrefix) && strings.EqualFold(answer[:len(ApprovalEditPrefix)], ApprovalEditPrefix) {
+		if text := strings.TrimSpace(answer[len(ApprovalEditPrefix):]); text != "" {
+			return &ApprovalDecision{Approved: true, Text: text}
+		}
+		return &ApprovalDecision{Approved: false, Comment: "the edited text is empty"}
+	}
+	switch strings.ToLower(answer) {
+	case "y", "yes", "approve", "approved", "true":
+		return &ApprovalDecision{Approved: true}
+	case "", "n", "no", "reject", "rejected", "false":
+		return &ApprovalDecision{Approved: false}
+	default:
+		return &ApprovalDecision{Approved: false, Comment: fmt.Sprintf("unrecognized answer %q", answer)}
+	}
+}
+
+// newApprovalHandler returns the webhook handler if a URL is set, the console handler if no name is set, and the registered handler otherwise.
+func newApprovalHandler(name string, webhookURL string) (ApprovalHandler, error) {
+	if webhookURL != "" {
+		return &WebhookApprovalHandler{URL: webhookURL}, nil
+	}
+	if name == "" {
+		return NewConsoleApprovalHandler(), nil
+	}
+	return GetApprovalHandler(name)
+}
+
+// ConsoleApprovalHandler asks on a terminal. The prompt and the text are written to Writer and the answer is read as a line from Reader.
+// For approvals, "y" or "yes" approve, "edit: " followed by text approves with the edited text, and "n", "no", an empty line or any other answer reject.
+// A ConsoleApprovalHandler can be used by concurrent runs. A single goroutine reads the lines of Reader, so an answer is never lost to a request which was cancelled.
+type ConsoleApprovalHandler struct {
+	Reader io.Reader
+	Writer io.Writer
+
+	startReading sync.Once
+	answers      chan consoleAnswer
+}
+
+// consoleAnswer is a line read by a ConsoleApprovalHandler.
+type consoleAnswer struct {
+	line string
+	err  error
+}
+
+// NewConsoleApprovalHandler creates a ConsoleApprovalHandler reading from the standard input and writing to the standard output.
+func NewConsoleApprovalHandler() *ConsoleApprovalHandler {
+	return &ConsoleApprovalHandler{Reader: os.Stdin, Writer: os.Stdout}
+}
+
+// RequestApproval writes the request and reads the answer. It stops waiting when the context is done.
+func (handler *ConsoleApprovalHandler) RequestApproval(ctx context.Context, request ApprovalRequest) (*ApprovalDecision, error) {
+	handler.startReading.Do(handler.readLines)
+
+	question := "[y]es / [n]o / edit: <replacement>: "
+	if request.Input {
+		question = "> "
+	}
+	if request.Text != "" && !request.Input {
+		fmt.Fprintf(handler.Writer, "%s\n\n%s\n\n%s", request.Prompt, request.Text, question)
+	} else {
+		fmt.Fprintf(handler.Writer, "%s\n%s", request.Prompt, question)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case a, ok := <-handler.answers:
+		if !ok {
+			return nil, fmt.Errorf("failed to read the answer: %w", io.EOF)
+		}
+		if a.err != nil {
+			return nil, fmt.Errorf("failed to read the answer: %w", a.err)
+		}
+		if request.Input {
+			return &ApprovalDecision{Approved: true, Text: a.line}, nil
+		}
+		return parseApprovalAnswer(a.line), nil
+	}
+}
+
+// readLines starts the goroutine which reads the answers from Reader. It ends with the first read error, which is passed to the waiting request before the channel is closed.
+func (handler *ConsoleApprovalHandler) readLines() {
+	handler.answers = make(chan consoleAnswer)
+	lines := bufio.NewReader(handler.Reader)
+	go func() {
+		defer close(handler.answers)
+		for {
+			line, err := lines.ReadString('\n')
+			if err == io.EOF && line != "" {
+				err = nil
+			}
+			handler.answers <- consoleAnswer{line: strings.TrimRight(line, "\r\n"), err: err}
+			if err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// PendingApproval is an ApprovalRequest sent by a ChannelApprovalHandler, waiting for its answer.
+type PendingApproval struct {
+	Request ApprovalRequest
+	reply   chan ApprovalDecision
+}
+
+// Reply answers the request. Only the first reply is used.
+func (pending *PendingApproval) Reply(decision ApprovalDecision) {
+	select {
+	case pending.reply <- decision:
+	default:
+	}
+}
+
+// ChannelApprovalHandler sends requests to the Requests channel and waits until they are answered with [PendingApproval.Reply].
+// It connects flows to user interfaces running in the same process, like a chat bot or a GUI.
+type ChannelApprovalHandler struct {
+	Requests chan *PendingApproval
+}
+
+// NewChannelApprovalHandler creates a ChannelApprovalHandler whose channel buffers up to size requests.
+func NewChannelApprovalHandler(size int) *ChannelApprovalHandler {
+	return &ChannelApprovalHandler{Requests: make(chan *PendingApproval, size)}
+}
+
+// RequestApproval sends the request and waits for the reply. It stops waiting when the context is done.
+func (handler *ChannelApprovalHandler) RequestApproval(ctx context.Context, request ApprovalRequest) (*ApprovalDecision, error) {
+	pending := &PendingApproval{Request: request, reply: make(chan ApprovalDecision, 1)}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case handler.Requests <- pending:
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case decision := <-pending.reply:
+		return &decision, nil
+	}
+}
+
+// PauseApprovalHandler pauses the flow instead of waiting for the answer. The flow returns a *flow.PauseError whose Token is passed to Flow.ResumeWithInput together with the answer.
+// The flow needs a checkpoint store to be paused.
+type PauseApprovalHandler struct {
+}
+
+// RequestApproval returns a *flow.PauseError with the prompt of the request.
+func (handler *PauseApprovalHandler) RequestApproval(ctx context.Context, request ApprovalRequest) (*ApprovalDecision, error) {
+	return nil, &flow.PauseError{Prompt: request.Prompt}
+}
+
+// WebhookApprovalHandler posts the request as JSON to a URL.
+// If the server answers with status 200 and an ApprovalDecision as JSON, the decision is used right away. If it answers with status 202 Accepted, the flow is paused, and the server resumes it later with Flow.ResumeWithInput, using the runId of the request as token.
+type WebhookApprovalHandler struct {
+	URL     string
+	Headers map[string]string
+	// The timeout of the request. Defaults to 30 seconds.
+	Timeout time.Duration
+}
+
+// RequestApproval posts the request and returns the decision of the server, or a *flow.PauseError if the server accepted the request for later.
+func (handler *WebhookApprovalHandler) RequestApproval(ctx context.Context, request ApprovalRequest) (*ApprovalDecision, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	timeout := handler.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, handler.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	for key, value := range handler.Headers {
+		httpRequest.Header.Set(key, value)
+	}
+
+	response, err := http.DefaultClient.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusAccepted:
+		return nil, &flow.PauseError{Prompt: request.Prompt}
+	case http.StatusOK:
+		var decision ApprovalDecision
+		if err := json.NewDecoder(response.Body).Decode(&decision); err != nil {
+			return nil, fmt.Errorf("invalid approval decision: %w", err)
+		}
+		return &decision, nil
+	default:
+		return nil, fmt.Errorf("approval webhook returned status %d", response.StatusCode)
+	}
+}
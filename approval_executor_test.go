@@ -0,0 +1,227 @@
+package anyi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jieliu2000/anyi/flow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newConsoleHandler returns a ConsoleApprovalHandler answering with the given input and the buffer it writes to.
+func newConsoleHandler(input string) (*ConsoleApprovalHandler, *bytes.Buffer) {
+	output := &bytes.Buffer{}
+	return &ConsoleApprovalHandler{Reader: strings.NewReader(input), Writer: output}, output
+}
+
+func TestApprovalExecutor_Console(t *testing.T) {
+	handler, output := newConsoleHandler("y\n")
+	executor := &ApprovalExecutor{Prompt: "Send this to {{.Variables.customer}}?", HandlerImpl: handler}
+	flowContext := flow.NewFlowContext("Dear customer", nil)
+	flowContext.SetVariable("customer", "ACME")
+
+	result, err := executor.Run(*flowContext, &flow.Step{Name: "review"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "Dear customer", result.Text)
+	assert.Equal(t, true, result.Variables["approved"])
+	assert.Contains(t, output.String(), "Send this to ACME?\n\nDear customer\n")
+
+	// Edited answers replace the text
+	handler, _ = newConsoleHandler("edit: Dear ACME\n")
+	executor = &ApprovalExecutor{HandlerImpl: handler}
+	result, err = executor.Run(*flowContext, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Dear ACME", result.Text)
+
+	// Unknown answers reject instead of replacing the text
+	handler, _ = newConsoleHandler("Dear ACME\n")
+	executor = &ApprovalExecutor{HandlerImpl: handler}
+	result, err = executor.Run(*flowContext, nil)
+	assert.ErrorIs(t, err, ErrRejected)
+	assert.Equal(t, "Dear customer", result.Text)
+
+	handler, _ = newConsoleHandler("no\n")
+	executor = &ApprovalExecutor{HandlerImpl: handler}
+	result, err = executor.Run(*flowContext, nil)
+	assert.ErrorIs(t, err, ErrRejected)
+	assert.Equal(t, false, result.Variables["approved"])
+
+	handler, _ = newConsoleHandler("n")
+	executor = &ApprovalExecutor{HandlerImpl: handler, ContinueOnReject: true, ResultVariable: "send"}
+	result, err = executor.Run(*flowContext, nil)
+	require.NoError(t, err)
+	assert.Equal(t, false, result.Variables["send"])
+}
+
+func TestConsoleApprovalHandler_CancelledRequest(t *testing.T) {
+	reader, writer := io.Pipe()
+	handler := &ConsoleApprovalHandler{Reader: reader, Writer: io.Discard}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := handler.RequestApproval(ctx, ApprovalRequest{Prompt: "First?"})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// The answer typed after the cancelled request goes to the next request
+	go writer.Write([]byte("y\n"))
+	decision, err := handler.RequestApproval(context.Background(), ApprovalRequest{Prompt: "Second?"})
+	require.NoError(t, err)
+	assert.True(t, decision.Approved)
+
+	writer.Close()
+	_, err = handler.RequestApproval(context.Background(), ApprovalRequest{Prompt: "Third?"})
+	assert.ErrorIs(t, err, io.EOF)
+	_, err = handler.RequestApproval(context.Background(), ApprovalRequest{Prompt: "Fourth?"})
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestApprovalExecutor_Input(t *testing.T) {
+	handler, output := newConsoleHandler("Summarize it in French\n")
+	executor := &ApprovalExecutor{Input: true, HandlerImpl: handler}
+
+	result, err := executor.Run(*flow.NewFlowContext("previous", nil), nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, "Summarize it in French", result.Text)
+	assert.Equal(t, DefaultInputPrompt+"\n> ", output.String())
+}
+
+func TestApprovalExecutor_Channel(t *testing.T) {
+	handler := NewChannelApprovalHandler(1)
+	executor := &ApprovalExecutor{HandlerImpl: handler}
+
+	go func() {
+		pending := <-handler.Requests
+		if pending.Request.Text == "rm -rf build" {
+			pending.Reply(ApprovalDecision{Approved: false, Comment: "too dangerous"})
+		}
+	}()
+	_, err := executor.Run(*flow.NewFlowContext("rm -rf build", nil), nil)
+
+	assert.ErrorIs(t, err, ErrRejected)
+	assert.EqualError(t, err, "rejected: too dangerous")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = executor.RunContext(ctx, *flow.NewFlowContext("waiting", nil), nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestApprovalExecutor_PauseAndResume(t *testing.T) {
+	resetRegistry()
+	newReviewFlow := func() *flow.Flow {
+		approval, err := NewExecutorFromConfig(&ExecutorConfig{Type: "approval", WithConfig: map[string]any{"handler": "pause", "prompt": "Publish?"}})
+		require.NoError(t, err)
+		publish := funcExecutor(func(flowContext flow.FlowContext) (*flow.FlowContext, error) {
+			flowContext.Text = "published: " + flowContext.Text
+			return &flowContext, nil
+		})
+		reviewFlow, err := flow.NewFlow(nil, "review", *flow.NewStep(approval, nil, nil), *flow.NewStep(publish, nil, nil))
+		require.NoError(t, err)
+		reviewFlow.Checkpoints = flow.NewMemoryCheckpointStore()
+		return reviewFlow
+	}
+
+	reviewFlow := newReviewFlow()
+	_, err := reviewFlow.Run(flow.FlowContext{Text: "draft"})
+	var pause *flow.PauseError
+	require.ErrorAs(t, err, &pause)
+	assert.Equal(t, "Publish?", pause.Prompt)
+
+	result, err := reviewFlow.ResumeWithInput(pause.Token, "edit: final text")
+	require.NoError(t, err)
+	assert.Equal(t, "published: final text", result.Text)
+	assert.Equal(t, true, result.Variables["approved"])
+
+	reviewFlow = newReviewFlow()
+	_, err = reviewFlow.Run(flow.FlowContext{Text: "draft"})
+	require.ErrorAs(t, err, &pause)
+	_, err = reviewFlow.ResumeWithInput(pause.Token, map[string]any{"approved": false, "comment": "off topic"})
+	assert.ErrorIs(t, err, ErrRejected)
+	assert.ErrorContains(t, err, "off topic")
+}
+
+func TestWebhookApprovalHandler(t *testing.T) {
+	var received ApprovalRequest
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("X-Token"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			w.Write([]byte(`{"approved": true, "text": "edited"}`))
+		}
+	}))
+	defer server.Close()
+	handler := &WebhookApprovalHandler{URL: server.URL, Headers: map[string]string{"X-Token": "secret"}}
+
+	decision, err := handler.RequestApproval(context.Background(), ApprovalRequest{RunID: "run-1", Prompt: "Approve?", Text: "draft"})
+
+	require.NoError(t, err)
+	assert.Equal(t, &ApprovalDecision{Approved: true, Text: "edited"}, decision)
+	assert.Equal(t, ApprovalRequest{RunID: "run-1", Prompt: "Approve?", Text: "draft"}, received)
+
+	status = http.StatusAccepted
+	_, err = handler.RequestApproval(context.Background(), ApprovalRequest{Prompt: "Approve?"})
+	var pause *flow.PauseError
+	assert.ErrorAs(t, err, &pause)
+
+	status = http.StatusInternalServerError
+	_, err = handler.RequestApproval(context.Background(), ApprovalRequest{Prompt: "Approve?"})
+	assert.EqualError(t, err, "approval webhook returned status 500")
+}
+
+func TestRunCommandExecutor_Confirm(t *testing.T) {
+	handler, output := newConsoleHandler("n\n")
+	executor := &RunCommandExecutor{Silent: true, OutputToContext: true, Confirm: true, ConfirmHandlerImpl: handler}
+
+	_, err := executor.Run(*flow.NewFlowContext("echo generated", nil), nil)
+
+	assert.ErrorIs(t, err, ErrRejected)
+	assert.Contains(t, output.String(), "Run this command?\n\necho generated\n")
+
+	handler, _ = newConsoleHandler("EDIT: echo edited\n")
+	executor.ConfirmHandlerImpl = handler
+	result, err := executor.Run(*flow.NewFlowContext("echo generated", nil), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "edited", result.Text)
+
+	handler, _ = newConsoleHandler("yes\n")
+	executor.ConfirmHandlerImpl = handler
+	result, err = executor.Run(*flow.NewFlowContext("echo generated", nil), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "generated", result.Text)
+}
+
+func TestRunCommandExecutor_ConfirmUnknownAnswer(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "ran")
+	command := "touch " + marker
+
+	for _, answer := range []string{"cancel\n", "nah\n", "edit:\n"} {
+		handler, _ := newConsoleHandler(answer)
+		executor := &RunCommandExecutor{Silent: true, Confirm: true, ConfirmHandlerImpl: handler}
+
+		_, err := executor.Run(*flow.NewFlowContext(command, nil), nil)
+
+		assert.ErrorIs(t, err, ErrRejected, answer)
+	}
+
+	// Strings passed when resuming are interpreted the same way
+	executor := &RunCommandExecutor{Silent: true, Confirm: true}
+	flowContext := flow.NewFlowContext(command, nil)
+	flowContext.ResumeInput = "stop"
+	_, err := executor.Run(*flowContext, nil)
+	assert.ErrorIs(t, err, ErrRejected)
+
+	assert.NoFileExists(t, marker)
+}
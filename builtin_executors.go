@@ -1,17 +1,22 @@
 package anyi
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"os/exec"
 	"regexp"
+	"runtime"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/jieliu2000/anyi/flow"
+	"github.com/jieliu2000/anyi/internal/expr"
 	"github.com/jieliu2000/anyi/llm"
 	"github.com/jieliu2000/anyi/llm/chat"
-	"github.com/jieliu2000/shello"
+	"github.com/jieliu2000/anyi/llm/tokenizer"
 )
 
 // SetContextExecutor is an executor that sets values in the flow context.
@@ -103,71 +108,87 @@ func (executor *DecoratedExecutor) Init() error {
 //   - Updated flow context after execution
 //   - Any error encountered during execution
 func (executor *DecoratedExecutor) Run(flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
-	context := &flowContext
+	return executor.RunContext(context.Background(), flowContext, step)
+}
+
+// RunContext works like Run but passes the context to the wrapped executor.
+func (executor *DecoratedExecutor) RunContext(ctx context.Context, flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
+	result := &flowContext
 	if executor.ExecutorImpl == nil {
-		return context, errors.New("no executor provided")
+		return result, errors.New("no executor provided")
 	}
 	if executor.PreRun != nil {
 		var err error
-		context, err := executor.PreRun(*context, step)
+		result, err := executor.PreRun(*result, step)
 		if err != nil {
-			return context, err
+			return result, err
 		}
 	}
-	context, err := executor.ExecutorImpl.Run(*context, step)
+	result, err := flow.NewContextStepExecutor(executor.ExecutorImpl).RunContext(ctx, *result, step)
 	if executor.PostRun != nil {
 
-		context, err = executor.PostRun(*context, step)
+		result, err = executor.PostRun(*result, step)
 	}
-	return context, err
+	return result, err
 }
 
 // ConditionalFlowExecutor is an executor that routes flow execution based on conditions.
-// It uses the text in the flow context to determine which flow to execute next.
-// If no condition matches and a Default flow is specified, it will execute the default flow.
+// The Conditions are expressions evaluated in order on the flow context, and the flow of the first one which is true runs. See NewExpressionEnv for the names the expressions can use.
+// If no condition is true, the text in the flow context is looked up in Switch. If this doesn't match either and a Default flow is specified, it will execute the default flow.
+//
+// Example usage in configuration:
+//
+//	{
+//	  "type": "condition",
+//	  "withconfig": {
+//	    "conditions": [
+//	      {"when": "matches(lower(Text), 'route:\\s*billing')", "flow": "billing"},
+//	      {"when": "number(json(Text).priority) > 3", "flow": "escalate"}
+//	    ],
+//	    "default": "general"
+//	  }
+//	}
 type ConditionalFlowExecutor struct {
-	Switch  map[string]string `json:"switch" yaml:"switch" mapstructure:"switch"`
-	Default string            `json:"default" yaml:"default" mapstructure:"default"`
-	Trim    string            `json:"trim" yaml:"trim" mapstructure:"trim"`
+	Conditions []FlowCondition   `json:"conditions" yaml:"conditions" mapstructure:"conditions"`
+	Switch     map[string]string `json:"switch" yaml:"switch" mapstructure:"switch"`
+	Default    string            `json:"default" yaml:"default" mapstructure:"default"`
+	Trim       string            `json:"trim" yaml:"trim" mapstructure:"trim"`
+}
+
+// FlowCondition routes to a flow if an expression is true.
+type FlowCondition struct {
+	// The expression, for example "Variables.score >= 8 && contains(Text, 'approved')"
+	When string `json:"when" yaml:"when" mapstructure:"when"`
+	// The name of the flow to run if the expression is true
+	Flow string `json:"flow" yaml:"flow" mapstructure:"flow"`
+
+	expression *expr.Expression
 }
 
-// Init initializes the ConditionalFlowExecutor.
-// It checks the provided switches and default flow, and retrieves the corresponding flows.
+// Init initializes the ConditionalFlowExecutor by compiling the conditions.
+// The flows are looked up when the step runs, so a configuration can reference flows which are defined after the flow of the step.
 //
 // Returns:
-//   - An error if no switches are provided or if any referenced flow cannot be found
+//   - An error if neither conditions nor switches are provided or if a condition is not a valid expression
 func (executor *ConditionalFlowExecutor) Init() error {
-	if executor.Switch == nil || len(executor.Switch) == 0 {
+	if len(executor.Conditions) == 0 && len(executor.Switch) == 0 {
 		return errors.New("no switch provided")
 	}
 
-	// Validate switch flows
-	for _, value := range executor.Switch {
-		flow, err := GetFlow(value)
-		if err != nil {
-			return errors.Join(err, errors.New("failed to get flow "+value))
-		}
-		if flow == nil {
-			return errors.New("flow " + value + " not found")
-		}
-	}
-
-	// Validate default flow if provided
-	if executor.Default != "" {
-		flow, err := GetFlow(executor.Default)
+	for i := range executor.Conditions {
+		condition := &executor.Conditions[i]
+		expression, err := expr.Compile(condition.When)
 		if err != nil {
-			return errors.Join(err, errors.New("failed to get default flow "+executor.Default))
-		}
-		if flow == nil {
-			return errors.New("default flow " + executor.Default + " not found")
+			return fmt.Errorf("invalid condition %q: %w", condition.When, err)
 		}
+		condition.expression = expression
 	}
 
 	return nil
 }
 
 // Run executes the flow based on the condition in the flow context.
-// The text in the flow context is used as a key to find the next flow to execute.
+// The conditions are evaluated in order and the first one which is true selects the flow. Otherwise the text in the flow context is used as a key to find the next flow to execute.
 // If no matching condition is found, it will execute the default flow if specified.
 //
 // Parameters:
@@ -176,18 +197,27 @@ func (executor *ConditionalFlowExecutor) Init() error {
 //
 // Returns:
 //   - Updated flow context after the selected flow executes
-//   - An error if no matching flow is found and no default flow is specified, or if the flow execution fails
+//   - An error if Init wasn't called for the conditions, if a condition cannot be evaluated, if no matching flow is found and no default flow is specified, or if the flow execution fails
 func (executor *ConditionalFlowExecutor) Run(flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
+	return executor.RunContext(context.Background(), flowContext, step)
+}
+
+// RunContext works like Run but runs the selected flow with the given context.
+func (executor *ConditionalFlowExecutor) RunContext(ctx context.Context, flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
 	condition := flowContext.Text
 	if executor.Trim != "" {
 		condition = strings.Trim(condition, executor.Trim)
 	}
 
-	var flowName string
-	var found bool
+	flowName, found, err := executor.matchCondition(flowContext)
+	if err != nil {
+		return &flowContext, err
+	}
 
 	// Try to find a matching condition in the switch
-	flowName, found = executor.Switch[condition]
+	if !found {
+		flowName, found = executor.Switch[condition]
+	}
 
 	// If no match found, use default flow if available
 	if !found || flowName == "" {
@@ -207,15 +237,52 @@ func (executor *ConditionalFlowExecutor) Run(flowContext flow.FlowContext, step
 		return &flowContext, fmt.Errorf("flow %s not found", flowName)
 	}
 
-	return flow.Run(flowContext)
+	// The run of the flow gets its own RunID, so it doesn't overwrite the checkpoint of this run
+	runID := flowContext.RunID
+	flowContext.RunID = ""
+	result, err := flow.RunContext(ctx, flowContext)
+	if result != nil {
+		result.RunID = runID
+	}
+	return result, err
+}
+
+// matchCondition returns the flow of the first condition which is true.
+// The conditions are compiled by Init and only read here, so an executor can be shared by flows running concurrently.
+func (executor *ConditionalFlowExecutor) matchCondition(flowContext flow.FlowContext) (string, bool, error) {
+	if len(executor.Conditions) == 0 {
+		return "", false, nil
+	}
+	env := NewExpressionEnv(flowContext)
+	for i := range executor.Conditions {
+		condition := &executor.Conditions[i]
+		if condition.expression == nil {
+			return "", false, fmt.Errorf("condition %q is not compiled, call Init before running the executor", condition.When)
+		}
+		matched, err := condition.expression.EvalBool(env)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to evaluate condition %q: %w", condition.When, err)
+		}
+		if matched {
+			return condition.Flow, true, nil
+		}
+	}
+	return "", false, nil
 }
 
 // RunCommandExecutor is an executor that runs system commands.
 // It executes the command specified in the flow context's Text field.
+// If Confirm is set, a human has to approve the command before it runs, which is recommended for commands generated by a model. See [ApprovalExecutor] for how the handlers ask.
 type RunCommandExecutor struct {
 	Silent          bool   `json:"silent" yaml:"silent" mapstructure:"silent"`
 	OutputToContext bool   `json:"outputToContext" yaml:"outputToContext" mapstructure:"outputToContext"`
 	Path            string `json:"path" yaml:"path" mapstructure:"path"`
+	// If true, the command is only run after a human approved it. The human can also edit the command.
+	Confirm bool `json:"confirm" yaml:"confirm" mapstructure:"confirm"`
+	// The name of the approval handler asking for the confirmation. Defaults to the console.
+	ConfirmHandler string `json:"confirmHandler" yaml:"confirmHandler" mapstructure:"confirmHandler"`
+
+	ConfirmHandlerImpl ApprovalHandler `json:"-" yaml:"-" mapstructure:"-"`
 }
 
 // Init initializes the RunCommandExecutor.
@@ -234,15 +301,27 @@ func (executor *RunCommandExecutor) Init() error {
 //   - Updated flow context (with command output in Text field if OutputToContext is true)
 //   - Any error encountered during command execution
 func (executor *RunCommandExecutor) Run(flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
+	return executor.RunContext(context.Background(), flowContext, step)
+}
+
+// RunContext works like Run but kills the command process when the context is cancelled or its deadline expires.
+func (executor *RunCommandExecutor) RunContext(ctx context.Context, flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
 	commandText := flowContext.Text
 	if commandText == "" {
 		return &flowContext, errors.New("no command provided")
 	}
+	if executor.Confirm {
+		confirmed, err := executor.confirm(ctx, flowContext, step)
+		if err != nil {
+			return &flowContext, err
+		}
+		commandText = confirmed
+	}
 	if !executor.Silent {
 		log.Infof("Running command: %s", commandText)
 	}
 
-	outputString, _, err := shello.RunOutputWithDir(commandText, executor.Path)
+	outputString, _, err := runCommand(ctx, commandText, executor.Path)
 
 	if err != nil {
 		return &flowContext, err
@@ -256,6 +335,71 @@ func (executor *RunCommandExecutor) Run(flowContext flow.FlowContext, step *flow
 	return &flowContext, nil
 }
 
+// confirm asks a human to approve the command in the Text of the flow context. It returns the command to run, which the human may have edited, or ErrRejected.
+func (executor *RunCommandExecutor) confirm(ctx context.Context, flowContext flow.FlowContext, step *flow.Step) (string, error) {
+	var decision *ApprovalDecision
+	var err error
+	if flowContext.ResumeInput != nil {
+		decision, err = decisionFromInput(flowContext.ResumeInput, false)
+	} else {
+		if executor.ConfirmHandlerImpl == nil {
+			executor.ConfirmHandlerImpl, err = newApprovalHandler(executor.ConfirmHandler, "")
+			if err != nil {
+				return "", err
+			}
+		}
+		request := ApprovalRequest{
+			RunID:   flowContext.RunID,
+			Prompt:  "Run this command?",
+			Text:    flowContext.Text,
+			Context: flowContext,
+		}
+		if step != nil {
+			request.Step = step.Name
+		}
+		decision, err = executor.ConfirmHandlerImpl.RequestApproval(ctx, request)
+		if err == nil && decision == nil {
+			err = errors.New("approval handler returned no decision")
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if !decision.Approved {
+		return "", rejectedError(decision.Comment)
+	}
+	if decision.Text != "" {
+		return decision.Text, nil
+	}
+	return flowContext.Text, nil
+}
+
+// runCommand runs the command with bash (or powershell on Windows) in the given directory and returns the trimmed standard output and standard error.
+// The process is killed when the context is done.
+func runCommand(ctx context.Context, command string, dir string) (string, string, error) {
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+
+	shell := "bash"
+	if runtime.GOOS == "windows" {
+		shell = "powershell.exe"
+	}
+
+	cmd := exec.CommandContext(ctx, shell, "-c", command)
+	if dir != "" {
+		cmd.Dir = dir
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if ctxErr := ctx.Err(); ctxErr != nil && err != nil {
+		err = errors.Join(ctxErr, err)
+	}
+
+	return strings.TrimSpace(stdout.String()), strings.TrimSpace(stderr.String()), err
+}
+
 // LLMExecutor is an executor that sends prompts to large language models.
 // It supports template-based prompts, system messages, and JSON output formatting.
 type LLMExecutor struct {
@@ -265,24 +409,63 @@ type LLMExecutor struct {
 	SystemMessage     string `json:"systemMessage" yaml:"systemMessage" mapstructure:"systemMessage"`
 	OutputJSON        bool   `json:"outputJSON" yaml:"outputJSON" mapstructure:"outputJSON"`
 	Trim              string `json:"trim" yaml:"trim" mapstructure:"trim"`
+
+	// OutputSchema is a JSON schema the reply of the model must conform to. If it's set, the reply is validated and the model is asked to correct invalid replies.
+	// The validated JSON is written to the Text field of the flow context.
+	OutputSchema map[string]any `json:"outputSchema" yaml:"outputSchema" mapstructure:"outputSchema"`
+
+	// Generation parameters which override the settings of the client for this step. Unset values keep the client defaults.
+	Temperature      *float32 `json:"temperature" yaml:"temperature" mapstructure:"temperature"`
+	TopP             *float32 `json:"topP" yaml:"topP" mapstructure:"topP"`
+	MaxTokens        *int     `json:"maxTokens" yaml:"maxTokens" mapstructure:"maxTokens"`
+	Stop             []string `json:"stop" yaml:"stop" mapstructure:"stop"`
+	Seed             *int     `json:"seed" yaml:"seed" mapstructure:"seed"`
+	PresencePenalty  *float32 `json:"presencePenalty" yaml:"presencePenalty" mapstructure:"presencePenalty"`
+	FrequencyPenalty *float32 `json:"frequencyPenalty" yaml:"frequencyPenalty" mapstructure:"frequencyPenalty"`
+
+	// Conversation makes the step take part in the multi-turn dialog of the flow. The earlier messages in FlowContext.Conversation are sent before the prompt, and the prompt and the reply are appended to the conversation.
+	Conversation *ConversationConfig `json:"conversation" yaml:"conversation" mapstructure:"conversation"`
+	// ConversationPolicy is used instead of creating a policy from Conversation. Setting it also makes the step take part in the dialog.
+	ConversationPolicy flow.ConversationPolicy `json:"-" yaml:"-" mapstructure:"-"`
+
+	// ContextOverflow checks that the prompt and MaxTokens fit into the context window of the model before the request is sent. If MaxTokens is not set, the max tokens of the client are reserved for the reply, see llm.MaxTokens. It supports these values:
+	//	* "fail" - Returns an error wrapping ErrContextWindowExceeded
+	//	* "truncate" - Drops the oldest messages of the conversation and shortens the prompt, see tokenizer.TruncateMessages
+	// The prompt is not checked if ContextOverflow is empty.
+	ContextOverflow string `json:"contextOverflow" yaml:"contextOverflow" mapstructure:"contextOverflow"`
+	// The context window of the model in tokens. Defaults to the window of the model, see tokenizer.LookupModel.
+	// Ollama uses the num_ctx option as the window, which is usually smaller than the window of the model, so set it to num_ctx for Ollama clients.
+	ContextWindow int `json:"contextWindow" yaml:"contextWindow" mapstructure:"contextWindow"`
+	// The model whose tokenizer and context window are used. Defaults to the model of the client, see llm.ModelName.
+	TokenizerModel string `json:"tokenizerModel" yaml:"tokenizerModel" mapstructure:"tokenizerModel"`
 }
 
+const (
+	// ContextOverflowFail makes LLMExecutor return an error if the prompt doesn't fit into the context window.
+	ContextOverflowFail = "fail"
+	// ContextOverflowTruncate makes LLMExecutor shorten the prompt if it doesn't fit into the context window.
+	ContextOverflowTruncate = "truncate"
+)
+
+// ErrContextWindowExceeded is returned by LLMExecutor if the prompt and MaxTokens don't fit into the context window of the model.
+var ErrContextWindowExceeded = errors.New("context window exceeded")
+
 // Init initializes the LLMExecutor by creating template formatters.
-// It creates a formatter based on either the Template string or TemplateFile.
+// It creates a formatter based on either the Template string or TemplateFile, and the conversation policy if Conversation is set.
 //
 // Returns:
-//   - An error if neither Template nor TemplateFile is provided, or if formatter creation fails
+//   - An error if neither Template nor TemplateFile is provided, if ContextOverflow is invalid, or if formatter or policy creation fails
 func (executor *LLMExecutor) Init() error {
-	if executor.TemplateFormatter == nil && executor.Template != "" {
-		formatter, err := chat.NewPromptTemplateFormatter(executor.Template)
-		if err != nil {
-			return err
-		}
-		executor.TemplateFormatter = formatter
-		return nil
+	if err := validateContextOverflow(executor.ContextOverflow); err != nil {
+		return err
 	}
-	if executor.TemplateFormatter == nil && executor.TemplateFile != "" {
-		formatter, err := chat.NewPromptTemplateFormatterFromFile(executor.TemplateFile)
+	policy, err := executor.conversationPolicy()
+	if err != nil {
+		return err
+	}
+	executor.ConversationPolicy = policy
+	if executor.TemplateFormatter == nil && (executor.Template != "" || executor.TemplateFile != "") {
+		formatter, err := executor.formatter()
 		if err != nil {
 			return err
 		}
@@ -292,6 +475,28 @@ func (executor *LLMExecutor) Init() error {
 	return errors.New("no required parameters. You need to set either template or templateFile")
 }
 
+// formatter returns the template formatter set up by Init, or parses the template if Init wasn't called.
+func (executor *LLMExecutor) formatter() (*chat.PromptyTemplateFormatter, error) {
+	if executor.TemplateFormatter != nil {
+		return executor.TemplateFormatter, nil
+	}
+	if executor.Template != "" {
+		return chat.NewPromptTemplateFormatter(executor.Template)
+	}
+	if executor.TemplateFile != "" {
+		return chat.NewPromptTemplateFormatterFromFile(executor.TemplateFile)
+	}
+	return nil, nil
+}
+
+// conversationPolicy returns the conversation policy set up by Init, or creates it from Conversation if Init wasn't called.
+func (executor *LLMExecutor) conversationPolicy() (flow.ConversationPolicy, error) {
+	if executor.ConversationPolicy != nil || executor.Conversation == nil {
+		return executor.ConversationPolicy, nil
+	}
+	return NewConversationPolicy(executor.Conversation)
+}
+
 // Run sends a prompt to a language model and processes the response.
 // It formats the prompt using the template formatter, adds system messages if provided,
 // handles image URLs if present, and sends the messages to the LLM client.
@@ -304,6 +509,11 @@ func (executor *LLMExecutor) Init() error {
 //   - Updated flow context with the model's response in the Text field
 //   - Any error encountered during execution
 func (executor *LLMExecutor) Run(flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
+	return executor.RunContext(context.Background(), flowContext, step)
+}
+
+// RunContext works like Run but sends the request to the model with the given context, so the request is aborted when the context is cancelled.
+func (executor *LLMExecutor) RunContext(ctx context.Context, flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
 	if step == nil {
 		return nil, errors.New("no step provided")
 	}
@@ -315,26 +525,19 @@ func (executor *LLMExecutor) Run(flowContext flow.FlowContext, step *flow.Step)
 		return nil, errors.New("no client set for flow step")
 	}
 
-	if executor.TemplateFormatter == nil && executor.Template != "" {
-		var err error
-		executor.TemplateFormatter, err = chat.NewPromptTemplateFormatter(executor.Template)
-		if err != nil {
-			return nil, err
-		}
+	// Runs share the executor, so what Init would set up is kept in locals
+	formatter, err := executor.formatter()
+	if err != nil {
+		return nil, err
 	}
-
-	if executor.TemplateFormatter == nil && executor.TemplateFile != "" {
-		var err error
-		executor.TemplateFormatter, err = chat.NewPromptTemplateFormatterFromFile(executor.TemplateFile)
-		if err != nil {
-			return nil, err
-		}
+	policy, err := executor.conversationPolicy()
+	if err != nil {
+		return nil, err
 	}
 
 	var input string
-	if executor.TemplateFormatter != nil {
-		var err error
-		input, err = executor.TemplateFormatter.Format(flowContext)
+	if formatter != nil {
+		input, err = formatter.Format(flowContext)
 		if err != nil {
 			return nil, err
 		}
@@ -347,47 +550,157 @@ func (executor *LLMExecutor) Run(flowContext flow.FlowContext, step *flow.Step)
 		messages = append(messages, chat.NewSystemMessage(executor.SystemMessage))
 	}
 
-	if len(flowContext.ImageURLs) > 0 {
-		msg := chat.Message{
-			Role: "user",
-		}
-
-		if input != "" {
-			msg.ContentParts = append(msg.ContentParts, chat.ContentPart{
-				Text: input,
-			})
-		}
-
-		for _, imgURL := range flowContext.ImageURLs {
-			msg.ContentParts = append(msg.ContentParts, chat.ContentPart{
-				ImageUrl: imgURL,
-			})
+	userMessage := newUserMessage(input, flowContext.ImageURLs)
+	var conversation *flow.Conversation
+	if policy != nil {
+		conversation = flowContext.Conversation.Clone()
+		conversation.Append(userMessage)
+		if err := policy.Apply(ctx, conversation, step.ClientImpl); err != nil {
+			return nil, err
 		}
-
-		messages = append(messages, msg)
+		messages = append(messages, conversation.ModelMessages()...)
 	} else {
-		messages = append(messages, chat.NewUserMessage(input))
+		messages = append(messages, userMessage)
 	}
 
-	var options *chat.ChatOptions
-	if executor.OutputJSON {
-		options = &chat.ChatOptions{
-			Format: "json",
-		}
+	options := executor.chatOptions()
+	messages, err = executor.fitContextWindow(messages, step.ClientImpl)
+	if err != nil {
+		return nil, err
 	}
 
-	output, _, err := step.ClientImpl.Chat(messages, options)
+	var output *chat.Message
+	if executor.OutputSchema != nil {
+		output, _, err = llm.ChatWithSchema(ctx, step.ClientImpl, messages, executor.OutputSchema, options, llm.DefaultStructuredOutputRetries)
+	} else {
+		output, _, err = llm.ChatContext(ctx, step.ClientImpl, messages, options)
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	if conversation != nil {
+		conversation.Append(chat.NewAssistantMessage(output.Content))
+		flowContext.Conversation = conversation
+	}
+
 	flowContext.Text = output.Content
+	if output.Thinking != "" {
+		// Providers like Anthropic return the thinking separately instead of <think> tags in the content
+		flowContext.Think = output.Thinking
+	}
 	if executor.Trim != "" {
 		flowContext.Text = strings.Trim(flowContext.Text, executor.Trim)
 	}
 	return &flowContext, nil
 }
 
+// chatOptions returns the chat options of the step, or nil if the step doesn't set any.
+func (executor *LLMExecutor) chatOptions() *chat.ChatOptions {
+	options := &chat.ChatOptions{
+		Temperature:      executor.Temperature,
+		TopP:             executor.TopP,
+		MaxTokens:        executor.MaxTokens,
+		Stop:             executor.Stop,
+		Seed:             executor.Seed,
+		PresencePenalty:  executor.PresencePenalty,
+		FrequencyPenalty: executor.FrequencyPenalty,
+	}
+	if executor.OutputJSON {
+		options.Format = "json"
+	}
+	if options.Format == "" && options.Temperature == nil && options.TopP == nil && options.MaxTokens == nil && len(options.Stop) == 0 &&
+		options.Seed == nil && options.PresencePenalty == nil && options.FrequencyPenalty == nil {
+		return nil
+	}
+	return options
+}
+
+// validateContextOverflow returns an error if the mode is not empty, ContextOverflowFail or ContextOverflowTruncate.
+func validateContextOverflow(mode string) error {
+	switch mode {
+	case "", ContextOverflowFail, ContextOverflowTruncate:
+		return nil
+	}
+	return fmt.Errorf("invalid contextOverflow %q, it must be %q or %q", mode, ContextOverflowFail, ContextOverflowTruncate)
+}
+
+// fitContextWindow checks the messages against the context window of the model according to ContextOverflow.
+//
+// Parameters:
+//   - messages: The messages to send
+//   - client: The client of the step, used to find the model if TokenizerModel is not set
+//
+// Returns:
+//   - The messages, shortened if ContextOverflow is "truncate"
+//   - An error wrapping ErrContextWindowExceeded if the messages don't fit, or an error if the context window of the model is unknown
+func (executor *LLMExecutor) fitContextWindow(messages []chat.Message, client llm.Client) ([]chat.Message, error) {
+	if executor.ContextOverflow == "" {
+		return messages, nil
+	}
+	if err := validateContextOverflow(executor.ContextOverflow); err != nil {
+		return nil, err
+	}
+
+	model := executor.TokenizerModel
+	if model == "" {
+		model = llm.ModelName(client)
+	}
+	window := executor.ContextWindow
+	if window <= 0 {
+		info, _ := tokenizer.LookupModel(model)
+		window = info.ContextWindow
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("the context window of model %q is unknown, set contextWindow of the step", model)
+	}
+	reserved := llm.MaxTokens(client)
+	if executor.MaxTokens != nil {
+		reserved = *executor.MaxTokens
+	}
+	limit := window - reserved
+	if limit <= 0 {
+		return nil, fmt.Errorf("%w: maxTokens %d doesn't leave room for the prompt in the context window of %d tokens", ErrContextWindowExceeded, reserved, window)
+	}
+
+	counter := tokenizer.ForModel(model)
+	if executor.ContextOverflow == ContextOverflowTruncate {
+		truncated, err := tokenizer.TruncateMessages(counter, messages, limit)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrContextWindowExceeded, err)
+		}
+		return truncated, nil
+	}
+	if tokens := tokenizer.CountMessages(counter, messages); tokens > limit {
+		return nil, fmt.Errorf("%w: the prompt has %d tokens and %d tokens are reserved for the reply, the context window has %d tokens", ErrContextWindowExceeded, tokens, reserved, window)
+	}
+	return messages, nil
+}
+
+// newUserMessage creates the user message sent to the model. If there are image URLs, the input and the images are sent as content parts.
+func newUserMessage(input string, imageURLs []string) chat.Message {
+	if len(imageURLs) == 0 {
+		return chat.NewUserMessage(input)
+	}
+
+	msg := chat.Message{
+		Role: "user",
+	}
+
+	if input != "" {
+		msg.ContentParts = append(msg.ContentParts, chat.ContentPart{
+			Text: input,
+		})
+	}
+
+	for _, imgURL := range imageURLs {
+		msg.ContentParts = append(msg.ContentParts, chat.ContentPart{
+			ImageUrl: imgURL,
+		})
+	}
+	return msg
+}
+
 // NewLLMStepWithTemplateFile creates a new workflow step with an LLM executor
 // that uses a template from a file.
 //
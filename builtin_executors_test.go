@@ -1,9 +1,17 @@
 package anyi
 
 import (
+	"context"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jieliu2000/anyi/flow"
+	"github.com/jieliu2000/anyi/internal/test"
+	"github.com/jieliu2000/anyi/llm/chat"
+	"github.com/jieliu2000/anyi/llm/openai"
+	"github.com/mitchellh/mapstructure"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -227,3 +235,279 @@ func TestDeepSeekStyleResponseFilter_Init(t *testing.T) {
 }
 
 // MCP Executor tests have been moved to mcp_executor_test.go
+
+func TestRunCommandExecutor_RunContext(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test commands require bash")
+	}
+
+	t.Run("Outputs command result to context", func(t *testing.T) {
+		executor := &RunCommandExecutor{Silent: true, OutputToContext: true}
+		result, err := executor.RunContext(context.Background(), flow.FlowContext{Text: "echo hello"}, nil)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", result.Text)
+	})
+
+	t.Run("Kills the command when the deadline expires", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		executor := &RunCommandExecutor{Silent: true}
+		start := time.Now()
+		_, err := executor.RunContext(ctx, flow.FlowContext{Text: "sleep 5"}, nil)
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), 4*time.Second)
+	})
+}
+
+func TestLLMExecutor_RunContext(t *testing.T) {
+	client := &test.MockClient{ChatOutput: "response"}
+	executor := &LLMExecutor{Template: "{{.Text}}"}
+	assert.NoError(t, executor.Init())
+	step := flow.NewStep(executor, nil, client)
+
+	t.Run("Returns the model response", func(t *testing.T) {
+		result, err := executor.RunContext(context.Background(), flow.FlowContext{Text: "hello"}, step)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "response", result.Text)
+	})
+
+	t.Run("Doesn't call the model when the context is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := executor.RunContext(ctx, flow.FlowContext{Text: "hello"}, step)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+type thinkingClient struct {
+	test.MockClient
+}
+
+func (c *thinkingClient) Chat(messages []chat.Message, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
+	return &chat.Message{Role: "assistant", Content: "answer", Thinking: "reasoning"}, chat.ResponseInfo{}, nil
+}
+
+func TestLLMExecutor_RunSetsThinkFromMessage(t *testing.T) {
+	executor := &LLMExecutor{Template: "{{.Text}}"}
+	assert.NoError(t, executor.Init())
+	step := flow.NewStep(executor, nil, &thinkingClient{})
+
+	result, err := executor.Run(flow.FlowContext{Text: "question"}, step)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "answer", result.Text)
+	assert.Equal(t, "reasoning", result.Think)
+}
+
+func TestLLMExecutor_RunWithOutputSchema(t *testing.T) {
+	client := &test.SequenceClient{Outputs: []string{`{"answer": 42}`, "```json\n{\"answer\": \"42\"}\n```"}}
+	executor := &LLMExecutor{
+		Template: "{{.Text}}",
+		OutputSchema: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"answer": map[string]any{"type": "string"}},
+			"required":   []any{"answer"},
+		},
+	}
+	assert.NoError(t, executor.Init())
+	step := flow.NewStep(executor, nil, client)
+
+	result, err := executor.Run(flow.FlowContext{Text: "question"}, step)
+
+	assert.NoError(t, err)
+	assert.Equal(t, `{"answer": "42"}`, result.Text)
+	assert.Len(t, client.Messages, 2)
+	assert.Equal(t, executor.OutputSchema, client.Options[0].Schema)
+}
+
+func TestLLMExecutor_GenerationOverrides(t *testing.T) {
+	executor := &LLMExecutor{}
+	err := mapstructure.Decode(map[string]any{
+		"template":    "{{.Text}}",
+		"temperature": 0,
+		"maxTokens":   256,
+		"stop":        []string{"END"},
+		"seed":        7,
+	}, executor)
+	assert.NoError(t, err)
+	assert.NoError(t, executor.Init())
+
+	client := &test.SequenceClient{Outputs: []string{"response"}}
+	step := flow.NewStep(executor, nil, client)
+
+	_, err = executor.Run(flow.FlowContext{Text: "question"}, step)
+
+	assert.NoError(t, err)
+	options := client.Options[0]
+	assert.Equal(t, float32(0), *options.Temperature)
+	assert.Equal(t, 256, *options.MaxTokens)
+	assert.Equal(t, []string{"END"}, options.Stop)
+	assert.Equal(t, 7, *options.Seed)
+	assert.Nil(t, options.TopP)
+	assert.Equal(t, "", options.Format)
+
+	assert.Nil(t, (&LLMExecutor{}).chatOptions())
+}
+
+func TestLLMExecutor_ContextOverflow(t *testing.T) {
+	maxTokens := 20
+	newExecutor := func(overflow string) *LLMExecutor {
+		executor := &LLMExecutor{
+			Template:        "{{.Text}}",
+			SystemMessage:   "Be brief.",
+			ContextOverflow: overflow,
+			ContextWindow:   40,
+			TokenizerModel:  "my-model",
+			MaxTokens:       &maxTokens,
+		}
+		assert.NoError(t, executor.Init())
+		return executor
+	}
+	// 20 tokens are left for the prompt: 3 for the reply, 3 + 3 for the system message and 3 for the user message, so 8 tokens of text fit with the approximation of 4 characters per token
+	longText := strings.Repeat("word ", 20)
+
+	t.Run("Sends prompts which fit", func(t *testing.T) {
+		client := &test.SequenceClient{Outputs: []string{"response"}}
+		executor := newExecutor(ContextOverflowFail)
+
+		result, err := executor.Run(flow.FlowContext{Text: "short question"}, flow.NewStep(executor, nil, client))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "response", result.Text)
+	})
+
+	t.Run("Fails without calling the model", func(t *testing.T) {
+		client := &test.SequenceClient{Outputs: []string{"response"}}
+		executor := newExecutor(ContextOverflowFail)
+
+		_, err := executor.Run(flow.FlowContext{Text: longText}, flow.NewStep(executor, nil, client))
+
+		assert.ErrorIs(t, err, ErrContextWindowExceeded)
+		assert.Empty(t, client.Messages)
+	})
+
+	t.Run("Truncates the prompt", func(t *testing.T) {
+		client := &test.SequenceClient{Outputs: []string{"response"}}
+		executor := newExecutor(ContextOverflowTruncate)
+
+		_, err := executor.Run(flow.FlowContext{Text: longText}, flow.NewStep(executor, nil, client))
+
+		assert.NoError(t, err)
+		sent := client.Messages[0]
+		assert.Len(t, sent, 2)
+		assert.Equal(t, longText[:32], sent[1].Content)
+	})
+
+	t.Run("Uses the model of the client", func(t *testing.T) {
+		executor := &LLMExecutor{Template: "{{.Text}}", ContextOverflow: ContextOverflowFail}
+		assert.NoError(t, executor.Init())
+
+		_, err := executor.fitContextWindow([]chat.Message{chat.NewUserMessage(longText)}, &openai.OpenAIClient{Config: &openai.OpenAIModelConfig{Model: "gpt-4o"}})
+		assert.NoError(t, err)
+
+		_, err = executor.fitContextWindow([]chat.Message{chat.NewUserMessage(longText)}, &test.SequenceClient{})
+		assert.ErrorContains(t, err, "contextWindow")
+	})
+
+	t.Run("Reserves the max tokens of the client", func(t *testing.T) {
+		executor := &LLMExecutor{Template: "{{.Text}}", ContextOverflow: ContextOverflowFail, ContextWindow: 40, TokenizerModel: "my-model"}
+		assert.NoError(t, executor.Init())
+		config := openai.DefaultConfig("key")
+		config.MaxTokens = 38
+
+		_, err := executor.fitContextWindow([]chat.Message{chat.NewUserMessage("short question")}, &openai.OpenAIClient{Config: config})
+		assert.ErrorIs(t, err, ErrContextWindowExceeded)
+
+		executor.MaxTokens = &maxTokens
+		_, err = executor.fitContextWindow([]chat.Message{chat.NewUserMessage("short question")}, &openai.OpenAIClient{Config: config})
+		assert.NoError(t, err, "the max tokens of the step replace those of the client")
+	})
+
+	t.Run("Rejects unknown modes", func(t *testing.T) {
+		executor := &LLMExecutor{Template: "{{.Text}}", ContextOverflow: "drop"}
+		assert.Error(t, executor.Init())
+	})
+}
+
+func TestConditionalFlowExecutor_Conditions(t *testing.T) {
+	GlobalRegistry = &anyiRegistry{Flows: make(map[string]*flow.Flow)}
+	for _, name := range []string{"billing", "escalate", "exact", "general"} {
+		routed := name
+		RegisterFlow(name, newFuncFlow(t, name, func(flowContext flow.FlowContext) (*flow.FlowContext, error) {
+			flowContext.Text = routed
+			return &flowContext, nil
+		}))
+	}
+
+	executor := &ConditionalFlowExecutor{
+		Conditions: []FlowCondition{
+			{When: `matches(lower(Text), "route:\s*billing")`, Flow: "billing"},
+			{When: `number(json(Text).priority) > 3 || Variables.vip == true`, Flow: "escalate"},
+			{When: `contains(Text, "billing")`, Flow: "general"},
+		},
+		Switch:  map[string]string{"exact": "exact"},
+		Default: "general",
+		Trim:    " ",
+	}
+	assert.NoError(t, executor.Init())
+
+	tests := []struct {
+		text      string
+		variables map[string]any
+		expected  string
+	}{
+		{"Route: Billing.", nil, "billing"},
+		{"```json\n{\"priority\": 5}\n```", nil, "escalate"},
+		{`{"priority": "2"}`, map[string]any{"vip": true}, "escalate"},
+		{"Something about billing", nil, "general"},
+		{" exact ", nil, "exact"},
+		{"unknown", nil, "general"},
+	}
+	for _, test := range tests {
+		result, err := executor.Run(flow.FlowContext{Text: test.text, Variables: test.variables}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, result.Text, test.text)
+	}
+}
+
+func TestConditionalFlowExecutor_InvalidConditions(t *testing.T) {
+	GlobalRegistry = &anyiRegistry{Flows: make(map[string]*flow.Flow)}
+	RegisterFlow("target", newFuncFlow(t, "target", func(flowContext flow.FlowContext) (*flow.FlowContext, error) {
+		return &flowContext, nil
+	}))
+
+	executor := &ConditionalFlowExecutor{Conditions: []FlowCondition{{When: "Text ==", Flow: "target"}}}
+	assert.ErrorContains(t, executor.Init(), `invalid condition "Text =="`)
+
+	executor = &ConditionalFlowExecutor{Conditions: []FlowCondition{{When: "true", Flow: "missing"}}}
+	assert.NoError(t, executor.Init())
+	_, err := executor.Run(flow.FlowContext{}, nil)
+	assert.Error(t, err)
+
+	executor = &ConditionalFlowExecutor{Conditions: []FlowCondition{{When: "number(Text) > 1", Flow: "target"}}}
+	assert.NoError(t, executor.Init())
+	_, err = executor.Run(flow.FlowContext{Text: "many"}, nil)
+	assert.EqualError(t, err, `failed to evaluate condition "number(Text) > 1": number: "many" is not a number`)
+
+	assert.EqualError(t, (&ConditionalFlowExecutor{}).Init(), "no switch provided")
+
+	executor = &ConditionalFlowExecutor{Conditions: []FlowCondition{{When: "true", Flow: "target"}}}
+	_, err = executor.Run(flow.FlowContext{Text: "many"}, nil)
+	assert.EqualError(t, err, `condition "true" is not compiled, call Init before running the executor`)
+
+	// The flows can be registered after Init
+	executor = &ConditionalFlowExecutor{Conditions: []FlowCondition{{When: "true", Flow: "later"}}}
+	assert.NoError(t, executor.Init())
+	RegisterFlow("later", newFuncFlow(t, "later", func(flowContext flow.FlowContext) (*flow.FlowContext, error) {
+		flowContext.Text = "later"
+		return &flowContext, nil
+	}))
+	result, err := executor.Run(flow.FlowContext{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "later", result.Text)
+}
@@ -1,11 +1,20 @@
 package anyi
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"os"
 	"regexp"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/jieliu2000/anyi/flow"
+	"github.com/jieliu2000/anyi/internal/jsonschema"
+	"github.com/jieliu2000/anyi/llm"
+	"github.com/jieliu2000/anyi/llm/chat"
+	"github.com/mitchellh/mapstructure"
 )
 
 type JsonValidator struct {
@@ -16,13 +25,21 @@ func (validator *JsonValidator) Init() error {
 }
 
 func (validator *JsonValidator) Validate(stepOutput string, Step *flow.Step) bool {
+	return validator.ValidateResult(context.Background(), stepOutput, Step).Passed
+}
+
+// ValidateResult checks if the output is valid JSON and explains why it isn't.
+func (validator *JsonValidator) ValidateResult(ctx context.Context, stepOutput string, Step *flow.Step) flow.ValidationResult {
 	if stepOutput == "" {
-		return false
+		return flow.ValidationResult{Reason: "the output is empty, expected JSON"}
 	}
 	//check if the output is valid json
 	var js json.RawMessage
 	err := json.Unmarshal([]byte(stepOutput), &js)
-	return err == nil
+	if err != nil {
+		return flow.ValidationResult{Reason: fmt.Sprintf("the output is not valid JSON: %v", err)}
+	}
+	return flow.ValidationResult{Passed: true}
 }
 
 // JsonValidator is a validator for string output. It can be used to check if the step's output matches a given regular expression or equals a specific string.
@@ -64,18 +81,477 @@ func (validator *StringValidator) Init() error {
 //
 // [Golang regexp documentation]: https://pkg.go.dev/regexp
 func (validator *StringValidator) Validate(stepOutput string, Step *flow.Step) bool {
+	return validator.ValidateResult(context.Background(), stepOutput, Step).Passed
+}
+
+// ValidateResult works like Validate but also returns the reason why the output was rejected.
+func (validator *StringValidator) ValidateResult(ctx context.Context, stepOutput string, Step *flow.Step) flow.ValidationResult {
 
 	if validator.EqualTo != "" && stepOutput == validator.EqualTo {
-		return true
+		return flow.ValidationResult{Passed: true}
 	}
 
 	if validator.MatchRegex != "" {
 		matched, err := regexp.MatchString(validator.MatchRegex, stepOutput)
 		if err != nil {
-			return false
+			return flow.ValidationResult{Reason: err.Error()}
+		}
+		if !matched {
+			return flow.ValidationResult{Reason: fmt.Sprintf("the output should match the regular expression %s", validator.MatchRegex)}
+		}
+		return flow.ValidationResult{Passed: true}
+	}
+
+	if validator.EqualTo != "" {
+		return flow.ValidationResult{Reason: fmt.Sprintf("the output should be %q", validator.EqualTo)}
+	}
+	return flow.ValidationResult{}
+}
+
+// DefaultLLMValidatorTemplate is the template used by LLMValidator if neither Template nor TemplateFile is set.
+const DefaultLLMValidatorTemplate = `Evaluate the following output against the criteria.
+
+Criteria:
+{{.Criteria}}
+
+Output:
+{{.Output}}
+
+Reply with JSON. "pass" tells whether the output meets the criteria, "score" rates how well it meets them from 0 to 10, and "reason" explains the verdict in one or two sentences.`
+
+// LLMValidator asks a model to judge the step output against a rubric ("LLM as judge").
+// The model replies with a [LLMVerdict]. If Threshold is set, the output passes when the score of the verdict reaches the threshold, otherwise when the verdict passes. The reason of the verdict is passed to the retry of the step.
+// The validator uses the validator client of the step, see [flow.Step.GetValidatorClient] and the ValidatorClientName field of StepConfig.
+//
+// Example configuration:
+//
+//	validator:
+//	  type: "llm"
+//	  withconfig:
+//	    criteria: "The summary mentions every person named in the text and is at most three sentences long."
+//	    threshold: 7
+type LLMValidator struct {
+	// The rubric the output is judged against. It's available as .Criteria in the template.
+	Criteria string `json:"criteria" yaml:"criteria" mapstructure:"criteria"`
+	// The template of the prompt sent to the model. The data of the template is a [LLMValidatorInput]. Defaults to DefaultLLMValidatorTemplate.
+	Template     string `json:"template" yaml:"template" mapstructure:"template"`
+	TemplateFile string `json:"templateFile" yaml:"templateFile" mapstructure:"templateFile"`
+	// An optional system message sent before the prompt.
+	SystemMessage string `json:"systemMessage" yaml:"systemMessage" mapstructure:"systemMessage"`
+	// The minimum score an output needs to pass. If not set, the pass field of the verdict decides.
+	Threshold float64 `json:"threshold" yaml:"threshold" mapstructure:"threshold"`
+
+	TemplateFormatter *chat.PromptyTemplateFormatter `json:"-" yaml:"-" mapstructure:"-"`
+}
+
+// LLMValidatorInput is the data of the LLMValidator template.
+type LLMValidatorInput struct {
+	Criteria string
+	Output   string
+}
+
+// LLMVerdict is the reply of the model judging an output.
+type LLMVerdict struct {
+	Pass   bool    `json:"pass" description:"Whether the output meets the criteria"`
+	Score  float64 `json:"score" description:"How well the output meets the criteria"`
+	Reason string  `json:"reason" description:"A short explanation of the verdict"`
+}
+
+// Init initializes the template formatter of the LLMValidator.
+// It returns an error if neither Criteria, Template nor TemplateFile is set, or if the template can't be parsed.
+func (validator *LLMValidator) Init() error {
+	if validator.TemplateFormatter != nil {
+		return nil
+	}
+
+	var formatter *chat.PromptyTemplateFormatter
+	var err error
+	switch {
+	case validator.Template != "":
+		formatter, err = chat.NewPromptTemplateFormatter(validator.Template)
+	case validator.TemplateFile != "":
+		formatter, err = chat.NewPromptTemplateFormatterFromFile(validator.TemplateFile)
+	case validator.Criteria != "":
+		formatter, err = chat.NewPromptTemplateFormatter(DefaultLLMValidatorTemplate)
+	default:
+		return errors.New("LLMValidator should have criteria, template or templateFile set")
+	}
+	if err != nil {
+		return err
+	}
+	validator.TemplateFormatter = formatter
+	return nil
+}
+
+// Validate asks the model whether the output meets the criteria. See ValidateResult.
+func (validator *LLMValidator) Validate(stepOutput string, Step *flow.Step) bool {
+	return validator.ValidateResult(context.Background(), stepOutput, Step).Passed
+}
+
+// ValidateResult asks the model to judge the output and returns its verdict.
+// Outputs are rejected if the model can't be asked, for example because the step has no client, and the reason contains the error.
+func (validator *LLMValidator) ValidateResult(ctx context.Context, stepOutput string, Step *flow.Step) flow.ValidationResult {
+	verdict, err := validator.Judge(ctx, stepOutput, Step)
+	if err != nil {
+		return flow.ValidationResult{Reason: fmt.Sprintf("failed to validate the output: %v", err)}
+	}
+
+	if validator.Threshold > 0 {
+		if verdict.Score >= validator.Threshold {
+			return flow.ValidationResult{Passed: true, Reason: verdict.Reason}
+		}
+		return flow.ValidationResult{Reason: fmt.Sprintf("score %g is below %g: %s", verdict.Score, validator.Threshold, verdict.Reason)}
+	}
+	return flow.ValidationResult{Passed: verdict.Pass, Reason: verdict.Reason}
+}
+
+// Judge sends the output and the criteria to the validator client of the step and returns the verdict of the model.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - stepOutput: The output to judge
+//   - step: The step which produced the output
+//
+// Returns:
+//   - The verdict of the model
+//   - An error if the step has no client, the template can't be formatted or the model doesn't reply with a verdict
+func (validator *LLMValidator) Judge(ctx context.Context, stepOutput string, step *flow.Step) (*LLMVerdict, error) {
+	if step == nil {
+		return nil, errors.New("no step provided")
+	}
+	client := step.GetValidatorClient()
+	if client == nil {
+		return nil, errors.New("no client set to validate the step output")
+	}
+	if err := validator.Init(); err != nil {
+		return nil, err
+	}
+
+	prompt, err := validator.TemplateFormatter.Format(LLMValidatorInput{Criteria: validator.Criteria, Output: stepOutput})
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]chat.Message, 0, 2)
+	if validator.SystemMessage != "" {
+		messages = append(messages, chat.NewSystemMessage(validator.SystemMessage))
+	}
+	messages = append(messages, chat.NewUserMessage(prompt))
+
+	verdict, _, err := llm.ChatInto[LLMVerdict](ctx, client, messages, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &verdict, nil
+}
+
+// JsonSchemaValidator checks that the step output is JSON conforming to a JSON schema.
+// The schema is set either inline with Schema or as a path to a JSON file with SchemaFile.
+// The keywords type, enum, const, properties, required, additionalProperties, minProperties, maxProperties, items, minItems, maxItems, uniqueItems, minimum, maximum, exclusiveMinimum, exclusiveMaximum, multipleOf, minLength, maxLength, pattern, allOf, anyOf, oneOf, not and $ref within the schema are supported.
+// Schemas using other keywords, like format or if, are rejected by Init because the output could pass without conforming to them. Annotations like title and description are allowed.
+//
+// In YAML configuration files it's best to write the schema as a JSON string, because the config loader lowercases the keys of nested maps:
+//
+//	validator:
+//	  type: "jsonschema"
+//	  withconfig:
+//	    schema: |
+//	      {"type": "object", "required": ["name"], "properties": {"name": {"type": "string", "minLength": 1}}}
+type JsonSchemaValidator struct {
+	// The JSON schema, either as a map or as a JSON string.
+	Schema any `json:"schema" yaml:"schema" mapstructure:"schema"`
+	// The path of a JSON file containing the schema. Used if Schema is not set.
+	SchemaFile string `json:"schemaFile" yaml:"schemaFile" mapstructure:"schemaFile"`
+
+	schema map[string]any
+}
+
+// Init parses the schema. It returns an error if neither Schema nor SchemaFile is set, if the schema isn't a JSON object, or if it uses unsupported keywords.
+func (validator *JsonSchemaValidator) Init() error {
+	schema, err := validator.parseSchema()
+	if err != nil {
+		return err
+	}
+	if err := jsonschema.Check(schema); err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+	validator.schema = schema
+	return nil
+}
+
+// parseSchema returns the schema of Schema or SchemaFile as a map.
+func (validator *JsonSchemaValidator) parseSchema() (map[string]any, error) {
+	var data []byte
+	switch schema := validator.Schema.(type) {
+	case nil:
+		if validator.SchemaFile == "" {
+			return nil, errors.New("JsonSchemaValidator should have either schema or schemaFile set")
+		}
+		var err error
+		data, err = os.ReadFile(validator.SchemaFile)
+		if err != nil {
+			return nil, err
+		}
+	case string:
+		data = []byte(schema)
+	case []byte:
+		data = schema
+	case map[string]any:
+		return schema, nil
+	default:
+		var err error
+		data, err = json.Marshal(schema)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema: %w", err)
 		}
-		return matched
 	}
 
-	return false
+	var parsed map[string]any
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return parsed, nil
+}
+
+// Validate checks the output against the schema. See ValidateResult.
+func (validator *JsonSchemaValidator) Validate(stepOutput string, Step *flow.Step) bool {
+	return validator.ValidateResult(context.Background(), stepOutput, Step).Passed
+}
+
+// ValidateResult checks the output against the schema. The reason names the path of the first invalid value.
+func (validator *JsonSchemaValidator) ValidateResult(ctx context.Context, stepOutput string, Step *flow.Step) flow.ValidationResult {
+	if validator.schema == nil {
+		if err := validator.Init(); err != nil {
+			return flow.ValidationResult{Reason: err.Error()}
+		}
+	}
+	if err := jsonschema.ValidateJSON(validator.schema, []byte(stepOutput)); err != nil {
+		return flow.ValidationResult{Reason: fmt.Sprintf("the output doesn't match the JSON schema: %v", err)}
+	}
+	return flow.ValidationResult{Passed: true}
+}
+
+// LengthValidator checks that the number of characters of the step output is within bounds.
+type LengthValidator struct {
+	// The minimum number of characters. Zero means no minimum.
+	MinLength int `json:"minLength" yaml:"minLength" mapstructure:"minLength"`
+	// The maximum number of characters. Zero means no maximum.
+	MaxLength int `json:"maxLength" yaml:"maxLength" mapstructure:"maxLength"`
+}
+
+// Init checks that at least one bound is set and that the bounds are consistent.
+func (validator *LengthValidator) Init() error {
+	if validator.MinLength <= 0 && validator.MaxLength <= 0 {
+		return errors.New("LengthValidator should have minLength or maxLength set")
+	}
+	if validator.MaxLength > 0 && validator.MinLength > validator.MaxLength {
+		return fmt.Errorf("minLength %d is greater than maxLength %d", validator.MinLength, validator.MaxLength)
+	}
+	return nil
+}
+
+// Validate checks the length of the output. See ValidateResult.
+func (validator *LengthValidator) Validate(stepOutput string, Step *flow.Step) bool {
+	return validator.ValidateResult(context.Background(), stepOutput, Step).Passed
+}
+
+// ValidateResult checks the length of the output in characters (runes, not bytes).
+func (validator *LengthValidator) ValidateResult(ctx context.Context, stepOutput string, Step *flow.Step) flow.ValidationResult {
+	length := utf8.RuneCountInString(stepOutput)
+	if validator.MinLength > 0 && length < validator.MinLength {
+		return flow.ValidationResult{Reason: fmt.Sprintf("the output has %d characters, at least %d are required", length, validator.MinLength)}
+	}
+	if validator.MaxLength > 0 && length > validator.MaxLength {
+		return flow.ValidationResult{Reason: fmt.Sprintf("the output has %d characters, at most %d are allowed", length, validator.MaxLength)}
+	}
+	return flow.ValidationResult{Passed: true}
+}
+
+// KeywordValidator checks that the step output contains all of the required keywords and none of the forbidden ones.
+type KeywordValidator struct {
+	// Keywords which must all appear in the output.
+	Contains []string `json:"contains" yaml:"contains" mapstructure:"contains"`
+	// Keywords which must not appear in the output.
+	NotContains []string `json:"notContains" yaml:"notContains" mapstructure:"notContains"`
+	// If true, keywords are matched regardless of case.
+	IgnoreCase bool `json:"ignoreCase" yaml:"ignoreCase" mapstructure:"ignoreCase"`
+}
+
+// Init checks that at least one keyword is set.
+func (validator *KeywordValidator) Init() error {
+	if len(validator.Contains) == 0 && len(validator.NotContains) == 0 {
+		return errors.New("KeywordValidator should have contains or notContains set")
+	}
+	return nil
+}
+
+// Validate checks the keywords of the output. See ValidateResult.
+func (validator *KeywordValidator) Validate(stepOutput string, Step *flow.Step) bool {
+	return validator.ValidateResult(context.Background(), stepOutput, Step).Passed
+}
+
+// ValidateResult checks the keywords of the output. The reason lists all missing and all forbidden keywords found.
+func (validator *KeywordValidator) ValidateResult(ctx context.Context, stepOutput string, Step *flow.Step) flow.ValidationResult {
+	output := stepOutput
+	if validator.IgnoreCase {
+		output = strings.ToLower(output)
+	}
+	contains := func(keyword string) bool {
+		if validator.IgnoreCase {
+			keyword = strings.ToLower(keyword)
+		}
+		return strings.Contains(output, keyword)
+	}
+
+	var missing, forbidden []string
+	for _, keyword := range validator.Contains {
+		if !contains(keyword) {
+			missing = append(missing, fmt.Sprintf("%q", keyword))
+		}
+	}
+	for _, keyword := range validator.NotContains {
+		if contains(keyword) {
+			forbidden = append(forbidden, fmt.Sprintf("%q", keyword))
+		}
+	}
+
+	var reasons []string
+	if len(missing) > 0 {
+		reasons = append(reasons, "the output should contain "+strings.Join(missing, ", "))
+	}
+	if len(forbidden) > 0 {
+		reasons = append(reasons, "the output should not contain "+strings.Join(forbidden, ", "))
+	}
+	if len(reasons) > 0 {
+		return flow.ValidationResult{Reason: strings.Join(reasons, "; ")}
+	}
+	return flow.ValidationResult{Passed: true}
+}
+
+// AllValidator passes if all of its validators pass. The validators run in order and the first rejection is returned.
+//
+// Each element of Validators is either the name of a registered validator (see [RegisterValidator]) or a validator configuration with type and withconfig:
+//
+//	validator:
+//	  type: "all"
+//	  withconfig:
+//	    validators:
+//	      - "json"
+//	      - type: "length"
+//	        withconfig: { maxLength: 2000 }
+type AllValidator struct {
+	Validators []any `json:"validators" yaml:"validators" mapstructure:"validators"`
+
+	validators []flow.ResultValidator
+}
+
+// Init creates the validators. It returns an error if no validator is set or a validator can't be created.
+func (validator *AllValidator) Init() error {
+	validators, err := newValidators(validator.Validators)
+	if err != nil {
+		return err
+	}
+	validator.validators = validators
+	return nil
+}
+
+// Validate runs the validators. See ValidateResult.
+func (validator *AllValidator) Validate(stepOutput string, Step *flow.Step) bool {
+	return validator.ValidateResult(context.Background(), stepOutput, Step).Passed
+}
+
+// ValidateResult runs the validators in order and returns the result of the first one rejecting the output.
+func (validator *AllValidator) ValidateResult(ctx context.Context, stepOutput string, Step *flow.Step) flow.ValidationResult {
+	if validator.validators == nil {
+		if err := validator.Init(); err != nil {
+			return flow.ValidationResult{Reason: err.Error()}
+		}
+	}
+	for _, v := range validator.validators {
+		result := v.ValidateResult(ctx, stepOutput, Step)
+		if !result.Passed {
+			if result.Reason == "" {
+				result.Reason = flow.DefaultValidationFailure
+			}
+			return result
+		}
+	}
+	return flow.ValidationResult{Passed: true}
+}
+
+// AnyValidator passes if at least one of its validators passes. The validators are set like the validators of [AllValidator].
+type AnyValidator struct {
+	Validators []any `json:"validators" yaml:"validators" mapstructure:"validators"`
+
+	validators []flow.ResultValidator
+}
+
+// Init creates the validators. It returns an error if no validator is set or a validator can't be created.
+func (validator *AnyValidator) Init() error {
+	validators, err := newValidators(validator.Validators)
+	if err != nil {
+		return err
+	}
+	validator.validators = validators
+	return nil
+}
+
+// Validate runs the validators. See ValidateResult.
+func (validator *AnyValidator) Validate(stepOutput string, Step *flow.Step) bool {
+	return validator.ValidateResult(context.Background(), stepOutput, Step).Passed
+}
+
+// ValidateResult runs the validators in order until one passes. If none passes, the reasons of all validators are returned.
+func (validator *AnyValidator) ValidateResult(ctx context.Context, stepOutput string, Step *flow.Step) flow.ValidationResult {
+	if validator.validators == nil {
+		if err := validator.Init(); err != nil {
+			return flow.ValidationResult{Reason: err.Error()}
+		}
+	}
+	reasons := make([]string, 0, len(validator.validators))
+	for _, v := range validator.validators {
+		result := v.ValidateResult(ctx, stepOutput, Step)
+		if result.Passed {
+			return result
+		}
+		if result.Reason == "" {
+			result.Reason = flow.DefaultValidationFailure
+		}
+		reasons = append(reasons, result.Reason)
+	}
+	return flow.ValidationResult{Reason: "no validator passed: " + strings.Join(reasons, "; ")}
+}
+
+// newValidators creates the validators of AllValidator and AnyValidator.
+// Strings are looked up as registered validators, other values are decoded as ValidatorConfig.
+func newValidators(specs []any) ([]flow.ResultValidator, error) {
+	if len(specs) == 0 {
+		return nil, errors.New("no validators set")
+	}
+	validators := make([]flow.ResultValidator, 0, len(specs))
+	for i, spec := range specs {
+		var validator flow.StepValidator
+		var err error
+		switch spec := spec.(type) {
+		case string:
+			validator, err = GetValidator(spec)
+			if err == nil {
+				err = validator.Init()
+			}
+		case flow.StepValidator:
+			validator = spec
+		case *ValidatorConfig:
+			validator, err = NewValidatorFromConfig(spec)
+		default:
+			var config ValidatorConfig
+			if err = mapstructure.Decode(spec, &config); err == nil {
+				validator, err = NewValidatorFromConfig(&config)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("validator %d: %w", i, err)
+		}
+		validators = append(validators, flow.NewResultValidator(validator))
+	}
+	return validators, nil
 }
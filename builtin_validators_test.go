@@ -1,10 +1,14 @@
 package anyi
 
 import (
+	"context"
+	"os"
 	"testing"
 
 	"github.com/jieliu2000/anyi/flow"
+	"github.com/jieliu2000/anyi/internal/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestStringValidator_Init(t *testing.T) {
@@ -104,3 +108,204 @@ func TestJsonValidator_Validate(t *testing.T) {
 	assert.False(t, validator.Validate("not json string", step))
 	assert.True(t, validator.Validate(`{"key": "value"}`, step))
 }
+
+func TestJsonValidator_ValidateResult(t *testing.T) {
+	validator := &JsonValidator{}
+
+	result := validator.ValidateResult(context.Background(), "", nil)
+	assert.Equal(t, flow.ValidationResult{Reason: "the output is empty, expected JSON"}, result)
+
+	result = validator.ValidateResult(context.Background(), `{"key": }`, nil)
+	assert.False(t, result.Passed)
+	assert.Contains(t, result.Reason, "the output is not valid JSON: invalid character '}'")
+
+	result = validator.ValidateResult(context.Background(), `[1]`, nil)
+	assert.True(t, result.Passed)
+}
+
+func TestStringValidator_ValidateResult(t *testing.T) {
+	validator := &StringValidator{EqualTo: "yes"}
+	assert.Equal(t, flow.ValidationResult{Reason: `the output should be "yes"`}, validator.ValidateResult(context.Background(), "no", nil))
+	assert.True(t, validator.ValidateResult(context.Background(), "yes", nil).Passed)
+
+	validator = &StringValidator{MatchRegex: "^[0-9]+$"}
+	assert.Equal(t, flow.ValidationResult{Reason: "the output should match the regular expression ^[0-9]+$"}, validator.ValidateResult(context.Background(), "abc", nil))
+	assert.True(t, validator.ValidateResult(context.Background(), "42", nil).Passed)
+}
+
+func TestJsonValidator_RetryPrompt(t *testing.T) {
+	executor := &LLMExecutor{Template: `{{if .LastError}}Attempt {{.Attempt}}. Your answer "{{.PreviousOutput}}" was rejected: {{.LastError}}. {{end}}Answer {{.Text}} as JSON.`}
+	assert.NoError(t, executor.Init())
+	client := &test.SequenceClient{Outputs: []string{"forty-two", `{"answer": 42}`}}
+	f, err := flow.NewFlow(client, "json", *flow.NewStep(executor, &JsonValidator{}, client))
+	assert.NoError(t, err)
+
+	result, err := f.RunWithInput("the question")
+
+	assert.NoError(t, err)
+	assert.Equal(t, `{"answer": 42}`, result.Text)
+	assert.Equal(t, "Answer the question as JSON.", client.Messages[0][0].Content)
+	assert.Equal(t, `Attempt 2. Your answer "forty-two" was rejected: the output is not valid JSON: invalid character 'o' in literal false (expecting 'a'). Answer the question as JSON.`, client.Messages[1][0].Content)
+}
+
+func TestLLMValidator_ValidateResult(t *testing.T) {
+	validator := &LLMValidator{Criteria: "Mentions Paris", SystemMessage: "You are a strict reviewer."}
+	assert.NoError(t, validator.Init())
+
+	judge := &test.SequenceClient{Outputs: []string{
+		`{"pass": false, "score": 2, "reason": "Paris is not mentioned"}`,
+		"```json\n{\"pass\": true, \"score\": 9, \"reason\": \"ok\"}\n```",
+	}}
+	step := flow.NewStepWithValidator(nil, nil, validator, &test.SequenceClient{}, judge)
+
+	result := validator.ValidateResult(context.Background(), "London is big", step)
+	assert.Equal(t, flow.ValidationResult{Reason: "Paris is not mentioned"}, result)
+	assert.Equal(t, "You are a strict reviewer.", judge.Messages[0][0].Content)
+	assert.Contains(t, judge.Messages[0][1].Content, "Criteria:\nMentions Paris")
+	assert.Contains(t, judge.Messages[0][1].Content, "Output:\nLondon is big")
+	assert.Equal(t, "json", judge.Options[0].Format)
+
+	assert.True(t, validator.Validate("Paris is big", step))
+}
+
+func TestLLMValidator_Threshold(t *testing.T) {
+	validator := &LLMValidator{Template: "Rate {{.Output}}", Threshold: 7}
+	assert.NoError(t, validator.Init())
+	client := &test.SequenceClient{Outputs: []string{
+		`{"pass": true, "score": 6.5, "reason": "too long"}`,
+		`{"pass": false, "score": 7, "reason": "fine"}`,
+	}}
+	step := flow.NewStep(nil, validator, client)
+
+	assert.Equal(t, flow.ValidationResult{Reason: "score 6.5 is below 7: too long"}, validator.ValidateResult(context.Background(), "a", step))
+	assert.Equal(t, flow.ValidationResult{Passed: true, Reason: "fine"}, validator.ValidateResult(context.Background(), "b", step))
+	assert.Equal(t, "Rate a", client.Messages[0][0].Content)
+}
+
+func TestLLMValidator_Errors(t *testing.T) {
+	assert.EqualError(t, (&LLMValidator{}).Init(), "LLMValidator should have criteria, template or templateFile set")
+
+	validator := &LLMValidator{Criteria: "anything"}
+	result := validator.ValidateResult(context.Background(), "output", flow.NewStep(nil, validator, nil))
+	assert.Equal(t, flow.ValidationResult{Reason: "failed to validate the output: no client set to validate the step output"}, result)
+
+	client := &test.SequenceClient{}
+	result = validator.ValidateResult(context.Background(), "output", flow.NewStep(nil, validator, client))
+	assert.Equal(t, flow.ValidationResult{Reason: "failed to validate the output: no more outputs"}, result)
+}
+
+func TestJsonSchemaValidator(t *testing.T) {
+	schema := `{"type": "object", "required": ["name"], "properties": {"name": {"type": "string", "minLength": 2}}}`
+	validator := &JsonSchemaValidator{Schema: schema}
+	assert.NoError(t, validator.Init())
+
+	assert.True(t, validator.Validate(`{"name": "Ada"}`, nil))
+	assert.Equal(t, flow.ValidationResult{Reason: "the output doesn't match the JSON schema: $.name: expected at least 2 characters, got 1"}, validator.ValidateResult(context.Background(), `{"name": "A"}`, nil))
+	assert.Contains(t, validator.ValidateResult(context.Background(), "name: Ada", nil).Reason, "the output doesn't match the JSON schema: invalid JSON")
+
+	validator = &JsonSchemaValidator{Schema: map[string]any{"type": "array", "items": map[string]any{"type": "number"}}}
+	assert.NoError(t, validator.Init())
+	assert.True(t, validator.Validate(`[1, 2]`, nil))
+	assert.False(t, validator.Validate(`[1, "2"]`, nil))
+
+	file := t.TempDir() + "/schema.json"
+	assert.NoError(t, os.WriteFile(file, []byte(schema), 0o600))
+	validator = &JsonSchemaValidator{SchemaFile: file}
+	assert.NoError(t, validator.Init())
+	assert.False(t, validator.Validate(`{}`, nil))
+
+	assert.EqualError(t, (&JsonSchemaValidator{}).Init(), "JsonSchemaValidator should have either schema or schemaFile set")
+	assert.ErrorContains(t, (&JsonSchemaValidator{Schema: "[1]"}).Init(), "invalid schema")
+	assert.Contains(t, (&JsonSchemaValidator{}).ValidateResult(context.Background(), "{}", nil).Reason, "should have either schema or schemaFile set")
+
+	// Schemas relying on unsupported keywords are rejected instead of accepting anything
+	assert.EqualError(t, (&JsonSchemaValidator{Schema: `{"type": "string", "format": "email"}`}).Init(), `invalid schema: $: unsupported keyword "format"`)
+	validator = &JsonSchemaValidator{Schema: `{"oneOf": [{"type": "string"}, {"type": "integer"}]}`}
+	assert.NoError(t, validator.Init())
+	assert.False(t, validator.Validate(`true`, nil))
+}
+
+func TestLengthValidator(t *testing.T) {
+	validator := &LengthValidator{MinLength: 3, MaxLength: 5}
+	assert.NoError(t, validator.Init())
+
+	assert.True(t, validator.Validate("héllo", nil))
+	assert.Equal(t, "the output has 2 characters, at least 3 are required", validator.ValidateResult(context.Background(), "hi", nil).Reason)
+	assert.Equal(t, "the output has 6 characters, at most 5 are allowed", validator.ValidateResult(context.Background(), "hello!", nil).Reason)
+
+	assert.Error(t, (&LengthValidator{}).Init())
+	assert.EqualError(t, (&LengthValidator{MinLength: 5, MaxLength: 3}).Init(), "minLength 5 is greater than maxLength 3")
+}
+
+func TestKeywordValidator(t *testing.T) {
+	validator := &KeywordValidator{Contains: []string{"Paris", "France"}, NotContains: []string{"London", "maybe"}, IgnoreCase: true}
+	assert.NoError(t, validator.Init())
+
+	assert.True(t, validator.Validate("PARIS is the capital of france.", nil))
+	assert.Equal(t, `the output should contain "France"; the output should not contain "London", "maybe"`,
+		validator.ValidateResult(context.Background(), "Paris, or maybe London", nil).Reason)
+
+	validator.IgnoreCase = false
+	assert.Equal(t, `the output should contain "Paris", "France"`, validator.ValidateResult(context.Background(), "paris, france", nil).Reason)
+
+	assert.Error(t, (&KeywordValidator{}).Init())
+}
+
+func TestCompositeValidators(t *testing.T) {
+	resetRegistry()
+	RegisterValidator("short", &LengthValidator{MaxLength: 10})
+
+	all := &AllValidator{Validators: []any{
+		"json",
+		"short",
+		map[string]any{"type": "keyword", "withconfig": map[string]any{"contains": []string{"ok"}}},
+	}}
+	assert.NoError(t, all.Init())
+	assert.True(t, all.Validate(`["ok"]`, nil))
+	assert.Equal(t, "the output has 14 characters, at most 10 are allowed", all.ValidateResult(context.Background(), `["ok", "long"]`, nil).Reason)
+	assert.Equal(t, `the output should contain "ok"`, all.ValidateResult(context.Background(), `[]`, nil).Reason)
+
+	anyValidator := &AnyValidator{Validators: []any{"json", &StringValidator{EqualTo: "none"}}}
+	assert.NoError(t, anyValidator.Init())
+	assert.True(t, anyValidator.Validate("none", nil))
+	assert.True(t, anyValidator.Validate("{}", nil))
+	assert.Equal(t, `no validator passed: the output is not valid JSON: invalid character 'x' looking for beginning of value; the output should be "none"`,
+		anyValidator.ValidateResult(context.Background(), "x", nil).Reason)
+
+	assert.EqualError(t, (&AllValidator{}).Init(), "no validators set")
+	assert.EqualError(t, (&AnyValidator{Validators: []any{"missing"}}).Init(), "validator 0: no validator found with the given name: missing")
+}
+
+func TestCompositeValidator_FromConfig(t *testing.T) {
+	resetRegistry()
+	config := `
+flows:
+  - name: "composite"
+    steps:
+      - executor:
+          type: "setContext"
+          withconfig:
+            text: '{"name": "Ada"}'
+        maxRetryTimes: 0
+        validator:
+          type: "all"
+          withconfig:
+            validators:
+              - type: "jsonschema"
+                withconfig:
+                  schema: '{"type": "object", "required": ["name"], "properties": {"name": {"minLength": 1}}}'
+              - type: "length"
+                withconfig:
+                  maxLength: 20
+`
+	require.NoError(t, ConfigFromString(config, "yaml"))
+	f, err := GetFlow("composite")
+	require.NoError(t, err)
+
+	result, err := f.RunWithInput("")
+	require.NoError(t, err)
+	assert.Equal(t, `{"name": "Ada"}`, result.Text)
+
+	_, ok := f.Steps[0].Validator.(*AllValidator)
+	assert.True(t, ok)
+}
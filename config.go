@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -53,6 +54,14 @@ type FlowConfig struct {
 	Description  string           `mapstructure:"description" json:"description" yaml:"description"`
 	Steps        []StepConfig     `mapstructure:"steps" json:"steps" yaml:"steps"`
 	Variables    map[string]any   `mapstructure:"variables" json:"variables" yaml:"variables"`
+	// The maximum number of steps running at the same time when the steps declare dependencies. Zero means no limit.
+	MaxParallelism int `mapstructure:"maxParallelism" json:"maxParallelism" yaml:"maxParallelism"`
+	// The maximum number of step runs of the flow, which guards against endless loops when steps jump back. Defaults to the number of steps plus flow.DefaultMaxStepRuns.
+	MaxStepRuns int `mapstructure:"maxStepRuns" json:"maxStepRuns" yaml:"maxStepRuns"`
+	// The directory where the state of each run is saved after every step, so failed runs can be continued with flow.Resume. If empty, no checkpoints are saved.
+	CheckpointDir string `mapstructure:"checkpointDir" json:"checkpointDir" yaml:"checkpointDir"`
+	// The directory where the memory and conversation of each session are saved for flow.RunWithSession. If empty, sessions are not available.
+	SessionDir string `mapstructure:"sessionDir" json:"sessionDir" yaml:"sessionDir"`
 }
 
 // StepConfig defines the configuration structure for workflow steps.
@@ -62,11 +71,23 @@ type StepConfig struct {
 	// The client name which will be used to validate the step output. If not set, validator will use the default client of the step (which is identified by the ClientName field). If the step doesn't have a default client, the validator will use the default client of the flow.
 	ValidatorClientName string `mapstructure:"validatorClientName" json:"validatorClientName" yaml:"validatorClientName"`
 	MaxRetryTimes       int    `mapstructure:"maxRetryTimes" json:"maxRetryTimes" yaml:"maxRetryTimes"`
+	// The delay before the first retry of the step when its output doesn't pass validation, for example "2s". The delay doubles with each further retry.
+	RetryBackoff time.Duration `mapstructure:"retryBackoff" json:"retryBackoff" yaml:"retryBackoff"`
 
 	Validator *ValidatorConfig `mapstructure:"validator" json:"validator" yaml:"validator"`
 	// This is a required field. The executor name which will be used to execute the step.
 	Executor *ExecutorConfig `mapstructure:"executor" json:"executor" yaml:"executor"`
 	Name     string          `mapstructure:"name" json:"name" yaml:"name"`
+	// The names of the steps this step depends on. If any step of a flow sets this field, the flow runs its steps as a DAG.
+	DependsOn []string `mapstructure:"dependsOn" json:"dependsOn" yaml:"dependsOn"`
+	// How the outputs of the dependencies are merged: "concat" (default), "last" or "json". See flow.JoinMode.
+	Join string `mapstructure:"join" json:"join" yaml:"join"`
+	// The name of the step to run after this one instead of the following step. "$end" ends the flow.
+	Next string `mapstructure:"next" json:"next" yaml:"next"`
+	// The name of the step to run after this step succeeded. Takes precedence over Next.
+	OnSuccess string `mapstructure:"onSuccess" json:"onSuccess" yaml:"onSuccess"`
+	// The name of the step to run if this step fails or its output doesn't pass validation. If not set, the flow fails.
+	OnFailure string `mapstructure:"onFailure" json:"onFailure" yaml:"onFailure"`
 }
 
 // NewClientFromConfig creates a new LLM client from a client configuration.
@@ -80,15 +101,11 @@ type StepConfig struct {
 //   - A new LLM client instance
 //   - Any error encountered during client creation
 func NewClientFromConfig(config *llm.ClientConfig) (llm.Client, error) {
-	model, err := llm.NewModelConfigFromClientConfig(config)
-	if err != nil {
-		return nil, err
-	}
-
-	client, err := NewClient(config.Name, model)
+	client, err := llm.NewClientFromClientConfig(config)
 	if err != nil {
 		return nil, err
 	}
+	setClient(config.Name, client)
 	if config.Default {
 		defaultClient, err := GetDefaultClient()
 		if err == nil || defaultClient != nil {
@@ -148,11 +165,24 @@ func NewStepFromConfig(stepConfig *StepConfig) (*flow.Step, error) {
 			return nil, err
 		}
 	}
-	step := flow.NewStep(executor, validator, client)
+	var validatorClient llm.Client
+	if stepConfig.ValidatorClientName != "" {
+		validatorClient, err = GetClient(stepConfig.ValidatorClientName)
+		if err != nil {
+			return nil, err
+		}
+	}
+	step := flow.NewStepWithValidator(nil, executor, validator, client, validatorClient)
 	step.Name = stepConfig.Name
+	step.DependsOn = stepConfig.DependsOn
+	step.Join = flow.JoinMode(stepConfig.Join)
+	step.Next = stepConfig.Next
+	step.OnSuccess = stepConfig.OnSuccess
+	step.OnFailure = stepConfig.OnFailure
 	if stepConfig.MaxRetryTimes > 0 {
 		step.MaxRetryTimes = stepConfig.MaxRetryTimes
 	}
+	step.RetryBackoff = stepConfig.RetryBackoff
 	return step, nil
 }
 
@@ -202,6 +232,21 @@ func NewFlowFromConfig(flowConfig *FlowConfig) (*flow.Flow, error) {
 		return nil, err
 	}
 
+	f.MaxParallelism = flowConfig.MaxParallelism
+	f.MaxStepRuns = flowConfig.MaxStepRuns
+	if flowConfig.CheckpointDir != "" {
+		f.Checkpoints, err = flow.NewFileCheckpointStore(flowConfig.CheckpointDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if flowConfig.SessionDir != "" {
+		f.Sessions, err = flow.NewFileMemoryStore(flowConfig.SessionDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Set flow variables from config
 	if flowConfig.Variables != nil {
 		f.Variables = make(map[string]any)
@@ -223,7 +268,7 @@ func NewFlowFromConfig(flowConfig *FlowConfig) (*flow.Flow, error) {
 //
 // Returns:
 //   - A new step executor
-//   - Any error encountered during executor creation
+//   - An error if the executor type is unknown, or the configuration can't be decoded or is rejected by the Init method of the executor
 func NewExecutorFromConfig(executorConfig *ExecutorConfig) (flow.StepExecutor, error) {
 	if executorConfig == nil {
 		return nil, errors.New("executor config is nil")
@@ -244,11 +289,30 @@ func NewExecutorFromConfig(executorConfig *ExecutorConfig) (flow.StepExecutor, e
 		return nil, fmt.Errorf("executor type %s is not found", executorConfig.Type)
 	}
 
-	mapstructure.Decode(executorConfig.WithConfig, executor)
-	executor.Init()
+	if err := decodeWithConfig(executorConfig.WithConfig, executor); err != nil {
+		return nil, fmt.Errorf("invalid config of executor %s: %w", executorConfig.Type, err)
+	}
+	if err := executor.Init(); err != nil {
+		return nil, fmt.Errorf("invalid config of executor %s: %w", executorConfig.Type, err)
+	}
 	return executor, nil
 }
 
+// decodeWithConfig decodes the withconfig map of an executor or validator into it. Durations can be given as strings like "30s".
+func decodeWithConfig(withConfig map[string]interface{}, target any) error {
+	if len(withConfig) == 0 {
+		return nil
+	}
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.StringToTimeDurationHookFunc(),
+		Result:     target,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(withConfig)
+}
+
 // NewValidatorFromConfig creates a new validator from a validator configuration.
 // It instantiates the appropriate validator type based on the configuration,
 // decodes the configuration parameters, and initializes the validator.
@@ -258,7 +322,7 @@ func NewExecutorFromConfig(executorConfig *ExecutorConfig) (flow.StepExecutor, e
 //
 // Returns:
 //   - A new step validator
-//   - Any error encountered during validator creation
+//   - An error if the validator type is unknown, or the configuration can't be decoded or is rejected by the Init method of the validator
 func NewValidatorFromConfig(validatorConfig *ValidatorConfig) (flow.StepValidator, error) {
 	if validatorConfig == nil {
 		return nil, errors.New("validator config is nil")
@@ -279,8 +343,12 @@ func NewValidatorFromConfig(validatorConfig *ValidatorConfig) (flow.StepValidato
 		return nil, fmt.Errorf("validator type %s is not found", validatorConfig.Type)
 	}
 
-	mapstructure.Decode(validatorConfig.WithConfig, validator)
-	validator.Init()
+	if err := decodeWithConfig(validatorConfig.WithConfig, validator); err != nil {
+		return nil, fmt.Errorf("invalid config of validator %s: %w", validatorConfig.Type, err)
+	}
+	if err := validator.Init(); err != nil {
+		return nil, fmt.Errorf("invalid config of validator %s: %w", validatorConfig.Type, err)
+	}
 	return validator, nil
 
 }
@@ -1,13 +1,17 @@
 package anyi
 
 import (
+	"errors"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/jieliu2000/anyi/flow"
 	"github.com/jieliu2000/anyi/internal/test"
 	"github.com/jieliu2000/anyi/llm"
+	"github.com/jieliu2000/anyi/llm/deepseek"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type MockExecutor struct {
@@ -129,6 +133,73 @@ func TestNewFlowFromConfig_WithDescription(t *testing.T) {
 	assert.Equal(t, flowConfig.Description, flowInstance.Description)
 	assert.Equal(t, 1, len(flowInstance.Steps))
 }
+func TestNewFlowFromConfig_WithDependencies(t *testing.T) {
+	GlobalRegistry = &anyiRegistry{
+		Flows:      make(map[string]*flow.Flow),
+		Clients:    make(map[string]llm.Client),
+		Executors:  make(map[string]flow.StepExecutor),
+		Validators: make(map[string]flow.StepValidator),
+	}
+	RegisterClient("test-client", &test.MockClient{})
+	RegisterExecutor("test-executor", &MockExecutor{})
+
+	flowConfig := &FlowConfig{
+		ClientName:     "test-client",
+		Name:           "dag-flow",
+		MaxParallelism: 2,
+		Steps: []StepConfig{
+			{Name: "a", Executor: &ExecutorConfig{Type: "test-executor"}},
+			{Name: "b", Executor: &ExecutorConfig{Type: "test-executor"}},
+			{Name: "merge", DependsOn: []string{"a", "b"}, Join: "last", Executor: &ExecutorConfig{Type: "test-executor"}},
+		},
+	}
+
+	flowInstance, err := NewFlowFromConfig(flowConfig)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, flowInstance.MaxParallelism)
+	assert.Equal(t, []string{"a", "b"}, flowInstance.Steps[2].DependsOn)
+	assert.Equal(t, flow.JoinLast, flowInstance.Steps[2].Join)
+
+	result, err := flowInstance.RunWithInput("input")
+	assert.NoError(t, err)
+	assert.Equal(t, "input", result.Text)
+}
+
+func TestNewFlowFromConfig_WithTransitions(t *testing.T) {
+	GlobalRegistry = &anyiRegistry{
+		Flows:      make(map[string]*flow.Flow),
+		Clients:    make(map[string]llm.Client),
+		Executors:  make(map[string]flow.StepExecutor),
+		Validators: make(map[string]flow.StepValidator),
+	}
+	RegisterClient("test-client", &test.MockClient{})
+	RegisterExecutor("test-executor", &MockExecutor{})
+
+	flowConfig := &FlowConfig{
+		ClientName:  "test-client",
+		Name:        "jump-flow",
+		MaxStepRuns: 20,
+		Steps: []StepConfig{
+			{Name: "draft", Next: "review", Executor: &ExecutorConfig{Type: "test-executor"}},
+			{Name: "skipped", Executor: &ExecutorConfig{Type: "test-executor"}},
+			{Name: "review", OnSuccess: "$end", OnFailure: "draft", RetryBackoff: time.Second, Executor: &ExecutorConfig{Type: "test-executor"}},
+		},
+	}
+
+	flowInstance, err := NewFlowFromConfig(flowConfig)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 20, flowInstance.MaxStepRuns)
+	assert.Equal(t, "review", flowInstance.Steps[0].Next)
+	assert.Equal(t, flow.EndStep, flowInstance.Steps[2].OnSuccess)
+	assert.Equal(t, "draft", flowInstance.Steps[2].OnFailure)
+	assert.Equal(t, time.Second, flowInstance.Steps[2].RetryBackoff)
+
+	_, err = flowInstance.RunWithInput("input")
+	assert.NoError(t, err)
+}
+
 func TestNewFlowFromConfig_WithNil(t *testing.T) {
 	// Execute
 	flowInstance, err := NewFlowFromConfig(nil)
@@ -252,6 +323,34 @@ func TestNewExecutorFromConfig(t *testing.T) {
 		assert.Equal(t, 10, executor.Param2)
 
 	})
+
+	t.Run("Init errors", func(t *testing.T) {
+		resetRegistry()
+		executorConfig := &ExecutorConfig{
+			Type: "condition",
+			WithConfig: map[string]interface{}{
+				"conditions": []map[string]interface{}{{"when": "Text ==", "flow": "target"}},
+			},
+		}
+
+		_, err := NewExecutorFromConfig(executorConfig)
+
+		assert.ErrorContains(t, err, `invalid config of executor condition: invalid condition "Text =="`)
+	})
+
+	t.Run("Flows defined later", func(t *testing.T) {
+		resetRegistry()
+		executorConfig := &ExecutorConfig{
+			Type: "condition",
+			WithConfig: map[string]interface{}{
+				"switch": map[string]interface{}{"a": "definedLater"},
+			},
+		}
+
+		_, err := NewExecutorFromConfig(executorConfig)
+
+		assert.NoError(t, err)
+	})
 }
 
 func TestNewClientFromConfigWithEmptyName(t *testing.T) {
@@ -280,6 +379,23 @@ func TestNewClientFromConfig(t *testing.T) {
 	assert.NotNil(t, client)
 }
 
+func TestNewClientFromConfig_DeepSeek(t *testing.T) {
+	config := llm.ClientConfig{
+		Name: "deepseek-test",
+		Type: "deepseek",
+		Config: map[string]interface{}{
+			"apiKey": "test_api_key",
+		},
+	}
+	client, err := NewClientFromConfig(&config)
+	assert.Nil(t, err)
+	assert.IsType(t, (*deepseek.DeepSeekClient)(nil), client)
+
+	registered, err := GetClient("deepseek-test")
+	assert.Nil(t, err)
+	assert.Same(t, client, registered)
+}
+
 func TestNewClientFromConfigWithInvalidType(t *testing.T) {
 	config := llm.ClientConfig{
 		Name: "test",
@@ -480,6 +596,23 @@ func TestNewValidatorFromConfig(t *testing.T) {
 	}
 }
 
+func TestNewValidatorFromConfig_DecodesAndInits(t *testing.T) {
+	resetRegistry()
+
+	validator, err := NewValidatorFromConfig(&ValidatorConfig{Type: "gocode", WithConfig: map[string]interface{}{"buildTimeout": "30s"}})
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, validator.(*GoCodeValidator).BuildTimeout)
+
+	_, err = NewValidatorFromConfig(&ValidatorConfig{Type: "length", WithConfig: map[string]interface{}{"minLength": 10, "maxLength": 5}})
+	assert.EqualError(t, err, "invalid config of validator length: minLength 10 is greater than maxLength 5")
+
+	_, err = NewValidatorFromConfig(&ValidatorConfig{Type: "llm"})
+	assert.ErrorContains(t, err, "should have criteria, template or templateFile set")
+
+	_, err = NewValidatorFromConfig(&ValidatorConfig{Type: "gocode", WithConfig: map[string]interface{}{"buildTimeout": "soon"}})
+	assert.ErrorContains(t, err, "invalid config of validator gocode")
+}
+
 // TestConfigFromString tests loading configuration from a string with specified format
 func TestConfigFromString(t *testing.T) {
 	// Setup test
@@ -706,3 +839,90 @@ flows: []
 		assert.Error(t, err)
 	})
 }
+
+func TestNewStepFromConfig_LLMValidator(t *testing.T) {
+	resetRegistry()
+	writer := &test.SequenceClient{Outputs: []string{"London", "Paris"}}
+	judge := &test.SequenceClient{Outputs: []string{
+		`{"pass": false, "score": 1, "reason": "wrong city"}`,
+		`{"pass": true, "score": 10, "reason": "correct"}`,
+	}}
+	RegisterClient("writer", writer)
+	RegisterClient("judge", judge)
+
+	step, err := NewStepFromConfig(&StepConfig{
+		ClientName:          "writer",
+		ValidatorClientName: "judge",
+		Executor:            &ExecutorConfig{Type: "llm", WithConfig: map[string]interface{}{"template": "{{.Text}}{{if .LastError}} ({{.LastError}}){{end}}"}},
+		Validator:           &ValidatorConfig{Type: "llm", WithConfig: map[string]interface{}{"criteria": "Names the capital of France"}},
+	})
+	require.NoError(t, err)
+	assert.Same(t, judge, step.GetValidatorClient())
+
+	f, err := flow.NewFlow(nil, "capital", *step)
+	require.NoError(t, err)
+	result, err := f.RunWithInput("Capital of France?")
+
+	require.NoError(t, err)
+	assert.Equal(t, "Paris", result.Text)
+	assert.Equal(t, "Capital of France? (wrong city)", writer.Messages[1][0].Content)
+
+	_, err = NewStepFromConfig(&StepConfig{ValidatorClientName: "missing", Executor: &ExecutorConfig{Type: "llm", WithConfig: map[string]interface{}{"template": "x"}}})
+	assert.Error(t, err)
+}
+
+func TestNewFlowFromConfig_CheckpointDir(t *testing.T) {
+	resetRegistry()
+	runs := 0
+	RegisterExecutor("flaky", funcExecutor(func(flowContext flow.FlowContext) (*flow.FlowContext, error) {
+		runs++
+		if runs == 1 {
+			return nil, errors.New("timeout")
+		}
+		flowContext.Text += " done"
+		return &flowContext, nil
+	}))
+
+	dir := t.TempDir()
+	flowInstance, err := NewFlowFromConfig(&FlowConfig{
+		Name:          "resumable",
+		CheckpointDir: dir,
+		Steps: []StepConfig{
+			{Name: "prepare", Executor: &ExecutorConfig{Type: "setContext", WithConfig: map[string]interface{}{"text": "prepared"}}},
+			{Name: "call", Executor: &ExecutorConfig{Type: "flaky"}},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &flow.FileCheckpointStore{Dir: dir}, flowInstance.Checkpoints)
+
+	_, err = flowInstance.Run(flow.FlowContext{RunID: "nightly"})
+	assert.EqualError(t, err, "run nightly failed: timeout")
+
+	result, err := flowInstance.Resume("nightly")
+	require.NoError(t, err)
+	assert.Equal(t, "prepared done", result.Text)
+}
+
+func TestNewFlowFromConfig_SessionDir(t *testing.T) {
+	resetRegistry()
+	RegisterExecutor("count", funcExecutor(func(flowContext flow.FlowContext) (*flow.FlowContext, error) {
+		count, _ := flowContext.Memory.(float64)
+		flowContext.Memory = count + 1
+		return &flowContext, nil
+	}))
+
+	dir := t.TempDir()
+	flowInstance, err := NewFlowFromConfig(&FlowConfig{
+		Name:       "bot",
+		SessionDir: dir,
+		Steps:      []StepConfig{{Name: "count", Executor: &ExecutorConfig{Type: "count"}}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &flow.FileMemoryStore{Dir: dir}, flowInstance.Sessions)
+
+	_, err = flowInstance.RunWithSession("chat-1", "hello")
+	require.NoError(t, err)
+	result, err := flowInstance.RunWithSession("chat-1", "again")
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, result.Memory)
+}
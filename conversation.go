@@ -0,0 +1,70 @@
+package anyi
+
+import (
+	"fmt"
+
+	"github.com/jieliu2000/anyi/flow"
+)
+
+// ConversationConfig configures how an LLMExecutor takes part in the multi-turn dialog of a flow. See [flow.Conversation].
+//
+// Example usage in configuration:
+//
+//	{
+//	  "type": "llm",
+//	  "withconfig": {
+//	    "template": "{{.Text}}",
+//	    "conversation": {"policy": "window", "maxMessages": 20}
+//	  }
+//	}
+type ConversationConfig struct {
+	// The policy deciding which messages are kept: "buffer" (the default) keeps all messages, "window" keeps the most recent messages and "summary" lets the model summarize older messages.
+	Policy string `json:"policy" yaml:"policy" mapstructure:"policy"`
+	// The maximum number of messages kept by "window", or the number at which "summary" compacts the conversation.
+	MaxMessages int `json:"maxMessages" yaml:"maxMessages" mapstructure:"maxMessages"`
+	// The maximum number of tokens kept by "window", or the number at which "summary" compacts the conversation.
+	MaxTokens int `json:"maxTokens" yaml:"maxTokens" mapstructure:"maxTokens"`
+	// The number of recent messages "summary" keeps as they are.
+	KeepMessages int `json:"keepMessages" yaml:"keepMessages" mapstructure:"keepMessages"`
+	// The instruction "summary" sends to the model. Defaults to flow.DefaultSummaryPrompt.
+	SummaryPrompt string `json:"summaryPrompt" yaml:"summaryPrompt" mapstructure:"summaryPrompt"`
+	// The name of the client writing the summaries. Defaults to the client of the step.
+	SummaryClientName string `json:"summaryClientName" yaml:"summaryClientName" mapstructure:"summaryClientName"`
+}
+
+// NewConversationPolicy creates the conversation policy described by the config.
+//
+// Parameters:
+//   - config: The conversation configuration
+//
+// Returns:
+//   - The conversation policy
+//   - An error if the policy is unknown or the summary client is not registered
+func NewConversationPolicy(config *ConversationConfig) (flow.ConversationPolicy, error) {
+	if config == nil {
+		return nil, nil
+	}
+	switch config.Policy {
+	case "", "buffer":
+		return &flow.BufferPolicy{}, nil
+	case "window":
+		return &flow.WindowPolicy{MaxMessages: config.MaxMessages, MaxTokens: config.MaxTokens}, nil
+	case "summary":
+		policy := &flow.SummaryPolicy{
+			MaxMessages:  config.MaxMessages,
+			MaxTokens:    config.MaxTokens,
+			KeepMessages: config.KeepMessages,
+			Prompt:       config.SummaryPrompt,
+		}
+		if config.SummaryClientName != "" {
+			client, err := GetClient(config.SummaryClientName)
+			if err != nil {
+				return nil, err
+			}
+			policy.Client = client
+		}
+		return policy, nil
+	default:
+		return nil, fmt.Errorf("unknown conversation policy: %s", config.Policy)
+	}
+}
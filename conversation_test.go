@@ -0,0 +1,73 @@
+package anyi
+
+import (
+	"testing"
+
+	"github.com/jieliu2000/anyi/flow"
+	"github.com/jieliu2000/anyi/internal/test"
+	"github.com/jieliu2000/anyi/llm/chat"
+	"github.com/mitchellh/mapstructure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLLMExecutor_Conversation(t *testing.T) {
+	client := &test.SequenceClient{Outputs: []string{"Hi Ann!", "Your name is Ann."}}
+	executor := &LLMExecutor{}
+	require.NoError(t, mapstructure.Decode(map[string]any{
+		"template":      "{{.Text}}",
+		"systemMessage": "Be brief.",
+		"conversation":  map[string]any{"policy": "window", "maxMessages": 10},
+	}, executor))
+	require.NoError(t, executor.Init())
+	assert.Equal(t, &flow.WindowPolicy{MaxMessages: 10}, executor.ConversationPolicy)
+	step := flow.NewStep(executor, nil, client)
+
+	first, err := executor.Run(flow.FlowContext{Text: "I'm Ann."}, step)
+	require.NoError(t, err)
+	second, err := executor.Run(flow.FlowContext{Text: "What's my name?", Conversation: first.Conversation}, step)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Your name is Ann.", second.Text)
+	assert.Equal(t, []chat.Message{
+		chat.NewSystemMessage("Be brief."),
+		chat.NewUserMessage("I'm Ann."),
+		chat.NewAssistantMessage("Hi Ann!"),
+		chat.NewUserMessage("What's my name?"),
+	}, client.Messages[1])
+	assert.Len(t, second.Conversation.Messages, 4)
+	assert.Len(t, first.Conversation.Messages, 2, "earlier contexts keep their history")
+
+	// Steps without a conversation don't read or change it
+	client.Outputs = []string{"Bonjour"}
+	third, err := (&LLMExecutor{Template: "Translate: {{.Text}}"}).Run(*second, flow.NewStep(nil, nil, client))
+	require.NoError(t, err)
+	assert.Len(t, client.Messages[2], 1)
+	assert.Same(t, second.Conversation, third.Conversation)
+}
+
+func TestLLMExecutor_RunDoesNotChangeExecutor(t *testing.T) {
+	client := &test.SequenceClient{Outputs: []string{"Hi Ann!"}}
+	executor := &LLMExecutor{Template: "{{.Text}}", Conversation: &ConversationConfig{Policy: "window", MaxMessages: 10}}
+
+	result, err := executor.Run(flow.FlowContext{Text: "I'm Ann."}, flow.NewStep(executor, nil, client))
+
+	require.NoError(t, err)
+	assert.Equal(t, "Hi Ann!", result.Text)
+	assert.Len(t, result.Conversation.Messages, 2)
+	assert.Nil(t, executor.TemplateFormatter, "runs without Init create the formatter in a local")
+	assert.Nil(t, executor.ConversationPolicy, "runs without Init create the policy in a local")
+}
+
+func TestNewConversationPolicy(t *testing.T) {
+	policy, err := NewConversationPolicy(&ConversationConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, &flow.BufferPolicy{}, policy)
+
+	policy, err = NewConversationPolicy(&ConversationConfig{Policy: "summary", MaxTokens: 2000, KeepMessages: 6})
+	require.NoError(t, err)
+	assert.Equal(t, &flow.SummaryPolicy{MaxTokens: 2000, KeepMessages: 6}, policy)
+
+	_, err = NewConversationPolicy(&ConversationConfig{Policy: "forever"})
+	assert.EqualError(t, err, "unknown conversation policy: forever")
+}
@@ -0,0 +1,108 @@
+// Package boltstore provides a flow.MemoryStore which keeps sessions in a bbolt database, an embedded key-value store in a single file written in pure Go.
+package boltstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/jieliu2000/anyi/flow"
+)
+
+// DefaultBucket is the bucket the sessions are stored in if no bucket is given.
+const DefaultBucket = "sessions"
+
+// Store keeps each session as JSON under its ID in a bucket of a bbolt database.
+// A bbolt database can only be opened by one process at a time. Close the store when it's no longer needed.
+type Store struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+// Open opens the database file, creating it if it doesn't exist, and returns a store using DefaultBucket.
+//
+// Parameters:
+//   - path: The path of the database file
+//
+// Returns:
+//   - The store
+//   - An error if the database can't be opened, for example because another process holds it open
+func Open(path string) (*Store, error) {
+	return OpenBucket(path, DefaultBucket)
+}
+
+// OpenBucket works like Open but stores the sessions in the given bucket, so several stores can share a database.
+func OpenBucket(path string, bucket string) (*Store, error) {
+	if bucket == "" {
+		return nil, errors.New("bucket cannot be empty")
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	store := &Store{db: db, bucket: []byte(bucket)}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(store.bucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// Close closes the database.
+func (store *Store) Close() error {
+	return store.db.Close()
+}
+
+// Load reads the session.
+func (store *Store) Load(sessionID string) (*flow.Session, error) {
+	var data []byte
+	err := store.db.View(func(tx *bolt.Tx) error {
+		// The value is only valid during the transaction
+		if value := tx.Bucket(store.bucket).Get([]byte(sessionID)); value != nil {
+			data = append([]byte(nil), value...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, flow.ErrSessionNotFound
+	}
+	var session flow.Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("invalid session %s: %w", sessionID, err)
+	}
+	return &session, nil
+}
+
+// Save writes the session.
+func (store *Store) Save(session *flow.Session) error {
+	if session == nil || session.ID == "" {
+		return errors.New("session has no ID")
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(store.bucket).Put([]byte(session.ID), data)
+	})
+}
+
+// Delete removes the session.
+func (store *Store) Delete(sessionID string) error {
+	if sessionID == "" {
+		return nil
+	}
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(store.bucket).Delete([]byte(sessionID))
+	})
+}
@@ -0,0 +1,68 @@
+package boltstore
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/jieliu2000/anyi/flow"
+	"github.com/jieliu2000/anyi/llm/chat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	store, err := Open(path)
+	require.NoError(t, err)
+
+	_, err = store.Load("alice")
+	assert.ErrorIs(t, err, flow.ErrSessionNotFound)
+
+	session := &flow.Session{
+		ID:           "alice",
+		Memory:       map[string]any{"plan": "pro"},
+		Conversation: &flow.Conversation{Messages: []chat.Message{chat.NewUserMessage("hi")}},
+	}
+	require.NoError(t, store.Save(session))
+	require.NoError(t, store.Close())
+
+	// The sessions survive reopening the database
+	store, err = Open(path)
+	require.NoError(t, err)
+	defer store.Close()
+	loaded, err := store.Load("alice")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"plan": "pro"}, loaded.Memory)
+	assert.Equal(t, "user: hi", loaded.Conversation.Transcript())
+
+	require.NoError(t, store.Delete("alice"))
+	_, err = store.Load("alice")
+	assert.ErrorIs(t, err, flow.ErrSessionNotFound)
+	assert.Error(t, store.Save(&flow.Session{}))
+}
+
+func TestStore_RunWithSession(t *testing.T) {
+	store, err := OpenBucket(filepath.Join(t.TempDir(), "bot.db"), "support")
+	require.NoError(t, err)
+	defer store.Close()
+
+	bot, _ := flow.NewFlow(nil, "bot", *flow.NewStep(counter{}, nil, nil))
+	bot.Sessions = store
+
+	_, err = bot.RunWithSession("alice", "first")
+	require.NoError(t, err)
+	result, err := bot.RunWithSession("alice", "second")
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, result.Memory)
+}
+
+// counter counts the runs of a session in Memory.
+type counter struct{}
+
+func (counter) Init() error { return nil }
+
+func (counter) Run(flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
+	count, _ := flowContext.Memory.(float64)
+	flowContext.Memory = count + 1
+	return &flowContext, nil
+}
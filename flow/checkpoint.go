@@ -0,0 +1,301 @@
+package flow
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCheckpointNotFound is returned by checkpoint stores when there is no checkpoint for a run.
+var ErrCheckpointNotFound = errors.New("checkpoint not found")
+
+// Checkpoint is the saved state of a flow run.
+type Checkpoint struct {
+	RunID    string `json:"runId"`
+	FlowName string `json:"flowName"`
+	// Context is the flow context after the last finished step. For DAG flows it's the context the run started with until the run is done.
+	Context FlowContext `json:"context"`
+	// NextStep is the index of the step the run continues with. It's only used by flows which don't run as a DAG.
+	NextStep int `json:"nextStep"`
+	// StepRuns is the number of steps run so far, which counts towards MaxStepRuns.
+	StepRuns int `json:"stepRuns"`
+	// Completed holds the results of the finished steps of a DAG flow by step name.
+	Completed map[string]FlowContext `json:"completed,omitempty"`
+	// Done is true if the run finished successfully. Context holds the result then.
+	Done bool `json:"done"`
+	// Paused is true if a step paused the run to wait for input. See [PauseError].
+	Paused bool `json:"paused,omitempty"`
+	// PausedStep is the name of the step waiting for input.
+	PausedStep string `json:"pausedStep,omitempty"`
+	// Prompt is the prompt of the paused step.
+	Prompt    string    `json:"prompt,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// CheckpointStore saves and loads the checkpoints of flow runs.
+// See [MemoryCheckpointStore] and [FileCheckpointStore] for the built-in implementations.
+type CheckpointStore interface {
+	// Save stores the checkpoint, replacing an earlier checkpoint of the same run.
+	Save(checkpoint *Checkpoint) error
+	// Load returns the checkpoint of the run, or ErrCheckpointNotFound if there is none.
+	Load(runID string) (*Checkpoint, error)
+	// Delete removes the checkpoint of the run. Deleting a checkpoint which doesn't exist is not an error.
+	Delete(runID string) error
+}
+
+// RunError is returned by flows with checkpoints when a run fails. It carries the ID needed to resume the run.
+type RunError struct {
+	RunID string
+	Err   error
+}
+
+func (e *RunError) Error() string {
+	return fmt.Sprintf("run %s failed: %v", e.RunID, e.Err)
+}
+
+func (e *RunError) Unwrap() error {
+	return e.Err
+}
+
+// NewRunID returns a random ID for a flow run.
+func NewRunID() string {
+	data := make([]byte, 16)
+	if _, err := rand.Read(data); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(data)
+}
+
+// saveCheckpoint saves the state of the run if the flow has a checkpoint store.
+func (flow *Flow) saveCheckpoint(state *Checkpoint) error {
+	if flow.Checkpoints == nil {
+		return nil
+	}
+	state.UpdatedAt = time.Now()
+	if err := flow.Checkpoints.Save(state); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Resume continues a run of the flow from its last checkpoint. See [Flow.ResumeContext].
+func (flow *Flow) Resume(runID string) (*FlowContext, error) {
+	return flow.ResumeContext(context.Background(), runID)
+}
+
+// ResumeContext continues a run of the flow from its last checkpoint, for example after a step failed or the process was restarted.
+// Steps which finished before the checkpoint was saved are not run again. If the run already finished, its result is returned without running any step.
+//
+// Checkpoints saved to a [FileCheckpointStore] are JSON, so Memory and the values of Variables are restored as decoded JSON (maps, slices, strings, float64 and bool).
+//
+// Parameters:
+//   - ctx: The context controlling the flow execution
+//   - runID: The RunID of the flow context of the run
+//
+// Returns:
+//   - The flow context after the last step
+//   - An error if the flow has no checkpoint store, the checkpoint can't be loaded or belongs to another flow, or a step fails
+func (flow *Flow) ResumeContext(ctx context.Context, runID string) (*FlowContext, error) {
+	state, flowContext, err := flow.loadRun(runID)
+	if err != nil {
+		return nil, err
+	}
+	if state.Done {
+		return flowContext, nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return flow.run(ctx, flowContext, state)
+}
+
+// loadRun loads the checkpoint of a run of the flow and prepares the flow context to continue the run with.
+func (flow *Flow) loadRun(runID string) (*Checkpoint, *FlowContext, error) {
+	if flow.Checkpoints == nil {
+		return nil, nil, fmt.Errorf("flow %s has no checkpoint store", flow.Name)
+	}
+	state, err := flow.Checkpoints.Load(runID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if state.FlowName != flow.Name {
+		return nil, nil, fmt.Errorf("run %s belongs to flow %s", runID, state.FlowName)
+	}
+	if err := flow.validateTransitions(); err != nil {
+		return nil, nil, err
+	}
+
+	flowContext := state.Context
+	flowContext.Flow = flow
+	flowContext.RunID = runID
+	if flowContext.Variables == nil {
+		flowContext.Variables = make(map[string]any)
+	}
+	return state, &flowContext, nil
+}
+
+// MemoryCheckpointStore keeps checkpoints in memory. Runs can be resumed as long as the process is running, for example after a step failed because a model was unavailable.
+type MemoryCheckpointStore struct {
+	mu          sync.RWMutex
+	checkpoints map[string]Checkpoint
+}
+
+// NewMemoryCheckpointStore creates an empty MemoryCheckpointStore.
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{checkpoints: make(map[string]Checkpoint)}
+}
+
+// Save stores a copy of the checkpoint.
+func (store *MemoryCheckpointStore) Save(checkpoint *Checkpoint) error {
+	if checkpoint == nil || checkpoint.RunID == "" {
+		return errors.New("checkpoint has no run ID")
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.checkpoints == nil {
+		store.checkpoints = make(map[string]Checkpoint)
+	}
+	store.checkpoints[checkpoint.RunID] = checkpoint.clone()
+	return nil
+}
+
+// Load returns a copy of the checkpoint of the run.
+func (store *MemoryCheckpointStore) Load(runID string) (*Checkpoint, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	checkpoint, ok := store.checkpoints[runID]
+	if !ok {
+		return nil, ErrCheckpointNotFound
+	}
+	cloned := checkpoint.clone()
+	return &cloned, nil
+}
+
+// Delete removes the checkpoint of the run.
+func (store *MemoryCheckpointStore) Delete(runID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.checkpoints, runID)
+	return nil
+}
+
+// clone returns a copy of the checkpoint whose contexts have their own Variables maps.
+func (checkpoint *Checkpoint) clone() Checkpoint {
+	cloned := *checkpoint
+	cloned.Context = checkpoint.Context.copy()
+	cloned.Context.Think = checkpoint.Context.Think
+	if checkpoint.Completed != nil {
+		cloned.Completed = make(map[string]FlowContext, len(checkpoint.Completed))
+		for name, result := range checkpoint.Completed {
+			copied := result.copy()
+			copied.Think = result.Think
+			cloned.Completed[name] = copied
+		}
+	}
+	return cloned
+}
+
+// FileCheckpointStore saves each checkpoint as a JSON file named after the run ID in a directory, so runs can be resumed after the process restarted.
+// The values of Memory and Variables must be serializable to JSON.
+type FileCheckpointStore struct {
+	Dir string
+}
+
+// NewFileCheckpointStore creates a FileCheckpointStore and the directory if it doesn't exist.
+func NewFileCheckpointStore(dir string) (*FileCheckpointStore, error) {
+	if dir == "" {
+		return nil, errors.New("checkpoint directory cannot be empty")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileCheckpointStore{Dir: dir}, nil
+}
+
+// path returns the file of the run. Run IDs containing path separators are rejected.
+func (store *FileCheckpointStore) path(runID string) (string, error) {
+	return jsonFilePath(store.Dir, "run ID", runID)
+}
+
+// jsonFilePath returns the JSON file named after the ID in the directory. IDs containing path separators are rejected, kind names the ID in the error.
+func jsonFilePath(dir string, kind string, id string) (string, error) {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return "", fmt.Errorf("invalid %s %q", kind, id)
+	}
+	return filepath.Join(dir, id+".json"), nil
+}
+
+// writeFileAtomic writes the data to a temporary file in the directory and renames it to the path, so a crash while writing doesn't corrupt the previous content.
+func writeFileAtomic(dir string, path string, id string, data []byte) error {
+	file, err := os.CreateTemp(dir, id+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+// Save writes the checkpoint to a temporary file and renames it, so a crash while saving doesn't corrupt the previous checkpoint.
+func (store *FileCheckpointStore) Save(checkpoint *Checkpoint) error {
+	if checkpoint == nil {
+		return errors.New("checkpoint is nil")
+	}
+	path, err := store.path(checkpoint.RunID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(store.Dir, path, checkpoint.RunID, data)
+}
+
+// Load reads the checkpoint of the run.
+func (store *FileCheckpointStore) Load(runID string) (*Checkpoint, error) {
+	path, err := store.path(runID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrCheckpointNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+	}
+	return &checkpoint, nil
+}
+
+// Delete removes the checkpoint file of the run.
+func (store *FileCheckpointStore) Delete(runID string) error {
+	path, err := store.path(runID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
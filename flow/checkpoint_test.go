@@ -0,0 +1,185 @@
+package flow
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failOnce returns a step function which fails on its first run and appends the suffix afterwards. runs counts the runs.
+func failOnce(suffix string, runs *int) func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+	return func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+		*runs++
+		if *runs == 1 {
+			return nil, errors.New("model unavailable")
+		}
+		flowContext.Text += suffix
+		return &flowContext, nil
+	}
+}
+
+// countRuns wraps a step function and counts its runs.
+func countRuns(run func(flowContext FlowContext, step *Step) (*FlowContext, error), runs *int) func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+	return func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+		*runs++
+		return run(flowContext, step)
+	}
+}
+
+func TestFlow_Resume(t *testing.T) {
+	firstRuns, secondRuns, thirdRuns := 0, 0, 0
+	flow, _ := NewFlow(nil, "batch",
+		newNamedStep("first", countRuns(func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+			flowContext.Text += "1"
+			flowContext.SetVariable("expensive", "result")
+			return &flowContext, nil
+		}, &firstRuns)),
+		newNamedStep("second", failOnce("2", &secondRuns)),
+		newNamedStep("third", countRuns(appendText("3"), &thirdRuns)),
+	)
+	flow.Checkpoints = NewMemoryCheckpointStore()
+
+	_, err := flow.Run(FlowContext{Text: "0"})
+
+	var runErr *RunError
+	require.ErrorAs(t, err, &runErr)
+	assert.NotEmpty(t, runErr.RunID)
+	assert.EqualError(t, err, "run "+runErr.RunID+" failed: model unavailable")
+
+	checkpoint, err := flow.Checkpoints.Load(runErr.RunID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, checkpoint.NextStep)
+	assert.Equal(t, "01", checkpoint.Context.Text)
+	assert.False(t, checkpoint.Done)
+
+	result, err := flow.Resume(runErr.RunID)
+
+	require.NoError(t, err)
+	assert.Equal(t, "0123", result.Text)
+	assert.Equal(t, "result", result.Variables["expensive"])
+	assert.Equal(t, runErr.RunID, result.RunID)
+	assert.Same(t, flow, result.Flow)
+	assert.Equal(t, 1, firstRuns)
+	assert.Equal(t, 2, secondRuns)
+
+	// A finished run returns its result without running steps again
+	result, err = flow.Resume(runErr.RunID)
+	require.NoError(t, err)
+	assert.Equal(t, "0123", result.Text)
+	assert.Equal(t, 1, thirdRuns)
+}
+
+func TestFlow_Resume_FirstStepFailed(t *testing.T) {
+	firstRuns := 0
+	flow, _ := NewFlow(nil, "batch", newNamedStep("first", failOnce("1", &firstRuns)), newNamedStep("second", appendText("2")))
+	flow.Checkpoints = NewMemoryCheckpointStore()
+
+	_, err := flow.Run(FlowContext{Text: "0", Variables: map[string]any{"input": "x"}})
+	var runErr *RunError
+	require.ErrorAs(t, err, &runErr)
+
+	result, err := flow.Resume(runErr.RunID)
+
+	require.NoError(t, err)
+	assert.Equal(t, "012", result.Text)
+	assert.Equal(t, "x", result.Variables["input"])
+	assert.Equal(t, 2, firstRuns)
+
+	// DAG flows whose only running step fails can be resumed as well
+	aRuns := 0
+	dag, _ := NewFlow(nil, "dag", newDAGStep("a", nil, failOnce("a", &aRuns)), newDAGStep("b", []string{"a"}, appendText("b")))
+	dag.Checkpoints = NewMemoryCheckpointStore()
+	_, err = dag.Run(FlowContext{Text: "0"})
+	require.ErrorAs(t, err, &runErr)
+
+	result, err = dag.Resume(runErr.RunID)
+
+	require.NoError(t, err)
+	assert.Equal(t, "0ab", result.Text)
+}
+
+func TestFlow_Resume_FileStoreAfterRestart(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "checkpoints")
+	newBatchFlow := func(secondRuns *int) *Flow {
+		store, err := NewFileCheckpointStore(dir)
+		require.NoError(t, err)
+		flow, _ := NewFlow(nil, "batch",
+			newNamedStep("first", func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+				flowContext.SetVariable("count", 2)
+				flowContext.Memory = map[string]any{"topic": "go"}
+				return &flowContext, nil
+			}),
+			newNamedStep("second", failOnce("!", secondRuns)),
+		)
+		flow.Checkpoints = store
+		return flow
+	}
+
+	secondRuns := 0
+	_, err := newBatchFlow(&secondRuns).Run(FlowContext{Text: "job", RunID: "job-42"})
+	assert.EqualError(t, err, "run job-42 failed: model unavailable")
+	assert.FileExists(t, filepath.Join(dir, "job-42.json"))
+
+	// A new flow instance, as after a restart of the process
+	result, err := newBatchFlow(&secondRuns).Resume("job-42")
+
+	require.NoError(t, err)
+	assert.Equal(t, "job!", result.Text)
+	assert.Equal(t, 2.0, result.Variables["count"])
+	assert.Equal(t, map[string]any{"topic": "go"}, result.Memory)
+
+	store := &FileCheckpointStore{Dir: dir}
+	require.NoError(t, store.Delete("job-42"))
+	require.NoError(t, store.Delete("job-42"))
+	_, err = store.Load("job-42")
+	assert.ErrorIs(t, err, ErrCheckpointNotFound)
+	entries, _ := os.ReadDir(dir)
+	assert.Empty(t, entries)
+}
+
+func TestFlow_Resume_DAG(t *testing.T) {
+	aRuns, bRuns := 0, 0
+	flow, _ := NewFlow(nil, "dag",
+		newDAGStep("a", nil, countRuns(appendText("a"), &aRuns)),
+		newDAGStep("b", nil, failOnce("b", &bRuns)),
+		newDAGStep("c", []string{"a", "b"}, appendText("c")),
+	)
+	flow.MaxParallelism = 1
+	flow.Checkpoints = NewMemoryCheckpointStore()
+
+	_, err := flow.Run(FlowContext{RunID: "dag-run"})
+	assert.EqualError(t, err, "run dag-run failed: step b failed: model unavailable")
+
+	result, err := flow.Resume("dag-run")
+
+	require.NoError(t, err)
+	assert.Equal(t, "a\n\nbc", result.Text)
+	assert.Equal(t, 1, aRuns)
+	assert.Equal(t, 2, bRuns)
+}
+
+func TestFlow_Resume_Errors(t *testing.T) {
+	flow, _ := NewFlow(nil, "plain", newNamedStep("a", appendText("")))
+	_, err := flow.Resume("run")
+	assert.EqualError(t, err, "flow plain has no checkpoint store")
+
+	flow.Checkpoints = NewMemoryCheckpointStore()
+	_, err = flow.Resume("missing")
+	assert.ErrorIs(t, err, ErrCheckpointNotFound)
+
+	other, _ := NewFlow(nil, "other", newNamedStep("a", appendText("")))
+	other.Checkpoints = flow.Checkpoints
+	_, err = other.Run(FlowContext{RunID: "run"})
+	require.NoError(t, err)
+	_, err = flow.Resume("run")
+	assert.EqualError(t, err, "run run belongs to flow other")
+
+	store := &FileCheckpointStore{Dir: t.TempDir()}
+	assert.EqualError(t, store.Save(&Checkpoint{RunID: "../escape"}), `invalid run ID "../escape"`)
+	_, err = NewFileCheckpointStore("")
+	assert.Error(t, err)
+}
@@ -0,0 +1,89 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// EndStep can be used as the target of Next, OnSuccess, OnFailure and Goto to end the flow successfully.
+	EndStep = "$end"
+
+	// DefaultMaxStepRuns is the number of step runs a flow may run on top of one run per step if MaxStepRuns is not set. Flows without jumps back never reach the limit.
+	DefaultMaxStepRuns = 100
+)
+
+// nextStep returns the step to continue with after the step succeeded, or an empty string to continue with the following step.
+// The Goto and Stop signals of the result are consumed, so they don't affect the steps after the jump or the caller of the flow.
+func nextStep(step *Step, result *FlowContext) string {
+	target := step.successTarget()
+	if result == nil {
+		return target
+	}
+
+	switch {
+	case result.Stop:
+		target = EndStep
+	case result.Goto != "":
+		target = result.Goto
+	}
+	result.Stop = false
+	result.Goto = ""
+	// The error of an earlier failed step is only visible to the step handling it
+	result.LastError = ""
+	return target
+}
+
+// successTarget returns the step configured to run after the step succeeded.
+func (step *Step) successTarget() string {
+	if step.OnSuccess != "" {
+		return step.OnSuccess
+	}
+	return step.Next
+}
+
+// stepIndex returns the index of the first step with the name, or -1 if there is no such step.
+func (flow *Flow) stepIndex(name string) int {
+	for i, step := range flow.Steps {
+		if step.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// validateTransitions checks that the steps referenced by Next, OnSuccess and OnFailure exist and that their names are unique.
+func (flow *Flow) validateTransitions() error {
+	hasTransitions := false
+	for _, step := range flow.Steps {
+		if step.Next != "" || step.OnSuccess != "" || step.OnFailure != "" {
+			hasTransitions = true
+			break
+		}
+	}
+	if !hasTransitions {
+		return nil
+	}
+	if flow.isDAG() {
+		return errors.New("next, onSuccess and onFailure cannot be used in flows whose steps declare dependencies")
+	}
+
+	names := map[string]bool{}
+	for _, step := range flow.Steps {
+		if step.Name == "" {
+			continue
+		}
+		if names[step.Name] {
+			return fmt.Errorf("duplicate step name %s", step.Name)
+		}
+		names[step.Name] = true
+	}
+	for _, step := range flow.Steps {
+		for _, target := range []string{step.Next, step.OnSuccess, step.OnFailure} {
+			if target != "" && target != EndStep && !names[target] {
+				return fmt.Errorf("step %s refers to unknown step %s", step.Name, target)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newNamedStep(name string, run func(flowContext FlowContext, step *Step) (*FlowContext, error)) Step {
+	step := NewStep(MockExecutor{Mock: run}, nil, nil)
+	step.Name = name
+	return *step
+}
+
+func TestFlow_Run_NextSkipsSteps(t *testing.T) {
+	first := newNamedStep("first", appendText("1"))
+	first.Next = "third"
+	flow, _ := NewFlow(nil, "jump",
+		first,
+		newNamedStep("second", appendText("2")),
+		newNamedStep("third", appendText("3")),
+	)
+
+	result, err := flow.Run(FlowContext{})
+
+	require.NoError(t, err)
+	assert.Equal(t, "13", result.Text)
+}
+
+func TestFlow_Run_ReviewAndReviseLoop(t *testing.T) {
+	review := NewStep(MockExecutor{Mock: appendText("")}, MockValidator{Mock: func(output string, step *Step) bool {
+		return len(output) >= 3
+	}}, nil)
+	review.Name = "review"
+	review.MaxRetryTimes = 0
+	review.OnSuccess = "publish"
+	review.OnFailure = "revise"
+
+	lastErrors := []string{}
+	revise := newNamedStep("revise", func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+		lastErrors = append(lastErrors, flowContext.LastError)
+		flowContext.Text += "+"
+		return &flowContext, nil
+	})
+	revise.Next = "review"
+
+	flow, _ := NewFlow(nil, "loop",
+		*review,
+		revise,
+		newNamedStep("publish", func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+			assert.Empty(t, flowContext.LastError)
+			flowContext.Text = "published " + flowContext.Text
+			return &flowContext, nil
+		}),
+	)
+
+	result, err := flow.Run(FlowContext{Text: "a"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "published a++", result.Text)
+	assert.Equal(t, []string{"step retry times exceeded", "step retry times exceeded"}, lastErrors)
+}
+
+func TestFlow_Run_ExecutorSignals(t *testing.T) {
+	flow, _ := NewFlow(nil, "signals",
+		newNamedStep("start", func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+			flowContext.Text += "s"
+			flowContext.Goto = "finish"
+			return &flowContext, nil
+		}),
+		newNamedStep("skipped", appendText("x")),
+		newNamedStep("finish", func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+			flowContext.Text += "f"
+			flowContext.Stop = true
+			return &flowContext, nil
+		}),
+		newNamedStep("after", appendText("x")),
+	)
+
+	result, err := flow.Run(FlowContext{})
+
+	require.NoError(t, err)
+	assert.Equal(t, "sf", result.Text)
+	assert.False(t, result.Stop)
+	assert.Empty(t, result.Goto)
+}
+
+func TestFlow_Run_EndStepAndFailure(t *testing.T) {
+	failing := newNamedStep("failing", func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+		return nil, errors.New("boom")
+	})
+	failing.OnFailure = "handle"
+	handle := newNamedStep("handle", func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+		flowContext.Text = "handled " + flowContext.LastError
+		return &flowContext, nil
+	})
+	handle.Next = EndStep
+
+	flow, _ := NewFlow(nil, "failure", failing, handle, newNamedStep("unreached", appendText("x")))
+	result, err := flow.Run(FlowContext{})
+
+	require.NoError(t, err)
+	assert.Equal(t, "handled boom", result.Text)
+}
+
+func TestFlow_Run_MaxStepRuns(t *testing.T) {
+	loop := newNamedStep("loop", appendText("."))
+	loop.Next = "loop"
+	flow, _ := NewFlow(nil, "endless", loop)
+	flow.MaxStepRuns = 5
+
+	_, err := flow.Run(FlowContext{})
+
+	assert.EqualError(t, err, "flow endless exceeded the maximum of 5 step runs")
+}
+
+func TestFlow_Run_LongLinearFlow(t *testing.T) {
+	steps := make([]Step, DefaultMaxStepRuns+50)
+	for i := range steps {
+		steps[i] = newNamedStep(fmt.Sprintf("step%d", i), appendText("."))
+	}
+	flow, _ := NewFlow(nil, "long", steps...)
+
+	result, err := flow.Run(FlowContext{})
+
+	require.NoError(t, err)
+	assert.Len(t, result.Text, len(steps))
+
+	// Loops still stop after DefaultMaxStepRuns runs on top of one run per step
+	steps[len(steps)-1].Next = "step0"
+	flow, _ = NewFlow(nil, "long", steps...)
+	_, err = flow.Run(FlowContext{})
+	assert.EqualError(t, err, fmt.Sprintf("flow long exceeded the maximum of %d step runs", len(steps)+DefaultMaxStepRuns))
+}
+
+func TestFlow_Run_InvalidTransitions(t *testing.T) {
+	step := newNamedStep("a", appendText(""))
+	step.Next = "missing"
+	flow, _ := NewFlow(nil, "invalid", step)
+	_, err := flow.Run(FlowContext{})
+	assert.EqualError(t, err, "step a refers to unknown step missing")
+
+	step.Next = "a"
+	flow, _ = NewFlow(nil, "invalid", step, newNamedStep("a", appendText("")))
+	_, err = flow.Run(FlowContext{})
+	assert.EqualError(t, err, "duplicate step name a")
+
+	goTo := newNamedStep("a", func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+		flowContext.Goto = "missing"
+		return &flowContext, nil
+	})
+	flow, _ = NewFlow(nil, "invalid", goTo)
+	_, err = flow.Run(FlowContext{})
+	assert.EqualError(t, err, "step missing not found")
+
+	dag := newDAGStep("b", []string{"a"}, appendText(""))
+	dag.Next = EndStep
+	flow, _ = NewFlow(nil, "invalid", newDAGStep("a", nil, appendText("")), dag)
+	_, err = flow.Run(FlowContext{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,247 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jieliu2000/anyi/llm"
+	"github.com/jieliu2000/anyi/llm/chat"
+)
+
+// DefaultSummaryPrompt is the instruction SummaryPolicy sends to the model if Prompt is not set.
+const DefaultSummaryPrompt = "Summarize the following conversation in a few sentences. Keep the facts, names, decisions and open questions which are needed to continue the conversation. Reply with the summary only."
+
+// Conversation is the message history of a multi-turn dialog. It's attached to the flow context as FlowContext.Conversation, so steps taking part in the dialog send the earlier exchanges to the model and later steps can read them.
+// Steps must not change a Conversation they received. They create a changed copy with Clone and set it on their result instead, so retries and resumed runs start from the history they were given.
+type Conversation struct {
+	// Messages holds the exchanges of the dialog, oldest first. It doesn't contain system messages.
+	Messages []chat.Message `json:"messages,omitempty"`
+	// Summary holds a summary of earlier messages which were removed by a [SummaryPolicy].
+	Summary string `json:"summary,omitempty"`
+}
+
+// Clone returns a copy of the conversation with its own message slice. Cloning a nil conversation returns an empty one.
+func (conversation *Conversation) Clone() *Conversation {
+	if conversation == nil {
+		return &Conversation{}
+	}
+	return &Conversation{
+		Messages: append([]chat.Message(nil), conversation.Messages...),
+		Summary:  conversation.Summary,
+	}
+}
+
+// Append adds messages to the end of the conversation.
+func (conversation *Conversation) Append(messages ...chat.Message) {
+	conversation.Messages = append(conversation.Messages, messages...)
+}
+
+// ModelMessages returns the messages sent to the model: the summary as a system message if there is one, followed by the messages of the conversation.
+func (conversation *Conversation) ModelMessages() []chat.Message {
+	if conversation == nil {
+		return nil
+	}
+	messages := make([]chat.Message, 0, len(conversation.Messages)+1)
+	if conversation.Summary != "" {
+		messages = append(messages, chat.NewSystemMessage("Summary of the earlier conversation:\n"+conversation.Summary))
+	}
+	return append(messages, conversation.Messages...)
+}
+
+// Transcript returns the conversation as text, one "role: content" paragraph per message, preceded by the summary if there is one. It's meant for prompt templates, for example {{.Conversation.Transcript}}.
+func (conversation *Conversation) Transcript() string {
+	if conversation == nil {
+		return ""
+	}
+	var parts []string
+	if conversation.Summary != "" {
+		parts = append(parts, "summary: "+conversation.Summary)
+	}
+	for _, message := range conversation.Messages {
+		parts = append(parts, message.Role+": "+messageText(message))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// messageText returns the content of the message, or the text of its content parts.
+func messageText(message chat.Message) string {
+	if message.Content != "" || len(message.ContentParts) == 0 {
+		return message.Content
+	}
+	var texts []string
+	for _, part := range message.ContentParts {
+		if part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// ConversationPolicy decides which messages of a conversation are kept before the conversation is sent to the model.
+// Apply is called on a copy of the conversation with the new user message appended, and changes it in place. The last message must be kept.
+type ConversationPolicy interface {
+	Apply(ctx context.Context, conversation *Conversation, client llm.Client) error
+}
+
+// TokenCounter returns the number of tokens of a text.
+type TokenCounter func(text string) int
+
+// EstimateTokens estimates the number of tokens of a text as one token per four characters, which is close for English text and most models.
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// messageTokens estimates the tokens of a message including a small overhead for the role.
+func messageTokens(message chat.Message, count TokenCounter) int {
+	return count(messageText(message)) + 4
+}
+
+// BufferPolicy keeps the whole conversation.
+type BufferPolicy struct {
+}
+
+// Apply keeps all messages.
+func (policy *BufferPolicy) Apply(ctx context.Context, conversation *Conversation, client llm.Client) error {
+	return nil
+}
+
+// WindowPolicy keeps the most recent messages of the conversation. Older messages are dropped.
+// If both limits are set, both apply. The newest message is always kept, and the kept messages never start with an answer of the model, since some providers require the first message to come from the user.
+type WindowPolicy struct {
+	// The maximum number of messages to keep. Zero means no limit.
+	MaxMessages int `json:"maxMessages" yaml:"maxMessages" mapstructure:"maxMessages"`
+	// The maximum number of tokens of the kept messages. Zero means no limit.
+	MaxTokens int `json:"maxTokens" yaml:"maxTokens" mapstructure:"maxTokens"`
+	// CountTokens counts the tokens of a message. Defaults to EstimateTokens.
+	CountTokens TokenCounter `json:"-" yaml:"-" mapstructure:"-"`
+}
+
+// Apply drops the oldest messages until the conversation fits the limits.
+func (policy *WindowPolicy) Apply(ctx context.Context, conversation *Conversation, client llm.Client) error {
+	conversation.Messages = conversation.Messages[policy.keepFrom(conversation.Messages):]
+	return nil
+}
+
+// keepFrom returns the index of the first message which is kept.
+func (policy *WindowPolicy) keepFrom(messages []chat.Message) int {
+	count := policy.CountTokens
+	if count == nil {
+		count = EstimateTokens
+	}
+
+	start := 0
+	if policy.MaxMessages > 0 && len(messages) > policy.MaxMessages {
+		start = len(messages) - policy.MaxMessages
+	}
+	if policy.MaxTokens > 0 {
+		tokens := 0
+		for i := len(messages) - 1; i >= start; i-- {
+			tokens += messageTokens(messages[i], count)
+			if tokens > policy.MaxTokens && i < len(messages)-1 {
+				start = i + 1
+				break
+			}
+		}
+	}
+	for start < len(messages)-1 && messages[start].Role != "user" {
+		start++
+	}
+	return start
+}
+
+// SummaryPolicy compacts the conversation by asking a model to summarize older messages once the conversation exceeds a limit.
+// The summary is kept in Conversation.Summary and sent to the model as a system message, followed by the KeepMessages most recent messages.
+type SummaryPolicy struct {
+	// The number of messages at which the conversation is compacted. Zero means no limit. If neither MaxMessages nor MaxTokens is set, the conversation is compacted at 20 messages.
+	MaxMessages int `json:"maxMessages" yaml:"maxMessages" mapstructure:"maxMessages"`
+	// The number of tokens at which the conversation is compacted. Zero means no limit.
+	MaxTokens int `json:"maxTokens" yaml:"maxTokens" mapstructure:"maxTokens"`
+	// The number of recent messages which are kept as they are. Defaults to 4.
+	KeepMessages int `json:"keepMessages" yaml:"keepMessages" mapstructure:"keepMessages"`
+	// The instruction for the summary. Defaults to DefaultSummaryPrompt.
+	Prompt string `json:"prompt" yaml:"prompt" mapstructure:"prompt"`
+
+	// Client is the client writing the summaries. If it's nil, the client of the step is used.
+	Client llm.Client `json:"-" yaml:"-" mapstructure:"-"`
+	// CountTokens counts the tokens of a message. Defaults to EstimateTokens.
+	CountTokens TokenCounter `json:"-" yaml:"-" mapstructure:"-"`
+}
+
+// Apply summarizes the older messages if the conversation exceeds MaxMessages or MaxTokens.
+func (policy *SummaryPolicy) Apply(ctx context.Context, conversation *Conversation, client llm.Client) error {
+	if !policy.exceeded(conversation.Messages) {
+		return nil
+	}
+	keep := policy.KeepMessages
+	if keep <= 0 {
+		keep = 4
+	}
+	cut := len(conversation.Messages) - keep
+	if cut < 0 {
+		cut = 0
+	}
+	// Keep the messages starting with a message of the user, like WindowPolicy
+	for cut < len(conversation.Messages)-1 && conversation.Messages[cut].Role != "user" {
+		cut++
+	}
+	if cut == 0 {
+		return nil
+	}
+
+	if policy.Client != nil {
+		client = policy.Client
+	}
+	if client == nil {
+		return errors.New("no client set to summarize the conversation")
+	}
+	summary, err := policy.summarize(ctx, client, conversation.Summary, conversation.Messages[:cut])
+	if err != nil {
+		return fmt.Errorf("failed to summarize the conversation: %w", err)
+	}
+	conversation.Summary = summary
+	conversation.Messages = append([]chat.Message(nil), conversation.Messages[cut:]...)
+	return nil
+}
+
+// exceeded returns true if the messages exceed the limits of the policy.
+func (policy *SummaryPolicy) exceeded(messages []chat.Message) bool {
+	maxMessages := policy.MaxMessages
+	if maxMessages <= 0 && policy.MaxTokens <= 0 {
+		maxMessages = 20
+	}
+	if maxMessages > 0 && len(messages) > maxMessages {
+		return true
+	}
+	if policy.MaxTokens > 0 {
+		count := policy.CountTokens
+		if count == nil {
+			count = EstimateTokens
+		}
+		tokens := 0
+		for _, message := range messages {
+			tokens += messageTokens(message, count)
+		}
+		return tokens > policy.MaxTokens
+	}
+	return false
+}
+
+// summarize asks the model for a summary of the previous summary and the messages.
+func (policy *SummaryPolicy) summarize(ctx context.Context, client llm.Client, previous string, messages []chat.Message) (string, error) {
+	prompt := policy.Prompt
+	if prompt == "" {
+		prompt = DefaultSummaryPrompt
+	}
+	transcript := (&Conversation{Summary: previous, Messages: messages}).Transcript()
+	output, _, err := llm.ChatContext(ctx, client, []chat.Message{
+		chat.NewSystemMessage(prompt),
+		chat.NewUserMessage(transcript),
+	}, nil)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(output.Content), nil
+}
@@ -0,0 +1,92 @@
+package flow
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jieliu2000/anyi/internal/test"
+	"github.com/jieliu2000/anyi/llm/chat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDialog returns a conversation of the given number of exchanges, "q1", "a1", "q2", "a2" and so on.
+func newDialog(exchanges int) *Conversation {
+	conversation := &Conversation{}
+	for i := 1; i <= exchanges; i++ {
+		conversation.Append(chat.NewUserMessage("q"+string(rune('0'+i))), chat.NewAssistantMessage("a"+string(rune('0'+i))))
+	}
+	return conversation
+}
+
+func contents(messages []chat.Message) []string {
+	var result []string
+	for _, message := range messages {
+		result = append(result, message.Content)
+	}
+	return result
+}
+
+func TestConversation_CloneAndTranscript(t *testing.T) {
+	var empty *Conversation
+	assert.Equal(t, &Conversation{}, empty.Clone())
+	assert.Equal(t, "", empty.Transcript())
+
+	conversation := newDialog(1)
+	conversation.Summary = "greeting"
+	clone := conversation.Clone()
+	clone.Append(chat.NewUserMessage("q2"))
+
+	assert.Len(t, conversation.Messages, 2)
+	assert.Equal(t, "summary: greeting\n\nuser: q1\n\nassistant: a1", conversation.Transcript())
+	assert.Equal(t, []chat.Message{
+		chat.NewSystemMessage("Summary of the earlier conversation:\ngreeting"),
+		chat.NewUserMessage("q1"),
+		chat.NewAssistantMessage("a1"),
+	}, conversation.ModelMessages())
+}
+
+func TestWindowPolicy(t *testing.T) {
+	conversation := newDialog(3)
+	conversation.Append(chat.NewUserMessage("q4"))
+
+	require.NoError(t, (&WindowPolicy{MaxMessages: 4}).Apply(context.Background(), conversation, nil))
+	assert.Equal(t, []string{"q3", "a3", "q4"}, contents(conversation.Messages), "the kept messages start with a user message")
+
+	// Each message counts 1 token for its content and 4 for the role
+	conversation = newDialog(3)
+	conversation.Append(chat.NewUserMessage("q4"))
+	require.NoError(t, (&WindowPolicy{MaxTokens: 16}).Apply(context.Background(), conversation, nil))
+	assert.Equal(t, []string{"q3", "a3", "q4"}, contents(conversation.Messages))
+
+	// The newest message is kept even if it exceeds the budget
+	conversation = &Conversation{Messages: []chat.Message{chat.NewUserMessage("a long question which doesn't fit")}}
+	require.NoError(t, (&WindowPolicy{MaxTokens: 1}).Apply(context.Background(), conversation, nil))
+	assert.Len(t, conversation.Messages, 1)
+
+	conversation = newDialog(3)
+	require.NoError(t, (&BufferPolicy{}).Apply(context.Background(), conversation, nil))
+	assert.Len(t, conversation.Messages, 6)
+}
+
+func TestSummaryPolicy(t *testing.T) {
+	client := &test.SequenceClient{Outputs: []string{"The user asked q1 and q2."}}
+	policy := &SummaryPolicy{MaxMessages: 4, KeepMessages: 2}
+
+	conversation := newDialog(2)
+	require.NoError(t, policy.Apply(context.Background(), conversation, client))
+	assert.Empty(t, client.Messages, "the conversation doesn't exceed the limit yet")
+
+	conversation.Summary = "Earlier, the user said hello."
+	conversation.Append(chat.NewUserMessage("q3"))
+	require.NoError(t, policy.Apply(context.Background(), conversation, client))
+
+	assert.Equal(t, "The user asked q1 and q2.", conversation.Summary)
+	assert.Equal(t, []string{"q3"}, contents(conversation.Messages), "the kept messages start with a user message")
+	require.Len(t, client.Messages, 1)
+	assert.Equal(t, DefaultSummaryPrompt, client.Messages[0][0].Content)
+	assert.Equal(t, "summary: Earlier, the user said hello.\n\nuser: q1\n\nassistant: a1\n\nuser: q2\n\nassistant: a2", client.Messages[0][1].Content)
+
+	err := (&SummaryPolicy{MaxMessages: 1, KeepMessages: 1}).Apply(context.Background(), newDialog(2), nil)
+	assert.EqualError(t, err, "no client set to summarize the conversation")
+}
@@ -0,0 +1,295 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// JoinMode defines how the results of the dependencies of a step are merged into the input of the step when a flow runs as a DAG.
+//
+// All modes merge Variables and Memory the same way:
+//   - Variables start from the variables the flow was started with. Each dependency, in the order of DependsOn, adds the variables it set or changed, so if several branches change the same variable the one listed last wins.
+//   - Memory is the memory of the last dependency in DependsOn which changed it, or the initial memory if no branch changed it.
+//
+// The modes only differ in how Text is merged.
+type JoinMode string
+
+const (
+	// JoinConcat joins the non-empty texts of the dependencies in the order of DependsOn, separated by a blank line. This is the default.
+	JoinConcat JoinMode = "concat"
+	// JoinLast uses the text of the dependency listed last in DependsOn.
+	JoinLast JoinMode = "last"
+	// JoinJSON sets the text to a JSON object mapping the name of each dependency to its text.
+	JoinJSON JoinMode = "json"
+)
+
+// dagNode is a step of a DAG flow with the indexes of the steps it depends on and of the steps depending on it.
+type dagNode struct {
+	step       Step
+	name       string
+	deps       []int
+	dependents []int
+}
+
+type dagStepResult struct {
+	index  int
+	result *FlowContext
+	err    error
+}
+
+// isDAG returns true if any step declares dependencies.
+func (flow *Flow) isDAG() bool {
+	for _, step := range flow.Steps {
+		if len(step.DependsOn) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// buildDAG resolves the dependencies of the steps and checks that the steps form an acyclic graph.
+func (flow *Flow) buildDAG() ([]*dagNode, error) {
+	nodes := make([]*dagNode, len(flow.Steps))
+	indexes := map[string]int{}
+	for i, step := range flow.Steps {
+		nodes[i] = &dagNode{step: step, name: step.Name}
+		if step.Name == "" {
+			nodes[i].name = strconv.Itoa(i)
+			continue
+		}
+		if _, exists := indexes[step.Name]; exists {
+			return nil, fmt.Errorf("duplicate step name %s", step.Name)
+		}
+		indexes[step.Name] = i
+	}
+
+	for i, node := range nodes {
+		switch node.step.Join {
+		case "", JoinConcat, JoinLast, JoinJSON:
+		default:
+			return nil, fmt.Errorf("step %s has unknown join mode %s", node.name, node.step.Join)
+		}
+		for _, dependency := range node.step.DependsOn {
+			dep, ok := indexes[dependency]
+			if !ok {
+				return nil, fmt.Errorf("step %s depends on unknown step %s", node.name, dependency)
+			}
+			node.deps = append(node.deps, dep)
+			nodes[dep].dependents = append(nodes[dep].dependents, i)
+		}
+	}
+
+	// Kahn's algorithm: if not all steps can be sorted, the remaining ones form a cycle
+	pending := make([]int, len(nodes))
+	ready := []int{}
+	for i, node := range nodes {
+		pending[i] = len(node.deps)
+		if pending[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	sorted := 0
+	for len(ready) > 0 {
+		current := ready[0]
+		ready = ready[1:]
+		sorted++
+		for _, dependent := range nodes[current].dependents {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+	if sorted != len(nodes) {
+		return nil, errors.New("steps have cyclic dependencies")
+	}
+	return nodes, nil
+}
+
+// runDAG runs the steps as soon as their dependencies finished. If a step fails, the steps still running are cancelled and the error is returned.
+// The result is the context of the step no other step depends on. If there are several such steps, their results are joined with JoinConcat.
+// Steps recorded as completed in the checkpoint are not run again.
+func (flow *Flow) runDAG(ctx context.Context, initial *FlowContext, state *Checkpoint) (*FlowContext, error) {
+	nodes, err := flow.buildDAG()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	limit := flow.MaxParallelism
+	if limit <= 0 {
+		limit = len(nodes)
+	}
+
+	results := make([]*FlowContext, len(nodes))
+	pending := make([]int, len(nodes))
+	for i, node := range nodes {
+		pending[i] = len(node.deps)
+	}
+	completed := 0
+	for i, node := range nodes {
+		if result, ok := state.Completed[node.name]; ok {
+			result.Flow = flow
+			results[i] = &result
+			completed++
+			for _, dependent := range node.dependents {
+				pending[dependent]--
+			}
+		}
+	}
+	ready := []int{}
+	for i := range nodes {
+		if pending[i] == 0 && results[i] == nil {
+			ready = append(ready, i)
+		}
+	}
+	if state.Completed == nil {
+		state.Completed = make(map[string]FlowContext, len(nodes))
+	}
+	state.Context = *initial
+
+	log.Debug("Starting run flow ", flow.Name, " as DAG with ", len(nodes), " steps.")
+	finished := make(chan dagStepResult)
+	running := 0
+	var firstErr error
+	for completed < len(nodes) {
+		for firstErr == nil && running < limit && len(ready) > 0 {
+			index := ready[0]
+			ready = ready[1:]
+
+			input := initial.copy()
+			if len(nodes[index].deps) > 0 {
+				input = joinResults(nodes[index].step.Join, initial, nodes, nodes[index].deps, results)
+			}
+
+			running++
+			go func(index int, input FlowContext) {
+				step := nodes[index].step
+				result, err := tryStep(ctx, &step, input)
+				finished <- dagStepResult{index: index, result: result, err: err}
+			}(index, input)
+		}
+
+		if running == 0 {
+			break
+		}
+		stepResult := <-finished
+		running--
+		completed++
+
+		if stepResult.err != nil {
+			var pause *PauseError
+			if errors.As(stepResult.err, &pause) {
+				stepResult.err = errors.New("pausing is not supported in flows whose steps declare dependencies")
+			}
+			if firstErr == nil {
+				firstErr = fmt.Errorf("step %s failed: %w", nodes[stepResult.index].name, stepResult.err)
+				cancel()
+			}
+			continue
+		}
+		extractThink(stepResult.result)
+		results[stepResult.index] = stepResult.result
+
+		if flow.Checkpoints != nil && stepResult.result != nil {
+			state.Completed[nodes[stepResult.index].name] = *stepResult.result
+			if err := flow.saveCheckpoint(state); err != nil && firstErr == nil {
+				firstErr = err
+				cancel()
+			}
+		}
+
+		for _, dependent := range nodes[stepResult.index].dependents {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	sinks := []int{}
+	for i, node := range nodes {
+		if len(node.dependents) == 0 {
+			sinks = append(sinks, i)
+		}
+	}
+	result := results[sinks[0]]
+	if len(sinks) > 1 {
+		joined := joinResults(JoinConcat, initial, nodes, sinks, results)
+		result = &joined
+	}
+
+	state.Context = *result
+	state.Done = true
+	if err := flow.saveCheckpoint(state); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// joinResults merges the results of the given steps into a new context according to the join mode. See [JoinMode] for the semantics.
+func joinResults(mode JoinMode, base *FlowContext, nodes []*dagNode, indexes []int, results []*FlowContext) FlowContext {
+	joined := base.copy()
+
+	texts := make([]string, 0, len(indexes))
+	namedTexts := make(map[string]string, len(indexes))
+	for _, index := range indexes {
+		result := results[index]
+		if result == nil {
+			continue
+		}
+		texts = append(texts, result.Text)
+		namedTexts[nodes[index].name] = result.Text
+
+		for k, v := range result.Variables {
+			if baseValue, exists := base.Variables[k]; !exists || !reflect.DeepEqual(baseValue, v) {
+				joined.Variables[k] = v
+			}
+		}
+		if !reflect.DeepEqual(result.Memory, base.Memory) {
+			joined.Memory = result.Memory
+		}
+	}
+
+	switch mode {
+	case JoinLast:
+		if len(texts) > 0 {
+			joined.Text = texts[len(texts)-1]
+		}
+	case JoinJSON:
+		data, _ := json.Marshal(namedTexts)
+		joined.Text = string(data)
+	default:
+		nonEmpty := make([]string, 0, len(texts))
+		for _, text := range texts {
+			if text != "" {
+				nonEmpty = append(nonEmpty, text)
+			}
+		}
+		joined.Text = strings.Join(nonEmpty, "\n\n")
+	}
+	return joined
+}
+
+// copy returns a copy of the context with its own Variables map, so branches running concurrently don't share it.
+func (fc *FlowContext) copy() FlowContext {
+	copied := *fc
+	copied.Think = ""
+	copied.Variables = make(map[string]any, len(fc.Variables))
+	for k, v := range fc.Variables {
+		copied.Variables[k] = v
+	}
+	return copied
+}
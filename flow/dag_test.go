@@ -0,0 +1,201 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDAGStep(name string, dependsOn []string, run func(flowContext FlowContext, step *Step) (*FlowContext, error)) Step {
+	step := NewStep(MockExecutor{Mock: run}, nil, nil)
+	step.Name = name
+	step.DependsOn = dependsOn
+	return *step
+}
+
+func appendText(suffix string) func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+	return func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+		flowContext.Text += suffix
+		return &flowContext, nil
+	}
+}
+
+func TestFlow_RunDAG_FanOutAndJoin(t *testing.T) {
+	setVariable := func(name string, value any) func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+		return func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+			flowContext.Text = step.Name + ":" + flowContext.Text
+			flowContext.Variables[name] = value
+			return &flowContext, nil
+		}
+	}
+	flow, err := NewFlow(nil, "dag",
+		newDAGStep("a", nil, setVariable("a", 1)),
+		newDAGStep("b", nil, setVariable("shared", "b")),
+		newDAGStep("c", nil, setVariable("c", 3)),
+		newDAGStep("merge", []string{"a", "b", "c"}, appendText("!")),
+	)
+	require.NoError(t, err)
+
+	result, err := flow.Run(FlowContext{Text: "doc", Variables: map[string]any{"shared": "initial"}})
+
+	require.NoError(t, err)
+	assert.Equal(t, "a:doc\n\nb:doc\n\nc:doc!", result.Text)
+	assert.Equal(t, map[string]any{"a": 1, "shared": "b", "c": 3}, result.Variables)
+	assert.Equal(t, "b", flow.Variables["shared"])
+}
+
+func TestFlow_RunDAG_RunsIndependentStepsConcurrently(t *testing.T) {
+	var running, maxRunning int32
+	slow := func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+		current := atomic.AddInt32(&running, 1)
+		for {
+			observed := atomic.LoadInt32(&maxRunning)
+			if current <= observed || atomic.CompareAndSwapInt32(&maxRunning, observed, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return &flowContext, nil
+	}
+
+	steps := []Step{}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		steps = append(steps, newDAGStep(name, nil, slow))
+	}
+	steps = append(steps, newDAGStep("merge", []string{"a", "b", "c", "d"}, appendText("")))
+
+	flow, _ := NewFlow(nil, "dag", steps...)
+	_, err := flow.Run(FlowContext{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(4), maxRunning)
+
+	atomic.StoreInt32(&maxRunning, 0)
+	flow.MaxParallelism = 2
+	_, err = flow.Run(FlowContext{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), maxRunning)
+}
+
+func TestFlow_RunDAG_JoinModes(t *testing.T) {
+	branches := func(join JoinMode) *Flow {
+		merge := newDAGStep("merge", []string{"first", "second"}, appendText(""))
+		merge.Join = join
+		flow, _ := NewFlow(nil, "dag",
+			newDAGStep("first", nil, appendText("1")),
+			newDAGStep("second", nil, appendText("2")),
+			merge,
+		)
+		return flow
+	}
+
+	result, err := branches(JoinLast).Run(FlowContext{Text: "x"})
+	require.NoError(t, err)
+	assert.Equal(t, "x2", result.Text)
+
+	result, err = branches(JoinJSON).Run(FlowContext{Text: "x"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"first":"x1","second":"x2"}`, result.Text)
+
+	_, err = branches("unknown").Run(FlowContext{})
+	assert.EqualError(t, err, "step merge has unknown join mode unknown")
+}
+
+func TestFlow_RunDAG_MultipleSinksAndMemory(t *testing.T) {
+	flow, _ := NewFlow(nil, "dag",
+		newDAGStep("root", nil, appendText("")),
+		newDAGStep("left", []string{"root"}, func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+			flowContext.Text = "left"
+			flowContext.Memory = "updated"
+			return &flowContext, nil
+		}),
+		newDAGStep("right", []string{"root"}, func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+			flowContext.Text = "right"
+			return &flowContext, nil
+		}),
+	)
+
+	result, err := flow.Run(FlowContext{Memory: "initial"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "left\n\nright", result.Text)
+	assert.Equal(t, "updated", result.Memory)
+}
+
+func TestFlow_RunDAG_InvalidGraph(t *testing.T) {
+	flow, _ := NewFlow(nil, "dag", newDAGStep("a", []string{"missing"}, appendText("")))
+	_, err := flow.Run(FlowContext{})
+	assert.EqualError(t, err, "step a depends on unknown step missing")
+
+	flow, _ = NewFlow(nil, "dag",
+		newDAGStep("a", []string{"b"}, appendText("")),
+		newDAGStep("b", []string{"a"}, appendText("")),
+	)
+	_, err = flow.Run(FlowContext{})
+	assert.EqualError(t, err, "steps have cyclic dependencies")
+
+	flow, _ = NewFlow(nil, "dag",
+		newDAGStep("a", nil, appendText("")),
+		newDAGStep("a", []string{"a"}, appendText("")),
+	)
+	_, err = flow.Run(FlowContext{})
+	assert.EqualError(t, err, "duplicate step name a")
+}
+
+func TestFlow_RunDAG_ErrorCancelsRunningSteps(t *testing.T) {
+	var mu sync.Mutex
+	executed := []string{}
+	record := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		executed = append(executed, name)
+	}
+
+	started := make(chan struct{})
+	failing := newDAGStep("failing", nil, func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+		<-started
+		return nil, errors.New("boom")
+	})
+	slow := Step{Name: "slow", Executor: contextFunc(func(ctx context.Context) error {
+		close(started)
+		select {
+		case <-ctx.Done():
+			record("slow cancelled")
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return nil
+		}
+	})}
+	after := newDAGStep("after", []string{"failing", "slow"}, func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+		record("after")
+		return &flowContext, nil
+	})
+
+	flow, _ := NewFlow(nil, "dag", failing, slow, after)
+	_, err := flow.Run(FlowContext{})
+
+	assert.EqualError(t, err, "step failing failed: boom")
+	assert.Equal(t, []string{"slow cancelled"}, executed)
+}
+
+// contextFunc is an executor which runs a function with the context of the flow.
+type contextFunc func(ctx context.Context) error
+
+func (f contextFunc) Init() error { return nil }
+
+func (f contextFunc) Run(flowContext FlowContext, step *Step) (*FlowContext, error) {
+	return f.RunContext(context.Background(), flowContext, step)
+}
+
+func (f contextFunc) RunContext(ctx context.Context, flowContext FlowContext, step *Step) (*FlowContext, error) {
+	if err := f(ctx); err != nil {
+		return nil, err
+	}
+	return &flowContext, nil
+}
@@ -1,10 +1,14 @@
 package flow
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -25,12 +29,56 @@ type Flow struct {
 	ClientImpl llm.Client
 	// Variables are key-value pairs that will be available to all steps in the flow
 	Variables map[string]any
+	// MaxStepRuns limits how many steps a flow runs in total, so jumps back to earlier steps cannot loop forever. Defaults to the number of steps plus DefaultMaxStepRuns.
+	MaxStepRuns int
+	// MaxParallelism limits how many steps of a DAG flow run at the same time. Zero or a negative value means no limit. See [Flow.RunContext].
+	MaxParallelism int
+	// Checkpoints stores the state of runs when they start and after each step so that they can be resumed with [Flow.Resume]. If nil, no checkpoints are saved.
+	Checkpoints CheckpointStore
+	// Sessions stores the memory and conversation of sessions for [Flow.RunWithSession].
+	Sessions MemoryStore
+
+	// variablesMu guards Variables while steps of a DAG flow sync their variables concurrently
+	variablesMu sync.Mutex
 }
 type StepExecutor interface {
 	Init() error
 	Run(flowContext FlowContext, Step *Step) (*FlowContext, error)
 }
 
+// ContextStepExecutor is implemented by executors which support cancellation.
+// When a flow is run with a context, executors implementing this interface receive the context through RunContext so that cancellation and deadlines reach the LLM requests, subprocesses and remote calls they make.
+// Executors which only implement StepExecutor are wrapped with [NewContextStepExecutor].
+type ContextStepExecutor interface {
+	StepExecutor
+	RunContext(ctx context.Context, flowContext FlowContext, Step *Step) (*FlowContext, error)
+}
+
+// contextStepExecutorAdapter adapts a StepExecutor without context support to the ContextStepExecutor interface.
+type contextStepExecutorAdapter struct {
+	StepExecutor
+}
+
+// RunContext checks the context before running the wrapped executor. The executor itself cannot be interrupted once it's started.
+func (adapter *contextStepExecutorAdapter) RunContext(ctx context.Context, flowContext FlowContext, step *Step) (*FlowContext, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return adapter.StepExecutor.Run(flowContext, step)
+}
+
+// NewContextStepExecutor returns a ContextStepExecutor for the executor.
+// If the executor already implements ContextStepExecutor it is returned as is. Otherwise it's wrapped by an adapter which checks the context before calling Run.
+func NewContextStepExecutor(executor StepExecutor) ContextStepExecutor {
+	if executor == nil {
+		return nil
+	}
+	if contextExecutor, ok := executor.(ContextStepExecutor); ok {
+		return contextExecutor
+	}
+	return &contextStepExecutorAdapter{StepExecutor: executor}
+}
+
 // StepValidator is the interface for validators of step output.
 // In a flow if a step validator is set, the output of the step will be checked against the validator's Validate method.
 type StepValidator interface {
@@ -72,6 +120,9 @@ type Step struct {
 	MaxRetryTimes int
 	Name          string
 
+	// The delay before the first retry when the output doesn't pass validation. The delay doubles with each further retry. Zero means the step retries immediately.
+	RetryBackoff time.Duration `json:"retryBackoff,omitempty" yaml:"retryBackoff,omitempty" mapstructure:"retryBackoff,omitempty"`
+
 	// Controls whether variables can be modified during step execution
 	// When true, variables cannot be modified
 	VarsImmutable bool `json:"varsImmutable,omitempty" yaml:"varsImmutable,omitempty" mapstructure:"varsImmutable,omitempty"`
@@ -83,6 +134,19 @@ type Step struct {
 	// Controls whether memory can be modified during step execution
 	// When true, memory cannot be modified
 	MemoryImmutable bool `json:"memoryImmutable,omitempty" yaml:"memoryImmutable,omitempty" mapstructure:"memoryImmutable,omitempty"`
+
+	// Names of the steps this step depends on. If any step of a flow declares dependencies, the flow runs as a DAG and this step starts once all its dependencies finished.
+	DependsOn []string `json:"dependsOn,omitempty" yaml:"dependsOn,omitempty" mapstructure:"dependsOn,omitempty"`
+
+	// Controls how the results of the dependencies are merged into the input of this step. Defaults to JoinConcat. See [JoinMode].
+	Join JoinMode `json:"join,omitempty" yaml:"join,omitempty" mapstructure:"join,omitempty"`
+
+	// The name of the step to run after this one instead of the following step. Use EndStep to end the flow.
+	Next string `json:"next,omitempty" yaml:"next,omitempty" mapstructure:"next,omitempty"`
+	// The name of the step to run after this step succeeded. Takes precedence over Next.
+	OnSuccess string `json:"onSuccess,omitempty" yaml:"onSuccess,omitempty" mapstructure:"onSuccess,omitempty"`
+	// The name of the step to run if this step fails, including when its output doesn't pass validation. The step receives the flow context with the error in LastError. If not set, the flow fails.
+	OnFailure string `json:"onFailure,omitempty" yaml:"onFailure,omitempty" mapstructure:"onFailure,omitempty"`
 }
 
 // GetClient function returns the client of the Step.
@@ -95,6 +159,15 @@ func (step *Step) GetClient() llm.Client {
 	return nil
 }
 
+// GetValidatorClient returns the client used to validate the output of the step.
+// It's the validate client of the step if one is set, otherwise the client of the step. It returns nil if neither is set.
+func (step *Step) GetValidatorClient() llm.Client {
+	if step.validateClientImpl != nil {
+		return step.validateClientImpl
+	}
+	return step.GetClient()
+}
+
 type ShortTermMemory any
 
 // FlowContext is the flowContext for a flow. It will be passed to each flow step.
@@ -104,9 +177,28 @@ type FlowContext struct {
 	Text      string
 	Memory    ShortTermMemory
 	Variables map[string]any
-	Flow      *Flow
+	Flow      *Flow `json:"-"`
 	ImageURLs []string
 	Think     string // Stores thinking content extracted from <think> tags in model output
+	// Conversation holds the message history of a multi-turn dialog. Steps taking part in the dialog, like an LLMExecutor with a conversation policy, send it to the model and append their exchange. It's nil if no step took part yet.
+	Conversation *Conversation
+
+	// LastError holds the error of the previous step if the flow continued with the OnFailure step of a failed step, or the reason the output of the previous attempt was rejected when a step is retried.
+	LastError string
+	// Goto can be set by an executor to continue the flow with the named step, or to end it with EndStep. It takes precedence over the Next and OnSuccess settings of the step.
+	Goto string
+	// Stop can be set by an executor to end the flow successfully after the current step.
+	Stop bool
+
+	// RunID identifies the run of the flow when checkpoints are enabled. See [Flow.Resume].
+	RunID string
+	// ResumeInput holds the input passed to [Flow.ResumeWithInput] while the step which paused the run runs again. It's nil otherwise.
+	ResumeInput any `json:"-"`
+
+	// Attempt is the number of the current attempt of the step, starting with 1. It's greater than 1 when the step is retried because its output didn't pass validation.
+	Attempt int
+	// PreviousOutput holds the output of the previous attempt of the step which didn't pass validation. LastError holds the reason.
+	PreviousOutput string
 }
 
 func (fc *FlowContext) UnmarshalJsonText(entity any) error {
@@ -180,7 +272,14 @@ func (fc *FlowContext) WithVariable(name string, value any) *FlowContext {
 		Flow:      fc.Flow,
 		ImageURLs: fc.ImageURLs,
 		Think:     fc.Think,
+		LastError: fc.LastError,
+		RunID:     fc.RunID,
+		Attempt:   fc.Attempt,
 		Variables: make(map[string]any),
+
+		PreviousOutput: fc.PreviousOutput,
+		ResumeInput:    fc.ResumeInput,
+		Conversation:   fc.Conversation,
 	}
 
 	// Copy all existing variables
@@ -238,46 +337,95 @@ func NewStepWithValidator(stepConfig any, executor StepExecutor, validator StepV
 	}
 }
 
-func tryStep(step *Step, flowContext FlowContext) (*FlowContext, error) {
-	var err error
+// tryStep runs the step until its output passes the validator of the step or the retries allowed by MaxRetryTimes are used up.
+// Each retry runs the executor with the input of the first attempt. The reason the output was rejected is passed in LastError, the rejected output in PreviousOutput and the number of the attempt in Attempt, so the executor (for example the template of an LLM executor) can correct the output.
+// If RetryBackoff is set, the step waits before each retry.
+func tryStep(ctx context.Context, step *Step, flowContext FlowContext) (*FlowContext, error) {
+	validator := NewResultValidator(step.Validator)
+	input := flowContext
+	for attempt := 1; ; attempt++ {
+		if err := waitRetry(ctx, step.retryDelay(attempt)); err != nil {
+			return nil, err
+		}
+		input.Attempt = attempt
+		result, err := runStep(ctx, step, input)
+		if err != nil {
+			return result, err
+		}
+		// If no validator is set, simply return the updated context.
+		if validator == nil {
+			return result, nil
+		}
+
+		// Validate the step output
+		validation := validator.ValidateResult(ctx, result.Text, step)
+		if validation.Passed {
+			result.LastError = ""
+			result.PreviousOutput = ""
+			return result, nil
+		}
+		if attempt > step.MaxRetryTimes {
+			log.Error("Step retry times exceeded, returning error.")
+			if validation.Reason != "" {
+				return result, fmt.Errorf("step retry times exceeded: %s", validation.Reason)
+			}
+			return result, errors.New("step retry times exceeded")
+		}
+
+		// Otherwise, try again with the reason of the failure
+		log.Debug("Step output didn't pass validation, retrying. Reason: ", validation.Reason)
+		input = flowContext
+		input.LastError = validation.Reason
+		if input.LastError == "" {
+			input.LastError = DefaultValidationFailure
+		}
+		input.PreviousOutput = result.Text
+	}
+}
+
+// runStep runs the executor of the step once and applies the immutability settings of the step to the result.
+func runStep(ctx context.Context, step *Step, flowContext FlowContext) (*FlowContext, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	log.Debug("Running step ", step, ".")
 	// Store original values if immutability is enabled
 	originalVars := make(map[string]any)
 	originalText := flowContext.Text
 	var originalMemory any
-	
+
 	// Copy original variables if immutable
 	if step.VarsImmutable && flowContext.Variables != nil {
 		for k, v := range flowContext.Variables {
 			originalVars[k] = v
 		}
 	}
-	
+
 	// Store original memory if immutable
 	if step.MemoryImmutable {
 		originalMemory = flowContext.Memory
 	}
-	
+
 	// Run the step and get the updated flowContext
-	result, err := step.Executor.Run(flowContext, step)
+	result, err := NewContextStepExecutor(step.Executor).RunContext(ctx, flowContext, step)
 	step.runTimes++
 	if err != nil {
 		return result, err
 	}
-	
+
 	// Apply immutability constraints if needed
 	if result != nil {
 		// Restore original variables if immutable
 		if step.VarsImmutable && flowContext.Variables != nil {
 			result.Variables = originalVars
 		}
-		
+
 		// Restore original text if immutable
 		if step.TextImmutable {
 			result.Text = originalText
 		}
-		
+
 		// Restore original memory if immutable
 		if step.MemoryImmutable {
 			result.Memory = originalMemory
@@ -286,40 +434,25 @@ func tryStep(step *Step, flowContext FlowContext) (*FlowContext, error) {
 
 	// Sync variables from flowContext to flow
 	if result != nil && result.Variables != nil && result.Flow != nil {
-		if result.Flow.Variables == nil {
-			result.Flow.Variables = make(map[string]any)
-		}
-		for k, v := range result.Variables {
-			result.Flow.Variables[k] = v
-		}
+		result.Flow.syncVariables(result.Variables)
 	}
-
-	if step.runTimes > step.MaxRetryTimes+1 {
-		log.Error("Step retry times exceeded, returning error.")
-		return result, errors.New("step retry times exceeded")
-	}
-	if step.Validator != nil {
-		// Validate the step output
-		if step.Validator.Validate(result.Text, step) {
-			// If the step output is valid, update flowContext and continue to the next step
-			return result, nil
-		} else {
-			// Otherwise, try again
-			return tryStep(step, *result)
-		}
-	}
-	// If no validator is set, simply return the updated context.
 	return result, nil
 }
 
 func (flow *Flow) RunWithInput(input string) (*FlowContext, error) {
+	return flow.RunWithInputContext(context.Background(), input)
+}
+
+// RunWithInputContext works like RunWithInput but runs the flow with the given context.
+// See [Flow.RunContext] for how the context is used.
+func (flow *Flow) RunWithInputContext(ctx context.Context, input string) (*FlowContext, error) {
 	// Create a new flowContext with the input
 	flowContext := FlowContext{
 		Text:      input,
 		Variables: make(map[string]any),
 	}
 
-	return flow.Run(flowContext)
+	return flow.RunContext(ctx, flowContext)
 }
 
 // RunWithMemory runs the flow with the provided memory object.
@@ -413,6 +546,30 @@ func (flow *Flow) RunWithInputAndVariables(input string, variables map[string]an
 }
 
 func (flow *Flow) Run(initialFlowContext FlowContext) (*FlowContext, error) {
+	return flow.RunContext(context.Background(), initialFlowContext)
+}
+
+// RunContext runs the flow with the given context.
+// The context is checked before each step and passed to executors implementing [ContextStepExecutor], so cancelling it or reaching its deadline stops the flow and aborts running LLM requests, commands and MCP calls.
+// When the context is done, the flow returns the context error.
+//
+// The steps run one after another in the order of Steps. A step can continue with another step instead of the following one with Next, OnSuccess and OnFailure, and its executor can set Goto or Stop in the returned context. EndStep ends the flow successfully. MaxStepRuns guards against endless loops.
+// If any step declares DependsOn, the flow runs as a DAG instead: steps start as soon as their dependencies finished, independent steps run concurrently up to MaxParallelism, and the results of the dependencies are merged as described in [JoinMode].
+//
+// If Checkpoints is set, the state of the run is saved before the first step and after each step under the RunID of the flow context, so a failed or interrupted run can be continued with [Flow.Resume]. If RunID is empty, a new one is generated and errors are returned as [*RunError] carrying it.
+// Flows run by the steps of a flow with checkpoints, for example by a loop, return their errors unwrapped, so only the outermost run wraps them.
+//
+// Parameters:
+//   - ctx: The context controlling the flow execution
+//   - initialFlowContext: The initial flow context
+//
+// Returns:
+//   - The flow context after the last step
+//   - Any error encountered during flow execution
+func (flow *Flow) RunContext(ctx context.Context, initialFlowContext FlowContext) (*FlowContext, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	flowContext := &initialFlowContext
 	flowContext.Flow = flow
 
@@ -422,56 +579,188 @@ func (flow *Flow) Run(initialFlowContext FlowContext) (*FlowContext, error) {
 	}
 
 	// Merge flow variables into context (flowContext variables take precedence)
-	if flow.Variables != nil {
-		for k, v := range flow.Variables {
-			if _, exists := flowContext.Variables[k]; !exists {
-				flowContext.Variables[k] = v
-			}
+	flow.variablesMu.Lock()
+	for k, v := range flow.Variables {
+		if _, exists := flowContext.Variables[k]; !exists {
+			flowContext.Variables[k] = v
 		}
 	}
+	flow.variablesMu.Unlock()
 
-	// Compile regular expression to extract <think> tag content
-	thinkRegex, err := regexp.Compile(`(?s)<think>.*?</think>`)
-	if err != nil {
+	if err := flow.validateTransitions(); err != nil {
 		return nil, err
 	}
+	if flow.Checkpoints != nil && flowContext.RunID == "" {
+		flowContext.RunID = NewRunID()
+	}
+	state := &Checkpoint{RunID: flowContext.RunID, FlowName: flow.Name, Context: *flowContext}
+	// The state before the first step is saved too, so a run whose first step fails can be resumed
+	if err := flow.saveCheckpoint(state); err != nil {
+		if ctx.Value(checkpointedRunKey{}) != nil {
+			return nil, err
+		}
+		return nil, &RunError{RunID: state.RunID, Err: err}
+	}
+	return flow.run(ctx, flowContext, state)
+}
+
+// checkpointedRunKey marks the context of a run with checkpoints, so the runs of nested flows don't wrap their errors into a RunError again.
+type checkpointedRunKey struct{}
+
+// run runs the flow from the state of the checkpoint and wraps errors into a RunError if checkpoints are enabled and the run isn't nested in another run with checkpoints.
+func (flow *Flow) run(ctx context.Context, flowContext *FlowContext, state *Checkpoint) (*FlowContext, error) {
+	state.Paused = false
+	state.PausedStep = ""
+	state.Prompt = ""
+
+	outermost := ctx.Value(checkpointedRunKey{}) == nil
+	if flow.Checkpoints != nil && outermost {
+		ctx = context.WithValue(ctx, checkpointedRunKey{}, state.RunID)
+	}
+
+	var result *FlowContext
+	var err error
+	if flow.isDAG() {
+		result, err = flow.runDAG(ctx, flowContext, state)
+	} else {
+		result, err = flow.runSteps(ctx, flowContext, state)
+	}
+	var pause *PauseError
+	if err != nil && flow.Checkpoints != nil && outermost && !errors.As(err, &pause) {
+		return nil, &RunError{RunID: state.RunID, Err: err}
+	}
+	return result, err
+}
+
+// runSteps runs the steps one after another, starting with the step the checkpoint points to.
+func (flow *Flow) runSteps(ctx context.Context, flowContext *FlowContext, state *Checkpoint) (*FlowContext, error) {
+	maxStepRuns := flow.MaxStepRuns
+	if maxStepRuns <= 0 {
+		// Every step may run once, so long flows without jumps back are not limited
+		maxStepRuns = len(flow.Steps) + DefaultMaxStepRuns
+	}
 
 	log.Debug("Starting run flow ", flow.Name, " with initial context.")
-	// For each step in the flow
-	for _, step := range flow.Steps {
+	// Run the steps in order unless a step jumps to another one
+	for index, stepRuns := state.NextStep, state.StepRuns; index < len(flow.Steps); {
+		stepRuns++
+		if stepRuns > maxStepRuns {
+			return nil, fmt.Errorf("flow %s exceeded the maximum of %d step runs", flow.Name, maxStepRuns)
+		}
+
+		step := flow.Steps[index]
 		// Run the step and get the updated flowContext
-		result, err := tryStep(&step, *flowContext)
+		result, err := tryStep(ctx, &step, *flowContext)
 
 		log.Debug("Step running finished. Error:", err, ".")
-		if err != nil {
-			return nil, err
+		// The input of a resumed run is only meant for the step which paused it
+		flowContext.ResumeInput = nil
+		if result != nil {
+			result.ResumeInput = nil
 		}
 
-		// Sync variables from flowContext to flow after step execution
-		if flowContext.Variables != nil {
-			if flow.Variables == nil {
-				flow.Variables = make(map[string]any)
+		var target string
+		var pause *PauseError
+		if errors.As(err, &pause) {
+			return nil, flow.pause(state, flowContext, &step, index, stepRuns-1, pause)
+		}
+		if err != nil {
+			if step.OnFailure == "" || ctx.Err() != nil {
+				return nil, err
 			}
-			for k, v := range flowContext.Variables {
-				flow.Variables[k] = v
+			log.Debug("Step ", step.Name, " failed, continuing with step ", step.OnFailure, ".")
+			if result == nil {
+				result = flowContext
 			}
-		}
-
-		// Check if the result contains <think> tags
-		if result != nil && result.Text != "" {
-			thinkMatch := thinkRegex.FindStringSubmatch(result.Text)
-			if len(thinkMatch) > 0 {
-				// Extract <think> tag content to the Think property
-				result.Think = thinkMatch[0]
-				// Remove <think> tag content, keep the cleaned text
-				result.Text = strings.TrimSpace(thinkRegex.ReplaceAllString(result.Text, ""))
+			result.LastError = err.Error()
+			target = step.OnFailure
+		} else {
+			// Sync variables from flowContext to flow after step execution
+			if flowContext.Variables != nil {
+				flow.syncVariables(flowContext.Variables)
 			}
+
+			extractThink(result)
+			target = nextStep(&step, result)
 		}
 
 		// Update the flowContext
 		flowContext = result
+
+		switch target {
+		case "":
+			index++
+		case EndStep:
+			index = len(flow.Steps)
+		default:
+			index = flow.stepIndex(target)
+			if index < 0 {
+				return nil, fmt.Errorf("step %s not found", target)
+			}
+		}
+
+		state.NextStep = index
+		state.StepRuns = stepRuns
+		state.Context = *flowContext
+		state.Done = index >= len(flow.Steps)
+		if err := flow.saveCheckpoint(state); err != nil {
+			return nil, err
+		}
 	}
 
 	// Return the flowContext content
 	return flowContext, nil
 }
+
+// thinkRegex matches the <think> tag content in model output
+var thinkRegex = regexp.MustCompile(`(?s)<think>.*?</think>`)
+
+// extractThink moves the <think> tag content of the result text to the Think property.
+func extractThink(result *FlowContext) {
+	if result == nil || result.Text == "" {
+		return
+	}
+	thinkMatch := thinkRegex.FindStringSubmatch(result.Text)
+	if len(thinkMatch) > 0 {
+		// Extract <think> tag content to the Think property
+		result.Think = thinkMatch[0]
+		// Remove <think> tag content, keep the cleaned text
+		result.Text = strings.TrimSpace(thinkRegex.ReplaceAllString(result.Text, ""))
+	}
+}
+
+// Clone returns a copy of the flow with its own Steps and Variables.
+// Running the copy doesn't change the variables of the original flow, so a shared flow can be run in isolation, for example as a sub-flow. The executors, validators and clients of the steps are shared.
+func (flow *Flow) Clone() *Flow {
+	flow.variablesMu.Lock()
+	variables := make(map[string]any, len(flow.Variables))
+	for k, v := range flow.Variables {
+		variables[k] = v
+	}
+	flow.variablesMu.Unlock()
+
+	return &Flow{
+		Name:           flow.Name,
+		Description:    flow.Description,
+		Steps:          append([]Step(nil), flow.Steps...),
+		ClientImpl:     flow.ClientImpl,
+		Variables:      variables,
+		MaxStepRuns:    flow.MaxStepRuns,
+		MaxParallelism: flow.MaxParallelism,
+		Checkpoints:    flow.Checkpoints,
+		Sessions:       flow.Sessions,
+	}
+}
+
+// syncVariables copies the variables to the flow variables.
+func (flow *Flow) syncVariables(variables map[string]any) {
+	flow.variablesMu.Lock()
+	defer flow.variablesMu.Unlock()
+
+	if flow.Variables == nil {
+		flow.Variables = make(map[string]any)
+	}
+	for k, v := range variables {
+		flow.Variables[k] = v
+	}
+}
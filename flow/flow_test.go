@@ -1,6 +1,7 @@
 package flow
 
 import (
+	"context"
 	"errors"
 	"testing"
 
@@ -133,7 +134,7 @@ func Test_tryStep_RunError(t *testing.T) {
 		},
 		test.NewMockClient(),
 	)
-	_, err := tryStep(step, FlowContext{})
+	_, err := tryStep(context.Background(), step, FlowContext{})
 	assert.EqualError(t, err, "run error")
 }
 func Test_tryStep_RetryExceeded(t *testing.T) {
@@ -153,17 +154,17 @@ func Test_tryStep_RetryExceeded(t *testing.T) {
 		test.NewMockClient(),
 	)
 	step.MaxRetryTimes = 0
-	_, err := tryStep(step, FlowContext{})
+	_, err := tryStep(context.Background(), step, FlowContext{})
 	assert.EqualError(t, err, "step retry times exceeded")
 
 	step.runTimes = 0
 	step.MaxRetryTimes = 1
-	_, err = tryStep(step, FlowContext{})
+	_, err = tryStep(context.Background(), step, FlowContext{})
 	assert.EqualError(t, err, "step retry times exceeded")
 
 	step.runTimes = 0
 	step.MaxRetryTimes = 3
-	_, err = tryStep(step, FlowContext{})
+	_, err = tryStep(context.Background(), step, FlowContext{})
 	assert.NoError(t, err, "step should be success because retry times doesn't exceed MaxRetryTimes")
 }
 func Test_tryStep_ValidatorError(t *testing.T) {
@@ -177,7 +178,7 @@ func Test_tryStep_ValidatorError(t *testing.T) {
 		},
 		test.NewMockClient(),
 	)
-	_, err := tryStep(step, FlowContext{})
+	_, err := tryStep(context.Background(), step, FlowContext{})
 	assert.Error(t, err)
 }
 func Test_tryStep_ValidatorSuccess(t *testing.T) {
@@ -191,7 +192,7 @@ func Test_tryStep_ValidatorSuccess(t *testing.T) {
 		},
 		test.NewMockClient(),
 	)
-	result, err := tryStep(step, FlowContext{})
+	result, err := tryStep(context.Background(), step, FlowContext{})
 	assert.Nil(t, err)
 	assert.Equal(t, result, &FlowContext{})
 }
@@ -772,3 +773,90 @@ func TestFlowContext_Variables(t *testing.T) {
 		assert.Equal(t, "completed", resultContext.GetVariable("step2"))
 	})
 }
+
+type contextKey string
+
+type MockContextStepExecutor struct {
+	MockStepExecutor
+	ReceivedValue any
+}
+
+func (executor *MockContextStepExecutor) RunContext(ctx context.Context, flowContext FlowContext, step *Step) (*FlowContext, error) {
+	executor.ReceivedValue = ctx.Value(contextKey("key"))
+	return executor.Run(flowContext, step)
+}
+
+func TestRunContextWithCancelledContext(t *testing.T) {
+	executor := &MockStepExecutor{}
+	step := NewStep(executor, nil, nil)
+	flow, err := NewFlow(nil, "flow1", *step)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = flow.RunWithInputContext(ctx, "input")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.False(t, executor.RunCompleted)
+}
+
+func TestRunContextStopsBetweenSteps(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	first := &MockExecutor{
+		Mock: func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+			cancel()
+			return &flowContext, nil
+		},
+	}
+	second := &MockStepExecutor{}
+	flow, err := NewFlow(nil, "flow1", *NewStep(first, nil, nil), *NewStep(second, nil, nil))
+	assert.NoError(t, err)
+
+	_, err = flow.RunContext(ctx, FlowContext{})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.False(t, second.RunCompleted)
+}
+
+func TestRunContextPassesContextToExecutor(t *testing.T) {
+	executor := &MockContextStepExecutor{}
+	flow, err := NewFlow(nil, "flow1", *NewStep(executor, nil, nil))
+	assert.NoError(t, err)
+
+	ctx := context.WithValue(context.Background(), contextKey("key"), "value")
+	_, err = flow.RunContext(ctx, FlowContext{})
+	assert.NoError(t, err)
+	assert.Equal(t, "value", executor.ReceivedValue)
+	assert.True(t, executor.RunCompleted)
+}
+
+func TestNewContextStepExecutor(t *testing.T) {
+	assert.Nil(t, NewContextStepExecutor(nil))
+
+	contextExecutor := &MockContextStepExecutor{}
+	assert.Equal(t, contextExecutor, NewContextStepExecutor(contextExecutor))
+
+	executor := &MockStepExecutor{}
+	adapter := NewContextStepExecutor(executor)
+	_, err := adapter.RunContext(context.Background(), FlowContext{}, nil)
+	assert.NoError(t, err)
+	assert.True(t, executor.RunCompleted)
+}
+
+func TestFlow_Clone(t *testing.T) {
+	flow, err := NewFlow(nil, "original", newNamedStep("set", func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+		flowContext.SetVariable("written", true)
+		return &flowContext, nil
+	}))
+	assert.NoError(t, err)
+	flow.Variables = map[string]any{"default": 1}
+
+	clone := flow.Clone()
+	result, err := clone.Run(FlowContext{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, true, result.Variables["written"])
+	assert.Equal(t, 1, result.Variables["default"])
+	assert.Equal(t, map[string]any{"default": 1}, flow.Variables)
+	assert.Equal(t, "original", clone.Name)
+}
@@ -1,6 +1,7 @@
 package flow
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -31,7 +32,7 @@ func TestVarsImmutable(t *testing.T) {
 	}
 
 	// Run the step
-	result, err := tryStep(step, initialContext)
+	result, err := tryStep(context.Background(), step, initialContext)
 
 	// Verify no errors
 	assert.NoError(t, err)
@@ -63,7 +64,7 @@ func TestTextImmutable(t *testing.T) {
 	}
 
 	// Run the step
-	result, err := tryStep(step, initialContext)
+	result, err := tryStep(context.Background(), step, initialContext)
 
 	// Verify no errors
 	assert.NoError(t, err)
@@ -98,7 +99,7 @@ func TestMemoryImmutable(t *testing.T) {
 	}
 
 	// Run the step
-	result, err := tryStep(step, initialContext)
+	result, err := tryStep(context.Background(), step, initialContext)
 
 	// Verify no errors
 	assert.NoError(t, err)
@@ -147,7 +148,7 @@ func TestMutableProperties(t *testing.T) {
 	}
 
 	// Run the step
-	result, err := tryStep(step, initialContext)
+	result, err := tryStep(context.Background(), step, initialContext)
 
 	// Verify no errors
 	assert.NoError(t, err)
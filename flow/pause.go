@@ -0,0 +1,77 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+)
+
+// PauseError is returned by an executor to pause the run of the flow until a human (or another system) answers the prompt.
+// The flow saves a checkpoint of the run and returns the PauseError with Token and Step set. The run is continued with [Flow.ResumeWithInput], which runs the step again with the answer in FlowContext.ResumeInput.
+// Pausing needs a checkpoint store, see [Flow.Checkpoints], and is only supported by flows which don't run as a DAG.
+type PauseError struct {
+	// Token identifies the paused run. It's the RunID of the run.
+	Token string
+	// Step is the name of the step which paused the run.
+	Step string
+	// Prompt describes the input the step is waiting for.
+	Prompt string
+}
+
+func (e *PauseError) Error() string {
+	if e.Step != "" {
+		return fmt.Sprintf("flow paused at step %s: %s", e.Step, e.Prompt)
+	}
+	return "flow paused: " + e.Prompt
+}
+
+// pause saves the run as paused at the step, so it continues with this step when it's resumed.
+func (flow *Flow) pause(state *Checkpoint, flowContext *FlowContext, step *Step, index int, stepRuns int, pause *PauseError) error {
+	if flow.Checkpoints == nil {
+		return fmt.Errorf("step %s paused the flow, but flow %s has no checkpoint store", step.Name, flow.Name)
+	}
+
+	state.NextStep = index
+	state.StepRuns = stepRuns
+	state.Context = *flowContext
+	state.Done = false
+	state.Paused = true
+	state.PausedStep = step.Name
+	state.Prompt = pause.Prompt
+	if err := flow.saveCheckpoint(state); err != nil {
+		return err
+	}
+
+	pause.Token = state.RunID
+	pause.Step = step.Name
+	return pause
+}
+
+// ResumeWithInput continues a paused run with the answer to the prompt. See [Flow.ResumeWithInputContext].
+func (flow *Flow) ResumeWithInput(token string, input any) (*FlowContext, error) {
+	return flow.ResumeWithInputContext(context.Background(), token, input)
+}
+
+// ResumeWithInputContext continues a run paused by a [PauseError]. The step which paused the run runs again with the input in FlowContext.ResumeInput, then the flow continues as usual.
+//
+// Parameters:
+//   - ctx: The context controlling the flow execution
+//   - token: The Token of the PauseError
+//   - input: The answer to the prompt, for example an approval decision or edited text
+//
+// Returns:
+//   - The flow context after the last step
+//   - An error if the run can't be loaded or isn't paused, or a step fails. If another step pauses the run, a new PauseError is returned.
+func (flow *Flow) ResumeWithInputContext(ctx context.Context, token string, input any) (*FlowContext, error) {
+	state, flowContext, err := flow.loadRun(token)
+	if err != nil {
+		return nil, err
+	}
+	if !state.Paused {
+		return nil, fmt.Errorf("run %s is not paused", token)
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	flowContext.ResumeInput = input
+	return flow.run(ctx, flowContext, state)
+}
@@ -0,0 +1,87 @@
+package flow
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// askOnce returns a step function which pauses the flow until it's resumed, then appends the resume input to the text.
+func askOnce(prompt string) func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+	return func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+		if flowContext.ResumeInput == nil {
+			return nil, &PauseError{Prompt: prompt}
+		}
+		flowContext.Text += flowContext.ResumeInput.(string)
+		return &flowContext, nil
+	}
+}
+
+func TestFlow_PauseAndResumeWithInput(t *testing.T) {
+	firstRuns := 0
+	var thirdInput any = "unset"
+	flow, _ := NewFlow(nil, "review",
+		newNamedStep("draft", countRuns(appendText("draft"), &firstRuns)),
+		newNamedStep("approve", askOnce("Publish the draft?")),
+		newNamedStep("publish", func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+			thirdInput = flowContext.ResumeInput
+			flowContext.Text += "!"
+			return &flowContext, nil
+		}),
+	)
+	flow.Checkpoints = NewMemoryCheckpointStore()
+
+	_, err := flow.Run(FlowContext{RunID: "review-1"})
+
+	var pause *PauseError
+	require.ErrorAs(t, err, &pause)
+	assert.Equal(t, "review-1", pause.Token)
+	assert.Equal(t, "approve", pause.Step)
+	assert.EqualError(t, err, "flow paused at step approve: Publish the draft?")
+
+	checkpoint, err := flow.Checkpoints.Load("review-1")
+	require.NoError(t, err)
+	assert.True(t, checkpoint.Paused)
+	assert.Equal(t, "approve", checkpoint.PausedStep)
+	assert.Equal(t, "Publish the draft?", checkpoint.Prompt)
+	assert.Equal(t, 1, checkpoint.NextStep)
+	assert.Equal(t, "draft", checkpoint.Context.Text)
+
+	result, err := flow.ResumeWithInput(pause.Token, " approved")
+
+	require.NoError(t, err)
+	assert.Equal(t, "draft approved!", result.Text)
+	assert.Nil(t, result.ResumeInput)
+	assert.Nil(t, thirdInput)
+	assert.Equal(t, 1, firstRuns)
+
+	checkpoint, err = flow.Checkpoints.Load("review-1")
+	require.NoError(t, err)
+	assert.True(t, checkpoint.Done)
+	assert.False(t, checkpoint.Paused)
+
+	_, err = flow.ResumeWithInput(pause.Token, "again")
+	assert.EqualError(t, err, "run review-1 is not paused")
+}
+
+func TestFlow_Pause_Errors(t *testing.T) {
+	flow, _ := NewFlow(nil, "review", newNamedStep("approve", askOnce("Approve?")))
+
+	_, err := flow.Run(FlowContext{})
+	assert.EqualError(t, err, "step approve paused the flow, but flow review has no checkpoint store")
+
+	_, err = flow.ResumeWithInput("run", "yes")
+	assert.EqualError(t, err, "flow review has no checkpoint store")
+
+	dag, _ := NewFlow(nil, "dag",
+		newDAGStep("a", nil, appendText("a")),
+		newDAGStep("approve", []string{"a"}, askOnce("Approve?")),
+	)
+	dag.Checkpoints = NewMemoryCheckpointStore()
+	_, err = dag.Run(FlowContext{RunID: "dag-run"})
+	var pause *PauseError
+	assert.False(t, errors.As(err, &pause))
+	assert.EqualError(t, err, "run dag-run failed: step approve failed: pausing is not supported in flows whose steps declare dependencies")
+}
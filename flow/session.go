@@ -0,0 +1,206 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrSessionNotFound is returned by memory stores when there is no saved state for a session.
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is the state of a conversation with a user which outlives a single run of a flow, for example the state of a support chat across HTTP requests.
+type Session struct {
+	ID string `json:"id"`
+	// Memory is the Memory of the flow context after the last run of the session.
+	Memory ShortTermMemory `json:"memory,omitempty"`
+	// Conversation is the message history of the session.
+	Conversation *Conversation `json:"conversation,omitempty"`
+	UpdatedAt    time.Time     `json:"updatedAt"`
+}
+
+// MemoryStore saves and loads sessions by their ID. See [Flow.RunWithSession].
+// The built-in implementations are [InMemoryStore] and [FileMemoryStore]. The package boltstore has a store in an embedded key-value database.
+type MemoryStore interface {
+	// Load returns the session, or ErrSessionNotFound if nothing was saved for it.
+	Load(sessionID string) (*Session, error)
+	// Save stores the session, replacing an earlier state of the same session.
+	Save(session *Session) error
+	// Delete removes the session. Deleting a session which doesn't exist is not an error.
+	Delete(sessionID string) error
+}
+
+// RunWithSession runs the flow with the saved state of a session. See [Flow.RunWithSessionContext].
+func (flow *Flow) RunWithSession(sessionID string, input string) (*FlowContext, error) {
+	return flow.RunWithSessionContext(context.Background(), sessionID, input)
+}
+
+// RunWithSessionContext runs the flow with the Memory and Conversation saved for the session in the Sessions store of the flow, and saves them again after the run.
+// A session without saved state starts with empty memory and history. If the run fails, the saved state is not changed.
+// Runs of the same session should not overlap, since the state saved last wins.
+//
+// Parameters:
+//   - ctx: The context controlling the flow execution
+//   - sessionID: The ID of the session, for example the ID of a chat
+//   - input: The input text of the run
+//
+// Returns:
+//   - The flow context after the last step
+//   - An error if the flow has no memory store, the session can't be loaded or saved, or the flow fails
+func (flow *Flow) RunWithSessionContext(ctx context.Context, sessionID string, input string) (*FlowContext, error) {
+	if flow.Sessions == nil {
+		return nil, fmt.Errorf("flow %s has no memory store", flow.Name)
+	}
+	if sessionID == "" {
+		return nil, errors.New("session ID cannot be empty")
+	}
+	session, err := flow.Sessions.Load(sessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		session, err = &Session{ID: sessionID}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session %s: %w", sessionID, err)
+	}
+
+	result, err := flow.RunContext(ctx, FlowContext{
+		Text:         input,
+		Memory:       session.Memory,
+		Conversation: session.Conversation,
+		Variables:    make(map[string]any),
+	})
+	if err != nil {
+		return result, err
+	}
+
+	session.ID = sessionID
+	session.Memory = result.Memory
+	session.Conversation = result.Conversation
+	session.UpdatedAt = time.Now()
+	if err := flow.Sessions.Save(session); err != nil {
+		return result, fmt.Errorf("failed to save session %s: %w", sessionID, err)
+	}
+	return result, nil
+}
+
+// InMemoryStore keeps sessions in memory as long as the process is running.
+type InMemoryStore struct {
+	mu       sync.RWMutex
+	sessions map[string]Session
+}
+
+// NewInMemoryStore creates an empty InMemoryStore.
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{sessions: make(map[string]Session)}
+}
+
+// Load returns a copy of the session.
+func (store *InMemoryStore) Load(sessionID string) (*Session, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	session, ok := store.sessions[sessionID]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	cloned := session.clone()
+	return &cloned, nil
+}
+
+// Save stores a copy of the session.
+func (store *InMemoryStore) Save(session *Session) error {
+	if session == nil || session.ID == "" {
+		return errors.New("session has no ID")
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.sessions == nil {
+		store.sessions = make(map[string]Session)
+	}
+	store.sessions[session.ID] = session.clone()
+	return nil
+}
+
+// Delete removes the session.
+func (store *InMemoryStore) Delete(sessionID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.sessions, sessionID)
+	return nil
+}
+
+// clone returns a copy of the session with its own conversation. Memory is shared.
+func (session *Session) clone() Session {
+	cloned := *session
+	if session.Conversation != nil {
+		cloned.Conversation = session.Conversation.Clone()
+	}
+	return cloned
+}
+
+// FileMemoryStore saves each session as a JSON file named after the session ID in a directory.
+// Memory must be serializable to JSON and is loaded as decoded JSON (maps, slices, strings, float64 and bool).
+type FileMemoryStore struct {
+	Dir string
+}
+
+// NewFileMemoryStore creates a FileMemoryStore and the directory if it doesn't exist.
+func NewFileMemoryStore(dir string) (*FileMemoryStore, error) {
+	if dir == "" {
+		return nil, errors.New("memory directory cannot be empty")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileMemoryStore{Dir: dir}, nil
+}
+
+// Load reads the session file.
+func (store *FileMemoryStore) Load(sessionID string) (*Session, error) {
+	path, err := jsonFilePath(store.Dir, "session ID", sessionID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("invalid session %s: %w", path, err)
+	}
+	return &session, nil
+}
+
+// Save writes the session file. Like FileCheckpointStore, it writes a temporary file first so a crash doesn't corrupt the saved state.
+func (store *FileMemoryStore) Save(session *Session) error {
+	if session == nil {
+		return errors.New("session is nil")
+	}
+	path, err := jsonFilePath(store.Dir, "session ID", session.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(store.Dir, path, session.ID, data)
+}
+
+// Delete removes the session file.
+func (store *FileMemoryStore) Delete(sessionID string) error {
+	path, err := jsonFilePath(store.Dir, "session ID", sessionID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package flow
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/jieliu2000/anyi/llm/chat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// remember returns a step function which counts the runs of the session in Memory and adds the input and an answer to the conversation.
+func remember(flowContext FlowContext, step *Step) (*FlowContext, error) {
+	memory, _ := flowContext.Memory.(map[string]any)
+	count, _ := memory["turns"].(float64)
+	flowContext.Memory = map[string]any{"turns": count + 1}
+
+	conversation := flowContext.Conversation.Clone()
+	conversation.Append(chat.NewUserMessage(flowContext.Text), chat.NewAssistantMessage("ok"))
+	flowContext.Conversation = conversation
+	return &flowContext, nil
+}
+
+func TestFlow_RunWithSession(t *testing.T) {
+	for name, newStore := range map[string]func(t *testing.T) MemoryStore{
+		"memory": func(t *testing.T) MemoryStore { return NewInMemoryStore() },
+		"file": func(t *testing.T) MemoryStore {
+			store, err := NewFileMemoryStore(filepath.Join(t.TempDir(), "sessions"))
+			require.NoError(t, err)
+			return store
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			flow, _ := NewFlow(nil, "bot", newNamedStep("remember", remember))
+			flow.Sessions = newStore(t)
+
+			_, err := flow.RunWithSession("alice", "hello")
+			require.NoError(t, err)
+			_, err = flow.RunWithSession("bob", "hi")
+			require.NoError(t, err)
+			result, err := flow.RunWithSession("alice", "how are you?")
+			require.NoError(t, err)
+
+			assert.Equal(t, map[string]any{"turns": 2.0}, result.Memory)
+			assert.Equal(t, "user: hello\n\nassistant: ok\n\nuser: how are you?\n\nassistant: ok", result.Conversation.Transcript())
+
+			session, err := flow.Sessions.Load("alice")
+			require.NoError(t, err)
+			assert.Equal(t, "alice", session.ID)
+			assert.Len(t, session.Conversation.Messages, 4)
+			assert.False(t, session.UpdatedAt.IsZero())
+
+			require.NoError(t, flow.Sessions.Delete("alice"))
+			require.NoError(t, flow.Sessions.Delete("alice"))
+			_, err = flow.Sessions.Load("alice")
+			assert.ErrorIs(t, err, ErrSessionNotFound)
+		})
+	}
+}
+
+func TestFlow_RunWithSession_FailedRunKeepsState(t *testing.T) {
+	fail := false
+	flow, _ := NewFlow(nil, "bot",
+		newNamedStep("remember", remember),
+		newNamedStep("check", func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+			if fail {
+				return nil, errors.New("model unavailable")
+			}
+			return &flowContext, nil
+		}),
+	)
+	flow.Sessions = NewInMemoryStore()
+
+	_, err := flow.RunWithSession("alice", "hello")
+	require.NoError(t, err)
+	fail = true
+	_, err = flow.RunWithSession("alice", "lost")
+	assert.EqualError(t, err, "model unavailable")
+
+	session, err := flow.Sessions.Load("alice")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"turns": 1.0}, session.Memory)
+	assert.Len(t, session.Conversation.Messages, 2)
+}
+
+func TestFlow_RunWithSession_Errors(t *testing.T) {
+	flow, _ := NewFlow(nil, "bot", newNamedStep("remember", remember))
+	_, err := flow.RunWithSession("alice", "hello")
+	assert.EqualError(t, err, "flow bot has no memory store")
+
+	flow.Sessions = NewInMemoryStore()
+	_, err = flow.RunWithSession("", "hello")
+	assert.EqualError(t, err, "session ID cannot be empty")
+
+	store := &FileMemoryStore{Dir: t.TempDir()}
+	assert.EqualError(t, store.Save(&Session{ID: "../escape"}), `invalid session ID "../escape"`)
+	_, err = NewFileMemoryStore("")
+	assert.Error(t, err)
+}
@@ -0,0 +1,76 @@
+package flow
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultValidationFailure is the reason given to the retry of a step when its validator rejects the output without a reason.
+const DefaultValidationFailure = "the output did not pass validation"
+
+// ValidationResult is the result of validating the output of a step.
+type ValidationResult struct {
+	// Passed is true if the output is valid.
+	Passed bool
+	// Reason explains why the output was rejected. It's passed to the retry of the step in FlowContext.LastError so the executor can correct the output.
+	Reason string
+}
+
+// ResultValidator is implemented by validators which explain why they reject an output.
+// Validators which only implement StepValidator are wrapped with [NewResultValidator].
+type ResultValidator interface {
+	StepValidator
+	ValidateResult(ctx context.Context, stepOutput string, Step *Step) ValidationResult
+}
+
+// resultValidatorAdapter adapts a StepValidator returning a bool to the ResultValidator interface.
+type resultValidatorAdapter struct {
+	StepValidator
+}
+
+// ValidateResult calls the Validate method of the wrapped validator. Rejected outputs have no reason, so the retry gets [DefaultValidationFailure].
+func (adapter *resultValidatorAdapter) ValidateResult(ctx context.Context, stepOutput string, step *Step) ValidationResult {
+	if adapter.StepValidator.Validate(stepOutput, step) {
+		return ValidationResult{Passed: true}
+	}
+	return ValidationResult{}
+}
+
+// NewResultValidator returns a ResultValidator for the validator.
+// If the validator already implements ResultValidator it is returned as is. Otherwise it's wrapped by an adapter which calls Validate.
+func NewResultValidator(validator StepValidator) ResultValidator {
+	if validator == nil {
+		return nil
+	}
+	if resultValidator, ok := validator.(ResultValidator); ok {
+		return resultValidator
+	}
+	return &resultValidatorAdapter{StepValidator: validator}
+}
+
+// retryDelay returns how long to wait before the given attempt of the step. The delay starts at RetryBackoff before the second attempt and doubles with each further attempt.
+func (step *Step) retryDelay(attempt int) time.Duration {
+	if step.RetryBackoff <= 0 || attempt < 2 {
+		return 0
+	}
+	delay := step.RetryBackoff
+	for i := 2; i < attempt; i++ {
+		delay *= 2
+	}
+	return delay
+}
+
+// waitRetry waits for the delay or until the context is done.
+func waitRetry(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,111 @@
+package flow
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reasonValidator rejects outputs shorter than length and explains why.
+type reasonValidator struct {
+	length int
+}
+
+func (v reasonValidator) Init() error { return nil }
+
+func (v reasonValidator) Validate(output string, step *Step) bool {
+	return v.ValidateResult(context.Background(), output, step).Passed
+}
+
+func (v reasonValidator) ValidateResult(ctx context.Context, output string, step *Step) ValidationResult {
+	if len(output) < v.length {
+		return ValidationResult{Reason: "too short"}
+	}
+	return ValidationResult{Passed: true}
+}
+
+func TestTryStep_FeedbackOnRetry(t *testing.T) {
+	inputs := []FlowContext{}
+	step := NewStep(MockExecutor{Mock: func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+		inputs = append(inputs, flowContext)
+		flowContext.Text = flowContext.Text + flowContext.PreviousOutput + "!"
+		return &flowContext, nil
+	}}, reasonValidator{length: 8}, nil)
+
+	result, err := tryStep(context.Background(), step, FlowContext{Text: "hi"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "hihihi!!!", result.Text)
+	assert.Empty(t, result.LastError)
+	assert.Empty(t, result.PreviousOutput)
+
+	require.Len(t, inputs, 3)
+	for i, input := range inputs {
+		assert.Equal(t, i+1, input.Attempt)
+		assert.Equal(t, "hi", input.Text, "each attempt gets the original input")
+	}
+	assert.Empty(t, inputs[0].LastError)
+	assert.Equal(t, "too short", inputs[1].LastError)
+	assert.Equal(t, "hi!", inputs[1].PreviousOutput)
+	assert.Equal(t, "hihi!!", inputs[2].PreviousOutput)
+}
+
+func TestTryStep_RetryExceededWithReason(t *testing.T) {
+	step := NewStep(MockExecutor{Mock: appendText("")}, reasonValidator{length: 10}, nil)
+	step.MaxRetryTimes = 1
+
+	_, err := tryStep(context.Background(), step, FlowContext{Text: "short"})
+
+	assert.EqualError(t, err, "step retry times exceeded: too short")
+	assert.Equal(t, 2, step.runTimes)
+}
+
+func TestTryStep_BoolValidatorFeedback(t *testing.T) {
+	lastErrors := []string{}
+	step := NewStep(MockExecutor{Mock: func(flowContext FlowContext, step *Step) (*FlowContext, error) {
+		lastErrors = append(lastErrors, flowContext.LastError)
+		return &flowContext, nil
+	}}, MockValidator{Mock: func(output string, step *Step) bool {
+		return step.runTimes > 1
+	}}, nil)
+
+	_, err := tryStep(context.Background(), step, FlowContext{})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", DefaultValidationFailure}, lastErrors)
+}
+
+func TestTryStep_RetryBackoff(t *testing.T) {
+	step := NewStep(MockExecutor{Mock: appendText("")}, reasonValidator{length: 10}, nil)
+	step.MaxRetryTimes = 2
+	step.RetryBackoff = 20 * time.Millisecond
+
+	assert.Equal(t, time.Duration(0), step.retryDelay(1))
+	assert.Equal(t, 20*time.Millisecond, step.retryDelay(2))
+	assert.Equal(t, 40*time.Millisecond, step.retryDelay(3))
+
+	start := time.Now()
+	_, err := tryStep(context.Background(), step, FlowContext{})
+	assert.EqualError(t, err, "step retry times exceeded: too short")
+	assert.GreaterOrEqual(t, time.Since(start), 60*time.Millisecond)
+
+	step.RetryBackoff = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = tryStep(ctx, step, FlowContext{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestNewResultValidator(t *testing.T) {
+	assert.Nil(t, NewResultValidator(nil))
+
+	validator := reasonValidator{length: 1}
+	assert.Equal(t, validator, NewResultValidator(validator))
+
+	adapted := NewResultValidator(MockValidator{Mock: func(output string, step *Step) bool { return output == "ok" }})
+	assert.Equal(t, ValidationResult{Passed: true}, adapted.ValidateResult(context.Background(), "ok", nil))
+	assert.Equal(t, ValidationResult{}, adapted.ValidateResult(context.Background(), "no", nil))
+}
@@ -3,12 +3,13 @@ module github.com/jieliu2000/anyi
 go 1.20
 
 require (
-	github.com/jieliu2000/shello v0.1.0
+	github.com/dlclark/regexp2 v1.10.0
 	github.com/mitchellh/mapstructure v1.5.0
 	github.com/sashabaranov/go-openai v1.29.1
 	github.com/sirupsen/logrus v1.9.3
 	github.com/spf13/viper v1.19.0
 	github.com/stretchr/testify v1.9.0
+	go.etcd.io/bbolt v1.3.9
 )
 
 require (
@@ -0,0 +1,169 @@
+package anyi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jieliu2000/anyi/flow"
+)
+
+// DefaultGoCodeBuildTimeout is the time GoCodeValidator waits for go build if BuildTimeout is not set.
+const DefaultGoCodeBuildTimeout = time.Minute
+
+// goCodeBlockRegex matches markdown code blocks. The first group is the language of the block.
+var goCodeBlockRegex = regexp.MustCompile("(?s)```([A-Za-z0-9_+-]*)[^\\n]*\\n(.*?)```")
+
+// GoCodeValidator checks that the Go code in the step output compiles.
+// The code is taken from the markdown code blocks marked as go or golang. If there are none, all code blocks are used, and if the output has no code blocks, the whole output is treated as code.
+// Code without a package clause, like a few functions, is checked as a package of its own.
+//
+// By default the code is only parsed, which catches syntax errors. If Build is set, each code block is compiled with go build in a temporary module, which also catches type errors.
+// This needs the go command and only works for code importing the standard library.
+type GoCodeValidator struct {
+	// If true, the code is compiled with go build instead of only being parsed.
+	Build bool `json:"build" yaml:"build" mapstructure:"build"`
+	// The maximum time go build may take for each code block. Defaults to DefaultGoCodeBuildTimeout.
+	BuildTimeout time.Duration `json:"buildTimeout" yaml:"buildTimeout" mapstructure:"buildTimeout"`
+}
+
+// Init sets the default build timeout and checks that the go command is available if Build is set.
+func (validator *GoCodeValidator) Init() error {
+	if validator.BuildTimeout <= 0 {
+		validator.BuildTimeout = DefaultGoCodeBuildTimeout
+	}
+	if validator.Build {
+		if _, err := exec.LookPath("go"); err != nil {
+			return fmt.Errorf("the go command is required to build the code: %w", err)
+		}
+	}
+	return nil
+}
+
+// Validate checks the code of the output. See ValidateResult.
+func (validator *GoCodeValidator) Validate(stepOutput string, Step *flow.Step) bool {
+	return validator.ValidateResult(context.Background(), stepOutput, Step).Passed
+}
+
+// ValidateResult checks each code block of the output. The reason contains the compiler errors of the first invalid block.
+func (validator *GoCodeValidator) ValidateResult(ctx context.Context, stepOutput string, Step *flow.Step) flow.ValidationResult {
+	blocks := ExtractGoCode(stepOutput)
+	if len(blocks) == 0 {
+		return flow.ValidationResult{Reason: "the output contains no Go code"}
+	}
+
+	for i, code := range blocks {
+		var err error
+		if validator.Build {
+			err = validator.build(ctx, code)
+		} else {
+			err = parseGoCode(code)
+		}
+		if err != nil {
+			if len(blocks) > 1 {
+				return flow.ValidationResult{Reason: fmt.Sprintf("code block %d doesn't compile: %v", i+1, err)}
+			}
+			return flow.ValidationResult{Reason: fmt.Sprintf("the code doesn't compile: %v", err)}
+		}
+	}
+	return flow.ValidationResult{Passed: true}
+}
+
+// ExtractGoCode returns the Go code blocks of a markdown text.
+// Blocks marked as go or golang are returned if there are any, otherwise all code blocks. If the text has no code blocks, the trimmed text is returned as the only block.
+func ExtractGoCode(text string) []string {
+	matches := goCodeBlockRegex.FindAllStringSubmatch(text, -1)
+	if len(matches) == 0 {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return nil
+		}
+		return []string{text}
+	}
+
+	var goBlocks, allBlocks []string
+	for _, match := range matches {
+		code := strings.TrimSpace(match[2])
+		if code == "" {
+			continue
+		}
+		allBlocks = append(allBlocks, code)
+		language := strings.ToLower(match[1])
+		if language == "go" || language == "golang" {
+			goBlocks = append(goBlocks, code)
+		}
+	}
+	if len(goBlocks) > 0 {
+		return goBlocks
+	}
+	return allBlocks
+}
+
+// withPackageClause adds a package clause to code which doesn't start with one. The clause is put on the first line, so the line numbers of errors match the code.
+func withPackageClause(code string) string {
+	if _, err := parser.ParseFile(token.NewFileSet(), "", code, parser.PackageClauseOnly); err == nil {
+		return code
+	}
+	return "package snippet; " + code
+}
+
+// parseGoCode checks the syntax of the code.
+func parseGoCode(code string) error {
+	_, err := parser.ParseFile(token.NewFileSet(), "main.go", withPackageClause(code), parser.AllErrors)
+	return err
+}
+
+// build compiles the code with go build in a temporary module.
+func (validator *GoCodeValidator) build(ctx context.Context, code string) error {
+	timeout := validator.BuildTimeout
+	if timeout <= 0 {
+		timeout = DefaultGoCodeBuildTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	dir, err := os.MkdirTemp("", "anyi-gocode-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module gocode\n\ngo 1.20\n"), 0o600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(withPackageClause(code)), 0o600); err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, "go", "build", "-o", os.DevNull, ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=-mod=mod", "GOTOOLCHAIN=local")
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err == nil {
+		return nil
+	}
+
+	var messages []string
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		// Skip the "# gocode" header of the compiler output
+		if line == "" || strings.HasPrefix(line, "# ") {
+			continue
+		}
+		messages = append(messages, strings.TrimPrefix(line, "./"))
+	}
+	if len(messages) == 0 {
+		return err
+	}
+	return errors.New(strings.Join(messages, "\n"))
+}
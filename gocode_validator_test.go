@@ -0,0 +1,49 @@
+package anyi
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractGoCode(t *testing.T) {
+	assert.Equal(t, []string{"func a() {}"}, ExtractGoCode("  func a() {}\n"))
+	assert.Nil(t, ExtractGoCode(" "))
+	assert.Equal(t, []string{"x := 1", "y := 2"}, ExtractGoCode("Text\n```go\nx := 1\n```\nmore\n```golang\ny := 2\n```\n```bash\ngo run .\n```"))
+	assert.Equal(t, []string{"go run ."}, ExtractGoCode("```bash\ngo run .\n```"))
+}
+
+func TestGoCodeValidator_Parse(t *testing.T) {
+	validator := &GoCodeValidator{}
+	require.NoError(t, validator.Init())
+
+	result := validator.ValidateResult(context.Background(), "Here it is:\n```go\nfunc add(a, b int) int {\n\treturn a + b\n}\n```", nil)
+	assert.True(t, result.Passed)
+
+	result = validator.ValidateResult(context.Background(), "```go\npackage main\n\nfunc main() {\n\tif {\n}\n```", nil)
+	assert.False(t, result.Passed)
+	assert.Contains(t, result.Reason, "the code doesn't compile: main.go:4:5:")
+
+	result = validator.ValidateResult(context.Background(), "```go\nfunc a() {}\n```\n```go\nfunc b( {}\n```", nil)
+	assert.Contains(t, result.Reason, "code block 2 doesn't compile: main.go:1:")
+
+	assert.Equal(t, "the output contains no Go code", validator.ValidateResult(context.Background(), "", nil).Reason)
+}
+
+func TestGoCodeValidator_Build(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("the go command is not available")
+	}
+	validator := &GoCodeValidator{Build: true}
+	require.NoError(t, validator.Init())
+
+	result := validator.ValidateResult(context.Background(), "```go\nimport \"strings\"\n\nfunc Upper(s string) string {\n\treturn strings.ToUpper(s)\n}\n```", nil)
+	assert.True(t, result.Passed, result.Reason)
+
+	result = validator.ValidateResult(context.Background(), "```go\nfunc Count() int {\n\treturn \"many\"\n}\n```", nil)
+	assert.False(t, result.Passed)
+	assert.Contains(t, result.Reason, `main.go:2:9: cannot use "many"`)
+}
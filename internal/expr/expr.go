@@ -0,0 +1,878 @@
+// Package expr evaluates the small expression language used by flow conditions.
+//
+// Expressions support number, string ('single' or "double" quoted), true, false and nil literals, identifiers resolved from an environment,
+// member access (a.b), indexing (a["b"], a[0]), function calls, the arithmetic operators + - * / %, the comparisons == != < <= > >=
+// and the logical operators && || !. Accessing a missing member or index yields nil instead of an error, and ordering comparisons (< <= > >=) with nil are false, so conditions on optional values stay simple.
+//
+// The following functions are available:
+//   - len(v): The length of a string, list or map
+//   - contains(v, x): Whether the string v contains the substring x, the list v contains the element x or the map v has the key x
+//   - startsWith(s, prefix), endsWith(s, suffix): String prefix and suffix checks
+//   - lower(s), upper(s), trim(s): Case conversion and removal of surrounding whitespace
+//   - string(v): Converts a value to a string
+//   - number(v): Converts a number or a numeric string to a number. nil stays nil.
+//   - matches(s, pattern): Whether the string matches the regular expression
+//   - find(s, pattern): The first match of the regular expression, or its first group if it has groups. Empty if there is no match.
+//   - json(s): Parses the JSON in the string, which may be wrapped in a markdown code fence. Returns nil if the string isn't valid JSON.
+package expr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Function is a function which can be called in expressions.
+type Function func(args ...any) (any, error)
+
+// functions are the functions available in all expressions.
+var functions = map[string]Function{
+	"len":        lenFunction,
+	"contains":   containsFunction,
+	"startsWith": stringPredicate(strings.HasPrefix),
+	"endsWith":   stringPredicate(strings.HasSuffix),
+	"lower":      stringFunction(strings.ToLower),
+	"upper":      stringFunction(strings.ToUpper),
+	"trim":       stringFunction(strings.TrimSpace),
+	"string":     stringConversionFunction,
+	"number":     numberFunction,
+	"matches":    matchesFunction,
+	"find":       findFunction,
+	"json":       jsonFunction,
+}
+
+// Expression is a compiled expression which can be evaluated several times.
+type Expression struct {
+	source string
+	root   node
+}
+
+// Compile parses an expression.
+//
+// Parameters:
+//   - source: The expression
+//
+// Returns:
+//   - The compiled expression
+//   - An error if the expression is empty or has a syntax error
+func Compile(source string) (*Expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return nil, errors.New("expression is empty")
+	}
+	root, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if token := p.peek(); token.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", token.text, token.pos)
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+// String returns the source of the expression.
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Eval evaluates the expression. Identifiers are looked up in env.
+func (e *Expression) Eval(env map[string]any) (any, error) {
+	return e.root.eval(env)
+}
+
+// EvalBool evaluates the expression and converts the result to a boolean with the rules of Truthy.
+func (e *Expression) EvalBool(env map[string]any) (bool, error) {
+	value, err := e.Eval(env)
+	if err != nil {
+		return false, err
+	}
+	return Truthy(value), nil
+}
+
+// Eval compiles and evaluates an expression.
+func Eval(source string, env map[string]any) (any, error) {
+	e, err := Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	return e.Eval(env)
+}
+
+// EvalBool compiles and evaluates an expression and converts the result to a boolean with the rules of Truthy.
+func EvalBool(source string, env map[string]any) (bool, error) {
+	e, err := Compile(source)
+	if err != nil {
+		return false, err
+	}
+	return e.EvalBool(env)
+}
+
+// Truthy converts a value to a boolean. nil, false, zero numbers, empty strings and empty collections are false, everything else is true.
+func Truthy(value any) bool {
+	if value == nil {
+		return false
+	}
+	if b, ok := value.(bool); ok {
+		return b
+	}
+	if number, ok := toNumber(value); ok {
+		return number != 0
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return v.Len() > 0
+	case reflect.Pointer, reflect.Interface:
+		return !v.IsNil()
+	}
+	return true
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value any
+	pos   int
+}
+
+// operators are sorted so that longer operators are matched first.
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ".", ","}
+
+func tokenize(source string) ([]token, error) {
+	tokens := []token{}
+	for pos := 0; pos < len(source); {
+		c := source[pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			pos++
+		case c >= '0' && c <= '9':
+			start := pos
+			for pos < len(source) && (source[pos] >= '0' && source[pos] <= '9' || source[pos] == '.') {
+				pos++
+			}
+			number, err := strconv.ParseFloat(source[start:pos], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at position %d", source[start:pos], start)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: source[start:pos], value: number, pos: start})
+		case c == '"' || c == '\'':
+			text, end, err := readString(source, pos)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: source[pos:end], value: text, pos: pos})
+			pos = end
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			start := pos
+			for pos < len(source) && (source[pos] == '_' || source[pos] >= 'a' && source[pos] <= 'z' || source[pos] >= 'A' && source[pos] <= 'Z' || source[pos] >= '0' && source[pos] <= '9') {
+				pos++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: source[start:pos], pos: start})
+		default:
+			matched := false
+			for _, operator := range operators {
+				if strings.HasPrefix(source[pos:], operator) {
+					tokens = append(tokens, token{kind: tokenOperator, text: operator, pos: pos})
+					pos += len(operator)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, pos)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, text: "end of expression", pos: len(source)}), nil
+}
+
+// readString reads a quoted string starting at pos and returns its value and the position after the closing quote.
+// The escapes \n, \t, \\ and escaped quotes are supported in both quote styles.
+func readString(source string, pos int) (string, int, error) {
+	quote := source[pos]
+	var builder strings.Builder
+	for i := pos + 1; i < len(source); i++ {
+		switch source[i] {
+		case quote:
+			return builder.String(), i + 1, nil
+		case '\\':
+			if i+1 >= len(source) {
+				break
+			}
+			i++
+			switch source[i] {
+			case 'n':
+				builder.WriteByte('\n')
+			case 't':
+				builder.WriteByte('\t')
+			case '\\', '"', '\'':
+				builder.WriteByte(source[i])
+			default:
+				// Other escapes are kept, so regular expressions like "\d+" don't need double escaping
+				builder.WriteByte('\\')
+				builder.WriteByte(source[i])
+			}
+		default:
+			builder.WriteByte(source[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string at position %d", pos)
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it's one of the operators.
+func (p *parser) accept(operators ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokenOperator {
+		return "", false
+	}
+	for _, operator := range operators {
+		if t.text == operator {
+			p.pos++
+			return operator, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expect(operator string) error {
+	if _, ok := p.accept(operator); !ok {
+		t := p.peek()
+		return fmt.Errorf("expected %q at position %d, got %q", operator, t.pos, t.text)
+	}
+	return nil
+}
+
+func (p *parser) parseExpression() (node, error) {
+	return p.parseBinary(0)
+}
+
+// precedence lists the binary operators from the lowest to the highest precedence.
+var precedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) parseBinary(level int) (node, error) {
+	if level == len(precedence) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		operator, ok := p.accept(precedence[level]...)
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{operator: operator, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if operator, ok := p.accept("!", "-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{operator: operator, operand: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	n, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch operator, _ := p.accept(".", "[", "("); operator {
+		case ".":
+			name := p.next()
+			if name.kind != tokenIdent {
+				return nil, fmt.Errorf("expected a member name at position %d, got %q", name.pos, name.text)
+			}
+			n = &memberNode{target: n, key: &literalNode{value: name.text}}
+		case "[":
+			key, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			n = &memberNode{target: n, key: key}
+		case "(":
+			identifier, ok := n.(*identifierNode)
+			if !ok {
+				return nil, errors.New("only functions can be called")
+			}
+			function, ok := functions[identifier.name]
+			if !ok {
+				return nil, fmt.Errorf("unknown function %s", identifier.name)
+			}
+			args, err := p.parseArguments()
+			if err != nil {
+				return nil, err
+			}
+			n = &callNode{name: identifier.name, function: function, args: args}
+		default:
+			return n, nil
+		}
+	}
+}
+
+func (p *parser) parseArguments() ([]node, error) {
+	args := []node{}
+	if _, ok := p.accept(")"); ok {
+		return args, nil
+	}
+	for {
+		arg, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if _, ok := p.accept(","); !ok {
+			return args, p.expect(")")
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber, tokenString:
+		return &literalNode{value: t.value}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "nil", "null":
+			return &literalNode{value: nil}, nil
+		}
+		return &identifierNode{name: t.text}, nil
+	case tokenOperator:
+		if t.text == "(" {
+			n, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+}
+
+type node interface {
+	eval(env map[string]any) (any, error)
+}
+
+type literalNode struct {
+	value any
+}
+
+func (n *literalNode) eval(env map[string]any) (any, error) {
+	return n.value, nil
+}
+
+type identifierNode struct {
+	name string
+}
+
+func (n *identifierNode) eval(env map[string]any) (any, error) {
+	value, ok := env[n.name]
+	if !ok {
+		return nil, fmt.Errorf("unknown identifier %s", n.name)
+	}
+	return value, nil
+}
+
+type memberNode struct {
+	target node
+	key    node
+}
+
+func (n *memberNode) eval(env map[string]any) (any, error) {
+	target, err := n.target.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	key, err := n.key.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return member(target, key), nil
+}
+
+// member returns the member of a map or struct, or the element of a slice, array or string. Missing members are nil.
+func member(target any, key any) any {
+	v := reflect.ValueOf(target)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		keyValue := reflect.ValueOf(key)
+		if key == nil || !keyValue.Type().ConvertibleTo(v.Type().Key()) {
+			return nil
+		}
+		value := v.MapIndex(keyValue.Convert(v.Type().Key()))
+		if !value.IsValid() {
+			return nil
+		}
+		return value.Interface()
+	case reflect.Struct:
+		name, ok := key.(string)
+		if !ok {
+			return nil
+		}
+		field := v.FieldByName(name)
+		if !field.IsValid() || !field.CanInterface() {
+			return nil
+		}
+		return field.Interface()
+	case reflect.Slice, reflect.Array, reflect.String:
+		number, ok := toNumber(key)
+		if !ok || number != math.Trunc(number) {
+			return nil
+		}
+		index := int(number)
+		if index < 0 {
+			index += v.Len()
+		}
+		if index < 0 || index >= v.Len() {
+			return nil
+		}
+		if v.Kind() == reflect.String {
+			return string(v.String()[index])
+		}
+		return v.Index(index).Interface()
+	}
+	return nil
+}
+
+type callNode struct {
+	name     string
+	function Function
+	args     []node
+}
+
+func (n *callNode) eval(env map[string]any) (any, error) {
+	args := make([]any, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	result, err := n.function(args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return result, nil
+}
+
+type unaryNode struct {
+	operator string
+	operand  node
+}
+
+func (n *unaryNode) eval(env map[string]any) (any, error) {
+	value, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.operator == "!" {
+		return !Truthy(value), nil
+	}
+	number, ok := toNumber(value)
+	if !ok {
+		return nil, fmt.Errorf("cannot negate %v", value)
+	}
+	return -number, nil
+}
+
+type binaryNode struct {
+	operator string
+	left     node
+	right    node
+}
+
+func (n *binaryNode) eval(env map[string]any) (any, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// The logical operators short-circuit
+	switch n.operator {
+	case "&&":
+		if !Truthy(left) {
+			return false, nil
+		}
+		right, err := n.right.eval(env)
+		return Truthy(right), err
+	case "||":
+		if Truthy(left) {
+			return true, nil
+		}
+		right, err := n.right.eval(env)
+		return Truthy(right), err
+	}
+
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.operator {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "<", "<=", ">", ">=":
+		return compare(n.operator, left, right)
+	}
+	return arithmetic(n.operator, left, right)
+}
+
+// equal compares numbers by value regardless of their Go type and other values with reflect.DeepEqual.
+func equal(left any, right any) bool {
+	leftNumber, leftOk := toNumber(left)
+	rightNumber, rightOk := toNumber(right)
+	if leftOk && rightOk {
+		return leftNumber == rightNumber
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+func compare(operator string, left any, right any) (bool, error) {
+	if left == nil || right == nil {
+		return false, nil
+	}
+
+	var result int
+	leftNumber, leftOk := toNumber(left)
+	rightNumber, rightOk := toNumber(right)
+	leftString, leftIsString := left.(string)
+	rightString, rightIsString := right.(string)
+	switch {
+	case leftOk && rightOk:
+		result = compareOrdered(leftNumber, rightNumber)
+	case leftIsString && rightIsString:
+		result = strings.Compare(leftString, rightString)
+	default:
+		return false, fmt.Errorf("cannot compare %v and %v", left, right)
+	}
+
+	switch operator {
+	case "<":
+		return result < 0, nil
+	case "<=":
+		return result <= 0, nil
+	case ">":
+		return result > 0, nil
+	}
+	return result >= 0, nil
+}
+
+func compareOrdered(left float64, right float64) int {
+	switch {
+	case left < right:
+		return -1
+	case left > right:
+		return 1
+	}
+	return 0
+}
+
+func arithmetic(operator string, left any, right any) (any, error) {
+	if operator == "+" {
+		leftString, leftIsString := left.(string)
+		rightString, rightIsString := right.(string)
+		if leftIsString || rightIsString {
+			if !leftIsString {
+				leftString = fmt.Sprint(left)
+			}
+			if !rightIsString {
+				rightString = fmt.Sprint(right)
+			}
+			return leftString + rightString, nil
+		}
+	}
+
+	leftNumber, leftOk := toNumber(left)
+	rightNumber, rightOk := toNumber(right)
+	if !leftOk || !rightOk {
+		return nil, fmt.Errorf("operator %s needs numbers, got %v and %v", operator, left, right)
+	}
+	switch operator {
+	case "+":
+		return leftNumber + rightNumber, nil
+	case "-":
+		return leftNumber - rightNumber, nil
+	case "*":
+		return leftNumber * rightNumber, nil
+	case "/":
+		if rightNumber == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return leftNumber / rightNumber, nil
+	}
+	if rightNumber == 0 {
+		return nil, errors.New("division by zero")
+	}
+	return math.Mod(leftNumber, rightNumber), nil
+}
+
+// toNumber converts Go numbers of any type to float64. Strings and other values are not converted.
+func toNumber(value any) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+func lenFunction(args ...any) (any, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected 1 argument, got %d", len(args))
+	}
+	if args[0] == nil {
+		return 0.0, nil
+	}
+	v := reflect.ValueOf(args[0])
+	switch v.Kind() {
+	case reflect.String:
+		return float64(len([]rune(v.String()))), nil
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), nil
+	}
+	return nil, fmt.Errorf("cannot get the length of %v", args[0])
+}
+
+func containsFunction(args ...any) (any, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("expected 2 arguments, got %d", len(args))
+	}
+	if text, ok := args[0].(string); ok {
+		substring, ok := args[1].(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a string to search for, got %v", args[1])
+		}
+		return strings.Contains(text, substring), nil
+	}
+	if args[0] == nil {
+		return false, nil
+	}
+
+	v := reflect.ValueOf(args[0])
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if equal(v.Index(i).Interface(), args[1]) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case reflect.Map:
+		return member(args[0], args[1]) != nil, nil
+	}
+	return nil, fmt.Errorf("cannot search in %v", args[0])
+}
+
+// stringArgs checks that all arguments are strings.
+func stringArgs(count int, args []any) ([]string, error) {
+	if len(args) != count {
+		return nil, fmt.Errorf("expected %d arguments, got %d", count, len(args))
+	}
+	strs := make([]string, count)
+	for i, arg := range args {
+		str, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a string, got %v", arg)
+		}
+		strs[i] = str
+	}
+	return strs, nil
+}
+
+func stringPredicate(predicate func(s string, affix string) bool) Function {
+	return func(args ...any) (any, error) {
+		strs, err := stringArgs(2, args)
+		if err != nil {
+			return nil, err
+		}
+		return predicate(strs[0], strs[1]), nil
+	}
+}
+
+func stringFunction(convert func(s string) string) Function {
+	return func(args ...any) (any, error) {
+		strs, err := stringArgs(1, args)
+		if err != nil {
+			return nil, err
+		}
+		return convert(strs[0]), nil
+	}
+}
+
+func stringConversionFunction(args ...any) (any, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected 1 argument, got %d", len(args))
+	}
+	switch v := args[0].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	}
+	return fmt.Sprint(args[0]), nil
+}
+
+func numberFunction(args ...any) (any, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected 1 argument, got %d", len(args))
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+	if number, ok := toNumber(args[0]); ok {
+		return number, nil
+	}
+	if text, ok := args[0].(string); ok {
+		number, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", text)
+		}
+		return number, nil
+	}
+	return nil, fmt.Errorf("%v is not a number", args[0])
+}
+
+// regexps caches the compiled patterns of matches and find, since conditions are usually evaluated many times with the same patterns.
+var regexps sync.Map
+
+func compileRegexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexps.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexps.Store(pattern, re)
+	return re, nil
+}
+
+func matchesFunction(args ...any) (any, error) {
+	strs, err := stringArgs(2, args)
+	if err != nil {
+		return nil, err
+	}
+	re, err := compileRegexp(strs[1])
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString(strs[0]), nil
+}
+
+func findFunction(args ...any) (any, error) {
+	strs, err := stringArgs(2, args)
+	if err != nil {
+		return nil, err
+	}
+	re, err := compileRegexp(strs[1])
+	if err != nil {
+		return nil, err
+	}
+	match := re.FindStringSubmatch(strs[0])
+	switch {
+	case match == nil:
+		return "", nil
+	case len(match) > 1:
+		return match[1], nil
+	}
+	return match[0], nil
+}
+
+func jsonFunction(args ...any) (any, error) {
+	strs, err := stringArgs(1, args)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimSpace(strs[0])
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```")
+		if newline := strings.Index(text, "\n"); newline >= 0 {
+			text = text[newline+1:]
+		}
+		text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+	}
+
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return nil, nil
+	}
+	return value, nil
+}
@@ -0,0 +1,177 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testMemory struct {
+	Topic string
+	Count int
+}
+
+func TestEval(t *testing.T) {
+	env := map[string]any{
+		"Text": "approved",
+		"Variables": map[string]any{
+			"count": 3,
+			"items": []any{"a", "b"},
+			"user":  map[string]any{"name": "Ada"},
+		},
+		"Memory": &testMemory{Topic: "go", Count: 2},
+	}
+
+	tests := []struct {
+		expression string
+		expected   any
+	}{
+		{`Text == "approved"`, true},
+		{`Text != 'approved'`, false},
+		{`Variables.count < 5 && Variables.count >= 3`, true},
+		{`Variables.count + 2 * 3`, 9.0},
+		{`(Variables.count + 2) * 3`, 15.0},
+		{`Variables.count % 2 == 1`, true},
+		{`-Variables.count`, -3.0},
+		{`Variables.items[1]`, "b"},
+		{`Variables.items[-1]`, "b"},
+		{`Variables["user"].name`, "Ada"},
+		{`Variables.missing.name`, nil},
+		{`Variables.missing == nil`, true},
+		{`!Variables.missing`, true},
+		{`Memory.Topic + "-" + Memory.Count`, "go-2"},
+		{`len(Variables.items) == 2`, true},
+		{`len(Text)`, 8.0},
+		{`Text < "b"`, true},
+		{`false || Variables.count`, true},
+		{`Variables.missing > 1 || Variables.missing <= 1`, false},
+	}
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			result, err := Eval(test.expression, env)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, result)
+		})
+	}
+}
+
+func TestEval_ShortCircuit(t *testing.T) {
+	result, err := Eval(`false && unknown`, map[string]any{})
+	assert.NoError(t, err)
+	assert.Equal(t, false, result)
+
+	result, err = Eval(`true || unknown`, map[string]any{})
+	assert.NoError(t, err)
+	assert.Equal(t, true, result)
+}
+
+func TestEval_Errors(t *testing.T) {
+	tests := map[string]string{
+		``:              "expression is empty",
+		`a ==`:          `unexpected "end of expression" at position 4`,
+		`(1 + 2`:        `expected ")" at position 6, got "end of expression"`,
+		`"open`:         "unterminated string at position 0",
+		`a # b`:         `unexpected character '#' at position 2`,
+		`unknown`:       "unknown identifier unknown",
+		`missing(1)`:    "unknown function missing",
+		`1 / 0`:         "division by zero",
+		`"a" < 1`:       "cannot compare a and 1",
+		`"a" * 2`:       "operator * needs numbers, got a and 2",
+		`len(1)`:        "len: cannot get the length of 1",
+		`len()`:         "len: expected 1 argument, got 0",
+		`1 2`:           `unexpected "2" at position 2`,
+		`Variables.(1)`: `expected a member name at position 10, got "("`,
+	}
+	for expression, expected := range tests {
+		t.Run(expression, func(t *testing.T) {
+			_, err := Eval(expression, map[string]any{"Variables": map[string]any{}})
+			assert.EqualError(t, err, expected)
+		})
+	}
+}
+
+func TestEvalBool(t *testing.T) {
+	e, err := Compile(`Variables.done`)
+	require.NoError(t, err)
+	assert.Equal(t, "Variables.done", e.String())
+
+	result, err := e.EvalBool(map[string]any{"Variables": map[string]any{"done": "yes"}})
+	assert.NoError(t, err)
+	assert.True(t, result)
+
+	result, err = e.EvalBool(map[string]any{"Variables": map[string]any{}})
+	assert.NoError(t, err)
+	assert.False(t, result)
+}
+
+func TestTruthy(t *testing.T) {
+	assert.False(t, Truthy(nil))
+	assert.False(t, Truthy(0))
+	assert.False(t, Truthy(""))
+	assert.False(t, Truthy([]string{}))
+	assert.False(t, Truthy((*testMemory)(nil)))
+	assert.True(t, Truthy(1.5))
+	assert.True(t, Truthy("false"))
+	assert.True(t, Truthy(map[string]any{"a": 1}))
+	assert.True(t, Truthy(testMemory{}))
+}
+
+func TestEval_Functions(t *testing.T) {
+	env := map[string]any{
+		"Text":      "  Route: Billing. ",
+		"Reply":     "```json\n{\"route\": \"sales\", \"score\": \"7\"}\n```",
+		"Variables": map[string]any{"tags": []any{"urgent", "vip"}, "limits": map[string]any{"max": 3}},
+	}
+
+	tests := []struct {
+		expression string
+		expected   any
+	}{
+		{`contains(Text, "Billing")`, true},
+		{`contains(Variables.tags, "vip")`, true},
+		{`contains(Variables.tags, "spam")`, false},
+		{`contains(Variables.limits, "max")`, true},
+		{`contains(Variables.missing, "x")`, false},
+		{`startsWith(trim(Text), "Route")`, true},
+		{`endsWith(Text, "x")`, false},
+		{`lower(trim(Text))`, "route: billing."},
+		{`upper("a")`, "A"},
+		{`matches(Text, "(?i)route:\s*billing")`, true},
+		{`matches(Text, '^\d+$')`, false},
+		{`find(Text, "Route:\s*(\w+)")`, "Billing"},
+		{`find(Text, "\w+:")`, "Route:"},
+		{`find(Text, "missing")`, ""},
+		{`json(Reply).route == "sales"`, true},
+		{`number(json(Reply).score) >= 7`, true},
+		{`json(Text)`, nil},
+		{`json('[1, 2]')[1]`, 2.0},
+		{`string(1.5) + string(nil)`, "1.5"},
+		{`number(" 42 ")`, 42.0},
+		{`number(json(Text).score)`, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			result, err := Eval(test.expression, env)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, result)
+		})
+	}
+}
+
+func TestEval_FunctionErrors(t *testing.T) {
+	tests := map[string]string{
+		`number("x")`:        `number: "x" is not a number`,
+		`lower(1)`:           "lower: expected a string, got 1",
+		`matches("a", "(")`:  "matches: error parsing regexp: missing closing ): `(`",
+		`contains(1, 2)`:     "contains: cannot search in 1",
+		`startsWith("a")`:    "startsWith: expected 2 arguments, got 1",
+		`contains("a", nil)`: "contains: expected a string to search for, got <nil>",
+	}
+	for expression, expected := range tests {
+		t.Run(expression, func(t *testing.T) {
+			_, err := Eval(expression, map[string]any{})
+			assert.EqualError(t, err, expected)
+		})
+	}
+}
@@ -0,0 +1,486 @@
+// Package jsonschema validates decoded JSON values against the subset of JSON Schema used for tool parameters and structured output.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxDepth limits the nesting of schemas while validating, so recursive references which don't descend into the value can't loop forever.
+const maxDepth = 256
+
+// keywords holds the supported keywords. Annotations are accepted and don't affect validation.
+var keywords = map[string]bool{
+	"type": true, "enum": true, "const": true,
+	"properties": true, "required": true, "additionalProperties": true, "minProperties": true, "maxProperties": true,
+	"items": true, "minItems": true, "maxItems": true, "uniqueItems": true,
+	"minimum": true, "maximum": true, "exclusiveMinimum": true, "exclusiveMaximum": true, "multipleOf": true,
+	"minLength": true, "maxLength": true, "pattern": true,
+	"allOf": true, "anyOf": true, "oneOf": true, "not": true,
+	"$ref": true, "$defs": true, "definitions": true,
+
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true, "default": true,
+	"examples": true, "deprecated": true, "readOnly": true, "writeOnly": true,
+}
+
+// Validate checks a value decoded by encoding/json against a JSON schema.
+// The keywords type, enum, const, properties, required, additionalProperties, minProperties, maxProperties, items, minItems, maxItems, uniqueItems, minimum, maximum, exclusiveMinimum, exclusiveMaximum, multipleOf, minLength, maxLength, pattern, allOf, anyOf, oneOf, not and $ref to the same schema (like "#/$defs/address") are supported.
+// Other keywords are ignored, use Check to reject schemas which rely on them.
+//
+// Parameters:
+//   - schema: The JSON schema
+//   - value: The value to validate. Numbers must be float64 or json.Number like encoding/json produces them.
+//
+// Returns:
+//   - An error describing the first violation, with the path of the invalid value, or nil if the value is valid
+func Validate(schema map[string]any, value any) error {
+	normalized := normalize(schema)
+	v := &validator{root: normalized}
+	return v.validate(normalized, value, "$", 0)
+}
+
+// Check returns an error if the schema uses keywords Validate doesn't support, a $ref which can't be resolved or an invalid pattern.
+// Values validated against such a schema could pass although they violate it, so schemas should be checked before they are used.
+func Check(schema map[string]any) error {
+	normalized := normalize(schema)
+	return check(normalized, normalized, "$")
+}
+
+func check(root map[string]any, schema map[string]any, path string) error {
+	names := make([]string, 0, len(schema))
+	for name := range schema {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !keywords[name] {
+			return fmt.Errorf("%s: unsupported keyword %q", path, name)
+		}
+		value := schema[name]
+		switch name {
+		case "properties", "$defs", "definitions":
+			children, ok := value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s: %s must be an object", path, name)
+			}
+			if err := checkChildren(root, children, path+"."+name); err != nil {
+				return err
+			}
+		case "items", "not":
+			child, ok := value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s: %s must be a schema", path, name)
+			}
+			if err := check(root, child, path+"."+name); err != nil {
+				return err
+			}
+		case "additionalProperties":
+			if child, ok := value.(map[string]any); ok {
+				if err := check(root, child, path+"."+name); err != nil {
+					return err
+				}
+			}
+		case "allOf", "anyOf", "oneOf":
+			list, ok := value.([]any)
+			if !ok || len(list) == 0 {
+				return fmt.Errorf("%s: %s must be a non-empty array of schemas", path, name)
+			}
+			for i, item := range list {
+				child, ok := item.(map[string]any)
+				if !ok {
+					return fmt.Errorf("%s.%s[%d]: must be a schema", path, name, i)
+				}
+				if err := check(root, child, fmt.Sprintf("%s.%s[%d]", path, name, i)); err != nil {
+					return err
+				}
+			}
+		case "$ref":
+			ref, _ := value.(string)
+			if _, err := resolve(root, ref); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		case "pattern":
+			pattern, _ := value.(string)
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("%s: invalid pattern %q: %w", path, pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+func checkChildren(root map[string]any, children map[string]any, path string) error {
+	names := make([]string, 0, len(children))
+	for name := range children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		child, ok := children[name].(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s.%s: must be a schema", path, name)
+		}
+		if err := check(root, child, path+"."+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolve returns the schema a $ref points to. Only references within the same schema are supported, as JSON pointers like "#/$defs/address".
+func resolve(root map[string]any, ref string) (map[string]any, error) {
+	if ref == "#" {
+		return root, nil
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref %q, only references within the schema are supported", ref)
+	}
+	current := root
+	for _, token := range strings.Split(ref[2:], "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		next, ok := current[token].(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("$ref %q not found", ref)
+		}
+		current = next
+	}
+	return current, nil
+}
+
+// ValidateJSON decodes the JSON text and validates it against the schema.
+func ValidateJSON(schema map[string]any, data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return Validate(schema, value)
+}
+
+// normalize converts the schema to the generic form encoding/json produces, so schemas built in Go and schemas decoded from JSON are handled the same way.
+func normalize(schema map[string]any) map[string]any {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return schema
+	}
+	var normalized map[string]any
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return schema
+	}
+	return normalized
+}
+
+// validator validates values against a schema whose references are resolved in root.
+type validator struct {
+	root map[string]any
+}
+
+func (v *validator) validate(schema map[string]any, value any, path string, depth int) error {
+	if schema == nil {
+		return nil
+	}
+	if depth > maxDepth {
+		return fmt.Errorf("%s: the schema is nested too deeply", path)
+	}
+	if number, ok := value.(json.Number); ok {
+		f, err := number.Float64()
+		if err != nil {
+			return fmt.Errorf("%s: invalid number %s", path, number)
+		}
+		value = f
+	}
+
+	if types := schemaTypes(schema); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if hasType(value, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(types, " or "), typeName(value))
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, item := range enum {
+			if reflect.DeepEqual(item, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value %v is not one of %v", path, value, enum)
+		}
+	}
+	if constant, ok := schema["const"]; ok && !reflect.DeepEqual(constant, value) {
+		return fmt.Errorf("%s: value %v is not %v", path, value, constant)
+	}
+	if err := v.validateCombinations(schema, value, path, depth); err != nil {
+		return err
+	}
+
+	switch typed := value.(type) {
+	case map[string]any:
+		return v.validateObject(schema, typed, path, depth)
+	case []any:
+		return v.validateArray(schema, typed, path, depth)
+	case string:
+		return validateString(schema, typed, path)
+	case float64:
+		return validateNumber(schema, typed, path)
+	}
+	return nil
+}
+
+// validateCombinations checks $ref, allOf, anyOf, oneOf and not.
+func (v *validator) validateCombinations(schema map[string]any, value any, path string, depth int) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		target, err := resolve(v.root, ref)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := v.validate(target, value, path, depth+1); err != nil {
+			return err
+		}
+	}
+	if all, ok := schema["allOf"].([]any); ok {
+		for _, item := range all {
+			sub, _ := item.(map[string]any)
+			if err := v.validate(sub, value, path, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	if alternatives, ok := schema["anyOf"].([]any); ok {
+		var firstErr error
+		matched := false
+		for _, item := range alternatives {
+			sub, _ := item.(map[string]any)
+			err := v.validate(sub, value, path, depth+1)
+			if err == nil {
+				matched = true
+				break
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: value doesn't match any schema of anyOf, the first fails with: %w", path, firstErr)
+		}
+	}
+	if one, ok := schema["oneOf"].([]any); ok {
+		matches := 0
+		for _, item := range one {
+			sub, _ := item.(map[string]any)
+			if v.validate(sub, value, path, depth+1) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fmt.Errorf("%s: value matches %d schemas of oneOf, expected exactly one", path, matches)
+		}
+	}
+	if not, ok := schema["not"].(map[string]any); ok && v.validate(not, value, path, depth+1) == nil {
+		return fmt.Errorf("%s: value must not match the schema of not", path)
+	}
+	return nil
+}
+
+func (v *validator) validateObject(schema map[string]any, value map[string]any, path string, depth int) error {
+	properties, _ := schema["properties"].(map[string]any)
+
+	if minProperties, ok := schema["minProperties"].(float64); ok && float64(len(value)) < minProperties {
+		return fmt.Errorf("%s: expected at least %v properties, got %d", path, minProperties, len(value))
+	}
+	if maxProperties, ok := schema["maxProperties"].(float64); ok && float64(len(value)) > maxProperties {
+		return fmt.Errorf("%s: expected at most %v properties, got %d", path, maxProperties, len(value))
+	}
+
+	if required, ok := schema["required"].([]any); ok {
+		for _, name := range required {
+			key, _ := name.(string)
+			if _, exists := value[key]; !exists {
+				return fmt.Errorf("%s: missing required property %q", path, key)
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		propertyPath := path + "." + key
+		if property, ok := properties[key].(map[string]any); ok {
+			if err := v.validate(property, value[key], propertyPath, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				return fmt.Errorf("%s: property is not allowed", propertyPath)
+			}
+		case map[string]any:
+			if err := v.validate(additional, value[key], propertyPath, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v *validator) validateArray(schema map[string]any, value []any, path string, depth int) error {
+	if minItems, ok := schema["minItems"].(float64); ok && float64(len(value)) < minItems {
+		return fmt.Errorf("%s: expected at least %v items, got %d", path, minItems, len(value))
+	}
+	if maxItems, ok := schema["maxItems"].(float64); ok && float64(len(value)) > maxItems {
+		return fmt.Errorf("%s: expected at most %v items, got %d", path, maxItems, len(value))
+	}
+	if unique, ok := schema["uniqueItems"].(bool); ok && unique {
+		for i := range value {
+			for j := i + 1; j < len(value); j++ {
+				if reflect.DeepEqual(value[i], value[j]) {
+					return fmt.Errorf("%s: items %d and %d are equal, expected unique items", path, i, j)
+				}
+			}
+		}
+	}
+	if items, ok := schema["items"].(map[string]any); ok {
+		for i, item := range value {
+			if err := v.validate(items, item, fmt.Sprintf("%s[%d]", path, i), depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateString(schema map[string]any, value string, path string) error {
+	length := float64(len([]rune(value)))
+	if minLength, ok := schema["minLength"].(float64); ok && length < minLength {
+		return fmt.Errorf("%s: expected at least %v characters, got %v", path, minLength, length)
+	}
+	if maxLength, ok := schema["maxLength"].(float64); ok && length > maxLength {
+		return fmt.Errorf("%s: expected at most %v characters, got %v", path, maxLength, length)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("%s: invalid pattern %q: %w", path, pattern, err)
+		}
+		if !re.MatchString(value) {
+			return fmt.Errorf("%s: value %q doesn't match pattern %q", path, value, pattern)
+		}
+	}
+	return nil
+}
+
+func validateNumber(schema map[string]any, value float64, path string) error {
+	if minimum, ok := schema["minimum"].(float64); ok && value < minimum {
+		return fmt.Errorf("%s: value %v is less than the minimum %v", path, value, minimum)
+	}
+	if maximum, ok := schema["maximum"].(float64); ok && value > maximum {
+		return fmt.Errorf("%s: value %v is greater than the maximum %v", path, value, maximum)
+	}
+	// exclusiveMinimum and exclusiveMaximum are numbers since draft 6 and flags for minimum and maximum in draft 4
+	switch exclusive := schema["exclusiveMinimum"].(type) {
+	case float64:
+		if value <= exclusive {
+			return fmt.Errorf("%s: value %v must be greater than %v", path, value, exclusive)
+		}
+	case bool:
+		if minimum, ok := schema["minimum"].(float64); ok && exclusive && value <= minimum {
+			return fmt.Errorf("%s: value %v must be greater than %v", path, value, minimum)
+		}
+	}
+	switch exclusive := schema["exclusiveMaximum"].(type) {
+	case float64:
+		if value >= exclusive {
+			return fmt.Errorf("%s: value %v must be less than %v", path, value, exclusive)
+		}
+	case bool:
+		if maximum, ok := schema["maximum"].(float64); ok && exclusive && value >= maximum {
+			return fmt.Errorf("%s: value %v must be less than %v", path, value, maximum)
+		}
+	}
+	if multipleOf, ok := schema["multipleOf"].(float64); ok && multipleOf > 0 {
+		quotient := value / multipleOf
+		if math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			return fmt.Errorf("%s: value %v is not a multiple of %v", path, value, multipleOf)
+		}
+	}
+	return nil
+}
+
+func schemaTypes(schema map[string]any) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []any:
+		types := []string{}
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func hasType(value any, t string) bool {
+	switch t {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == math.Trunc(f)
+	case "null":
+		return value == nil
+	}
+	return false
+}
+
+func typeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
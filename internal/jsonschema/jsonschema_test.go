@@ -0,0 +1,141 @@
+package jsonschema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	schema := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"name":   map[string]any{"type": "string", "minLength": 1, "pattern": "^[A-Z]"},
+			"age":    map[string]any{"type": "integer", "minimum": 0, "maximum": 150},
+			"status": map[string]any{"type": "string", "enum": []string{"active", "inactive"}},
+			"tags": map[string]any{
+				"type":     "array",
+				"items":    map[string]any{"type": "string"},
+				"maxItems": 2,
+			},
+			"nickname": map[string]any{"type": []string{"string", "null"}},
+		},
+		"required":             []string{"name", "age"},
+		"additionalProperties": false,
+	}
+
+	tests := []struct {
+		name    string
+		json    string
+		wantErr string
+	}{
+		{name: "valid", json: `{"name": "Ann", "age": 30, "status": "active", "tags": ["a"], "nickname": null}`},
+		{name: "invalid JSON", json: `{"name": `, wantErr: "invalid JSON"},
+		{name: "wrong root type", json: `[]`, wantErr: "$: expected object, got array"},
+		{name: "missing required", json: `{"name": "Ann"}`, wantErr: `$: missing required property "age"`},
+		{name: "not an integer", json: `{"name": "Ann", "age": 1.5}`, wantErr: "$.age: expected integer, got number"},
+		{name: "below minimum", json: `{"name": "Ann", "age": -1}`, wantErr: "$.age: value -1 is less than the minimum 0"},
+		{name: "above maximum", json: `{"name": "Ann", "age": 200}`, wantErr: "$.age: value 200 is greater than the maximum 150"},
+		{name: "enum", json: `{"name": "Ann", "age": 1, "status": "gone"}`, wantErr: "$.status: value gone is not one of [active inactive]"},
+		{name: "pattern", json: `{"name": "ann", "age": 1}`, wantErr: `$.name: value "ann" doesn't match pattern "^[A-Z]"`},
+		{name: "min length", json: `{"name": "", "age": 1}`, wantErr: "$.name: expected at least 1 characters, got 0"},
+		{name: "items", json: `{"name": "Ann", "age": 1, "tags": [1]}`, wantErr: "$.tags[0]: expected string, got number"},
+		{name: "max items", json: `{"name": "Ann", "age": 1, "tags": ["a", "b", "c"]}`, wantErr: "$.tags: expected at most 2 items, got 3"},
+		{name: "additional property", json: `{"name": "Ann", "age": 1, "extra": true}`, wantErr: "$.extra: property is not allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateJSON(schema, []byte(tt.json))
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateWithoutSchema(t *testing.T) {
+	assert.NoError(t, Validate(nil, map[string]any{"a": 1.0}))
+	assert.NoError(t, Validate(map[string]any{}, "anything"))
+}
+
+func TestValidate_CombinationsAndReferences(t *testing.T) {
+	schema := map[string]any{
+		"$defs": map[string]any{
+			"positive": map[string]any{"type": "number", "exclusiveMinimum": 0},
+		},
+		"type": "object",
+		"properties": map[string]any{
+			"price":    map[string]any{"$ref": "#/$defs/positive"},
+			"quantity": map[string]any{"allOf": []any{map[string]any{"type": "integer"}, map[string]any{"multipleOf": 5}}},
+			"contact":  map[string]any{"anyOf": []any{map[string]any{"type": "string", "pattern": "@"}, map[string]any{"type": "integer"}}},
+			"kind":     map[string]any{"oneOf": []any{map[string]any{"const": "a"}, map[string]any{"type": "string", "maxLength": 1}}},
+			"name":     map[string]any{"type": "string", "not": map[string]any{"const": "admin"}},
+			"tags":     map[string]any{"type": "array", "uniqueItems": true},
+		},
+		"minProperties": 1,
+	}
+
+	tests := []struct {
+		name    string
+		json    string
+		wantErr string
+	}{
+		{name: "valid", json: `{"price": 1.5, "quantity": 10, "contact": "a@b.c", "kind": "b", "name": "ann", "tags": [1, 2]}`},
+		{name: "ref", json: `{"price": 0}`, wantErr: "$.price: value 0 must be greater than 0"},
+		{name: "allOf", json: `{"quantity": 7}`, wantErr: "$.quantity: value 7 is not a multiple of 5"},
+		{name: "anyOf", json: `{"contact": "nobody"}`, wantErr: `$.contact: value doesn't match any schema of anyOf, the first fails with: $.contact: value "nobody" doesn't match pattern "@"`},
+		{name: "oneOf", json: `{"kind": "a"}`, wantErr: "$.kind: value matches 2 schemas of oneOf, expected exactly one"},
+		{name: "not", json: `{"name": "admin"}`, wantErr: "$.name: value must not match the schema of not"},
+		{name: "uniqueItems", json: `{"tags": [1, 1]}`, wantErr: "$.tags: items 0 and 1 are equal, expected unique items"},
+		{name: "minProperties", json: `{}`, wantErr: "$: expected at least 1 properties, got 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateJSON(schema, []byte(tt.json))
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+
+	// Draft 4 uses exclusiveMaximum as a flag for maximum
+	assert.EqualError(t, Validate(map[string]any{"maximum": 10, "exclusiveMaximum": true}, 10.0), "$: value 10 must be less than 10")
+
+	// References which don't descend into the value stop instead of looping
+	assert.ErrorContains(t, Validate(map[string]any{"$ref": "#"}, 1.0), "nested too deeply")
+}
+
+func TestCheck(t *testing.T) {
+	assert.NoError(t, Check(map[string]any{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"title":       "Person",
+		"type":        "object",
+		"properties":  map[string]any{"name": map[string]any{"type": "string", "description": "The name"}, "home": map[string]any{"$ref": "#/definitions/address"}},
+		"definitions": map[string]any{"address": map[string]any{"type": "object"}},
+	}))
+
+	tests := []struct {
+		name    string
+		schema  map[string]any
+		wantErr string
+	}{
+		{name: "format", schema: map[string]any{"properties": map[string]any{"email": map[string]any{"type": "string", "format": "email"}}}, wantErr: `$.properties.email: unsupported keyword "format"`},
+		{name: "nested in anyOf", schema: map[string]any{"anyOf": []any{map[string]any{"if": map[string]any{}}}}, wantErr: `$.anyOf[0]: unsupported keyword "if"`},
+		{name: "lowercased keyword", schema: map[string]any{"type": "string", "minlength": 1}, wantErr: `$: unsupported keyword "minlength"`},
+		{name: "remote ref", schema: map[string]any{"$ref": "https://example.com/schema.json"}, wantErr: `$: unsupported $ref "https://example.com/schema.json", only references within the schema are supported`},
+		{name: "missing ref", schema: map[string]any{"items": map[string]any{"$ref": "#/$defs/missing"}}, wantErr: `$.items: $ref "#/$defs/missing" not found`},
+		{name: "invalid pattern", schema: map[string]any{"pattern": "("}, wantErr: "$: invalid pattern \"(\": error parsing regexp: missing closing ): `(`"},
+		{name: "empty oneOf", schema: map[string]any{"oneOf": []any{}}, wantErr: "$: oneOf must be a non-empty array of schemas"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.EqualError(t, Check(tt.schema), tt.wantErr)
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package test
 
 import (
+	"context"
 	"errors"
+	"strings"
 
 	"github.com/jieliu2000/anyi/llm/chat"
 	"github.com/jieliu2000/anyi/llm/tools"
@@ -36,3 +38,53 @@ func (m *MockClient) Chat(messages []chat.Message, options *chat.ChatOptions) (*
 func NewMockClient() *MockClient {
 	return &MockClient{}
 }
+
+// SequenceClient returns the configured outputs one after another and records the messages and options of every call.
+type SequenceClient struct {
+	Outputs  []string
+	Messages [][]chat.Message
+	Options  []*chat.ChatOptions
+}
+
+func (c *SequenceClient) ChatWithFunctions(messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
+	return c.Chat(messages, options)
+}
+
+func (c *SequenceClient) Chat(messages []chat.Message, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
+	c.Messages = append(c.Messages, append([]chat.Message{}, messages...))
+	c.Options = append(c.Options, options)
+	if len(c.Outputs) == 0 {
+		return nil, chat.ResponseInfo{}, errors.New("no more outputs")
+	}
+	output := chat.NewAssistantMessage(c.Outputs[0])
+	c.Outputs = c.Outputs[1:]
+	return &output, chat.ResponseInfo{}, nil
+}
+
+// EmbeddingClient is a SequenceClient which also computes embeddings. The vector of a text counts how often each word of Vocabulary occurs in it, ignoring case and punctuation.
+type EmbeddingClient struct {
+	SequenceClient
+	Vocabulary []string
+	// Embedded records the texts of every Embed call
+	Embedded [][]string
+}
+
+func (c *EmbeddingClient) Embed(ctx context.Context, texts []string) ([][]float32, chat.ResponseInfo, error) {
+	c.Embedded = append(c.Embedded, append([]string{}, texts...))
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector := make([]float32, len(c.Vocabulary))
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+		})
+		for _, word := range words {
+			for j, term := range c.Vocabulary {
+				if word == term {
+					vector[j]++
+				}
+			}
+		}
+		vectors[i] = vector
+	}
+	return vectors, chat.ResponseInfo{PromptTokens: len(texts)}, nil
+}
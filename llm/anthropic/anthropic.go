@@ -1,19 +1,31 @@
 package anthropic
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
 
 	"github.com/jieliu2000/anyi/llm/chat"
 	"github.com/jieliu2000/anyi/llm/config"
-	"github.com/jieliu2000/anyi/llm/openai"
 	"github.com/jieliu2000/anyi/llm/tools"
-
-	impl "github.com/sashabaranov/go-openai"
+	log "github.com/sirupsen/logrus"
 )
 
 const (
 	DefaultBaseUrl = "https://api.anthropic.com"
 
+	// DefaultAPIVersion is the value sent in the anthropic-version header if no version is configured.
+	DefaultAPIVersion = "2023-06-01"
+
+	// DefaultMaxTokens is used for the required max_tokens parameter if MaxTokens is not set in the config.
+	DefaultMaxTokens = 4096
+
 	// Official Anthropic API models (verified from official documentation)
 	// https://docs.claude.com/en/docs/about-claude/models/overview
 
@@ -50,12 +62,16 @@ type AnthropicModelConfig struct {
 	BaseUrl    string `json:"baseUrl" mapstructure:"baseUrl"`
 	Model      string `json:"model" mapstructure:"model"`
 	APIVersion string `json:"apiVersion" mapstructure:"apiVersion"`
+
+	// ThinkingBudget enables extended thinking when it's greater than 0. It's the maximum number of tokens the model can use for thinking and must be less than MaxTokens, otherwise ThinkingBudget plus DefaultMaxTokens is sent as max_tokens with a warning.
+	// The thinking content is returned in the Thinking field of the response message, and the signed thinking blocks in ThinkingBlocks, which are sent back with the message in later requests as tool use requires.
+	ThinkingBudget int `json:"thinkingBudget" mapstructure:"thinkingBudget"`
 }
 
 // AnthropicClient defines the structure for Anthropic client
 type AnthropicClient struct {
 	Config     *AnthropicModelConfig
-	clientImpl *impl.Client
+	clientImpl *http.Client
 }
 
 // DefaultConfig creates default Anthropic configuration
@@ -65,7 +81,7 @@ func DefaultConfig(apiKey string) *AnthropicModelConfig {
 		APIKey:           apiKey,
 		Model:            DefaultModel,
 		BaseUrl:          DefaultBaseUrl,
-		APIVersion:       "2023-06-01", // Use the latest API version
+		APIVersion:       DefaultAPIVersion,
 	}
 }
 
@@ -82,7 +98,7 @@ func NewConfig(apiKey string, model string, baseUrl string, apiVersion string) *
 		baseUrl = DefaultBaseUrl
 	}
 	if len(apiVersion) == 0 {
-		apiVersion = "2023-06-01"
+		apiVersion = DefaultAPIVersion
 	}
 	return &AnthropicModelConfig{
 		GeneralLLMConfig: config.DefaultGeneralConfig(),
@@ -106,40 +122,377 @@ func NewClient(config *AnthropicModelConfig) (*AnthropicClient, error) {
 	if config.Model == "" {
 		config.Model = DefaultModel
 	}
-
-	// Create OpenAI compatible client
-	configImpl := impl.DefaultConfig(config.APIKey)
-	configImpl.BaseURL = config.BaseUrl
-
-	// Note: This is a simplified implementation, actual integration may require adding Anthropic-specific request headers
-	// such as 'anthropic-version'
-	// The current go-openai library doesn't directly expose methods to set custom headers
-	// A custom HTTP implementation might be needed in a production environment
+	if config.BaseUrl == "" {
+		config.BaseUrl = DefaultBaseUrl
+	}
+	if config.APIVersion == "" {
+		config.APIVersion = DefaultAPIVersion
+	}
 
 	return &AnthropicClient{
 		Config:     config,
-		clientImpl: impl.NewClientWithConfig(configImpl),
+		clientImpl: &http.Client{},
 	}, nil
 }
 
 // Chat implements chat functionality for Anthropic
 func (c *AnthropicClient) Chat(messages []chat.Message, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
-	// Create a temporary config object compatible with OpenAIModelConfig
-	openaiConfig := &openai.OpenAIModelConfig{
-		GeneralLLMConfig: c.Config.GeneralLLMConfig,
-		Model:            c.Config.Model,
-	}
+	return c.ChatContext(context.Background(), messages, options)
+}
 
-	return openai.ExecuteChat(c.clientImpl, c.Config.Model, messages, options, openaiConfig)
+// ChatContext works like Chat but sends the request with the given context. The request is aborted when the context is cancelled or its deadline expires.
+func (c *AnthropicClient) ChatContext(ctx context.Context, messages []chat.Message, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
+	return c.ChatWithFunctionsContext(ctx, messages, nil, options)
 }
 
 // ChatWithFunctions implements function calling functionality for Anthropic
 func (c *AnthropicClient) ChatWithFunctions(messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
-	// Create a temporary config object compatible with OpenAIModelConfig
-	openaiConfig := &openai.OpenAIModelConfig{
-		GeneralLLMConfig: c.Config.GeneralLLMConfig,
-		Model:            c.Config.Model,
+	return c.ChatWithFunctionsContext(context.Background(), messages, functions, options)
+}
+
+// ChatWithFunctionsContext works like ChatWithFunctions but sends the request with the given context. The request is aborted when the context is cancelled or its deadline expires.
+func (c *AnthropicClient) ChatWithFunctionsContext(ctx context.Context, messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
+	info := chat.ResponseInfo{}
+
+	request, err := c.newRequest(messages, functions, options)
+	if err != nil {
+		return nil, info, err
+	}
+
+	res, err := c.callMessagesAPI(ctx, request)
+	if err != nil {
+		return nil, info, err
+	}
+	defer res.Body.Close()
+
+	responseBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, info, err
+	}
+
+	response := AnthropicResponse{}
+	if err := json.Unmarshal(responseBody, &response); err != nil {
+		return nil, info, err
+	}
+
+	info.PromptTokens = response.Usage.InputTokens
+	info.CompletionTokens = response.Usage.OutputTokens
+
+	return ConvertFromAnthropicContent(response.Content), info, nil
+}
+
+// ChatStream sends the messages to the model and streams the response back through the returned channel.
+// Thinking deltas are delivered in the Thinking field of the chunks.
+func (c *AnthropicClient) ChatStream(ctx context.Context, messages []chat.Message, options *chat.ChatOptions) (<-chan chat.StreamChunk, error) {
+	return c.ChatWithFunctionsStream(ctx, messages, nil, options)
+}
+
+// ChatWithFunctionsStream works like ChatStream but also allows the model to call the given functions. Tool calls are streamed as fragments of their JSON input.
+func (c *AnthropicClient) ChatWithFunctionsStream(ctx context.Context, messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (<-chan chat.StreamChunk, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	request, err := c.newRequest(messages, functions, options)
+	if err != nil {
+		return nil, err
+	}
+	request.Stream = true
+
+	res, err := c.callMessagesAPI(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	output := make(chan chat.StreamChunk)
+	go func() {
+		defer close(output)
+		defer res.Body.Close()
+		readStream(ctx, res.Body, output)
+	}()
+	return output, nil
+}
+
+// newRequest creates a Messages API request with the model and generation parameters of the client applied.
+func (c *AnthropicClient) newRequest(messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (*AnthropicRequest, error) {
+	if c.Config == nil {
+		return nil, errors.New("config cannot be nil")
+	}
+
+	system, anthropicMessages, err := ConvertToAnthropicMessages(messages)
+	if err != nil {
+		return nil, err
+	}
+
+	if options != nil && (options.Schema != nil || strings.ToLower(options.Format) == "json") {
+		// The Messages API has no JSON mode, so the model is instructed through the system prompt.
+		if system != "" {
+			system += "\n\n"
+		}
+		if options.Schema != nil {
+			schema, err := json.Marshal(options.Schema)
+			if err != nil {
+				return nil, err
+			}
+			system += "Respond only with a valid JSON value which conforms to this JSON schema, without any other text:\n" + string(schema)
+		} else {
+			system += "Respond only with a valid JSON object, without any other text."
+		}
+	}
+
+	request := &AnthropicRequest{
+		Model:         c.Config.Model,
+		System:        system,
+		Messages:      anthropicMessages,
+		MaxTokens:     c.Config.MaxTokens,
+		StopSequences: c.Config.Stop,
+		Tools:         ConvertToAnthropicTools(functions),
+	}
+	if options != nil && options.MaxTokens != nil {
+		request.MaxTokens = *options.MaxTokens
+	}
+	if request.MaxTokens <= 0 {
+		request.MaxTokens = DefaultMaxTokens
+	}
+	if options != nil && len(options.Stop) > 0 {
+		request.StopSequences = options.Stop
+	}
+	if options != nil && len(functions) > 0 {
+		request.ToolChoice = convertToolChoice(options.ToolChoice)
 	}
 
-	return openai.ExecuteChatWithFunctions(c.clientImpl, c.Config.Model, messages, functions, options, openaiConfig)
+	if c.Config.ThinkingBudget > 0 {
+		request.Thinking = &AnthropicThinking{
+			Type:         "enabled",
+			BudgetTokens: c.Config.ThinkingBudget,
+		}
+		if request.MaxTokens <= c.Config.ThinkingBudget {
+			log.Warnf("max tokens %d must be more than the thinking budget %d, sending %d instead", request.MaxTokens, c.Config.ThinkingBudget, c.Config.ThinkingBudget+DefaultMaxTokens)
+			request.MaxTokens = c.Config.ThinkingBudget + DefaultMaxTokens
+		}
+		// Extended thinking doesn't allow changing temperature or top_p.
+		return request, nil
+	}
+
+	// Per-call overrides replace the sampling settings of the client. Both are sent only if both are overridden.
+	if options != nil && (options.Temperature != nil || options.TopP != nil) {
+		if options.Temperature != nil {
+			temperature := limitTemperature(*options.Temperature)
+			request.Temperature = &temperature
+		}
+		if options.TopP != nil {
+			topP := *options.TopP
+			request.TopP = &topP
+		}
+		return request, nil
+	}
+
+	// Newer models reject requests which set both temperature and top_p, so top_p is only sent when it actually narrows the sampling.
+	if c.Config.Temperature > 0 {
+		temperature := limitTemperature(c.Config.Temperature)
+		request.Temperature = &temperature
+	} else if c.Config.TopP > 0 && c.Config.TopP < 1 {
+		topP := c.Config.TopP
+		request.TopP = &topP
+	}
+	return request, nil
+}
+
+// limitTemperature returns the temperature, or 1 with a warning if it's above 1, the maximum of Anthropic models.
+func limitTemperature(temperature float32) float32 {
+	if temperature > 1 {
+		log.Warnf("temperature %v is above the maximum of 1 of Anthropic models, sending 1 instead", temperature)
+		return 1
+	}
+	return temperature
+}
+
+// convertToolChoice converts the tool choice of the chat options. "required" is mapped to "any" and a function name to a "tool" choice.
+func convertToolChoice(toolChoice string) *AnthropicToolChoice {
+	switch toolChoice {
+	case "":
+		return nil
+	case chat.ToolChoiceAuto, chat.ToolChoiceNone:
+		return &AnthropicToolChoice{Type: toolChoice}
+	case chat.ToolChoiceRequired:
+		return &AnthropicToolChoice{Type: "any"}
+	default:
+		return &AnthropicToolChoice{Type: "tool", Name: toolChoice}
+	}
+}
+
+func (c *AnthropicClient) messagesURL() string {
+	baseUrl := strings.TrimSuffix(c.Config.BaseUrl, "/")
+	baseUrl = strings.TrimSuffix(baseUrl, "/v1")
+	return baseUrl + "/v1/messages"
+}
+
+// callMessagesAPI sends the request to the Messages API and returns the response if the status is OK.
+func (c *AnthropicClient) callMessagesAPI(ctx context.Context, request *AnthropicRequest) (*http.Response, error) {
+	if c.clientImpl == nil {
+		return nil, errors.New("http client cannot be nil, maybe you didn't initiatialize the client. Considering using NewClient function")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	requestJson, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, c.messagesURL(), bytes.NewBuffer(requestJson))
+	if err != nil {
+		return nil, err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpRequest.Header.Set("x-api-key", c.Config.APIKey)
+	httpRequest.Header.Set("anthropic-version", c.Config.APIVersion)
+
+	res, err := c.clientImpl.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		errorResponse := AnthropicErrorResponse{}
+		if json.Unmarshal(body, &errorResponse) == nil && errorResponse.Error.Message != "" {
+			return nil, fmt.Errorf("error response from anthropic messages api (status %d): %s: %s", res.StatusCode, errorResponse.Error.Type, errorResponse.Error.Message)
+		}
+		return nil, fmt.Errorf("error response status from anthropic messages api: %d", res.StatusCode)
+	}
+	return res, nil
+}
+
+// readStream parses the server-sent events of a streaming response and sends the deltas to the output channel.
+func readStream(ctx context.Context, body io.Reader, output chan<- chat.StreamChunk) {
+	send := func(chunk chat.StreamChunk) bool {
+		select {
+		case output <- chunk:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	usage := chat.ResponseInfo{}
+	stopReason := ""
+	// Maps the content block index of the response to the index of the tool call.
+	toolCallIndexes := map[int]int{}
+	// The thinking blocks being streamed by content block index. They are sent in one chunk when they are complete.
+	thinkingBlocks := map[int]*AnthropicContentBlock{}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+
+		event := AnthropicStreamEvent{}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			send(chat.StreamChunk{Err: err})
+			return
+		}
+
+		chunk := chat.StreamChunk{}
+		switch event.Type {
+		case "message_start":
+			usage.PromptTokens = event.Message.Usage.InputTokens
+			chunk.Role = event.Message.Role
+		case "content_block_start":
+			if event.ContentBlock.Type == "thinking" || event.ContentBlock.Type == "redacted_thinking" {
+				block := event.ContentBlock
+				thinkingBlocks[event.Index] = &block
+			}
+			if event.ContentBlock.Type == "tool_use" {
+				index := len(toolCallIndexes)
+				toolCallIndexes[event.Index] = index
+				chunk.ToolCalls = []chat.ToolCallDelta{{
+					Index: index,
+					ID:    event.ContentBlock.ID,
+					Type:  "function",
+					Name:  event.ContentBlock.Name,
+				}}
+			}
+		case "content_block_delta":
+			switch event.Delta.Type {
+			case "text_delta":
+				chunk.Content = event.Delta.Text
+			case "thinking_delta":
+				chunk.Thinking = event.Delta.Thinking
+				if block, ok := thinkingBlocks[event.Index]; ok {
+					block.Thinking += event.Delta.Thinking
+				}
+			case "signature_delta":
+				if block, ok := thinkingBlocks[event.Index]; ok {
+					block.Signature += event.Delta.Signature
+				}
+			case "input_json_delta":
+				chunk.ToolCalls = []chat.ToolCallDelta{{
+					Index:     toolCallIndexes[event.Index],
+					Arguments: event.Delta.PartialJSON,
+				}}
+			}
+		case "content_block_stop":
+			if block, ok := thinkingBlocks[event.Index]; ok {
+				chunk.ThinkingBlocks = []chat.ThinkingBlock{convertThinkingContent(*block)}
+				delete(thinkingBlocks, event.Index)
+			}
+		case "message_delta":
+			if event.Delta.StopReason != "" {
+				stopReason = event.Delta.StopReason
+			}
+			if event.Usage != nil {
+				usage.CompletionTokens = event.Usage.OutputTokens
+			}
+		case "message_stop":
+			send(chat.StreamChunk{Done: true, FinishReason: stopReason, Usage: &usage})
+			return
+		case "error":
+			send(chat.StreamChunk{Err: fmt.Errorf("error event from anthropic messages api: %s: %s", event.Error.Type, event.Error.Message)})
+			return
+		}
+
+		if chunk.Role == "" && chunk.Content == "" && chunk.Thinking == "" && len(chunk.ToolCalls) == 0 && len(chunk.ThinkingBlocks) == 0 {
+			continue
+		}
+		if !send(chunk) {
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		send(chat.StreamChunk{Err: err})
+		return
+	}
+	send(chat.StreamChunk{Err: errors.New("anthropic stream ended unexpectedly")})
+}
+
+// ModelName returns the model of the config. It's used to look up the context window of the model.
+func (c *AnthropicClient) ModelName() string {
+	if c.Config == nil {
+		return ""
+	}
+	return c.Config.Model
+}
+
+// MaxTokens returns the max_tokens sent when a call doesn't override them: the max tokens of the config, DefaultMaxTokens if they are not set, or more if extended thinking needs them.
+// They are reserved for the reply when the context window is checked.
+func (c *AnthropicClient) MaxTokens() int {
+	if c.Config == nil {
+		return DefaultMaxTokens
+	}
+	maxTokens := c.Config.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = DefaultMaxTokens
+	}
+	if c.Config.ThinkingBudget > 0 && maxTokens <= c.Config.ThinkingBudget {
+		maxTokens = c.Config.ThinkingBudget + DefaultMaxTokens
+	}
+	return maxTokens
 }
@@ -0,0 +1,367 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/jieliu2000/anyi/internal/test"
+	"github.com/jieliu2000/anyi/llm/chat"
+	"github.com/jieliu2000/anyi/llm/tools"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewClient(t *testing.T) {
+	t.Run("Returns error when config is nil", func(t *testing.T) {
+		_, err := NewClient(nil)
+		assert.Error(t, err)
+	})
+	t.Run("Returns error when api key is empty", func(t *testing.T) {
+		_, err := NewClient(&AnthropicModelConfig{})
+		assert.Error(t, err)
+	})
+	t.Run("Fills in default values", func(t *testing.T) {
+		client, err := NewClient(&AnthropicModelConfig{APIKey: "key"})
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultModel, client.Config.Model)
+		assert.Equal(t, DefaultBaseUrl, client.Config.BaseUrl)
+		assert.Equal(t, DefaultAPIVersion, client.Config.APIVersion)
+	})
+}
+
+func TestChat(t *testing.T) {
+	mockServer := test.NewTestServer()
+	mockServer.RequestHandler = func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		assert.Equal(t, "test-api-key", r.Header.Get("x-api-key"))
+		assert.Equal(t, DefaultAPIVersion, r.Header.Get("anthropic-version"))
+
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		requestMap := make(map[string]interface{})
+		err = json.Unmarshal(body, &requestMap)
+		assert.NoError(t, err)
+
+		assert.Equal(t, ClaudeHaiku45, requestMap["model"])
+		assert.Equal(t, "You are an assistant", requestMap["system"])
+		assert.Equal(t, float64(DefaultMaxTokens), requestMap["max_tokens"])
+		assert.Equal(t, float64(1), requestMap["temperature"])
+		assert.NotContains(t, requestMap, "top_p")
+
+		messages := requestMap["messages"].([]interface{})
+		assert.Equal(t, 1, len(messages))
+		message := messages[0].(map[string]interface{})
+		assert.Equal(t, "user", message["role"])
+		assert.Equal(t, []interface{}{map[string]interface{}{"type": "text", "text": "Hello"}}, message["content"])
+
+		io.WriteString(w, `{
+			"id": "msg_1",
+			"type": "message",
+			"role": "assistant",
+			"content": [{"type": "text", "text": "Hi there"}],
+			"stop_reason": "end_turn",
+			"usage": {"input_tokens": 12, "output_tokens": 3}
+		}`)
+	}
+	defer mockServer.Close()
+	mockServer.Start()
+
+	client, err := NewClient(NewConfig("test-api-key", ClaudeHaiku45, mockServer.URL(), ""))
+	assert.NoError(t, err)
+
+	messages := []chat.Message{
+		chat.NewSystemMessage("You are an assistant"),
+		chat.NewUserMessage("Hello"),
+	}
+	response, info, err := client.Chat(messages, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "assistant", response.Role)
+	assert.Equal(t, "Hi there", response.Content)
+	assert.Equal(t, 12, info.PromptTokens)
+	assert.Equal(t, 3, info.CompletionTokens)
+}
+
+func TestChatWithThinking(t *testing.T) {
+	mockServer := test.NewTestServer()
+	mockServer.RequestHandler = func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		request := AnthropicRequest{}
+		err = json.Unmarshal(body, &request)
+		assert.NoError(t, err)
+
+		assert.Equal(t, &AnthropicThinking{Type: "enabled", BudgetTokens: 2048}, request.Thinking)
+		assert.Greater(t, request.MaxTokens, 2048)
+		assert.Nil(t, request.Temperature)
+		assert.Nil(t, request.TopP)
+
+		io.WriteString(w, `{
+			"role": "assistant",
+			"content": [
+				{"type": "thinking", "thinking": "The user greets me.", "signature": "sig"},
+				{"type": "redacted_thinking", "data": "encrypted"},
+				{"type": "text", "text": "Hello!"}
+			],
+			"usage": {"input_tokens": 5, "output_tokens": 20}
+		}`)
+	}
+	defer mockServer.Close()
+	mockServer.Start()
+
+	config := NewConfig("test-api-key", ClaudeSonnet45, mockServer.URL(), "")
+	config.ThinkingBudget = 2048
+	client, err := NewClient(config)
+	assert.NoError(t, err)
+
+	response, _, err := client.Chat([]chat.Message{chat.NewUserMessage("Hi")}, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello!", response.Content)
+	assert.Equal(t, "The user greets me.", response.Thinking)
+	assert.Equal(t, []chat.ThinkingBlock{{Thinking: "The user greets me.", Signature: "sig"}, {RedactedData: "encrypted"}}, response.ThinkingBlocks)
+}
+
+func TestChatWithFunctions(t *testing.T) {
+	mockServer := test.NewTestServer()
+	mockServer.RequestHandler = func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		request := AnthropicRequest{}
+		err = json.Unmarshal(body, &request)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 1, len(request.Tools))
+		assert.Equal(t, "get_weather", request.Tools[0].Name)
+		assert.Equal(t, []interface{}{"city"}, request.Tools[0].InputSchema["required"])
+
+		io.WriteString(w, `{
+			"role": "assistant",
+			"content": [
+				{"type": "text", "text": "Let me check."},
+				{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "Paris"}}
+			],
+			"stop_reason": "tool_use",
+			"usage": {"input_tokens": 20, "output_tokens": 10}
+		}`)
+	}
+	defer mockServer.Close()
+	mockServer.Start()
+
+	client, err := NewClient(NewConfig("test-api-key", ClaudeHaiku45, mockServer.URL(), ""))
+	assert.NoError(t, err)
+
+	functions := []tools.FunctionConfig{
+		{
+			Name:        "get_weather",
+			Description: "Get the weather of a city",
+			Params: []tools.ParameterConfig{
+				tools.NewRequiredParameter("city", "string", "The city"),
+			},
+		},
+	}
+	response, _, err := client.ChatWithFunctions([]chat.Message{chat.NewUserMessage("Weather in Paris?")}, functions, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Let me check.", response.Content)
+	assert.Equal(t, 1, len(response.ToolCalls))
+	assert.Equal(t, "toolu_1", response.ToolCalls[0].ID)
+	assert.Equal(t, "get_weather", response.ToolCalls[0].Function.Name)
+	assert.Equal(t, "Paris", response.ToolCalls[0].Function.Arguments["city"])
+}
+
+func TestChatWithErrorResponse(t *testing.T) {
+	mockServer := test.NewTestServer()
+	mockServer.RequestHandler = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"type": "error", "error": {"type": "invalid_request_error", "message": "max_tokens: field required"}}`)
+	}
+	defer mockServer.Close()
+	mockServer.Start()
+
+	client, err := NewClient(NewConfig("test-api-key", ClaudeHaiku45, mockServer.URL(), ""))
+	assert.NoError(t, err)
+
+	_, _, err = client.Chat([]chat.Message{chat.NewUserMessage("Hi")}, nil)
+	assert.ErrorContains(t, err, "max_tokens: field required")
+}
+
+func TestChatStream(t *testing.T) {
+	mockServer := test.NewTestServer()
+	mockServer.RequestHandler = func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		request := AnthropicRequest{}
+		err = json.Unmarshal(body, &request)
+		assert.NoError(t, err)
+		assert.True(t, request.Stream)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			`{"type":"message_start","message":{"role":"assistant","usage":{"input_tokens":9,"output_tokens":1}}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"Hmm."}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig"}}`,
+			`{"type":"content_block_stop","index":0}`,
+			`{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`,
+			`{"type":"ping"}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Hello"}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":" world"}}`,
+			`{"type":"content_block_stop","index":1}`,
+			`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{}}}`,
+			`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"city\": "}}`,
+			`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"\"Paris\"}"}}`,
+			`{"type":"content_block_stop","index":2}`,
+			`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":15}}`,
+			`{"type":"message_stop"}`,
+		}
+		for _, event := range events {
+			io.WriteString(w, "event: message\ndata: "+event+"\n\n")
+		}
+	}
+	defer mockServer.Close()
+	mockServer.Start()
+
+	client, err := NewClient(NewConfig("test-api-key", ClaudeHaiku45, mockServer.URL(), ""))
+	assert.NoError(t, err)
+
+	stream, err := client.ChatStream(context.Background(), []chat.Message{chat.NewUserMessage("Hi")}, nil)
+	assert.NoError(t, err)
+
+	message, info, err := chat.CollectStream(stream)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello world", message.Content)
+	assert.Equal(t, "Hmm.", message.Thinking)
+	assert.Equal(t, []chat.ThinkingBlock{{Thinking: "Hmm.", Signature: "sig"}}, message.ThinkingBlocks)
+	assert.Equal(t, 1, len(message.ToolCalls))
+	assert.Equal(t, "toolu_1", message.ToolCalls[0].ID)
+	assert.Equal(t, "Paris", message.ToolCalls[0].Function.Arguments["city"])
+	assert.Equal(t, chat.ResponseInfo{PromptTokens: 9, CompletionTokens: 15}, info)
+}
+
+func TestConvertToAnthropicMessages(t *testing.T) {
+	messages := []chat.Message{
+		chat.NewSystemMessage("Be brief."),
+		{
+			Role: "user",
+			ContentParts: []chat.ContentPart{
+				{Text: "What is this?"},
+				{ImageUrl: "data:image/png;base64,aGVsbG8="},
+				{ImageUrl: "https://example.com/cat.jpg"},
+			},
+		},
+		{
+			Role:           "assistant",
+			ThinkingBlocks: []chat.ThinkingBlock{{Thinking: "Look it up.", Signature: "sig"}, {RedactedData: "encrypted"}},
+			ToolCalls: []chat.ToolCall{
+				{ID: "toolu_1", Function: chat.FunctionCall{Name: "lookup", Arguments: map[string]any{"q": "cat"}}},
+				{ID: "toolu_2", Function: chat.FunctionCall{Name: "lookup"}},
+			},
+		},
+		{Role: "tool", ToolCallID: "toolu_1", Content: "a cat"},
+		{Role: "tool", ToolCallID: "toolu_2", Content: "Error: not found", ToolError: true},
+	}
+
+	system, converted, err := ConvertToAnthropicMessages(messages)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Be brief.", system)
+	assert.Equal(t, 3, len(converted))
+
+	assert.Equal(t, "user", converted[0].Role)
+	assert.Equal(t, "text", converted[0].Content[0].Type)
+	assert.Equal(t, &AnthropicImageSource{Type: "base64", MediaType: "image/png", Data: "aGVsbG8="}, converted[0].Content[1].Source)
+	assert.Equal(t, &AnthropicImageSource{Type: "url", URL: "https://example.com/cat.jpg"}, converted[0].Content[2].Source)
+
+	// Thinking blocks are sent back before the tool_use blocks
+	assert.Equal(t, "assistant", converted[1].Role)
+	assert.Equal(t, AnthropicContentBlock{Type: "thinking", Thinking: "Look it up.", Signature: "sig"}, converted[1].Content[0])
+	assert.Equal(t, AnthropicContentBlock{Type: "redacted_thinking", Data: "encrypted"}, converted[1].Content[1])
+	assert.Equal(t, "tool_use", converted[1].Content[2].Type)
+	assert.Equal(t, "toolu_1", converted[1].Content[2].ID)
+	assert.Equal(t, map[string]any{}, converted[1].Content[3].Input)
+
+	assert.Equal(t, "user", converted[2].Role)
+	assert.Equal(t, 2, len(converted[2].Content))
+	assert.Equal(t, "tool_result", converted[2].Content[0].Type)
+	assert.Equal(t, "toolu_1", converted[2].Content[0].ToolUseID)
+	assert.False(t, converted[2].Content[0].IsError)
+	assert.Equal(t, "Error: not found", converted[2].Content[1].Content)
+	assert.True(t, converted[2].Content[1].IsError)
+}
+
+func TestConvertToAnthropicMessagesWithInvalidMessages(t *testing.T) {
+	_, _, err := ConvertToAnthropicMessages([]chat.Message{{Role: "tool", Content: "result"}})
+	assert.Error(t, err)
+
+	_, _, err = ConvertToAnthropicMessages([]chat.Message{{Role: "unknown", Content: "text"}})
+	assert.Error(t, err)
+
+	_, _, err = ConvertToAnthropicMessages([]chat.Message{{Role: "user", ContentParts: []chat.ContentPart{{ImageUrl: "data:image/png,abc"}}}})
+	assert.Error(t, err)
+}
+
+func TestNewRequestWithSchema(t *testing.T) {
+	client, err := NewClient(&AnthropicModelConfig{APIKey: "key"})
+	assert.NoError(t, err)
+	options := chat.NewSchemaChatOptions("answer", map[string]any{"type": "object"})
+
+	request, err := client.newRequest([]chat.Message{chat.NewSystemMessage("Be brief"), chat.NewUserMessage("Hi")}, nil, &options)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Be brief\n\nRespond only with a valid JSON value which conforms to this JSON schema, without any other text:\n{\"type\":\"object\"}", request.System)
+}
+
+func TestNewRequestWithOverrides(t *testing.T) {
+	client, err := NewClient(&AnthropicModelConfig{APIKey: "key"})
+	assert.NoError(t, err)
+	client.Config.Temperature = 0.9
+	functions := []tools.FunctionConfig{tools.NewFunctionConfig("lookup", "Look something up")}
+	messages := []chat.Message{chat.NewUserMessage("Hi")}
+
+	t.Run("Overrides replace the client settings", func(t *testing.T) {
+		options := (&chat.ChatOptions{Stop: []string{"END"}, ToolChoice: chat.ToolChoiceRequired}).WithTemperature(0).WithMaxTokens(20)
+
+		request, err := client.newRequest(messages, functions, options)
+
+		assert.NoError(t, err)
+		assert.Equal(t, float32(0), *request.Temperature)
+		assert.Nil(t, request.TopP)
+		assert.Equal(t, 20, request.MaxTokens)
+		assert.Equal(t, []string{"END"}, request.StopSequences)
+		assert.Equal(t, &AnthropicToolChoice{Type: "any"}, request.ToolChoice)
+	})
+
+	t.Run("Tool choice by name", func(t *testing.T) {
+		request, err := client.newRequest(messages, functions, &chat.ChatOptions{ToolChoice: "lookup"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, &AnthropicToolChoice{Type: "tool", Name: "lookup"}, request.ToolChoice)
+		assert.Equal(t, float32(0.9), *request.Temperature)
+	})
+
+	t.Run("Warns when the settings are changed", func(t *testing.T) {
+		hook := logtest.NewGlobal()
+		defer hook.Reset()
+
+		request, err := client.newRequest(messages, nil, (&chat.ChatOptions{}).WithTemperature(1.5))
+		assert.NoError(t, err)
+		assert.Equal(t, float32(1), *request.Temperature)
+		assert.Len(t, hook.AllEntries(), 1)
+
+		thinkingClient, err := NewClient(&AnthropicModelConfig{APIKey: "key", ThinkingBudget: 2048})
+		assert.NoError(t, err)
+		thinkingClient.Config.MaxTokens = 1024
+		request, err = thinkingClient.newRequest(messages, nil, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 2048+DefaultMaxTokens, request.MaxTokens)
+		assert.Len(t, hook.AllEntries(), 2)
+	})
+}
@@ -0,0 +1,325 @@
+package anthropic
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jieliu2000/anyi/llm/chat"
+	"github.com/jieliu2000/anyi/llm/tools"
+)
+
+// AnthropicRequest is the request body of the Messages API.
+type AnthropicRequest struct {
+	Model         string               `json:"model"`
+	System        string               `json:"system,omitempty"`
+	Messages      []AnthropicMessage   `json:"messages"`
+	MaxTokens     int                  `json:"max_tokens"`
+	Temperature   *float32             `json:"temperature,omitempty"`
+	TopP          *float32             `json:"top_p,omitempty"`
+	StopSequences []string             `json:"stop_sequences,omitempty"`
+	Tools         []AnthropicTool      `json:"tools,omitempty"`
+	ToolChoice    *AnthropicToolChoice `json:"tool_choice,omitempty"`
+	Thinking      *AnthropicThinking   `json:"thinking,omitempty"`
+	Stream        bool                 `json:"stream,omitempty"`
+}
+
+// AnthropicToolChoice controls how the model uses the tools. Type is "auto", "any", "none" or "tool", Name is the name of the tool if Type is "tool".
+type AnthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+// AnthropicThinking configures extended thinking.
+type AnthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+// AnthropicMessage is a message of the Messages API. Anthropic only accepts "user" and "assistant" roles, the system prompt is sent separately.
+type AnthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []AnthropicContentBlock `json:"content"`
+}
+
+// AnthropicContentBlock is a content block of a message. The Type field decides which of the other fields are used:
+//   - "text": Text
+//   - "image": Source
+//   - "tool_use": ID, Name and Input
+//   - "tool_result": ToolUseID, Content and IsError
+//   - "thinking": Thinking and Signature
+//   - "redacted_thinking": Data
+type AnthropicContentBlock struct {
+	Type      string                `json:"type"`
+	Text      string                `json:"text,omitempty"`
+	Source    *AnthropicImageSource `json:"source,omitempty"`
+	ID        string                `json:"id,omitempty"`
+	Name      string                `json:"name,omitempty"`
+	Input     any                   `json:"input,omitempty"`
+	ToolUseID string                `json:"tool_use_id,omitempty"`
+	Content   string                `json:"content,omitempty"`
+	IsError   bool                  `json:"is_error,omitempty"`
+	Thinking  string                `json:"thinking,omitempty"`
+	Signature string                `json:"signature,omitempty"`
+	Data      string                `json:"data,omitempty"`
+}
+
+// AnthropicImageSource is the source of an image block. It's either base64 encoded data or a URL.
+type AnthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// AnthropicTool is a tool definition of the Messages API.
+type AnthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+// AnthropicUsage is the token usage reported by the Messages API.
+type AnthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// AnthropicResponse is the response body of a non-streaming Messages API call.
+type AnthropicResponse struct {
+	ID         string                  `json:"id"`
+	Type       string                  `json:"type"`
+	Role       string                  `json:"role"`
+	Model      string                  `json:"model"`
+	Content    []AnthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      AnthropicUsage          `json:"usage"`
+}
+
+// AnthropicError is the error object returned by the Messages API.
+type AnthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// AnthropicErrorResponse is the response body of a failed Messages API call.
+type AnthropicErrorResponse struct {
+	Type  string         `json:"type"`
+	Error AnthropicError `json:"error"`
+}
+
+// AnthropicStreamDelta is the delta of a content_block_delta or message_delta event.
+type AnthropicStreamDelta struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	Thinking    string `json:"thinking"`
+	PartialJSON string `json:"partial_json"`
+	Signature   string `json:"signature"`
+	StopReason  string `json:"stop_reason"`
+}
+
+// AnthropicStreamEvent is an event of a streaming Messages API call.
+type AnthropicStreamEvent struct {
+	Type         string                `json:"type"`
+	Index        int                   `json:"index"`
+	Message      AnthropicResponse     `json:"message"`
+	ContentBlock AnthropicContentBlock `json:"content_block"`
+	Delta        AnthropicStreamDelta  `json:"delta"`
+	Usage        *AnthropicUsage       `json:"usage"`
+	Error        AnthropicError        `json:"error"`
+}
+
+// ConvertToAnthropicMessages converts the chat messages to the format of the Messages API.
+// System messages are joined and returned separately because Anthropic expects them in the top-level system parameter.
+// Messages with the "tool" role are sent as tool_result blocks of a user message, and consecutive messages of the same role are merged since the API expects the roles to alternate.
+//
+// Parameters:
+//   - messages: The chat messages
+//
+// Returns:
+//   - The system prompt
+//   - The converted messages
+//   - An error if a message can't be converted
+func ConvertToAnthropicMessages(messages []chat.Message) (string, []AnthropicMessage, error) {
+	systemPrompts := []string{}
+	anthropicMessages := []AnthropicMessage{}
+
+	for _, message := range messages {
+		role := message.Role
+		var blocks []AnthropicContentBlock
+
+		switch role {
+		case "system":
+			if message.Content != "" {
+				systemPrompts = append(systemPrompts, message.Content)
+			}
+			for _, part := range message.ContentParts {
+				if part.Text != "" {
+					systemPrompts = append(systemPrompts, part.Text)
+				}
+			}
+			continue
+		case "tool":
+			if message.ToolCallID == "" {
+				return "", nil, errors.New("tool message must have a tool call id")
+			}
+			role = "user"
+			blocks = []AnthropicContentBlock{{
+				Type:      "tool_result",
+				ToolUseID: message.ToolCallID,
+				Content:   message.Content,
+				IsError:   message.ToolError,
+			}}
+		case "user", "assistant":
+			var err error
+			blocks, err = convertContentBlocks(message)
+			if err != nil {
+				return "", nil, err
+			}
+		default:
+			return "", nil, errors.New("unsupported message role: " + message.Role)
+		}
+
+		if len(blocks) == 0 {
+			continue
+		}
+
+		last := len(anthropicMessages) - 1
+		if last >= 0 && anthropicMessages[last].Role == role {
+			anthropicMessages[last].Content = append(anthropicMessages[last].Content, blocks...)
+			continue
+		}
+		anthropicMessages = append(anthropicMessages, AnthropicMessage{Role: role, Content: blocks})
+	}
+
+	return strings.Join(systemPrompts, "\n\n"), anthropicMessages, nil
+}
+
+// convertContentBlocks converts the content of a user or assistant message. The thinking blocks of assistant messages are sent first, as the API requires them before the text and tool_use blocks.
+func convertContentBlocks(message chat.Message) ([]AnthropicContentBlock, error) {
+	blocks := []AnthropicContentBlock{}
+
+	if message.Role == "assistant" {
+		for _, thinking := range message.ThinkingBlocks {
+			blocks = append(blocks, convertThinkingBlock(thinking))
+		}
+	}
+
+	if message.Content != "" {
+		blocks = append(blocks, AnthropicContentBlock{Type: "text", Text: message.Content})
+	}
+
+	for _, part := range message.ContentParts {
+		if part.Text != "" {
+			blocks = append(blocks, AnthropicContentBlock{Type: "text", Text: part.Text})
+		}
+		if part.ImageUrl != "" {
+			source, err := convertImageSource(part.ImageUrl)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, AnthropicContentBlock{Type: "image", Source: source})
+		}
+	}
+
+	for _, call := range message.ToolCalls {
+		input := call.Function.Arguments
+		if input == nil {
+			input = map[string]any{}
+		}
+		blocks = append(blocks, AnthropicContentBlock{
+			Type:  "tool_use",
+			ID:    call.ID,
+			Name:  call.Function.Name,
+			Input: input,
+		})
+	}
+	return blocks, nil
+}
+
+// convertThinkingBlock converts a thinking block of a message to a thinking or redacted_thinking block.
+func convertThinkingBlock(thinking chat.ThinkingBlock) AnthropicContentBlock {
+	if thinking.RedactedData != "" {
+		return AnthropicContentBlock{Type: "redacted_thinking", Data: thinking.RedactedData}
+	}
+	return AnthropicContentBlock{Type: "thinking", Thinking: thinking.Thinking, Signature: thinking.Signature}
+}
+
+// convertThinkingContent converts a thinking or redacted_thinking block of a response to a thinking block of a message.
+func convertThinkingContent(block AnthropicContentBlock) chat.ThinkingBlock {
+	if block.Type == "redacted_thinking" {
+		return chat.ThinkingBlock{RedactedData: block.Data}
+	}
+	return chat.ThinkingBlock{Thinking: block.Thinking, Signature: block.Signature}
+}
+
+// convertImageSource converts an image URL to an image source. Data URLs are sent as base64 data, other URLs are passed to Anthropic as they are.
+func convertImageSource(imageUrl string) (*AnthropicImageSource, error) {
+	if !strings.HasPrefix(imageUrl, "data:") {
+		return &AnthropicImageSource{Type: "url", URL: imageUrl}, nil
+	}
+
+	header, data, found := strings.Cut(strings.TrimPrefix(imageUrl, "data:"), ",")
+	if !found || !strings.HasSuffix(header, ";base64") {
+		return nil, errors.New("invalid image url")
+	}
+	return &AnthropicImageSource{
+		Type:      "base64",
+		MediaType: strings.TrimSuffix(header, ";base64"),
+		Data:      data,
+	}, nil
+}
+
+// ConvertToAnthropicTools converts the function configs to tool definitions of the Messages API.
+func ConvertToAnthropicTools(functions []tools.FunctionConfig) []AnthropicTool {
+	if len(functions) == 0 {
+		return nil
+	}
+
+	anthropicTools := make([]AnthropicTool, 0, len(functions))
+	for _, function := range functions {
+		anthropicTools = append(anthropicTools, AnthropicTool{
+			Name:        function.Name,
+			Description: function.Description,
+			InputSchema: function.ParametersSchema(),
+		})
+	}
+	return anthropicTools
+}
+
+// ConvertFromAnthropicContent converts the content blocks of a response to a chat message.
+// Text blocks are joined into Content, thinking blocks into Thinking and tool_use blocks are converted to tool calls.
+// The thinking blocks are also kept with their signatures in ThinkingBlocks, so they are sent back when the message is part of a later request.
+func ConvertFromAnthropicContent(blocks []AnthropicContentBlock) *chat.Message {
+	result := &chat.Message{Role: "assistant"}
+
+	texts := []string{}
+	thoughts := []string{}
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			texts = append(texts, block.Text)
+		case "thinking":
+			thoughts = append(thoughts, block.Thinking)
+			result.ThinkingBlocks = append(result.ThinkingBlocks, convertThinkingContent(block))
+		case "redacted_thinking":
+			result.ThinkingBlocks = append(result.ThinkingBlocks, convertThinkingContent(block))
+		case "tool_use":
+			arguments, _ := block.Input.(map[string]any)
+			if arguments == nil {
+				arguments = map[string]any{}
+			}
+			result.ToolCalls = append(result.ToolCalls, chat.ToolCall{
+				ID:   block.ID,
+				Type: "function",
+				Function: chat.FunctionCall{
+					Name:      block.Name,
+					Arguments: arguments,
+				},
+			})
+		}
+	}
+
+	result.Content = strings.Join(texts, "")
+	result.Thinking = strings.Join(thoughts, "\n")
+	return result
+}
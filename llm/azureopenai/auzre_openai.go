@@ -1,6 +1,7 @@
 package azureopenai
 
 import (
+	"context"
 	"errors"
 
 	"github.com/jieliu2000/anyi/llm/chat"
@@ -17,6 +18,10 @@ type AzureOpenAIModelConfig struct {
 	ModelDeploymentId string `json:"modelDeploymentId" mapstructure:"modelDeploymentId" yaml:"modelDeploymentId"`
 	Endpoint          string `json:"endpoint" mapstructure:"endpoint" yaml:"endpoint"`
 	AllowInsecureHttp bool   `json:"allowInsecureHttp" yaml:"allowInsecureHttp" mapstructure:"allowInsecureHttp"`
+	// The deployment of the embedding model used by Embed. Embed fails if it's not set.
+	EmbeddingDeploymentId string `json:"embeddingDeploymentId" mapstructure:"embeddingDeploymentId" yaml:"embeddingDeploymentId"`
+	// The maximum number of texts sent in one embeddings request. Defaults to chat.DefaultEmbeddingBatchSize.
+	EmbeddingBatchSize int `json:"embeddingBatchSize" mapstructure:"embeddingBatchSize" yaml:"embeddingBatchSize"`
 }
 
 type AzureOpenAIClient struct {
@@ -53,13 +58,18 @@ func NewClient(config *AzureOpenAIModelConfig) (*AzureOpenAIClient, error) {
 
 	client := &AzureOpenAIClient{
 		Config:     config,
-		clientImpl: impl.NewClientWithConfig(configImpl),
+		clientImpl: openai.NewClientImpl(configImpl),
 	}
 
 	return client, nil
 }
 
 func (c *AzureOpenAIClient) ChatWithFunctions(messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
+	return c.ChatWithFunctionsContext(context.Background(), messages, functions, options)
+}
+
+// ChatWithFunctionsContext works like ChatWithFunctions but sends the request with the given context. The request is aborted when the context is cancelled or its deadline expires.
+func (c *AzureOpenAIClient) ChatWithFunctionsContext(ctx context.Context, messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
 	client := c.clientImpl
 
 	// Create a temporary config object compatible with OpenAIModelConfig
@@ -68,10 +78,15 @@ func (c *AzureOpenAIClient) ChatWithFunctions(messages []chat.Message, functions
 		Model:            c.Config.ModelDeploymentId,
 	}
 
-	return openai.ExecuteChatWithFunctions(client, c.Config.ModelDeploymentId, messages, functions, options, openaiConfig)
+	return openai.ExecuteChatWithFunctionsContext(ctx, client, c.Config.ModelDeploymentId, messages, functions, options, openaiConfig)
 }
 
 func (c *AzureOpenAIClient) Chat(messages []chat.Message, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
+	return c.ChatContext(context.Background(), messages, options)
+}
+
+// ChatContext works like Chat but sends the request with the given context. The request is aborted when the context is cancelled or its deadline expires.
+func (c *AzureOpenAIClient) ChatContext(ctx context.Context, messages []chat.Message, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
 	client := c.clientImpl
 
 	// Create a temporary config object compatible with OpenAIModelConfig
@@ -80,5 +95,45 @@ func (c *AzureOpenAIClient) Chat(messages []chat.Message, options *chat.ChatOpti
 		Model:            c.Config.ModelDeploymentId,
 	}
 
-	return openai.ExecuteChat(client, c.Config.ModelDeploymentId, messages, options, openaiConfig)
+	return openai.ExecuteChatContext(ctx, client, c.Config.ModelDeploymentId, messages, options, openaiConfig)
+}
+
+// ChatStream sends the messages to the model and streams the response back through the returned channel.
+func (c *AzureOpenAIClient) ChatStream(ctx context.Context, messages []chat.Message, options *chat.ChatOptions) (<-chan chat.StreamChunk, error) {
+	return c.ChatWithFunctionsStream(ctx, messages, nil, options)
+}
+
+// ChatWithFunctionsStream works like ChatStream but also allows the model to call the given functions.
+func (c *AzureOpenAIClient) ChatWithFunctionsStream(ctx context.Context, messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (<-chan chat.StreamChunk, error) {
+	// Create a temporary config object compatible with OpenAIModelConfig
+	openaiConfig := &openai.OpenAIModelConfig{
+		GeneralLLMConfig: c.Config.GeneralLLMConfig,
+		Model:            c.Config.ModelDeploymentId,
+	}
+
+	return openai.ExecuteChatStream(ctx, c.clientImpl, c.Config.ModelDeploymentId, messages, functions, options, openaiConfig)
+}
+
+// Embed computes the embeddings of the texts with the deployment set as EmbeddingDeploymentId.
+func (c *AzureOpenAIClient) Embed(ctx context.Context, texts []string) ([][]float32, chat.ResponseInfo, error) {
+	if c.Config.EmbeddingDeploymentId == "" {
+		return nil, chat.ResponseInfo{}, errors.New("embeddingDeploymentId is required for embeddings")
+	}
+	return openai.ExecuteEmbeddingsContext(ctx, c.clientImpl, c.Config.EmbeddingDeploymentId, texts, c.Config.EmbeddingBatchSize)
+}
+
+// ModelName returns the deployment ID of the config, which is usually named after the model. It's used to look up the context window of the model.
+func (c *AzureOpenAIClient) ModelName() string {
+	if c.Config == nil {
+		return ""
+	}
+	return c.Config.ModelDeploymentId
+}
+
+// MaxTokens returns the max tokens of the config, or 0 if they are not limited. They are reserved for the reply when the context window is checked.
+func (c *AzureOpenAIClient) MaxTokens() int {
+	if c.Config == nil {
+		return 0
+	}
+	return c.Config.MaxTokens
 }
@@ -1,6 +1,7 @@
 package azureopenai
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -138,3 +139,34 @@ func TestChat(t *testing.T) {
 
 	assert.Equal(t, "Reply to your input", response.Content)
 }
+
+func TestEmbed(t *testing.T) {
+	mockServer := test.NewTestServer()
+	mockServer.RequestHandler = func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "test-api-key", r.Header.Get("Api-Key"))
+		assert.Contains(t, r.URL.Path, "/openai/deployments/test-embedding/embeddings")
+
+		io.WriteString(w, `{"data":[{"index":0,"embedding":[0.1,0.2]}],"usage":{"prompt_tokens":3,"total_tokens":3}}`)
+	}
+	defer mockServer.Close()
+	mockServer.Start()
+
+	config := NewConfig("test-api-key", "test-deploy", mockServer.URL())
+	config.EmbeddingDeploymentId = "test-embedding"
+	client, err := NewClient(config)
+	assert.NoError(t, err)
+
+	vectors, info, err := client.Embed(context.Background(), []string{"Hello"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, [][]float32{{0.1, 0.2}}, vectors)
+	assert.Equal(t, 3, info.PromptTokens)
+}
+
+func TestEmbed_NoEmbeddingDeployment(t *testing.T) {
+	client, err := NewClient(NewConfig("test-api-key", "test-deploy", "http://localhost"))
+	assert.NoError(t, err)
+
+	_, _, err = client.Embed(context.Background(), []string{"Hello"})
+	assert.Error(t, err)
+}
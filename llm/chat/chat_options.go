@@ -7,6 +7,60 @@ import (
 
 type ChatOptions struct {
 	Format string `json:"format"`
+
+	// Schema is a JSON schema the reply of the model must conform to. It takes precedence over Format.
+	// OpenAI compatible clients send it as a json_schema response format, Ollama sends it as the format of the request and Anthropic adds it to the system prompt.
+	Schema map[string]any `json:"schema,omitempty"`
+	// SchemaName is the name of the schema sent to OpenAI compatible APIs. "response" is used if it's empty.
+	SchemaName string `json:"schemaName,omitempty"`
+
+	// The following fields override the generation parameters of the client configuration for a single call. Nil or empty values keep the client defaults.
+	// Providers ignore the parameters they don't support, for example Anthropic has no seed or penalties.
+	Temperature      *float32 `json:"temperature,omitempty" mapstructure:"temperature"`
+	TopP             *float32 `json:"topP,omitempty" mapstructure:"topP"`
+	MaxTokens        *int     `json:"maxTokens,omitempty" mapstructure:"maxTokens"`
+	Stop             []string `json:"stop,omitempty" mapstructure:"stop"`
+	Seed             *int     `json:"seed,omitempty" mapstructure:"seed"`
+	PresencePenalty  *float32 `json:"presencePenalty,omitempty" mapstructure:"presencePenalty"`
+	FrequencyPenalty *float32 `json:"frequencyPenalty,omitempty" mapstructure:"frequencyPenalty"`
+
+	// ToolChoice controls whether the model calls the provided functions. It's "auto", "none", "required" or the name of the function the model must call.
+	ToolChoice string `json:"toolChoice,omitempty" mapstructure:"toolChoice"`
+}
+
+const (
+	ToolChoiceAuto     = "auto"
+	ToolChoiceNone     = "none"
+	ToolChoiceRequired = "required"
+)
+
+// WithTemperature sets the temperature override and returns the options.
+func (options *ChatOptions) WithTemperature(temperature float32) *ChatOptions {
+	options.Temperature = &temperature
+	return options
+}
+
+// WithTopP sets the top_p override and returns the options.
+func (options *ChatOptions) WithTopP(topP float32) *ChatOptions {
+	options.TopP = &topP
+	return options
+}
+
+// WithMaxTokens sets the max tokens override and returns the options.
+func (options *ChatOptions) WithMaxTokens(maxTokens int) *ChatOptions {
+	options.MaxTokens = &maxTokens
+	return options
+}
+
+// WithSeed sets the seed and returns the options.
+func (options *ChatOptions) WithSeed(seed int) *ChatOptions {
+	options.Seed = &seed
+	return options
+}
+
+// NewSchemaChatOptions returns chat options which ask the model to reply with JSON conforming to the schema.
+func NewSchemaChatOptions(name string, schema map[string]any) ChatOptions {
+	return ChatOptions{Format: "json", Schema: schema, SchemaName: name}
 }
 
 func NewChatOptions(format string) ChatOptions {
@@ -0,0 +1,39 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+)
+
+// DefaultEmbeddingBatchSize is the number of texts sent in one embeddings request if the client config doesn't set a batch size.
+const DefaultEmbeddingBatchSize = 64
+
+// EmbedBatches splits the texts into batches of at most batchSize texts, calls embed for each batch and joins the results. The usage of the batches is added up.
+// It's meant for the clients implementing llm.Embedder. A batchSize below 1 means DefaultEmbeddingBatchSize.
+func EmbedBatches(ctx context.Context, texts []string, batchSize int, embed func(ctx context.Context, batch []string) ([][]float32, ResponseInfo, error)) ([][]float32, ResponseInfo, error) {
+	if batchSize < 1 {
+		batchSize = DefaultEmbeddingBatchSize
+	}
+	vectors := make([][]float32, 0, len(texts))
+	var usage ResponseInfo
+	for start := 0; start < len(texts); start += batchSize {
+		end := start + batchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, usage, err
+		}
+		batch, info, err := embed(ctx, texts[start:end])
+		if err != nil {
+			return nil, usage, err
+		}
+		if len(batch) != end-start {
+			return nil, usage, fmt.Errorf("expected %d embeddings, got %d", end-start, len(batch))
+		}
+		vectors = append(vectors, batch...)
+		usage.PromptTokens += info.PromptTokens
+		usage.CompletionTokens += info.CompletionTokens
+	}
+	return vectors, usage, nil
+}
@@ -0,0 +1,47 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbedBatches(t *testing.T) {
+	var batches [][]string
+	vectors, info, err := EmbedBatches(context.Background(), []string{"a", "b", "c"}, 2, func(ctx context.Context, batch []string) ([][]float32, ResponseInfo, error) {
+		batches = append(batches, batch)
+		result := make([][]float32, len(batch))
+		for i, text := range batch {
+			result[i] = []float32{float32(text[0])}
+		}
+		return result, ResponseInfo{PromptTokens: len(batch)}, nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"a", "b"}, {"c"}}, batches)
+	assert.Equal(t, [][]float32{{'a'}, {'b'}, {'c'}}, vectors)
+	assert.Equal(t, 3, info.PromptTokens)
+}
+
+func TestEmbedBatches_Errors(t *testing.T) {
+	_, _, err := EmbedBatches(context.Background(), []string{"a", "b"}, 0, func(ctx context.Context, batch []string) ([][]float32, ResponseInfo, error) {
+		return [][]float32{{1}}, ResponseInfo{}, nil
+	})
+	assert.ErrorContains(t, err, "expected 2 embeddings, got 1")
+
+	failure := errors.New("failed")
+	_, _, err = EmbedBatches(context.Background(), []string{"a"}, 0, func(ctx context.Context, batch []string) ([][]float32, ResponseInfo, error) {
+		return nil, ResponseInfo{}, failure
+	})
+	assert.ErrorIs(t, err, failure)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = EmbedBatches(ctx, []string{"a"}, 0, func(ctx context.Context, batch []string) ([][]float32, ResponseInfo, error) {
+		t.Fatal("embed must not be called with a cancelled context")
+		return nil, ResponseInfo{}, nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
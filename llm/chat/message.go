@@ -10,9 +10,33 @@ type Message struct {
 	Role         string        `json:"role"`
 	ContentParts []ContentPart `json:"contentParts,omitempty"`
 	ToolCalls    []ToolCall    `json:"tool_calls,omitempty"`
+	// ToolCallID is the ID of the tool call a "tool" message answers.
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	// Name is the name of the tool which produced the result in a "tool" message. Providers which don't use call IDs, like Ollama, match results by this name.
+	Name string `json:"name,omitempty"`
+	// Thinking contains the reasoning of the model if the provider returns it separately from the content, e.g. the extended thinking of Anthropic models.
+	Thinking string `json:"thinking,omitempty"`
+	// ThinkingBlocks are the reasoning blocks of the model as returned by the provider. Anthropic requires them to be sent back unchanged, with their signatures, when an assistant message with tool calls is part of a later request.
+	ThinkingBlocks []ThinkingBlock `json:"thinkingBlocks,omitempty"`
+	// ToolError is true in a "tool" message if the tool call failed. Providers which support it, like Anthropic, mark the result as an error.
+	ToolError bool `json:"toolError,omitempty"`
+}
+
+// ThinkingBlock is a block of reasoning returned by the model.
+type ThinkingBlock struct {
+	// Thinking is the reasoning text. It's empty for redacted blocks.
+	Thinking string `json:"thinking,omitempty"`
+	// Signature verifies the reasoning text when it's sent back to the provider.
+	Signature string `json:"signature,omitempty"`
+	// RedactedData is the encrypted reasoning of a block the provider redacted.
+	RedactedData string `json:"redactedData,omitempty"`
 }
 
 type ToolCall struct {
+	// ID is the provider assigned ID of the call. It's needed to send the result of the call back to the model.
+	ID string `json:"id,omitempty"`
+	// Type is the type of the call. Currently it's always "function".
+	Type     string       `json:"type,omitempty"`
 	Function FunctionCall `json:"function"`
 }
 
@@ -83,6 +107,38 @@ func NewAssistantMessage(content string) Message {
 	return Message{Content: content, Role: "assistant"}
 }
 
+// NewToolResultMessage creates a "tool" message which sends the result of a tool call back to the model.
+// The message references the call by its ID and carries the name of the called function, so it can be appended to the conversation right after the assistant message containing the call.
+//
+// Parameters:
+//   - call: The tool call returned by the model
+//   - result: The result of the call, usually a plain text or JSON string
+//
+// Returns:
+//   - The tool result message
+func NewToolResultMessage(call ToolCall, result string) Message {
+	return Message{
+		Role:       "tool",
+		Content:    result,
+		ToolCallID: call.ID,
+		Name:       call.Function.Name,
+	}
+}
+
+// NewToolErrorMessage creates a "tool" message which tells the model that a tool call failed.
+//
+// Parameters:
+//   - call: The tool call returned by the model
+//   - message: The description of the error
+//
+// Returns:
+//   - The tool result message with ToolError set
+func NewToolErrorMessage(call ToolCall, message string) Message {
+	result := NewToolResultMessage(call, message)
+	result.ToolError = true
+	return result
+}
+
 type PromptFormatter interface {
 	Format(Data any) (string, error)
 }
@@ -251,3 +251,14 @@ func TestNewImageMessage(t *testing.T) {
 	})
 
 }
+
+func TestNewToolResultMessage(t *testing.T) {
+	call := ToolCall{ID: "call_1", Type: "function", Function: FunctionCall{Name: "get_weather"}}
+
+	message := NewToolResultMessage(call, "sunny")
+
+	assert.Equal(t, "tool", message.Role)
+	assert.Equal(t, "sunny", message.Content)
+	assert.Equal(t, "call_1", message.ToolCallID)
+	assert.Equal(t, "get_weather", message.Name)
+}
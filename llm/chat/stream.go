@@ -0,0 +1,136 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// StreamChunk is an incremental piece of a streamed chat response.
+// A stream delivers any number of chunks carrying Content or ToolCalls deltas and ends with a chunk where Done is true.
+// If the stream fails, the last chunk has Err set and the channel is closed right after it.
+type StreamChunk struct {
+	// Content is the text delta of this chunk.
+	Content string `json:"content,omitempty"`
+	// Thinking is the delta of the model reasoning, for providers which stream it separately from the content.
+	Thinking string `json:"thinking,omitempty"`
+	// ThinkingBlocks are reasoning blocks which are complete with this chunk, for providers which need them to be sent back, see Message.ThinkingBlocks.
+	ThinkingBlocks []ThinkingBlock `json:"thinkingBlocks,omitempty"`
+	// Role is the role of the message being streamed. Usually it is only set in the first chunk.
+	Role string `json:"role,omitempty"`
+	// ToolCalls contains tool call fragments. Fragments belonging to the same call share the same Index.
+	ToolCalls []ToolCallDelta `json:"toolCalls,omitempty"`
+	// FinishReason is the reason reported by the provider for finishing the response, if any.
+	FinishReason string `json:"finishReason,omitempty"`
+	// Done is true in the final chunk of the stream.
+	Done bool `json:"done,omitempty"`
+	// Usage is the token usage of the whole request. It is only set in the final chunk and only if the provider reports it.
+	Usage *ResponseInfo `json:"usage,omitempty"`
+	// Err is set when the stream is terminated by an error.
+	Err error `json:"-"`
+}
+
+// ToolCallDelta is a fragment of a tool call in a streamed response.
+// The Arguments field contains a fragment of the JSON encoded arguments. The fragments of a call should be concatenated in order to get the full arguments.
+type ToolCallDelta struct {
+	Index     int    `json:"index"`
+	ID        string `json:"id,omitempty"`
+	Type      string `json:"type,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+}
+
+// CollectStream reads all chunks from the stream and assembles them into a single message.
+// It blocks until the stream is finished. If a chunk carries an error, the error is returned together with the content received so far.
+// A stream which is closed without a chunk with Done set, for example because its context was cancelled, is incomplete and returns an error wrapping io.ErrUnexpectedEOF.
+//
+// Parameters:
+//   - stream: The channel returned by a streaming chat call
+//
+// Returns:
+//   - The assembled message
+//   - The token usage reported by the provider
+//   - The error which terminated the stream, io.ErrUnexpectedEOF if the stream ended early, or an error if the arguments of a tool call are not valid JSON
+func CollectStream(stream <-chan StreamChunk) (*Message, ResponseInfo, error) {
+	info := ResponseInfo{}
+	result := &Message{Role: "assistant"}
+
+	var content strings.Builder
+	var thinking strings.Builder
+	calls := map[int]*ToolCallDelta{}
+	arguments := map[int]*strings.Builder{}
+	done := false
+
+	for chunk := range stream {
+		if chunk.Err != nil {
+			result.Content = content.String()
+			result.Thinking = thinking.String()
+			return result, info, chunk.Err
+		}
+		if chunk.Role != "" {
+			result.Role = chunk.Role
+		}
+		content.WriteString(chunk.Content)
+		thinking.WriteString(chunk.Thinking)
+		result.ThinkingBlocks = append(result.ThinkingBlocks, chunk.ThinkingBlocks...)
+
+		for _, delta := range chunk.ToolCalls {
+			call, ok := calls[delta.Index]
+			if !ok {
+				call = &ToolCallDelta{Index: delta.Index}
+				calls[delta.Index] = call
+				arguments[delta.Index] = &strings.Builder{}
+			}
+			if delta.ID != "" {
+				call.ID = delta.ID
+			}
+			if delta.Type != "" {
+				call.Type = delta.Type
+			}
+			if delta.Name != "" {
+				call.Name = delta.Name
+			}
+			arguments[delta.Index].WriteString(delta.Arguments)
+		}
+
+		if chunk.Usage != nil {
+			info = *chunk.Usage
+		}
+		if chunk.Done {
+			done = true
+		}
+	}
+
+	result.Content = content.String()
+	result.Thinking = thinking.String()
+
+	indexes := make([]int, 0, len(calls))
+	for index := range calls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	for _, index := range indexes {
+		args := make(map[string]any)
+		if raw := arguments[index].String(); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &args); err != nil {
+				return result, info, fmt.Errorf("invalid arguments of tool call %s: %w", calls[index].Name, err)
+			}
+		}
+		result.ToolCalls = append(result.ToolCalls, ToolCall{
+			ID:   calls[index].ID,
+			Type: calls[index].Type,
+			Function: FunctionCall{
+				Name:      calls[index].Name,
+				Arguments: args,
+			},
+		})
+	}
+
+	if !done {
+		return result, info, fmt.Errorf("stream ended without a final chunk: %w", io.ErrUnexpectedEOF)
+	}
+	return result, info, nil
+}
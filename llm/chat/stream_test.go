@@ -0,0 +1,65 @@
+package chat
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectStream(t *testing.T) {
+	stream := make(chan StreamChunk, 5)
+	stream <- StreamChunk{Role: "assistant", Content: "Let me "}
+	stream <- StreamChunk{Content: "check.", ToolCalls: []ToolCallDelta{{Index: 1, Name: "second", Arguments: `{"b":`}}}
+	stream <- StreamChunk{ToolCalls: []ToolCallDelta{{Index: 0, ID: "call_0", Name: "first", Arguments: `{"a":1}`}}}
+	stream <- StreamChunk{ToolCalls: []ToolCallDelta{{Index: 1, Arguments: `"x"}`}}}
+	stream <- StreamChunk{Done: true, Usage: &ResponseInfo{PromptTokens: 3, CompletionTokens: 7}}
+	close(stream)
+
+	message, info, err := CollectStream(stream)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "assistant", message.Role)
+	assert.Equal(t, "Let me check.", message.Content)
+	assert.Equal(t, ResponseInfo{PromptTokens: 3, CompletionTokens: 7}, info)
+	assert.Equal(t, 2, len(message.ToolCalls))
+	assert.Equal(t, "first", message.ToolCalls[0].Function.Name)
+	assert.Equal(t, float64(1), message.ToolCalls[0].Function.Arguments["a"])
+	assert.Equal(t, "second", message.ToolCalls[1].Function.Name)
+	assert.Equal(t, "x", message.ToolCalls[1].Function.Arguments["b"])
+}
+
+func TestCollectStreamWithError(t *testing.T) {
+	stream := make(chan StreamChunk, 2)
+	stream <- StreamChunk{Content: "partial"}
+	stream <- StreamChunk{Err: errors.New("connection reset")}
+	close(stream)
+
+	message, _, err := CollectStream(stream)
+
+	assert.EqualError(t, err, "connection reset")
+	assert.Equal(t, "partial", message.Content)
+}
+
+func TestCollectStreamWithoutDone(t *testing.T) {
+	stream := make(chan StreamChunk, 1)
+	stream <- StreamChunk{Content: "trunc"}
+	close(stream)
+
+	message, _, err := CollectStream(stream)
+
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, "trunc", message.Content)
+}
+
+func TestCollectStreamWithInvalidArguments(t *testing.T) {
+	stream := make(chan StreamChunk, 2)
+	stream <- StreamChunk{ToolCalls: []ToolCallDelta{{Index: 0, ID: "call_0", Name: "lookup", Arguments: `{"q":`}}}
+	stream <- StreamChunk{Done: true}
+	close(stream)
+
+	_, _, err := CollectStream(stream)
+
+	assert.ErrorContains(t, err, "invalid arguments of tool call lookup")
+}
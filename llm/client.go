@@ -1,20 +1,15 @@
 package llm
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"os"
 	"strings"
 
 	"github.com/jieliu2000/anyi/internal/utils"
-	"github.com/jieliu2000/anyi/llm/anthropic"
-	"github.com/jieliu2000/anyi/llm/azureopenai"
 	"github.com/jieliu2000/anyi/llm/chat"
-	"github.com/jieliu2000/anyi/llm/dashscope"
-	"github.com/jieliu2000/anyi/llm/ollama"
-	"github.com/jieliu2000/anyi/llm/openai"
-	"github.com/jieliu2000/anyi/llm/siliconcloud"
 	"github.com/jieliu2000/anyi/llm/tools"
-	"github.com/jieliu2000/anyi/llm/zhipu"
 	"github.com/mitchellh/mapstructure"
 )
 
@@ -33,8 +28,13 @@ type ClientConfig struct {
 	//	* "openai" - OpenAI model
 	//	* "azureopenai" - Azure OpenAI model
 	//	* "dashscope" - DashScope model
+	//	* "zhipu" - Zhipu AI model
+	//	* "siliconcloud" - SiliconCloud model
 	//	* "ollama" - Ollama model
 	//  * "anthropic" - Anthropic model
+	//	* "deepseek" - DeepSeek model
+	//	* "minimax" - MiniMax model
+	// Additional types can be added with RegisterProvider.
 	Type string `mapstructure:"type" json:"type"`
 
 	// The model config. The type of this field depends on the model. We define this property as map[string]interface{} for extensibility.
@@ -53,6 +53,149 @@ type Client interface {
 	ChatWithFunctions(messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error)
 }
 
+// ModelNamer is implemented by clients which report the model they send requests to. The built-in clients implement it.
+type ModelNamer interface {
+	ModelName() string
+}
+
+// ModelName returns the model of the client, or an empty string if the client doesn't implement ModelNamer.
+func ModelName(client Client) string {
+	if namer, ok := client.(ModelNamer); ok {
+		return namer.ModelName()
+	}
+	return ""
+}
+
+// MaxTokensReporter is implemented by clients which report the maximum number of reply tokens they request when a call doesn't set one. The built-in clients implement it.
+type MaxTokensReporter interface {
+	MaxTokens() int
+}
+
+// MaxTokens returns the maximum number of reply tokens the client requests by default, or 0 if there's no limit or the client doesn't implement MaxTokensReporter.
+func MaxTokens(client Client) int {
+	if reporter, ok := client.(MaxTokensReporter); ok {
+		return reporter.MaxTokens()
+	}
+	return 0
+}
+
+// ContextClient is implemented by clients which accept a context for their requests.
+// Cancelling the context or reaching its deadline aborts the underlying HTTP request.
+type ContextClient interface {
+	Client
+	ChatContext(ctx context.Context, messages []chat.Message, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error)
+	ChatWithFunctionsContext(ctx context.Context, messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error)
+}
+
+// ChatContext sends the messages with the given context.
+// If the client implements ContextClient, the context is passed down to the HTTP layer. Otherwise the context is only checked before calling Chat, so a cancelled context still prevents the request from being sent.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - client: The client to use
+//   - messages: The messages to send
+//   - options: The chat options, can be nil
+//
+// Returns:
+//   - The response message
+//   - The token usage
+//   - Any error encountered, including the context error if the context is done
+func ChatContext(ctx context.Context, client Client, messages []chat.Message, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
+	if client == nil {
+		return nil, chat.ResponseInfo{}, errors.New("client cannot be nil")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if contextClient, ok := client.(ContextClient); ok {
+		return contextClient.ChatContext(ctx, messages, options)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, chat.ResponseInfo{}, err
+	}
+	return client.Chat(messages, options)
+}
+
+// ChatWithFunctionsContext works like ChatContext but allows the model to call the given functions.
+func ChatWithFunctionsContext(ctx context.Context, client Client, messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
+	if client == nil {
+		return nil, chat.ResponseInfo{}, errors.New("client cannot be nil")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if contextClient, ok := client.(ContextClient); ok {
+		return contextClient.ChatWithFunctionsContext(ctx, messages, functions, options)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, chat.ResponseInfo{}, err
+	}
+	return client.ChatWithFunctions(messages, functions, options)
+}
+
+// StreamingClient is implemented by clients which can stream the response incrementally.
+// The returned channel delivers chunks as they arrive and is closed when the response is finished, when an error occurs or when the context is cancelled.
+// Use [chat.CollectStream] to assemble the chunks into a single message.
+type StreamingClient interface {
+	Client
+	ChatStream(ctx context.Context, messages []chat.Message, options *chat.ChatOptions) (<-chan chat.StreamChunk, error)
+	ChatWithFunctionsStream(ctx context.Context, messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (<-chan chat.StreamChunk, error)
+}
+
+// ChatStream streams the response of the client if it supports streaming.
+// If the client doesn't implement StreamingClient, the messages are sent with ChatContext and the whole response is delivered as a single final chunk, so callers can handle all clients the same way.
+//
+// Parameters:
+//   - ctx: The context controlling the lifetime of the stream
+//   - client: The client to use
+//   - messages: The messages to send
+//   - options: The chat options, can be nil
+//
+// Returns:
+//   - A channel delivering the response chunks
+//   - An error if the request couldn't be started
+func ChatStream(ctx context.Context, client Client, messages []chat.Message, options *chat.ChatOptions) (<-chan chat.StreamChunk, error) {
+	if client == nil {
+		return nil, errors.New("client cannot be nil")
+	}
+	if streamingClient, ok := client.(StreamingClient); ok {
+		return streamingClient.ChatStream(ctx, messages, options)
+	}
+
+	message, info, err := ChatContext(ctx, client, messages, options)
+	if err != nil {
+		return nil, err
+	}
+
+	output := make(chan chat.StreamChunk, 1)
+	output <- chat.StreamChunk{
+		Content:   message.Content,
+		Role:      message.Role,
+		ToolCalls: toolCallDeltas(message.ToolCalls),
+		Done:      true,
+		Usage:     &info,
+	}
+	close(output)
+	return output, nil
+}
+
+func toolCallDeltas(calls []chat.ToolCall) []chat.ToolCallDelta {
+	if len(calls) == 0 {
+		return nil
+	}
+	deltas := make([]chat.ToolCallDelta, 0, len(calls))
+	for i, call := range calls {
+		arguments, _ := json.Marshal(call.Function.Arguments)
+		deltas = append(deltas, chat.ToolCallDelta{
+			Index:     i,
+			Type:      "function",
+			Name:      call.Function.Name,
+			Arguments: string(arguments),
+		})
+	}
+	return deltas
+}
+
 // NewModelConfigFromClientConfig creates a new ModelConfig instance based on the provided ClientConfig.
 // Parameters:
 // - clientConfig *ClientConfig: The ClientConfig object containing configuration information.
@@ -64,25 +207,11 @@ func NewModelConfigFromClientConfig(clientConfig *ClientConfig) (ModelConfig, er
 		return nil, errors.New("client config is null")
 	}
 
-	var modelConfig ModelConfig
-	switch clientConfig.Type {
-	case "openai":
-		modelConfig = openai.DefaultConfig("")
-	case "azureopenai":
-		modelConfig = &azureopenai.AzureOpenAIModelConfig{}
-	case "dashscope":
-		modelConfig = dashscope.DefaultConfig("", "")
-	case "zhipu":
-		modelConfig = zhipu.DefaultConfig("", "")
-	case "siliconcloud":
-		modelConfig = siliconcloud.DefaultConfig("", "")
-	case "ollama":
-		modelConfig = ollama.DefaultConfig("")
-	case "anthropic":
-		modelConfig = anthropic.DefaultConfig("")
-	default:
+	p, ok := getProvider(clientConfig.Type)
+	if !ok {
 		return nil, errors.New("unknown client type:" + clientConfig.Type)
 	}
+	modelConfig := p.newConfig()
 
 	propertyConfig := clientConfig.Config
 	//Find and replace environment variables in the config
@@ -121,33 +250,31 @@ func NewModelConfigFromFile(configFile string) (ModelConfig, error) {
 
 // NewClient creates a new client based on the model config. The type of client is determined by the type of model config.
 // For example, if you pass in an OpenAIModelConfig, it will return a new OpenAIClient.
+// The client is created by the provider registered first for the config type, see RegisterProvider.
 func NewClient(config ModelConfig) (Client, error) {
+	p, ok := getProviderForConfig(config)
+	if !ok {
+		return nil, errors.New("unknown model config")
+	}
+	return p.newClient(config)
+}
 
-	//lint:ignore S1034 config variable will be used in future so we ignore this linter for now
-	switch config.(type) {
-
-	case *openai.OpenAIModelConfig:
-		return openai.NewClient(config.(*openai.OpenAIModelConfig))
-
-	case *azureopenai.AzureOpenAIModelConfig:
-		return azureopenai.NewClient(config.(*azureopenai.AzureOpenAIModelConfig))
-
-	case *dashscope.DashScopeModelConfig:
-		return dashscope.NewClient(config.(*dashscope.DashScopeModelConfig))
-
-	case *zhipu.ZhiPuModelConfig:
-		return zhipu.NewClient(config.(*zhipu.ZhiPuModelConfig))
-
-	case *siliconcloud.SiliconCloudConfig:
-		return siliconcloud.NewClient(config.(*siliconcloud.SiliconCloudConfig))
-
-	case *ollama.OllamaModelConfig:
-		return ollama.NewClient(config.(*ollama.OllamaModelConfig))
-
-	case *anthropic.AnthropicModelConfig:
-		return anthropic.NewClient(config.(*anthropic.AnthropicModelConfig))
+// NewClientFromClientConfig creates a new client from a client config using the provider registered for its type.
+// Unlike calling NewClient with the result of NewModelConfigFromClientConfig, this uses the provider of the type even if another provider shares its config type.
+//
+// Parameters:
+//   - clientConfig: The client config
+//
+// Returns:
+//   - The new client
+//   - An error if the type is unknown or the client can't be created
+func NewClientFromClientConfig(clientConfig *ClientConfig) (Client, error) {
+	modelConfig, err := NewModelConfigFromClientConfig(clientConfig)
+	if err != nil {
+		return nil, err
 	}
-	return nil, errors.New("unknown model config")
+	p, _ := getProvider(clientConfig.Type)
+	return p.newClient(modelConfig)
 }
 
 // NewClientFromConfigFile creates a new client based on the model config file.
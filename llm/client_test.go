@@ -1,14 +1,20 @@
 package llm
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"reflect"
 	"testing"
 
+	"github.com/jieliu2000/anyi/internal/test"
 	"github.com/jieliu2000/anyi/internal/utils"
+	"github.com/jieliu2000/anyi/llm/anthropic"
 	"github.com/jieliu2000/anyi/llm/azureopenai"
+	"github.com/jieliu2000/anyi/llm/chat"
 	"github.com/jieliu2000/anyi/llm/dashscope"
+	"github.com/jieliu2000/anyi/llm/deepseek"
+	"github.com/jieliu2000/anyi/llm/minimax"
 	"github.com/jieliu2000/anyi/llm/ollama"
 	"github.com/jieliu2000/anyi/llm/openai"
 	"github.com/jieliu2000/anyi/llm/siliconcloud"
@@ -177,3 +183,140 @@ func TestNewModelConfigFromClientConfig_WithEnvironmentVariables_CrossPlatform(t
 	assert.IsType(t, (*openai.OpenAIModelConfig)(nil), modelConfig)
 	assert.Equal(t, "test_api_key", modelConfig.(*openai.OpenAIModelConfig).APIKey)
 }
+
+func TestChatStreamFallsBackToChat(t *testing.T) {
+	client := &test.MockClient{ChatOutput: "full response"}
+
+	stream, err := ChatStream(context.Background(), client, []chat.Message{chat.NewUserMessage("Hi")}, nil)
+	assert.NoError(t, err)
+
+	chunks := []chat.StreamChunk{}
+	for chunk := range stream {
+		chunks = append(chunks, chunk)
+	}
+	assert.Equal(t, 1, len(chunks))
+	assert.Equal(t, "full response", chunks[0].Content)
+	assert.True(t, chunks[0].Done)
+}
+
+func TestChatStreamWithNilClient(t *testing.T) {
+	_, err := ChatStream(context.Background(), nil, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestNewClientFromClientConfig_DeepSeekAndMiniMax(t *testing.T) {
+	client, err := NewClientFromClientConfig(&ClientConfig{
+		Type:   "deepseek",
+		Config: map[string]interface{}{"apiKey": "key", "model": "deepseek-reasoner"},
+	})
+	assert.NoError(t, err)
+	assert.IsType(t, (*deepseek.DeepSeekClient)(nil), client)
+
+	modelConfig, err := NewModelConfigFromClientConfig(&ClientConfig{Type: "deepseek", Config: map[string]interface{}{"apiKey": "key"}})
+	assert.NoError(t, err)
+	assert.Equal(t, deepseek.DefaultModel, modelConfig.(*deepseek.DeepSeekModelConfig).Model)
+	assert.Equal(t, deepseek.DefaultBaseUrl, modelConfig.(*deepseek.DeepSeekModelConfig).BaseUrl)
+
+	client, err = NewClientFromClientConfig(&ClientConfig{
+		Type:   "minimax",
+		Config: map[string]interface{}{"apiKey": "key", "baseUrl": "https://example.com/v1"},
+	})
+	assert.NoError(t, err)
+	assert.IsType(t, (*minimax.MiniMaxClient)(nil), client)
+
+	client, err = NewClient(minimax.DefaultConfig("key", ""))
+	assert.NoError(t, err)
+	assert.IsType(t, (*minimax.MiniMaxClient)(nil), client)
+}
+
+func TestRegisterProvider(t *testing.T) {
+	created := []string{}
+	err := RegisterProvider("testgateway",
+		func() ModelConfig { return openai.NewConfig("", "gateway-model", "https://gateway.example.com/v1") },
+		func(config ModelConfig) (Client, error) {
+			created = append(created, config.(*openai.OpenAIModelConfig).Model)
+			return &test.MockClient{ChatOutput: "from gateway"}, nil
+		})
+	assert.NoError(t, err)
+	assert.Contains(t, ProviderTypes(), "testgateway")
+
+	client, err := NewClientFromClientConfig(&ClientConfig{Type: "testgateway", Config: map[string]interface{}{"apiKey": "key"}})
+	assert.NoError(t, err)
+	assert.IsType(t, (*test.MockClient)(nil), client)
+	assert.Equal(t, []string{"gateway-model"}, created)
+
+	// The openai provider keeps handling OpenAI configs passed to NewClient
+	client, err = NewClient(openai.DefaultConfig("key"))
+	assert.NoError(t, err)
+	assert.IsType(t, (*openai.OpenAIClient)(nil), client)
+}
+
+type testProviderConfig struct {
+	Model string
+}
+
+type otherTestProviderConfig struct {
+	Model string
+}
+
+func TestRegisterProvider_ReplaceWithOtherConfigType(t *testing.T) {
+	newClient := func(output string) ClientFactory {
+		return func(config ModelConfig) (Client, error) {
+			return &test.MockClient{ChatOutput: output}, nil
+		}
+	}
+	assert.NoError(t, RegisterProvider("testreplaced", func() ModelConfig { return &testProviderConfig{} }, newClient("replaced")))
+	assert.NoError(t, RegisterProvider("testsharing", func() ModelConfig { return &testProviderConfig{} }, newClient("sharing")))
+	assert.NoError(t, RegisterProvider("testalone", func() ModelConfig { return &otherTestProviderConfig{} }, newClient("alone")))
+
+	client, err := NewClient(&testProviderConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, "replaced", client.(*test.MockClient).ChatOutput)
+
+	// The config type moves to the other provider using it
+	assert.NoError(t, RegisterProvider("testreplaced", func() ModelConfig { return &otherTestProviderConfig{} }, newClient("new")))
+	client, err = NewClient(&testProviderConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, "sharing", client.(*test.MockClient).ChatOutput)
+
+	// No provider is left for the config type
+	assert.NoError(t, RegisterProvider("testalone", func() ModelConfig { return &testProviderConfig{} }, newClient("alone")))
+	_, err = NewClient(&otherTestProviderConfig{})
+	assert.NoError(t, err)
+	assert.NoError(t, RegisterProvider("testreplaced", func() ModelConfig { return &testProviderConfig{} }, newClient("new")))
+	_, err = NewClient(&otherTestProviderConfig{})
+	assert.EqualError(t, err, "unknown model config")
+}
+
+func TestRegisterProvider_InvalidArguments(t *testing.T) {
+	newConfig := func() ModelConfig { return openai.DefaultConfig("") }
+	newClient := func(config ModelConfig) (Client, error) { return nil, nil }
+
+	assert.Error(t, RegisterProvider("", newConfig, newClient))
+	assert.Error(t, RegisterProvider("invalid", nil, newClient))
+	assert.Error(t, RegisterProvider("invalid", newConfig, nil))
+	assert.Error(t, RegisterProvider("invalid", func() ModelConfig { return openai.OpenAIModelConfig{} }, newClient))
+	assert.NotContains(t, ProviderTypes(), "invalid")
+
+	_, err := NewClient(struct{}{})
+	assert.EqualError(t, err, "unknown model config")
+	_, err = NewClientFromClientConfig(&ClientConfig{Type: "invalid"})
+	assert.Error(t, err)
+}
+
+func TestModelName(t *testing.T) {
+	assert.Equal(t, "gpt-4o", ModelName(&openai.OpenAIClient{Config: &openai.OpenAIModelConfig{Model: "gpt-4o"}}))
+	assert.Equal(t, "my-deployment", ModelName(&azureopenai.AzureOpenAIClient{Config: &azureopenai.AzureOpenAIModelConfig{ModelDeploymentId: "my-deployment"}}))
+	assert.Equal(t, "", ModelName(&ollama.OllamaClient{}))
+	assert.Equal(t, "", ModelName(&test.MockClient{}))
+}
+
+func TestMaxTokens(t *testing.T) {
+	openaiConfig := openai.DefaultConfig("key")
+	openaiConfig.MaxTokens = 500
+	assert.Equal(t, 500, MaxTokens(&openai.OpenAIClient{Config: openaiConfig}))
+	assert.Equal(t, 0, MaxTokens(&ollama.OllamaClient{}))
+	assert.Equal(t, anthropic.DefaultMaxTokens, MaxTokens(&anthropic.AnthropicClient{Config: &anthropic.AnthropicModelConfig{}}))
+	assert.Equal(t, 8192+anthropic.DefaultMaxTokens, MaxTokens(&anthropic.AnthropicClient{Config: &anthropic.AnthropicModelConfig{ThinkingBudget: 8192}}))
+	assert.Equal(t, 0, MaxTokens(&test.MockClient{}))
+}
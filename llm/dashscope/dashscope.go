@@ -4,6 +4,7 @@
 package dashscope
 
 import (
+	"context"
 	"errors"
 
 	"github.com/jieliu2000/anyi/llm/chat"
@@ -67,11 +68,22 @@ const (
 	DefaultModel = "qwen3-max"
 )
 
+const (
+	// DefaultEmbeddingModel is the embedding model used by Embed if EmbeddingModel is not set.
+	DefaultEmbeddingModel = "text-embedding-v3"
+	// DefaultEmbeddingBatchSize is the number of texts DashScope accepts in one embeddings request.
+	DefaultEmbeddingBatchSize = 10
+)
+
 type DashScopeModelConfig struct {
 	config.GeneralLLMConfig
 	APIKey  string `json:"apiKey" mapstructure:"apiKey"`
 	BaseUrl string `json:"baseUrl" mapstructure:"baseUrl"`
 	Model   string `json:"model" mapstructure:"model"`
+	// The model used by Embed. Defaults to DefaultEmbeddingModel.
+	EmbeddingModel string `json:"embeddingModel" mapstructure:"embeddingModel"`
+	// The maximum number of texts sent in one embeddings request. Defaults to DefaultEmbeddingBatchSize.
+	EmbeddingBatchSize int `json:"embeddingBatchSize" mapstructure:"embeddingBatchSize"`
 }
 
 type DashScopeClient struct {
@@ -117,7 +129,7 @@ func NewClient(config *DashScopeModelConfig) (*DashScopeClient, error) {
 	// Create a new DashScopeClient using the provided config and the configured client implementation
 	client := &DashScopeClient{
 		Config:     config,
-		clientImpl: impl.NewClientWithConfig(configImpl),
+		clientImpl: openai.NewClientImpl(configImpl),
 	}
 
 	// Return the newly created DashScopeClient and nil error
@@ -125,6 +137,11 @@ func NewClient(config *DashScopeModelConfig) (*DashScopeClient, error) {
 }
 
 func (c *DashScopeClient) ChatWithFunctions(messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
+	return c.ChatWithFunctionsContext(context.Background(), messages, functions, options)
+}
+
+// ChatWithFunctionsContext works like ChatWithFunctions but sends the request with the given context. The request is aborted when the context is cancelled or its deadline expires.
+func (c *DashScopeClient) ChatWithFunctionsContext(ctx context.Context, messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
 	client := c.clientImpl
 
 	// Create a temporary config object compatible with OpenAIModelConfig
@@ -133,10 +150,15 @@ func (c *DashScopeClient) ChatWithFunctions(messages []chat.Message, functions [
 		Model:            c.Config.Model,
 	}
 
-	return openai.ExecuteChatWithFunctions(client, c.Config.Model, messages, functions, options, openaiConfig)
+	return openai.ExecuteChatWithFunctionsContext(ctx, client, c.Config.Model, messages, functions, options, openaiConfig)
 }
 
 func (c *DashScopeClient) Chat(messages []chat.Message, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
+	return c.ChatContext(context.Background(), messages, options)
+}
+
+// ChatContext works like Chat but sends the request with the given context. The request is aborted when the context is cancelled or its deadline expires.
+func (c *DashScopeClient) ChatContext(ctx context.Context, messages []chat.Message, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
 	client := c.clientImpl
 
 	// Create a temporary config object compatible with OpenAIModelConfig
@@ -145,5 +167,52 @@ func (c *DashScopeClient) Chat(messages []chat.Message, options *chat.ChatOption
 		Model:            c.Config.Model,
 	}
 
-	return openai.ExecuteChat(client, c.Config.Model, messages, options, openaiConfig)
+	return openai.ExecuteChatContext(ctx, client, c.Config.Model, messages, options, openaiConfig)
+}
+
+// ChatStream sends the messages to the model and streams the response back through the returned channel.
+func (c *DashScopeClient) ChatStream(ctx context.Context, messages []chat.Message, options *chat.ChatOptions) (<-chan chat.StreamChunk, error) {
+	return c.ChatWithFunctionsStream(ctx, messages, nil, options)
+}
+
+// ChatWithFunctionsStream works like ChatStream but also allows the model to call the given functions.
+func (c *DashScopeClient) ChatWithFunctionsStream(ctx context.Context, messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (<-chan chat.StreamChunk, error) {
+	// Create a temporary config object compatible with OpenAIModelConfig
+	openaiConfig := &openai.OpenAIModelConfig{
+		GeneralLLMConfig: c.Config.GeneralLLMConfig,
+		Model:            c.Config.Model,
+		// The API reports the usage of streams with stream_options
+		StreamUsage: true,
+	}
+
+	return openai.ExecuteChatStream(ctx, c.clientImpl, c.Config.Model, messages, functions, options, openaiConfig)
+}
+
+// Embed computes the embeddings of the texts with the EmbeddingModel of the config, or DefaultEmbeddingModel if it's not set.
+func (c *DashScopeClient) Embed(ctx context.Context, texts []string) ([][]float32, chat.ResponseInfo, error) {
+	model := c.Config.EmbeddingModel
+	if model == "" {
+		model = DefaultEmbeddingModel
+	}
+	batchSize := c.Config.EmbeddingBatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultEmbeddingBatchSize
+	}
+	return openai.ExecuteEmbeddingsContext(ctx, c.clientImpl, model, texts, batchSize)
+}
+
+// ModelName returns the model of the config. It's used to look up the context window of the model.
+func (c *DashScopeClient) ModelName() string {
+	if c.Config == nil {
+		return ""
+	}
+	return c.Config.Model
+}
+
+// MaxTokens returns the max tokens of the config, or 0 if they are not limited. They are reserved for the reply when the context window is checked.
+func (c *DashScopeClient) MaxTokens() int {
+	if c.Config == nil {
+		return 0
+	}
+	return c.Config.MaxTokens
 }
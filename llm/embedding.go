@@ -0,0 +1,42 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jieliu2000/anyi/llm/chat"
+)
+
+// Embedder is implemented by clients which can compute embeddings, the vectors representing the meaning of texts which are used for semantic search.
+// The OpenAI, Azure OpenAI, DashScope, Zhipu, SiliconCloud and Ollama clients implement it. The model is set with the embeddingModel property of their config.
+type Embedder interface {
+	// Embed returns one vector per text, in the order of the texts. Texts are sent in batches if there are more than the provider accepts in one request.
+	// The returned usage holds the number of input tokens in PromptTokens.
+	Embed(ctx context.Context, texts []string) ([][]float32, chat.ResponseInfo, error)
+}
+
+// Embed computes the embeddings of the texts with the client.
+//
+// Parameters:
+//   - ctx: The context of the requests
+//   - client: The client to use. It must implement Embedder
+//   - texts: The texts to embed
+//
+// Returns:
+//   - One vector per text
+//   - The token usage
+//   - An error if the client doesn't support embeddings or a request fails
+func Embed(ctx context.Context, client Client, texts []string) ([][]float32, chat.ResponseInfo, error) {
+	if client == nil {
+		return nil, chat.ResponseInfo{}, errors.New("client cannot be nil")
+	}
+	embedder, ok := client.(Embedder)
+	if !ok {
+		return nil, chat.ResponseInfo{}, fmt.Errorf("client of type %T doesn't support embeddings", client)
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return embedder.Embed(ctx, texts)
+}
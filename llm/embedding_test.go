@@ -0,0 +1,73 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/jieliu2000/anyi/internal/test"
+	"github.com/jieliu2000/anyi/llm/dashscope"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbed_ClientWithoutEmbeddings(t *testing.T) {
+	_, _, err := Embed(context.Background(), &test.SequenceClient{}, []string{"a"})
+	assert.ErrorContains(t, err, "doesn't support embeddings")
+
+	_, _, err = Embed(context.Background(), nil, []string{"a"})
+	assert.Error(t, err)
+}
+
+func TestEmbed_ClientConfig(t *testing.T) {
+	var batchSizes []int
+	mockServer := test.NewTestServer()
+	mockServer.RequestHandler = func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		request := struct {
+			Input []string `json:"input"`
+			Model string   `json:"model"`
+		}{}
+		assert.NoError(t, json.Unmarshal(body, &request))
+		assert.Equal(t, "text-embedding-v4", request.Model)
+		batchSizes = append(batchSizes, len(request.Input))
+
+		response := map[string]any{"usage": map[string]any{"prompt_tokens": len(request.Input)}}
+		var data []map[string]any
+		for i := range request.Input {
+			data = append(data, map[string]any{"index": i, "embedding": []float32{float32(i)}})
+		}
+		response["data"] = data
+		json.NewEncoder(w).Encode(response)
+	}
+	defer mockServer.Close()
+	mockServer.Start()
+
+	modelConfig, err := NewModelConfigFromClientConfig(&ClientConfig{
+		Type: "dashscope",
+		Config: map[string]interface{}{
+			"apiKey":         "test_api_key",
+			"model":          "qwen-max",
+			"baseUrl":        mockServer.URL(),
+			"embeddingModel": "text-embedding-v4",
+		},
+	})
+	assert.NoError(t, err)
+	client, err := NewClient(modelConfig)
+	assert.NoError(t, err)
+
+	texts := make([]string, 25)
+	for i := range texts {
+		texts[i] = "text"
+	}
+	vectors, info, err := Embed(context.Background(), client, texts)
+
+	assert.NoError(t, err)
+	assert.Len(t, vectors, 25)
+	assert.Equal(t, 25, info.PromptTokens)
+	// DashScope accepts a limited number of texts per request
+	assert.Equal(t, []int{dashscope.DefaultEmbeddingBatchSize, dashscope.DefaultEmbeddingBatchSize, 5}, batchSizes)
+}
@@ -1,6 +1,7 @@
 package minimax
 
 import (
+	"context"
 	"errors"
 
 	"github.com/jieliu2000/anyi/llm/chat"
@@ -78,28 +79,70 @@ func NewClient(config *MiniMaxModelConfig) (*MiniMaxClient, error) {
 
 	return &MiniMaxClient{
 		Config:     config,
-		clientImpl: impl.NewClientWithConfig(configImpl),
+		clientImpl: openai.NewClientImpl(configImpl),
 	}, nil
 }
 
 // ChatWithFunctions performs a chat completion with function/tool support
 func (c *MiniMaxClient) ChatWithFunctions(messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
+	return c.ChatWithFunctionsContext(context.Background(), messages, functions, options)
+}
+
+// ChatWithFunctionsContext works like ChatWithFunctions but sends the request with the given context. The request is aborted when the context is cancelled or its deadline expires.
+func (c *MiniMaxClient) ChatWithFunctionsContext(ctx context.Context, messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
 	// Create a temporary config object compatible with OpenAIModelConfig
 	openaiConfig := &openai.OpenAIModelConfig{
 		GeneralLLMConfig: c.Config.GeneralLLMConfig,
 		Model:            c.Config.Model,
 	}
 
-	return openai.ExecuteChatWithFunctions(c.clientImpl, c.Config.Model, messages, functions, options, openaiConfig)
+	return openai.ExecuteChatWithFunctionsContext(ctx, c.clientImpl, c.Config.Model, messages, functions, options, openaiConfig)
 }
 
 // Chat performs a simple chat completion
 func (c *MiniMaxClient) Chat(messages []chat.Message, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
+	return c.ChatContext(context.Background(), messages, options)
+}
+
+// ChatContext works like Chat but sends the request with the given context. The request is aborted when the context is cancelled or its deadline expires.
+func (c *MiniMaxClient) ChatContext(ctx context.Context, messages []chat.Message, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
 	// Create a temporary config object compatible with OpenAIModelConfig
 	openaiConfig := &openai.OpenAIModelConfig{
 		GeneralLLMConfig: c.Config.GeneralLLMConfig,
 		Model:            c.Config.Model,
 	}
 
-	return openai.ExecuteChat(c.clientImpl, c.Config.Model, messages, options, openaiConfig)
-}
\ No newline at end of file
+	return openai.ExecuteChatContext(ctx, c.clientImpl, c.Config.Model, messages, options, openaiConfig)
+}
+
+// ChatStream sends the messages to the model and streams the response back through the returned channel.
+func (c *MiniMaxClient) ChatStream(ctx context.Context, messages []chat.Message, options *chat.ChatOptions) (<-chan chat.StreamChunk, error) {
+	return c.ChatWithFunctionsStream(ctx, messages, nil, options)
+}
+
+// ChatWithFunctionsStream works like ChatStream but also allows the model to call the given functions.
+func (c *MiniMaxClient) ChatWithFunctionsStream(ctx context.Context, messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (<-chan chat.StreamChunk, error) {
+	// Create a temporary config object compatible with OpenAIModelConfig
+	openaiConfig := &openai.OpenAIModelConfig{
+		GeneralLLMConfig: c.Config.GeneralLLMConfig,
+		Model:            c.Config.Model,
+	}
+
+	return openai.ExecuteChatStream(ctx, c.clientImpl, c.Config.Model, messages, functions, options, openaiConfig)
+}
+
+// ModelName returns the model of the config. It's used to look up the context window of the model.
+func (c *MiniMaxClient) ModelName() string {
+	if c.Config == nil {
+		return ""
+	}
+	return c.Config.Model
+}
+
+// MaxTokens returns the max tokens of the config, or 0 if they are not limited. They are reserved for the reply when the context window is checked.
+func (c *MiniMaxClient) MaxTokens() int {
+	if c.Config == nil {
+		return 0
+	}
+	return c.Config.MaxTokens
+}
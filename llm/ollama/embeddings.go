@@ -0,0 +1,86 @@
+package ollama
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/jieliu2000/anyi/llm/chat"
+)
+
+// DefaultEmbeddingModel is the embedding model used by Embed if EmbeddingModel is not set.
+const DefaultEmbeddingModel = "nomic-embed-text"
+
+// OllamaEmbedRequest is the request body of the Ollama embed API.
+type OllamaEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// OllamaEmbedResponse is the response body of the Ollama embed API.
+type OllamaEmbedResponse struct {
+	Model           string      `json:"model"`
+	Embeddings      [][]float32 `json:"embeddings"`
+	PromptEvalCount int         `json:"prompt_eval_count"`
+	Error           string      `json:"error,omitempty"`
+}
+
+// Embed computes the embeddings of the texts with the "/embed" API of the Ollama server, using the EmbeddingModel of the config or DefaultEmbeddingModel if it's not set.
+func (c *OllamaClient) Embed(ctx context.Context, texts []string) ([][]float32, chat.ResponseInfo, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	model := c.Config.EmbeddingModel
+	if model == "" {
+		model = DefaultEmbeddingModel
+	}
+	httpClient := c.clientImpl
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return chat.EmbedBatches(ctx, texts, c.Config.EmbeddingBatchSize, func(ctx context.Context, batch []string) ([][]float32, chat.ResponseInfo, error) {
+		return c.callEmbedAPI(ctx, &OllamaEmbedRequest{Model: model, Input: batch}, httpClient)
+	})
+}
+
+func (c *OllamaClient) callEmbedAPI(ctx context.Context, request *OllamaEmbedRequest, httpClient *http.Client) ([][]float32, chat.ResponseInfo, error) {
+	requestJson, err := json.Marshal(*request)
+	if err != nil {
+		return nil, chat.ResponseInfo{}, err
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Config.OllamaApiURL+"/embed", bytes.NewBuffer(requestJson))
+	if err != nil {
+		return nil, chat.ResponseInfo{}, err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+
+	res, err := httpClient.Do(httpRequest)
+	if err != nil {
+		return nil, chat.ResponseInfo{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, chat.ResponseInfo{}, fmt.Errorf("error response status from ollama embed api: %d", res.StatusCode)
+	}
+
+	responseBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, chat.ResponseInfo{}, err
+	}
+
+	embedResponse := OllamaEmbedResponse{}
+	if err := json.Unmarshal(responseBody, &embedResponse); err != nil {
+		return nil, chat.ResponseInfo{}, err
+	}
+	if embedResponse.Error != "" {
+		return nil, chat.ResponseInfo{}, fmt.Errorf("ollama embed api error: %s", embedResponse.Error)
+	}
+
+	return embedResponse.Embeddings, chat.ResponseInfo{PromptTokens: embedResponse.PromptEvalCount}, nil
+}
@@ -0,0 +1,69 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/jieliu2000/anyi/internal/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbed(t *testing.T) {
+	var requests []OllamaEmbedRequest
+	mockServer := test.NewTestServer()
+	mockServer.RequestHandler = func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method, "Expected POST method")
+		assert.Equal(t, "/embed", r.URL.Path)
+
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		request := OllamaEmbedRequest{}
+		assert.NoError(t, json.Unmarshal(body, &request))
+		requests = append(requests, request)
+
+		response := OllamaEmbedResponse{Model: request.Model, PromptEvalCount: len(request.Input)}
+		for _, input := range request.Input {
+			response.Embeddings = append(response.Embeddings, []float32{float32(len(input))})
+		}
+		json.NewEncoder(w).Encode(response)
+	}
+	defer mockServer.Close()
+	mockServer.Start()
+
+	config := NewConfig("test-model", mockServer.URL())
+	config.EmbeddingBatchSize = 2
+	client, err := NewClient(config)
+	assert.NoError(t, err)
+
+	vectors, info, err := client.Embed(context.Background(), []string{"a", "bb", "ccc"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, [][]float32{{1}, {2}, {3}}, vectors)
+	assert.Equal(t, 3, info.PromptTokens)
+	assert.Len(t, requests, 2)
+	assert.Equal(t, DefaultEmbeddingModel, requests[0].Model)
+	assert.Equal(t, []string{"a", "bb"}, requests[0].Input)
+	assert.Equal(t, []string{"ccc"}, requests[1].Input)
+}
+
+func TestEmbed_ErrorStatus(t *testing.T) {
+	mockServer := test.NewTestServer()
+	mockServer.RequestHandler = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"error":"model \"missing\" not found"}`)
+	}
+	defer mockServer.Close()
+	mockServer.Start()
+
+	config := NewConfig("test-model", mockServer.URL())
+	config.EmbeddingModel = "missing"
+	client, err := NewClient(config)
+	assert.NoError(t, err)
+
+	_, _, err = client.Embed(context.Background(), []string{"a"})
+	assert.Error(t, err)
+}
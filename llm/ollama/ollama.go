@@ -1,7 +1,9 @@
 package ollama
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -74,6 +76,12 @@ type OllamaModelConfig struct {
 	//
 	//[Ollama's documentation]: https://github.com/ollama/ollama/blob/main/README.md#quickstart
 	Model string `json:"model" mapstructure:"model"`
+
+	//The model used by Embed. Defaults to DefaultEmbeddingModel.
+	EmbeddingModel string `json:"embeddingModel" mapstructure:"embeddingModel"`
+
+	//The maximum number of texts sent in one embeddings request. Defaults to chat.DefaultEmbeddingBatchSize.
+	EmbeddingBatchSize int `json:"embeddingBatchSize" mapstructure:"embeddingBatchSize"`
 }
 
 type OllamaClient struct {
@@ -140,28 +148,21 @@ func NewClient(config *OllamaModelConfig) (*OllamaClient, error) {
 }
 
 type OllamaRequest struct {
-	Model            string                   `json:"model"`
-	Messages         []OllamaMessage          `json:"messages"`
-	Stream           bool                     `json:"stream"`
-	Tools            []map[string]interface{} `json:"tools,omitempty"`
-	Format           string                   `json:"format,omitempty"`
-	Temperature      float32                  `json:"temperature,omitempty"`
-	TopP             float32                  `json:"top_p,omitempty"`
-	MaxTokens        int                      `json:"num_predict,omitempty"`
-	PresencePenalty  float32                  `json:"presence_penalty,omitempty"`
-	FrequencyPenalty float32                  `json:"frequency_penalty,omitempty"`
-	Stop             []string                 `json:"stop,omitempty"`
-}
-
-type OllamaParameterDetail struct {
-	Type        string   `json:"type"`
-	Description string   `json:"description,omitempty"`
-	Enum        []string `json:"enum,omitempty"`
+	Model    string                   `json:"model"`
+	Messages []OllamaMessage          `json:"messages"`
+	Stream   bool                     `json:"stream"`
+	Tools    []map[string]interface{} `json:"tools,omitempty"`
+	Format   any                      `json:"format,omitempty"`
+
+	// Options contains the generation parameters, using the option names of Ollama such as "temperature" or "num_predict".
+	Options map[string]any `json:"options,omitempty"`
 }
 
+// OllamaParameters is the JSON schema of the parameters of a function.
 type OllamaParameters struct {
-	Type       string                           `json:"type"`
-	Properties map[string]OllamaParameterDetail `json:"properties"`
+	Type       string         `json:"type"`
+	Properties map[string]any `json:"properties"`
+	Required   []string       `json:"required,omitempty"`
 }
 
 type OllamaFunction struct {
@@ -174,6 +175,8 @@ type OllamaResponse struct {
 	Message         chat.Message `json:"message"`
 	CreatedAt       time.Time    `json:"created_at"`
 	Done            bool         `json:"done"`
+	DoneReason      string       `json:"done_reason,omitempty"`
+	Error           string       `json:"error,omitempty"`
 	TotalDuration   int          `json:"total_duration"`
 	LoadDuration    int          `json:"load_duration"`
 	PromptEvalCount int          `json:"prompt_eval_count"`
@@ -181,16 +184,9 @@ type OllamaResponse struct {
 }
 
 func convertToOllamaFunction(function tools.FunctionConfig) OllamaFunction {
-
-	properties := make(map[string]OllamaParameterDetail)
-
-	for _, param := range function.Params {
-		properties[param.Name] = OllamaParameterDetail{
-			Type:        param.Type,
-			Description: param.Description,
-			Enum:        param.Enum,
-		}
-	}
+	schema := function.ParametersSchema()
+	properties, _ := schema["properties"].(map[string]any)
+	required, _ := schema["required"].([]string)
 
 	return OllamaFunction{
 		Name:        function.Name,
@@ -198,6 +194,7 @@ func convertToOllamaFunction(function tools.FunctionConfig) OllamaFunction {
 		Parameters: OllamaParameters{
 			Type:       "object",
 			Properties: properties,
+			Required:   required,
 		},
 	}
 }
@@ -220,7 +217,89 @@ func ConvertToOllamaTools(functions []tools.FunctionConfig) ([]map[string]interf
 	return ollamaFunctions, nil
 }
 
+// newRequest creates an Ollama chat request with the model, the general LLM configuration and the chat options of the client applied.
+func (c *OllamaClient) newRequest(ollamaMessages []OllamaMessage, options *chat.ChatOptions) *OllamaRequest {
+	request := &OllamaRequest{}
+	request.Model = c.Config.Model
+	request.Messages = ollamaMessages
+
+	// Set format options from options. Ollama accepts either "json" or a JSON schema as format.
+	if options != nil && options.Schema != nil {
+		request.Format = options.Schema
+	} else if options != nil && options.Format != "" {
+		request.Format = options.Format
+	}
+
+	request.Options = c.newOptions(options)
+	return request
+}
+
+// newOptions returns the Ollama options of a request: the generation parameters of the general LLM configuration of the client, with the parameters of the chat options applied over them. Zero values of the configuration are left to the defaults of the model.
+func (c *OllamaClient) newOptions(options *chat.ChatOptions) map[string]any {
+	ollamaOptions := map[string]any{}
+	if c.Config.Temperature != 0 {
+		ollamaOptions["temperature"] = c.Config.Temperature
+	}
+	if c.Config.TopP != 0 {
+		ollamaOptions["top_p"] = c.Config.TopP
+	}
+	if c.Config.MaxTokens > 0 {
+		ollamaOptions["num_predict"] = c.Config.MaxTokens
+	}
+	if len(c.Config.Stop) > 0 {
+		ollamaOptions["stop"] = c.Config.Stop
+	}
+	if c.Config.PresencePenalty != 0 {
+		ollamaOptions["presence_penalty"] = c.Config.PresencePenalty
+	}
+	if c.Config.FrequencyPenalty != 0 {
+		ollamaOptions["frequency_penalty"] = c.Config.FrequencyPenalty
+	}
+	if options != nil {
+		convertToOllamaOptions(options, ollamaOptions)
+	}
+	if len(ollamaOptions) == 0 {
+		return nil
+	}
+	return ollamaOptions
+}
+
+// convertToOllamaOptions sets the generation parameters of the chat options in the Ollama options.
+func convertToOllamaOptions(options *chat.ChatOptions, ollamaOptions map[string]any) {
+	if options.Temperature != nil {
+		ollamaOptions["temperature"] = *options.Temperature
+	}
+	if options.TopP != nil {
+		ollamaOptions["top_p"] = *options.TopP
+	}
+	if options.MaxTokens != nil {
+		ollamaOptions["num_predict"] = *options.MaxTokens
+	}
+	if len(options.Stop) > 0 {
+		ollamaOptions["stop"] = options.Stop
+	}
+	if options.Seed != nil {
+		ollamaOptions["seed"] = *options.Seed
+	}
+	if options.PresencePenalty != nil {
+		ollamaOptions["presence_penalty"] = *options.PresencePenalty
+	}
+	if options.FrequencyPenalty != nil {
+		ollamaOptions["frequency_penalty"] = *options.FrequencyPenalty
+	}
+}
+
+// allowsTools reports whether the tools should be sent. Ollama has no tool choice parameter, so only "none" is supported by not sending the tools.
+func allowsTools(options *chat.ChatOptions) bool {
+	return options == nil || options.ToolChoice != chat.ToolChoiceNone
+}
+
 func (c *OllamaClient) ChatWithFunctions(messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
+	return c.ChatWithFunctionsContext(context.Background(), messages, functions, options)
+}
+
+// ChatWithFunctionsContext works like ChatWithFunctions but sends the request with the given context. The request is aborted when the context is cancelled or its deadline expires.
+func (c *OllamaClient) ChatWithFunctionsContext(ctx context.Context, messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
 
 	response := chat.ResponseInfo{}
 	httpClient := c.clientImpl
@@ -240,32 +319,20 @@ func (c *OllamaClient) ChatWithFunctions(messages []chat.Message, functions []to
 		return nil, response, err
 	}
 
-	request := &OllamaRequest{}
-	request.Model = c.Config.Model
-	request.Messages = ollamaMessages
-	request.Tools = tools
-
-	// Apply general configuration from GeneralLLMConfig
-	request.Temperature = c.Config.Temperature
-	request.TopP = c.Config.TopP
-	if c.Config.MaxTokens > 0 {
-		request.MaxTokens = c.Config.MaxTokens
-	}
-	request.PresencePenalty = c.Config.PresencePenalty
-	request.FrequencyPenalty = c.Config.FrequencyPenalty
-	if len(c.Config.Stop) > 0 {
-		request.Stop = c.Config.Stop
-	}
-
-	// Set format options from options
-	if options != nil && options.Format != "" {
-		request.Format = options.Format
+	request := c.newRequest(ollamaMessages, options)
+	if allowsTools(options) {
+		request.Tools = tools
 	}
 
-	return c.callOllamaAPI(request, response, httpClient)
+	return c.callOllamaAPI(ctx, request, response, httpClient)
 }
 
 func (c *OllamaClient) Chat(messages []chat.Message, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
+	return c.ChatContext(context.Background(), messages, options)
+}
+
+// ChatContext works like Chat but sends the request with the given context. The request is aborted when the context is cancelled or its deadline expires.
+func (c *OllamaClient) ChatContext(ctx context.Context, messages []chat.Message, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
 
 	response := chat.ResponseInfo{}
 	httpClient := c.clientImpl
@@ -279,38 +346,61 @@ func (c *OllamaClient) Chat(messages []chat.Message, options *chat.ChatOptions)
 		return nil, response, err
 	}
 
-	request := &OllamaRequest{}
-	request.Model = c.Config.Model
-	request.Messages = ollamaMessages
+	request := c.newRequest(ollamaMessages, options)
 
-	// Apply general configuration from GeneralLLMConfig
-	request.Temperature = c.Config.Temperature
-	request.TopP = c.Config.TopP
-	if c.Config.MaxTokens > 0 {
-		request.MaxTokens = c.Config.MaxTokens
+	return c.callOllamaAPI(ctx, request, response, httpClient)
+}
+
+// ChatStream sends the messages to Ollama with streaming enabled. Ollama answers with newline delimited JSON objects, each of them is converted to a chunk and sent to the returned channel.
+// The channel is closed when the stream ends, fails or the context is cancelled.
+func (c *OllamaClient) ChatStream(ctx context.Context, messages []chat.Message, options *chat.ChatOptions) (<-chan chat.StreamChunk, error) {
+	return c.ChatWithFunctionsStream(ctx, messages, nil, options)
+}
+
+// ChatWithFunctionsStream works like ChatStream but also allows the model to call the given functions.
+// Ollama doesn't split tool calls into fragments, so each tool call is delivered in a single delta with the complete JSON arguments.
+func (c *OllamaClient) ChatWithFunctionsStream(ctx context.Context, messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (<-chan chat.StreamChunk, error) {
+	httpClient := c.clientImpl
+
+	if httpClient == nil {
+		return nil, errors.New("http client cannot be nil, maybe you didn't initiatialize the client. Considering using NewClient function")
 	}
-	request.PresencePenalty = c.Config.PresencePenalty
-	request.FrequencyPenalty = c.Config.FrequencyPenalty
-	if len(c.Config.Stop) > 0 {
-		request.Stop = c.Config.Stop
+
+	ollamaMessages, err := ConvertToOllamaMessages(messages)
+	if err != nil {
+		return nil, err
 	}
 
-	// Set format options from options
-	if options != nil && options.Format != "" {
-		request.Format = options.Format
+	request := c.newRequest(ollamaMessages, options)
+	if len(functions) > 0 && allowsTools(options) {
+		tools, err := ConvertToOllamaTools(functions)
+		if err != nil {
+			return nil, err
+		}
+		request.Tools = tools
 	}
+	request.Stream = true
 
-	return c.callOllamaAPI(request, response, httpClient)
+	return c.streamOllamaAPI(ctx, request, httpClient)
 }
 
-func (c *OllamaClient) callOllamaAPI(request *OllamaRequest, response chat.ResponseInfo, httpClient *http.Client) (*chat.Message, chat.ResponseInfo, error) {
+func (c *OllamaClient) callOllamaAPI(ctx context.Context, request *OllamaRequest, response chat.ResponseInfo, httpClient *http.Client) (*chat.Message, chat.ResponseInfo, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	requestJson, err := json.Marshal(*request)
 
 	if err != nil {
 		return nil, response, err
 	}
 
-	res, err := httpClient.Post(c.Config.OllamaApiURL+"/chat", "application/json", bytes.NewBuffer(requestJson))
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Config.OllamaApiURL+"/chat", bytes.NewBuffer(requestJson))
+	if err != nil {
+		return nil, response, err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+
+	res, err := httpClient.Do(httpRequest)
 
 	if err != nil {
 		return nil, response, err
@@ -337,5 +427,130 @@ func (c *OllamaClient) callOllamaAPI(request *OllamaRequest, response chat.Respo
 	response.PromptTokens = ollamaResponse.PromptEvalCount
 	response.CompletionTokens = ollamaResponse.EvalCount
 
+	for i := range ollamaResponse.Message.ToolCalls {
+		if ollamaResponse.Message.ToolCalls[i].Type == "" {
+			ollamaResponse.Message.ToolCalls[i].Type = "function"
+		}
+	}
+
 	return &ollamaResponse.Message, response, nil
 }
+
+func (c *OllamaClient) streamOllamaAPI(ctx context.Context, request *OllamaRequest, httpClient *http.Client) (<-chan chat.StreamChunk, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	requestJson, err := json.Marshal(*request)
+	if err != nil {
+		return nil, err
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Config.OllamaApiURL+"/chat", bytes.NewBuffer(requestJson))
+	if err != nil {
+		return nil, err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+
+	res, err := httpClient.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("error response status from ollama chat api: %d", res.StatusCode)
+	}
+
+	output := make(chan chat.StreamChunk)
+	go func() {
+		defer close(output)
+		defer res.Body.Close()
+
+		send := func(chunk chat.StreamChunk) bool {
+			select {
+			case output <- chunk:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		toolCallIndex := 0
+		scanner := bufio.NewScanner(res.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+
+			ollamaResponse := OllamaResponse{}
+			if err := json.Unmarshal(line, &ollamaResponse); err != nil {
+				send(chat.StreamChunk{Err: err})
+				return
+			}
+			if ollamaResponse.Error != "" {
+				send(chat.StreamChunk{Err: errors.New(ollamaResponse.Error)})
+				return
+			}
+
+			chunk := chat.StreamChunk{
+				Content: ollamaResponse.Message.Content,
+				Role:    ollamaResponse.Message.Role,
+			}
+			for _, call := range ollamaResponse.Message.ToolCalls {
+				arguments, err := json.Marshal(call.Function.Arguments)
+				if err != nil {
+					send(chat.StreamChunk{Err: err})
+					return
+				}
+				chunk.ToolCalls = append(chunk.ToolCalls, chat.ToolCallDelta{
+					Index:     toolCallIndex,
+					ID:        call.ID,
+					Type:      "function",
+					Name:      call.Function.Name,
+					Arguments: string(arguments),
+				})
+				toolCallIndex++
+			}
+
+			if ollamaResponse.Done {
+				chunk.Done = true
+				chunk.FinishReason = ollamaResponse.DoneReason
+				chunk.Usage = &chat.ResponseInfo{
+					PromptTokens:     ollamaResponse.PromptEvalCount,
+					CompletionTokens: ollamaResponse.EvalCount,
+				}
+				send(chunk)
+				return
+			}
+			if !send(chunk) {
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			send(chat.StreamChunk{Err: err})
+			return
+		}
+		send(chat.StreamChunk{Err: errors.New("ollama stream ended unexpectedly")})
+	}()
+
+	return output, nil
+}
+
+// ModelName returns the model of the config. It's used to look up the context window of the model.
+func (c *OllamaClient) ModelName() string {
+	if c.Config == nil {
+		return ""
+	}
+	return c.Config.Model
+}
+
+// MaxTokens returns the max tokens of the config, or 0 if they are not limited. They are reserved for the reply when the context window is checked.
+func (c *OllamaClient) MaxTokens() int {
+	if c.Config == nil {
+		return 0
+	}
+	return c.Config.MaxTokens
+}
@@ -1,14 +1,17 @@
 package ollama
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/jieliu2000/anyi/internal/test"
 	"github.com/jieliu2000/anyi/llm/chat"
 	"github.com/jieliu2000/anyi/llm/config"
+	"github.com/jieliu2000/anyi/llm/tools"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -118,15 +121,18 @@ func TestChatWithGeneralLLMConfig(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, "test-model", requestMap["model"])
 
-		// Verify that parameters from GeneralLLMConfig are correctly passed
-		assert.Equal(t, float64(0.7), requestMap["temperature"])
-		assert.Equal(t, float64(0.9), requestMap["top_p"])
-		assert.Equal(t, float64(100), requestMap["num_predict"])
-		assert.Equal(t, float64(0.5), requestMap["presence_penalty"])
-		assert.Equal(t, float64(0.5), requestMap["frequency_penalty"])
+		// Verify that parameters from GeneralLLMConfig are passed as options, since Ollama ignores top level parameters
+		assert.NotContains(t, requestMap, "temperature")
+		options, ok := requestMap["options"].(map[string]interface{})
+		assert.True(t, ok)
+		assert.InDelta(t, 0.7, options["temperature"], 1e-6)
+		assert.InDelta(t, 0.9, options["top_p"], 1e-6)
+		assert.Equal(t, float64(100), options["num_predict"])
+		assert.Equal(t, float64(0.5), options["presence_penalty"])
+		assert.Equal(t, float64(0.5), options["frequency_penalty"])
 
 		// Verify stop word list
-		stopWords, ok := requestMap["stop"].([]interface{})
+		stopWords, ok := options["stop"].([]interface{})
 		assert.True(t, ok)
 		assert.Equal(t, 2, len(stopWords))
 		assert.Equal(t, "stop1", stopWords[0])
@@ -307,3 +313,202 @@ func TestChat(t *testing.T) {
 
 	assert.Equal(t, "Reply to your input", response.Content)
 }
+
+func TestChatStream(t *testing.T) {
+	mockServer := test.NewTestServer()
+	mockServer.RequestHandler = func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		request := OllamaRequest{}
+		err = json.Unmarshal(body, &request)
+		assert.NoError(t, err)
+		assert.True(t, request.Stream)
+
+		io.WriteString(w, `{"model":"test-model","message":{"role":"assistant","content":"Hello"},"done":false}`+"\n")
+		io.WriteString(w, `{"model":"test-model","message":{"role":"assistant","content":" world"},"done":false}`+"\n")
+		io.WriteString(w, `{"model":"test-model","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":4,"eval_count":2}`+"\n")
+	}
+	defer mockServer.Close()
+	mockServer.Start()
+
+	client, err := NewClient(NewConfig("test-model", mockServer.URL()))
+	assert.NoError(t, err)
+
+	stream, err := client.ChatStream(context.Background(), []chat.Message{chat.NewUserMessage("Hi")}, nil)
+	assert.NoError(t, err)
+
+	message, info, err := chat.CollectStream(stream)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello world", message.Content)
+	assert.Equal(t, 4, info.PromptTokens)
+	assert.Equal(t, 2, info.CompletionTokens)
+}
+
+func TestChatStreamWithErrorLine(t *testing.T) {
+	mockServer := test.NewTestServer()
+	mockServer.RequestHandler = func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"model":"test-model","message":{"role":"assistant","content":"Hel"},"done":false}`+"\n")
+		io.WriteString(w, `{"error":"model crashed"}`+"\n")
+	}
+	defer mockServer.Close()
+	mockServer.Start()
+
+	client, err := NewClient(NewConfig("test-model", mockServer.URL()))
+	assert.NoError(t, err)
+
+	stream, err := client.ChatStream(context.Background(), []chat.Message{chat.NewUserMessage("Hi")}, nil)
+	assert.NoError(t, err)
+
+	message, _, err := chat.CollectStream(stream)
+	assert.EqualError(t, err, "model crashed")
+	assert.Equal(t, "Hel", message.Content)
+}
+
+func TestChatContextWithDeadline(t *testing.T) {
+	release := make(chan struct{})
+	mockServer := test.NewTestServer()
+	mockServer.RequestHandler = func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}
+	defer mockServer.Close()
+	defer close(release)
+	mockServer.Start()
+
+	client, err := NewClient(NewConfig("test-model", mockServer.URL()))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, _, err = client.ChatContext(ctx, []chat.Message{chat.NewUserMessage("Hi")}, nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestConvertToOllamaMessagesWithToolCalls(t *testing.T) {
+	call := chat.ToolCall{
+		ID:       "call_1",
+		Function: chat.FunctionCall{Name: "get_weather", Arguments: map[string]any{"city": "Paris"}},
+	}
+	messages := []chat.Message{
+		chat.NewUserMessage("Weather in Paris?"),
+		{Role: "assistant", ToolCalls: []chat.ToolCall{call}},
+		chat.NewToolResultMessage(call, "sunny"),
+		{Role: "tool", ToolCallID: "call_1", Content: "still sunny"},
+	}
+
+	ollamaMessages, err := ConvertToOllamaMessages(messages)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(ollamaMessages))
+	assert.Equal(t, []OllamaToolCall{{Function: OllamaToolCallFunction{Name: "get_weather", Arguments: map[string]any{"city": "Paris"}}}}, ollamaMessages[1].ToolCalls)
+	assert.Equal(t, "tool", ollamaMessages[2].Role)
+	assert.Equal(t, "get_weather", ollamaMessages[2].ToolName)
+	assert.Equal(t, "sunny", ollamaMessages[2].Content)
+	assert.Equal(t, "get_weather", ollamaMessages[3].ToolName)
+}
+
+func TestChatWithFunctionsReturnsToolCalls(t *testing.T) {
+	mockServer := test.NewTestServer()
+	mockServer.RequestHandler = func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"get_weather","arguments":{"city":"Paris"}}}]},"done":true}`)
+	}
+	defer mockServer.Close()
+	mockServer.Start()
+
+	client, err := NewClient(NewConfig("test-model", mockServer.URL()))
+	assert.NoError(t, err)
+
+	functions := []tools.FunctionConfig{{Name: "get_weather", Params: []tools.ParameterConfig{{Name: "city", Type: "string"}}}}
+	response, _, err := client.ChatWithFunctions([]chat.Message{chat.NewUserMessage("Weather in Paris?")}, functions, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(response.ToolCalls))
+	assert.Equal(t, "function", response.ToolCalls[0].Type)
+	assert.Equal(t, "get_weather", response.ToolCalls[0].Function.Name)
+	assert.Equal(t, "Paris", response.ToolCalls[0].Function.Arguments["city"])
+}
+
+func TestConvertToOllamaToolsWithNestedSchema(t *testing.T) {
+	function := tools.NewFunctionConfig("locate", "Locate a place",
+		tools.NewRequiredParameter("name", "string", "The name"),
+		tools.ParameterConfig{
+			Name: "near",
+			Type: "object",
+			Properties: []tools.ParameterConfig{
+				tools.NewRequiredParameter("lat", "number", ""),
+				tools.NewRequiredParameter("lon", "number", ""),
+			},
+		},
+	)
+
+	ollamaTools, err := ConvertToOllamaTools([]tools.FunctionConfig{function})
+
+	assert.NoError(t, err)
+	data, err := json.Marshal(ollamaTools[0]["function"])
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"name": "locate",
+		"description": "Locate a place",
+		"parameters": {
+			"type": "object",
+			"properties": {
+				"name": {"type": "string", "description": "The name"},
+				"near": {
+					"type": "object",
+					"properties": {"lat": {"type": "number"}, "lon": {"type": "number"}},
+					"required": ["lat", "lon"]
+				}
+			},
+			"required": ["name"]
+		}
+	}`, string(data))
+}
+
+func TestNewRequestWithSchema(t *testing.T) {
+	client, err := NewClient(DefaultConfig("test-model"))
+	assert.NoError(t, err)
+	schema := map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"name": map[string]any{"type": "string"}},
+	}
+
+	request := client.newRequest(nil, &chat.ChatOptions{Format: "json", Schema: schema})
+
+	data, err := json.Marshal(request)
+	assert.NoError(t, err)
+	requestMap := map[string]any{}
+	assert.NoError(t, json.Unmarshal(data, &requestMap))
+	assert.Equal(t, map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"name": map[string]any{"type": "string"}},
+	}, requestMap["format"])
+}
+
+func TestNewRequestWithOverrides(t *testing.T) {
+	config := DefaultConfig("test-model")
+	config.Temperature = 0.7
+	client, err := NewClient(config)
+	assert.NoError(t, err)
+	options := (&chat.ChatOptions{Stop: []string{"END"}}).WithTemperature(0).WithMaxTokens(50).WithSeed(42)
+
+	request := client.newRequest(nil, options)
+
+	assert.Equal(t, map[string]any{
+		"temperature": float32(0),
+		"top_p":       float32(1),
+		"num_predict": 50,
+		"stop":        []string{"END"},
+		"seed":        42,
+	}, request.Options)
+	assert.Equal(t, map[string]any{
+		"temperature": float32(0.7),
+		"top_p":       float32(1),
+	}, client.newRequest(nil, &chat.ChatOptions{Format: "json"}).Options)
+
+	client.Config.Temperature, client.Config.TopP = 0, 0
+	assert.Nil(t, client.newRequest(nil, nil).Options)
+}
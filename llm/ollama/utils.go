@@ -12,17 +12,41 @@ import (
 )
 
 type OllamaMessage struct {
-	Role    string   `json:"role"`
-	Content string   `json:"content"`
-	Images  []string `json:"images"`
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Images    []string         `json:"images"`
+	ToolCalls []OllamaToolCall `json:"tool_calls,omitempty"`
+	// ToolName is the name of the tool whose result a "tool" message carries.
+	ToolName string `json:"tool_name,omitempty"`
 }
 
+type OllamaToolCall struct {
+	Function OllamaToolCallFunction `json:"function"`
+}
+
+type OllamaToolCallFunction struct {
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments"`
+}
+
+// ConvertToOllamaMessages converts the chat messages to Ollama messages.
+// Ollama doesn't use tool call IDs, it matches tool results by the tool name. If a tool message has no Name, the name is looked up from the assistant tool call with the same ID.
 func ConvertToOllamaMessages(messages []chat.Message) (ollamaMessages []OllamaMessage, err error) {
+	toolNames := map[string]string{}
 	for _, message := range messages {
+		for _, call := range message.ToolCalls {
+			if call.ID != "" {
+				toolNames[call.ID] = call.Function.Name
+			}
+		}
+
 		ollamaMessage, err := ConvertToOllamaMessage(message)
 		if err != nil {
 			return nil, err
 		}
+		if ollamaMessage.Role == "tool" && ollamaMessage.ToolName == "" {
+			ollamaMessage.ToolName = toolNames[message.ToolCallID]
+		}
 		ollamaMessages = append(ollamaMessages, *ollamaMessage)
 	}
 	return ollamaMessages, nil
@@ -34,6 +58,21 @@ func ConvertToOllamaMessage(message chat.Message) (ollamaMessage *OllamaMessage,
 		Role:    message.Role,
 		Content: message.Content,
 	}
+	if message.Role == "tool" {
+		ollamaMessage.ToolName = message.Name
+	}
+	for _, call := range message.ToolCalls {
+		arguments := call.Function.Arguments
+		if arguments == nil {
+			arguments = map[string]any{}
+		}
+		ollamaMessage.ToolCalls = append(ollamaMessage.ToolCalls, OllamaToolCall{
+			Function: OllamaToolCallFunction{
+				Name:      call.Function.Name,
+				Arguments: arguments,
+			},
+		})
+	}
 	if len(message.ContentParts) > 0 {
 		for _, part := range message.ContentParts {
 			if ollamaMessage.Content == "" && part.Text != "" {
@@ -0,0 +1,50 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jieliu2000/anyi/llm/chat"
+	impl "github.com/sashabaranov/go-openai"
+)
+
+// DefaultEmbeddingModel is the embedding model of OpenAI clients if EmbeddingModel is not set.
+const DefaultEmbeddingModel = "text-embedding-3-small"
+
+// ExecuteEmbeddingsContext computes the embeddings of the texts with an OpenAI compatible embeddings endpoint. It's shared by the clients of the OpenAI compatible providers.
+// The texts are sent in batches of at most batchSize texts, see chat.EmbedBatches.
+func ExecuteEmbeddingsContext(ctx context.Context, client *impl.Client, model string, texts []string, batchSize int) ([][]float32, chat.ResponseInfo, error) {
+	if client == nil {
+		return nil, chat.ResponseInfo{}, errors.New("client cannot be null")
+	}
+	if model == "" {
+		return nil, chat.ResponseInfo{}, errors.New("no embedding model set")
+	}
+
+	return chat.EmbedBatches(ctx, texts, batchSize, func(ctx context.Context, batch []string) ([][]float32, chat.ResponseInfo, error) {
+		response, err := client.CreateEmbeddings(ctx, impl.EmbeddingRequestStrings{
+			Input:          batch,
+			Model:          impl.EmbeddingModel(model),
+			EncodingFormat: impl.EmbeddingEncodingFormatFloat,
+		})
+		if err != nil {
+			return nil, chat.ResponseInfo{}, err
+		}
+
+		// The embeddings are ordered by their index, which is not guaranteed to be the order of the response
+		vectors := make([][]float32, len(batch))
+		for _, data := range response.Data {
+			if data.Index < 0 || data.Index >= len(batch) {
+				return nil, chat.ResponseInfo{}, fmt.Errorf("embedding index %d out of range", data.Index)
+			}
+			vectors[data.Index] = data.Embedding
+		}
+		for i, vector := range vectors {
+			if vector == nil {
+				return nil, chat.ResponseInfo{}, fmt.Errorf("no embedding returned for text %d", i)
+			}
+		}
+		return vectors, chat.ResponseInfo{PromptTokens: response.Usage.PromptTokens}, nil
+	})
+}
@@ -0,0 +1,109 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/jieliu2000/anyi/internal/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbed(t *testing.T) {
+	var batches [][]string
+	mockServer := test.NewTestServer()
+	mockServer.RequestHandler = func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method, "Expected POST method")
+		assert.Equal(t, "/embeddings", r.URL.Path)
+
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		request := struct {
+			Input []string `json:"input"`
+			Model string   `json:"model"`
+		}{}
+		assert.NoError(t, json.Unmarshal(body, &request))
+		assert.Equal(t, "test-embedding", request.Model)
+		batches = append(batches, request.Input)
+
+		// Answer in reverse order to check that the vectors are sorted by index
+		if len(request.Input) == 2 {
+			io.WriteString(w, `{"object":"list","data":[
+				{"object":"embedding","index":1,"embedding":[0.3,0.4]},
+				{"object":"embedding","index":0,"embedding":[0.1,0.2]}
+			],"model":"test-embedding","usage":{"prompt_tokens":4,"total_tokens":4}}`)
+			return
+		}
+		io.WriteString(w, `{"object":"list","data":[
+			{"object":"embedding","index":0,"embedding":[0.5,0.6]}
+		],"model":"test-embedding","usage":{"prompt_tokens":2,"total_tokens":2}}`)
+	}
+	defer mockServer.Close()
+	mockServer.Start()
+
+	config := NewConfig("test-api-key", "", mockServer.URL())
+	config.EmbeddingModel = "test-embedding"
+	config.EmbeddingBatchSize = 2
+	client, err := NewClient(config)
+	assert.NoError(t, err)
+
+	vectors, info, err := client.Embed(context.Background(), []string{"a", "b", "c"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"a", "b"}, {"c"}}, batches)
+	assert.Equal(t, [][]float32{{0.1, 0.2}, {0.3, 0.4}, {0.5, 0.6}}, vectors)
+	assert.Equal(t, 6, info.PromptTokens)
+}
+
+func TestEmbed_DefaultModel(t *testing.T) {
+	mockServer := test.NewTestServer()
+	mockServer.RequestHandler = func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Contains(t, string(body), DefaultEmbeddingModel)
+		io.WriteString(w, `{"data":[{"index":0,"embedding":[1]}],"usage":{"prompt_tokens":1}}`)
+	}
+	defer mockServer.Close()
+	mockServer.Start()
+
+	client, err := NewClient(NewConfig("test-api-key", "", mockServer.URL()))
+	assert.NoError(t, err)
+
+	vectors, _, err := client.Embed(context.Background(), []string{"a"})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]float32{{1}}, vectors)
+}
+
+func TestEmbed_MissingEmbedding(t *testing.T) {
+	mockServer := test.NewTestServer()
+	mockServer.RequestHandler = func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data":[{"index":0,"embedding":[1]}],"usage":{"prompt_tokens":1}}`)
+	}
+	defer mockServer.Close()
+	mockServer.Start()
+
+	client, err := NewClient(NewConfig("test-api-key", "", mockServer.URL()))
+	assert.NoError(t, err)
+
+	_, _, err = client.Embed(context.Background(), []string{"a", "b"})
+	assert.Error(t, err)
+}
+
+func TestEmbed_ErrorResponse(t *testing.T) {
+	mockServer := test.NewTestServer()
+	mockServer.RequestHandler = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error":{"message":"bad input","type":"invalid_request_error"}}`)
+	}
+	defer mockServer.Close()
+	mockServer.Start()
+
+	client, err := NewClient(NewConfig("test-api-key", "", mockServer.URL()))
+	assert.NoError(t, err)
+
+	_, _, err = client.Embed(context.Background(), []string{"a"})
+	assert.Error(t, err)
+}
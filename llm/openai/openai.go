@@ -1,6 +1,7 @@
 package openai
 
 import (
+	"context"
 	"errors"
 
 	"github.com/jieliu2000/anyi/llm/chat"
@@ -77,6 +78,12 @@ type OpenAIModelConfig struct {
 	APIKey  string `json:"apiKey" mapstructure:"apiKey"`
 	BaseURL string `json:"baseUrl" mapstructure:"baseUrl"`
 	Model   string `json:"model" mapstructure:"model"`
+	// The model used by Embed. Defaults to DefaultEmbeddingModel.
+	EmbeddingModel string `json:"embeddingModel" mapstructure:"embeddingModel"`
+	// The maximum number of texts sent in one embeddings request. Defaults to chat.DefaultEmbeddingBatchSize.
+	EmbeddingBatchSize int `json:"embeddingBatchSize" mapstructure:"embeddingBatchSize"`
+	// StreamUsage asks for the token usage at the end of streams by sending stream_options. NewConfig enables it. Disable it for OpenAI compatible APIs which reject stream_options.
+	StreamUsage bool `json:"streamUsage" mapstructure:"streamUsage"`
 }
 
 type OpenAIClient struct {
@@ -110,6 +117,7 @@ func NewConfig(apiKey string, model string, baseURL string) *OpenAIModelConfig {
 		APIKey:           apiKey,
 		Model:            model,
 		BaseURL:          baseURL,
+		StreamUsage:      true,
 	}
 }
 
@@ -126,19 +134,29 @@ func NewClient(config *OpenAIModelConfig) (*OpenAIClient, error) {
 
 	client := &OpenAIClient{
 		Config:     config,
-		clientImpl: impl.NewClientWithConfig(configImpl),
+		clientImpl: NewClientImpl(configImpl),
 	}
 
 	return client, nil
 }
 
 func (c *OpenAIClient) ChatWithFunctions(messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
+	return c.ChatWithFunctionsContext(context.Background(), messages, functions, options)
+}
+
+// ChatWithFunctionsContext works like ChatWithFunctions but sends the request with the given context. The request is aborted when the context is cancelled or its deadline expires.
+func (c *OpenAIClient) ChatWithFunctionsContext(ctx context.Context, messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
 	client := c.clientImpl
 
-	return ExecuteChatWithFunctions(client, c.Config.Model, messages, functions, options, c.Config)
+	return ExecuteChatWithFunctionsContext(ctx, client, c.Config.Model, messages, functions, options, c.Config)
 }
 
 func (c *OpenAIClient) Chat(messages []chat.Message, options *chat.ChatOptions) (message *chat.Message, responseInfo chat.ResponseInfo, err error) {
+	return c.ChatContext(context.Background(), messages, options)
+}
+
+// ChatContext works like Chat but sends the request with the given context. The request is aborted when the context is cancelled or its deadline expires.
+func (c *OpenAIClient) ChatContext(ctx context.Context, messages []chat.Message, options *chat.ChatOptions) (message *chat.Message, responseInfo chat.ResponseInfo, err error) {
 	client := c.clientImpl
 
 	if client == nil {
@@ -148,5 +166,47 @@ func (c *OpenAIClient) Chat(messages []chat.Message, options *chat.ChatOptions)
 		return nil, chat.ResponseInfo{}, errors.New("config cannot be null")
 	}
 
-	return ExecuteChat(client, c.Config.Model, messages, options, c.Config)
+	return ExecuteChatContext(ctx, client, c.Config.Model, messages, options, c.Config)
+}
+
+// ChatStream sends the messages to the model and streams the response back through the returned channel.
+// See [ExecuteChatStream] for details about the stream.
+func (c *OpenAIClient) ChatStream(ctx context.Context, messages []chat.Message, options *chat.ChatOptions) (<-chan chat.StreamChunk, error) {
+	return c.ChatWithFunctionsStream(ctx, messages, nil, options)
+}
+
+// ChatWithFunctionsStream works like ChatStream but also allows the model to call the given functions. Tool calls are streamed as fragments.
+func (c *OpenAIClient) ChatWithFunctionsStream(ctx context.Context, messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (<-chan chat.StreamChunk, error) {
+	if c.Config == nil {
+		return nil, errors.New("config cannot be null")
+	}
+	return ExecuteChatStream(ctx, c.clientImpl, c.Config.Model, messages, functions, options, c.Config)
+}
+
+// Embed computes the embeddings of the texts with the EmbeddingModel of the config, or DefaultEmbeddingModel if it's not set.
+func (c *OpenAIClient) Embed(ctx context.Context, texts []string) ([][]float32, chat.ResponseInfo, error) {
+	if c.Config == nil {
+		return nil, chat.ResponseInfo{}, errors.New("config cannot be null")
+	}
+	model := c.Config.EmbeddingModel
+	if model == "" {
+		model = DefaultEmbeddingModel
+	}
+	return ExecuteEmbeddingsContext(ctx, c.clientImpl, model, texts, c.Config.EmbeddingBatchSize)
+}
+
+// ModelName returns the model of the config. It's used to look up the context window of the model.
+func (c *OpenAIClient) ModelName() string {
+	if c.Config == nil {
+		return ""
+	}
+	return c.Config.Model
+}
+
+// MaxTokens returns the max tokens of the config, or 0 if they are not limited. They are reserved for the reply when the context window is checked.
+func (c *OpenAIClient) MaxTokens() int {
+	if c.Config == nil {
+		return 0
+	}
+	return c.Config.MaxTokens
 }
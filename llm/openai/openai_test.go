@@ -1,6 +1,7 @@
 package openai
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -180,6 +181,36 @@ func TestGeneralLLMConfig(t *testing.T) {
 	assert.Equal(t, []string{"stop1", "stop2"}, client.Config.Stop)
 }
 
+func TestChatWithZeroTemperature(t *testing.T) {
+	mockServer := test.NewTestServer()
+	temperatures := []any{}
+	mockServer.RequestHandler = func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		requestMap := make(map[string]any)
+		assert.NoError(t, json.Unmarshal(body, &requestMap))
+		temperatures = append(temperatures, requestMap["temperature"])
+
+		io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":"Reply"},"finish_reason":"stop"}]}`)
+	}
+	defer mockServer.Close()
+	mockServer.Start()
+
+	config := DefaultConfig("test-api-key")
+	config.BaseURL = mockServer.URL()
+	config.Temperature = 0.8
+	client, err := NewClient(config)
+	assert.NoError(t, err)
+
+	messages := []chat.Message{chat.NewUserMessage("Hello")}
+	_, _, err = client.Chat(messages, (&chat.ChatOptions{}).WithTemperature(0))
+	assert.NoError(t, err)
+	_, _, err = client.Chat(messages, nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []any{float64(0), float64(0.8)}, temperatures)
+}
+
 // Test request applying GeneralLLMConfig
 func TestChatWithGeneralLLMConfig(t *testing.T) {
 	mockServer := test.NewTestServer()
@@ -427,3 +458,345 @@ func TestChatWithFormatOption(t *testing.T) {
 	assert.NotNil(t, response)
 	assert.Contains(t, response.Content, "Reply to your input")
 }
+
+func TestChatStream(t *testing.T) {
+	mockServer := test.NewTestServer()
+	mockServer.RequestHandler = func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		requestMap := make(map[string]interface{})
+		err = json.Unmarshal(body, &requestMap)
+		assert.NoError(t, err)
+		assert.Equal(t, true, requestMap["stream"])
+		assert.Equal(t, map[string]interface{}{"include_usage": true}, requestMap["stream_options"])
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		chunks := []string{
+			`{"id":"1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"role":"assistant","content":"Hello"}}]}`,
+			`{"id":"1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":" world"}}]}`,
+			`{"id":"1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+			`{"id":"1","object":"chat.completion.chunk","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}`,
+		}
+		for _, chunk := range chunks {
+			io.WriteString(w, "data: "+chunk+"\n\n")
+		}
+		io.WriteString(w, "data: [DONE]\n\n")
+	}
+	defer mockServer.Close()
+	mockServer.Start()
+
+	client, err := NewClient(NewConfig("test-api-key", "gpt-4o", mockServer.URL()))
+	assert.NoError(t, err)
+
+	stream, err := client.ChatStream(context.Background(), []chat.Message{chat.NewUserMessage("Hi")}, nil)
+	assert.NoError(t, err)
+
+	var contents []string
+	var last chat.StreamChunk
+	for chunk := range stream {
+		assert.NoError(t, chunk.Err)
+		if chunk.Content != "" {
+			contents = append(contents, chunk.Content)
+		}
+		last = chunk
+	}
+
+	assert.Equal(t, []string{"Hello", " world"}, contents)
+	assert.True(t, last.Done)
+	assert.Equal(t, "stop", last.FinishReason)
+	assert.Equal(t, &chat.ResponseInfo{PromptTokens: 5, CompletionTokens: 2}, last.Usage)
+}
+
+func TestChatStreamWithoutUsage(t *testing.T) {
+	mockServer := test.NewTestServer()
+	mockServer.RequestHandler = func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		requestMap := make(map[string]interface{})
+		err = json.Unmarshal(body, &requestMap)
+		assert.NoError(t, err)
+		assert.NotContains(t, requestMap, "stream_options")
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: "+`{"id":"1","choices":[{"index":0,"delta":{"role":"assistant","content":"Hello"},"finish_reason":"stop"}]}`+"\n\n")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}
+	defer mockServer.Close()
+	mockServer.Start()
+
+	config := NewConfig("test-api-key", "gpt-4o", mockServer.URL())
+	config.StreamUsage = false
+	client, err := NewClient(config)
+	assert.NoError(t, err)
+
+	stream, err := client.ChatStream(context.Background(), []chat.Message{chat.NewUserMessage("Hi")}, nil)
+	assert.NoError(t, err)
+
+	message, info, err := chat.CollectStream(stream)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello", message.Content)
+	assert.Equal(t, chat.ResponseInfo{}, info)
+}
+
+func TestChatWithFunctionsStream(t *testing.T) {
+	mockServer := test.NewTestServer()
+	mockServer.RequestHandler = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		chunks := []string{
+			`{"id":"1","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+			`{"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`,
+			`{"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]}}]}`,
+			`{"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		}
+		for _, chunk := range chunks {
+			io.WriteString(w, "data: "+chunk+"\n\n")
+		}
+		io.WriteString(w, "data: [DONE]\n\n")
+	}
+	defer mockServer.Close()
+	mockServer.Start()
+
+	client, err := NewClient(NewConfig("test-api-key", "gpt-4o", mockServer.URL()))
+	assert.NoError(t, err)
+
+	functions := []tools.FunctionConfig{
+		{
+			Name:        "get_weather",
+			Description: "Get the weather of a city",
+			Params: []tools.ParameterConfig{
+				{Name: "city", Type: "string", Description: "The city"},
+			},
+		},
+	}
+	stream, err := client.ChatWithFunctionsStream(context.Background(), []chat.Message{chat.NewUserMessage("Weather in Paris?")}, functions, nil)
+	assert.NoError(t, err)
+
+	message, _, err := chat.CollectStream(stream)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(message.ToolCalls))
+	assert.Equal(t, "get_weather", message.ToolCalls[0].Function.Name)
+	assert.Equal(t, "Paris", message.ToolCalls[0].Function.Arguments["city"])
+}
+
+func TestChatContextWithCancelledContext(t *testing.T) {
+	requested := false
+	mockServer := test.NewTestServer()
+	mockServer.RequestHandler = func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+	}
+	defer mockServer.Close()
+	mockServer.Start()
+
+	client, err := NewClient(NewConfig("test-api-key", "gpt-4o", mockServer.URL()))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err = client.ChatContext(ctx, []chat.Message{chat.NewUserMessage("Hi")}, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.False(t, requested)
+}
+
+func TestConvertToOpenAIChatMessagesWithToolCalls(t *testing.T) {
+	call := chat.ToolCall{
+		ID:   "call_1",
+		Type: "function",
+		Function: chat.FunctionCall{
+			Name:      "get_weather",
+			Arguments: map[string]any{"city": "Paris"},
+		},
+	}
+	messages := []chat.Message{
+		chat.NewUserMessage("Weather in Paris?"),
+		{Role: "assistant", ToolCalls: []chat.ToolCall{call, {ID: "call_2", Function: chat.FunctionCall{Name: "get_time"}}}},
+		chat.NewToolResultMessage(call, "sunny"),
+	}
+
+	openAIMessages := ConvertToOpenAIChatMessages(messages)
+
+	assert.Equal(t, 3, len(openAIMessages))
+	assert.Equal(t, []impl.ToolCall{
+		{ID: "call_1", Type: impl.ToolTypeFunction, Function: impl.FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+		{ID: "call_2", Type: impl.ToolTypeFunction, Function: impl.FunctionCall{Name: "get_time", Arguments: "{}"}},
+	}, openAIMessages[1].ToolCalls)
+	assert.Equal(t, impl.ChatMessageRoleTool, openAIMessages[2].Role)
+	assert.Equal(t, "call_1", openAIMessages[2].ToolCallID)
+	assert.Equal(t, "sunny", openAIMessages[2].Content)
+}
+
+func TestChatWithFunctionsToolCallRoundTrip(t *testing.T) {
+	requests := 0
+	mockServer := test.NewTestServer()
+	mockServer.RequestHandler = func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		request := impl.ChatCompletionRequest{}
+		err = json.Unmarshal(body, &request)
+		assert.NoError(t, err)
+
+		if requests == 1 {
+			io.WriteString(w, `{
+				"choices": [{
+					"message": {
+						"role": "assistant",
+						"tool_calls": [{"id": "call_abc", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]
+					},
+					"finish_reason": "tool_calls"
+				}]
+			}`)
+			return
+		}
+
+		assert.Equal(t, 3, len(request.Messages))
+		assert.Equal(t, "call_abc", request.Messages[1].ToolCalls[0].ID)
+		assert.Equal(t, impl.ChatMessageRoleTool, request.Messages[2].Role)
+		assert.Equal(t, "call_abc", request.Messages[2].ToolCallID)
+		assert.Equal(t, "sunny", request.Messages[2].Content)
+
+		io.WriteString(w, `{"choices": [{"message": {"role": "assistant", "content": "It's sunny in Paris."}, "finish_reason": "stop"}]}`)
+	}
+	defer mockServer.Close()
+	mockServer.Start()
+
+	client, err := NewClient(NewConfig("test-api-key", "gpt-4o", mockServer.URL()))
+	assert.NoError(t, err)
+
+	functions := []tools.FunctionConfig{{Name: "get_weather", Params: []tools.ParameterConfig{{Name: "city", Type: "string"}}}}
+	messages := []chat.Message{chat.NewUserMessage("Weather in Paris?")}
+
+	response, _, err := client.ChatWithFunctions(messages, functions, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(response.ToolCalls))
+	assert.Equal(t, "call_abc", response.ToolCalls[0].ID)
+	assert.Equal(t, "function", response.ToolCalls[0].Type)
+
+	messages = append(messages, *response, chat.NewToolResultMessage(response.ToolCalls[0], "sunny"))
+	response, _, err = client.ChatWithFunctions(messages, functions, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "It's sunny in Paris.", response.Content)
+	assert.Equal(t, 2, requests)
+}
+
+func TestConvertToFuncDescWithNestedSchema(t *testing.T) {
+	function := tools.NewFunctionConfig("search", "Search documents",
+		tools.NewRequiredParameter("query", "string", "The query"),
+		tools.NewOptionalParameter("type", "string", "The document type"),
+		tools.ParameterConfig{
+			Name:  "filters",
+			Type:  "array",
+			Items: &tools.ParameterConfig{Type: "object", Properties: []tools.ParameterConfig{tools.NewRequiredParameter("field", "string", "")}},
+		},
+	)
+
+	definition := convertToFuncDesc(function)
+
+	parameters := definition.Parameters.(map[string]any)
+	assert.Equal(t, []string{"query"}, parameters["required"])
+	properties := parameters["properties"].(map[string]any)
+	assert.Contains(t, properties, "_type_")
+	assert.NotContains(t, properties, "type")
+	filters := properties["filters"].(map[string]any)
+	items := filters["items"].(map[string]any)
+	assert.Equal(t, []string{"field"}, items["required"])
+	assert.Equal(t, "type", function.Params[1].Name)
+}
+
+func TestNewChatCompletionRequestWithSchema(t *testing.T) {
+	t.Run("Strict schema", func(t *testing.T) {
+		options := chat.NewSchemaChatOptions("city", map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"name":       map[string]any{"type": "string"},
+				"population": map[string]any{"type": "integer"},
+			},
+			"required": []string{"name", "population"},
+		})
+
+		request := newChatCompletionRequest("gpt-4o", []chat.Message{chat.NewUserMessage("Hi")}, nil, &options, nil)
+
+		data, err := json.Marshal(request.ResponseFormat)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{
+			"type": "json_schema",
+			"json_schema": {
+				"name": "city",
+				"strict": true,
+				"schema": {
+					"type": "object",
+					"properties": {"name": {"type": "string"}, "population": {"type": "integer"}},
+					"required": ["name", "population"],
+					"additionalProperties": false
+				}
+			}
+		}`, string(data))
+	})
+
+	t.Run("Optional properties disable strict mode", func(t *testing.T) {
+		schema := map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"name": map[string]any{"type": "string"}},
+		}
+		options := &chat.ChatOptions{Schema: schema}
+
+		request := newChatCompletionRequest("gpt-4o", []chat.Message{chat.NewUserMessage("Hi")}, nil, options, nil)
+
+		assert.Equal(t, impl.ChatCompletionResponseFormatTypeJSONSchema, request.ResponseFormat.Type)
+		assert.Equal(t, "response", request.ResponseFormat.JSONSchema.Name)
+		assert.False(t, request.ResponseFormat.JSONSchema.Strict)
+		data, err := json.Marshal(request.ResponseFormat.JSONSchema.Schema)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"type": "object", "properties": {"name": {"type": "string"}}}`, string(data))
+	})
+
+	t.Run("Roots which aren't objects disable strict mode", func(t *testing.T) {
+		for _, schema := range []map[string]any{
+			{"type": "array", "items": map[string]any{"type": "string"}},
+			{"type": "string"},
+		} {
+			options := &chat.ChatOptions{Schema: schema}
+
+			request := newChatCompletionRequest("gpt-4o", []chat.Message{chat.NewUserMessage("Hi")}, nil, options, nil)
+
+			assert.False(t, request.ResponseFormat.JSONSchema.Strict, schema["type"])
+			data, err := json.Marshal(request.ResponseFormat.JSONSchema.Schema)
+			assert.NoError(t, err)
+			expected, _ := json.Marshal(schema)
+			assert.JSONEq(t, string(expected), string(data))
+		}
+	})
+}
+
+func TestNewChatCompletionRequestWithOverrides(t *testing.T) {
+	config := DefaultConfig("key")
+	config.Temperature = 0.8
+	config.MaxTokens = 100
+	functions := []tools.FunctionConfig{tools.NewFunctionConfig("lookup", "Look something up")}
+
+	t.Run("Options override the client configuration", func(t *testing.T) {
+		options := (&chat.ChatOptions{Stop: []string{"END"}, ToolChoice: "lookup"}).WithTemperature(0).WithMaxTokens(10).WithSeed(3)
+
+		request := newChatCompletionRequest("gpt-4o", []chat.Message{chat.NewUserMessage("Hi")}, functions, options, config)
+
+		assert.Equal(t, float32(0), request.Temperature)
+		assert.Equal(t, 10, request.MaxTokens)
+		assert.Equal(t, []string{"END"}, request.Stop)
+		assert.Equal(t, 3, *request.Seed)
+		assert.Equal(t, impl.ToolChoice{Type: impl.ToolTypeFunction, Function: impl.ToolFunction{Name: "lookup"}}, request.ToolChoice)
+	})
+
+	t.Run("Client configuration is used without overrides", func(t *testing.T) {
+		options := &chat.ChatOptions{ToolChoice: chat.ToolChoiceRequired}
+
+		request := newChatCompletionRequest("gpt-4o", []chat.Message{chat.NewUserMessage("Hi")}, functions, options, config)
+
+		assert.Equal(t, float32(0.8), request.Temperature)
+		assert.Equal(t, 100, request.MaxTokens)
+		assert.Nil(t, request.Seed)
+		assert.Equal(t, "required", request.ToolChoice)
+	})
+}
@@ -1,9 +1,12 @@
 package openai
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
+	"net/http"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
@@ -13,46 +16,109 @@ import (
 	impl "github.com/sashabaranov/go-openai"
 )
 
-type ParameterDetail struct {
-	Type        string   `json:"type"`
-	Description string   `json:"description,omitempty"`
-	Enum        []string `json:"enum,omitempty"`
-}
-
 func convertToFuncDesc(function tools.FunctionConfig) impl.FunctionDefinition {
-
-	parameters := map[string]any{
-		"type": "object",
-	}
-	properties := make(map[string]any)
-
-	for _, param := range function.Params {
-		if param.Name == "type" {
-			param.Name = "_type_"
-		}
-		properties[param.Name] = ParameterDetail{
-			Type:        param.Type,
-			Description: param.Description,
-			Enum:        param.Enum,
+	params := make([]tools.ParameterConfig, len(function.Params))
+	copy(params, function.Params)
+	for i := range params {
+		if params[i].Name == "type" {
+			params[i].Name = "_type_"
 		}
 	}
-	parameters["properties"] = properties
+	function.Params = params
 
 	return impl.FunctionDefinition{
 		Name:        function.Name,
 		Description: function.Description,
-		Parameters:  parameters,
+		Parameters:  function.ParametersSchema(),
 	}
 }
 
-func ExecuteChatWithFunctions(client *impl.Client, model string, messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions, config *OpenAIModelConfig) (*chat.Message, chat.ResponseInfo, error) {
-	info := chat.ResponseInfo{}
+// newJSONSchemaResponseFormat creates a json_schema response format from the schema of the options.
+// Strict mode is enabled if the schema allows it, which means every property of every object is required. additionalProperties is set to false on the objects because strict mode needs it.
+func newJSONSchemaResponseFormat(options *chat.ChatOptions) *impl.ChatCompletionResponseFormat {
+	name := options.SchemaName
+	if name == "" {
+		name = "response"
+	}
 
-	if client == nil {
-		return nil, info, errors.New("client not initialized")
+	schema, strict := strictSchema(options.Schema)
+	// The root of a schema in strict mode must be an object, so arrays and plain values are sent without strict mode
+	if options.Schema["type"] != "object" {
+		strict = false
+	}
+	if !strict {
+		schema = options.Schema
+	}
+	data, err := json.Marshal(schema)
+	if err != nil {
+		log.Errorf("Failed to marshal response schema: %v", err)
+		return &impl.ChatCompletionResponseFormat{Type: impl.ChatCompletionResponseFormatTypeJSONObject}
 	}
 
-	messagesInput := ConvertToOpenAIChatMessages(messages)
+	return &impl.ChatCompletionResponseFormat{
+		Type: impl.ChatCompletionResponseFormatTypeJSONSchema,
+		JSONSchema: &impl.ChatCompletionResponseFormatJSONSchema{
+			Name:   name,
+			Schema: json.RawMessage(data),
+			Strict: strict,
+		},
+	}
+}
+
+// strictSchema returns a copy of the schema with additionalProperties set to false on all objects, and whether the schema can be used in strict mode.
+func strictSchema(schema map[string]any) (map[string]any, bool) {
+	result := make(map[string]any, len(schema)+1)
+	for key, value := range schema {
+		result[key] = value
+	}
+	strict := true
+
+	if properties, ok := schema["properties"].(map[string]any); ok {
+		required := map[string]bool{}
+		switch list := schema["required"].(type) {
+		case []string:
+			for _, name := range list {
+				required[name] = true
+			}
+		case []any:
+			for _, name := range list {
+				if s, ok := name.(string); ok {
+					required[s] = true
+				}
+			}
+		}
+
+		strictProperties := make(map[string]any, len(properties))
+		for name, property := range properties {
+			if !required[name] {
+				strict = false
+			}
+			if propertySchema, ok := property.(map[string]any); ok {
+				var propertyStrict bool
+				strictProperties[name], propertyStrict = strictSchema(propertySchema)
+				strict = strict && propertyStrict
+			} else {
+				strictProperties[name] = property
+			}
+		}
+		result["properties"] = strictProperties
+		if _, ok := schema["additionalProperties"]; !ok {
+			result["additionalProperties"] = false
+		}
+	} else if schema["type"] == "object" {
+		// Objects with arbitrary properties can't be described in strict mode
+		strict = false
+	}
+
+	if items, ok := schema["items"].(map[string]any); ok {
+		var itemsStrict bool
+		result["items"], itemsStrict = strictSchema(items)
+		strict = strict && itemsStrict
+	}
+	return result, strict
+}
+
+func convertToTools(functions []tools.FunctionConfig) []impl.Tool {
 	toolsImpl := []impl.Tool{}
 
 	for _, f := range functions {
@@ -64,15 +130,24 @@ func ExecuteChatWithFunctions(client *impl.Client, model string, messages []chat
 
 		toolsImpl = append(toolsImpl, toolImpl)
 	}
+	return toolsImpl
+}
 
+// newChatCompletionRequest builds the request shared by the blocking and the streaming chat calls.
+func newChatCompletionRequest(model string, messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions, config *OpenAIModelConfig) impl.ChatCompletionRequest {
 	request := impl.ChatCompletionRequest{
 		Model:    model,
-		Messages: messagesInput,
-		Tools:    toolsImpl,
+		Messages: ConvertToOpenAIChatMessages(messages),
+	}
+
+	if len(functions) > 0 {
+		request.Tools = convertToTools(functions)
 	}
 
 	if options != nil {
-		if strings.ToLower(options.Format) == "json" {
+		if options.Schema != nil {
+			request.ResponseFormat = newJSONSchemaResponseFormat(options)
+		} else if strings.ToLower(options.Format) == "json" {
 			request.ResponseFormat = &impl.ChatCompletionResponseFormat{
 				Type: "json_object",
 			}
@@ -92,8 +167,132 @@ func ExecuteChatWithFunctions(client *impl.Client, model string, messages []chat
 		}
 	}
 
+	if options != nil {
+		applyOptionOverrides(&request, options, len(functions) > 0)
+	}
+	return request
+}
+
+// zeroTemperatureKey marks the context of requests which have to send a temperature of 0.
+type zeroTemperatureKey struct{}
+
+// withExplicitZeroTemperature marks the context if the options ask for a temperature of 0, which go-openai would leave out of the request because the field is omitempty.
+func withExplicitZeroTemperature(ctx context.Context, options *chat.ChatOptions) context.Context {
+	if options == nil || options.Temperature == nil || *options.Temperature != 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, zeroTemperatureKey{}, true)
+}
+
+// requestDoer sends the HTTP requests of go-openai. It adds "temperature": 0 to the body of requests whose context is marked by withExplicitZeroTemperature.
+type requestDoer struct {
+	doer impl.HTTPDoer
+}
+
+func (d *requestDoer) Do(req *http.Request) (*http.Response, error) {
+	zero, _ := req.Context().Value(zeroTemperatureKey{}).(bool)
+	if !zero || req.Body == nil {
+		return d.doer.Do(req)
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &fields); err == nil {
+		if _, ok := fields["temperature"]; !ok {
+			fields["temperature"] = json.RawMessage("0")
+			if data, err := json.Marshal(fields); err == nil {
+				body = data
+			}
+		}
+	}
+
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.ContentLength = int64(len(body))
+	return d.doer.Do(req)
+}
+
+// NewClientImpl creates the go-openai client of an OpenAI compatible provider.
+// The client sends a temperature of 0 set in the chat options, which go-openai would otherwise leave out so the provider used its default temperature.
+//
+// Parameters:
+//   - configImpl: The go-openai client configuration
+//
+// Returns:
+//   - The go-openai client
+func NewClientImpl(configImpl impl.ClientConfig) *impl.Client {
+	doer := configImpl.HTTPClient
+	if doer == nil {
+		doer = &http.Client{}
+	}
+	configImpl.HTTPClient = &requestDoer{doer: doer}
+	return impl.NewClientWithConfig(configImpl)
+}
+
+// applyOptionOverrides applies the generation parameters of the chat options over the client defaults.
+func applyOptionOverrides(request *impl.ChatCompletionRequest, options *chat.ChatOptions, hasTools bool) {
+	if options.Temperature != nil {
+		// go-openai omits a zero temperature, see withExplicitZeroTemperature
+		request.Temperature = *options.Temperature
+	}
+	if options.TopP != nil {
+		request.TopP = *options.TopP
+	}
+	if options.MaxTokens != nil {
+		request.MaxTokens = *options.MaxTokens
+	}
+	if len(options.Stop) > 0 {
+		request.Stop = options.Stop
+	}
+	if options.Seed != nil {
+		seed := *options.Seed
+		request.Seed = &seed
+	}
+	if options.PresencePenalty != nil {
+		request.PresencePenalty = *options.PresencePenalty
+	}
+	if options.FrequencyPenalty != nil {
+		request.FrequencyPenalty = *options.FrequencyPenalty
+	}
+	if options.ToolChoice != "" && hasTools {
+		switch options.ToolChoice {
+		case chat.ToolChoiceAuto, chat.ToolChoiceNone, chat.ToolChoiceRequired:
+			request.ToolChoice = options.ToolChoice
+		default:
+			request.ToolChoice = impl.ToolChoice{
+				Type:     impl.ToolTypeFunction,
+				Function: impl.ToolFunction{Name: options.ToolChoice},
+			}
+		}
+	}
+}
+
+func ExecuteChatWithFunctions(client *impl.Client, model string, messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions, config *OpenAIModelConfig) (*chat.Message, chat.ResponseInfo, error) {
+	return ExecuteChatWithFunctionsContext(context.Background(), client, model, messages, functions, options, config)
+}
+
+// ExecuteChatWithFunctionsContext works like ExecuteChatWithFunctions but sends the request with the given context, so the HTTP call is aborted when the context is cancelled or its deadline expires.
+func ExecuteChatWithFunctionsContext(ctx context.Context, client *impl.Client, model string, messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions, config *OpenAIModelConfig) (*chat.Message, chat.ResponseInfo, error) {
+	info := chat.ResponseInfo{}
+
+	if client == nil {
+		return nil, info, errors.New("client not initialized")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	request := newChatCompletionRequest(model, messages, functions, options, config)
+
 	resp, err := client.CreateChatCompletion(
-		context.Background(),
+		withExplicitZeroTemperature(ctx, options),
 		request,
 	)
 
@@ -118,6 +317,8 @@ func ExecuteChatWithFunctions(client *impl.Client, model string, messages []chat
 				Arguments: params,
 			}
 			toolsCalls = append(toolsCalls, chat.ToolCall{
+				ID:       call.ID,
+				Type:     string(call.Type),
 				Function: funcCall,
 			})
 		}
@@ -131,42 +332,25 @@ func ExecuteChatWithFunctions(client *impl.Client, model string, messages []chat
 }
 
 func ExecuteChat(client *impl.Client, model string, messages []chat.Message, options *chat.ChatOptions, config *OpenAIModelConfig) (*chat.Message, chat.ResponseInfo, error) {
+	return ExecuteChatContext(context.Background(), client, model, messages, options, config)
+}
+
+// ExecuteChatContext works like ExecuteChat but sends the request with the given context, so the HTTP call is aborted when the context is cancelled or its deadline expires.
+func ExecuteChatContext(ctx context.Context, client *impl.Client, model string, messages []chat.Message, options *chat.ChatOptions, config *OpenAIModelConfig) (*chat.Message, chat.ResponseInfo, error) {
 	info := chat.ResponseInfo{}
 
 	if client == nil {
 		return nil, info, errors.New("client not initialized")
 	}
-
-	messagesInput := ConvertToOpenAIChatMessages(messages)
-	request := impl.ChatCompletionRequest{
-		Model:    model,
-		Messages: messagesInput,
+	if ctx == nil {
+		ctx = context.Background()
 	}
 
-	if options != nil {
-		if strings.ToLower(options.Format) == "json" {
-			request.ResponseFormat = &impl.ChatCompletionResponseFormat{
-				Type: "json_object",
-			}
-		}
-	}
-
-	if config != nil {
-		request.Temperature = config.Temperature
-		request.TopP = config.TopP
-		if config.MaxTokens > 0 {
-			request.MaxTokens = config.MaxTokens
-		}
-		request.PresencePenalty = config.PresencePenalty
-		request.FrequencyPenalty = config.FrequencyPenalty
-		if len(config.Stop) > 0 {
-			request.Stop = config.Stop
-		}
-	}
+	request := newChatCompletionRequest(model, messages, nil, options, config)
 
 	log.Debugf("Sending request now")
 	resp, err := client.CreateChatCompletion(
-		context.Background(),
+		withExplicitZeroTemperature(ctx, options),
 		request,
 	)
 	log.Debugf("Response: %v", resp)
@@ -185,6 +369,107 @@ func ExecuteChat(client *impl.Client, model string, messages []chat.Message, opt
 	return &result, info, nil
 }
 
+// ExecuteChatStream sends a streaming chat completion request to an OpenAI compatible API.
+// The returned channel receives the content and tool call deltas as soon as they arrive. The last chunk has Done set to true and carries the token usage if config.StreamUsage is set and the provider reports it.
+// The channel is closed when the stream ends, fails or the context is cancelled.
+//
+// Parameters:
+//   - ctx: Context used to cancel the stream
+//   - client: The go-openai client used to send the request
+//   - model: The model name
+//   - messages: The chat messages
+//   - functions: The functions the model may call. It can be nil.
+//   - options: The chat options. It can be nil.
+//   - config: The model config which provides the generation parameters. It can be nil.
+//
+// Returns:
+//   - A channel of stream chunks
+//   - An error if the stream cannot be started
+func ExecuteChatStream(ctx context.Context, client *impl.Client, model string, messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions, config *OpenAIModelConfig) (<-chan chat.StreamChunk, error) {
+	if client == nil {
+		return nil, errors.New("client not initialized")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	request := newChatCompletionRequest(model, messages, functions, options, config)
+	if config != nil && config.StreamUsage {
+		request.StreamOptions = &impl.StreamOptions{IncludeUsage: true}
+	}
+
+	stream, err := client.CreateChatCompletionStream(withExplicitZeroTemperature(ctx, options), request)
+	if err != nil {
+		return nil, err
+	}
+
+	output := make(chan chat.StreamChunk)
+	go func() {
+		defer close(output)
+		defer stream.Close()
+
+		send := func(chunk chat.StreamChunk) bool {
+			select {
+			case output <- chunk:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		final := chat.StreamChunk{Done: true}
+		for {
+			resp, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				send(final)
+				return
+			}
+			if err != nil {
+				send(chat.StreamChunk{Err: err})
+				return
+			}
+
+			if resp.Usage != nil {
+				final.Usage = &chat.ResponseInfo{
+					PromptTokens:     resp.Usage.PromptTokens,
+					CompletionTokens: resp.Usage.CompletionTokens,
+				}
+			}
+
+			for _, choice := range resp.Choices {
+				chunk := chat.StreamChunk{
+					Content: choice.Delta.Content,
+					Role:    choice.Delta.Role,
+				}
+				for i, call := range choice.Delta.ToolCalls {
+					index := i
+					if call.Index != nil {
+						index = *call.Index
+					}
+					chunk.ToolCalls = append(chunk.ToolCalls, chat.ToolCallDelta{
+						Index:     index,
+						ID:        call.ID,
+						Type:      string(call.Type),
+						Name:      call.Function.Name,
+						Arguments: call.Function.Arguments,
+					})
+				}
+				if choice.FinishReason != "" {
+					final.FinishReason = string(choice.FinishReason)
+				}
+				if chunk.Content == "" && chunk.Role == "" && len(chunk.ToolCalls) == 0 {
+					continue
+				}
+				if !send(chunk) {
+					return
+				}
+			}
+		}
+	}()
+
+	return output, nil
+}
+
 func ConvertToOpenAIChatMessages(messages []chat.Message) []impl.ChatCompletionMessage {
 	result := []impl.ChatCompletionMessage{}
 	for _, msg := range messages {
@@ -196,7 +481,9 @@ func ConvertToOpenAIChatMessages(messages []chat.Message) []impl.ChatCompletionM
 
 func convertToOpenAIChatMessage(msg chat.Message) impl.ChatCompletionMessage {
 	result := impl.ChatCompletionMessage{
-		Role: msg.Role,
+		Role:       msg.Role,
+		ToolCallID: msg.ToolCallID,
+		ToolCalls:  convertToOpenAIToolCalls(msg.ToolCalls),
 	}
 	if msg.Content != "" {
 		result.Content = msg.Content
@@ -227,3 +514,36 @@ func convertToOpenAIChatMessage(msg chat.Message) impl.ChatCompletionMessage {
 	}
 	return result
 }
+
+// convertToOpenAIToolCalls converts the tool calls of an assistant message, so the calls can be sent back to the model together with their results.
+func convertToOpenAIToolCalls(calls []chat.ToolCall) []impl.ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+
+	result := make([]impl.ToolCall, 0, len(calls))
+	for _, call := range calls {
+		arguments := "{}"
+		if len(call.Function.Arguments) > 0 {
+			bytes, err := json.Marshal(call.Function.Arguments)
+			if err == nil {
+				arguments = string(bytes)
+			}
+		}
+
+		callType := impl.ToolType(call.Type)
+		if callType == "" {
+			callType = impl.ToolTypeFunction
+		}
+
+		result = append(result, impl.ToolCall{
+			ID:   call.ID,
+			Type: callType,
+			Function: impl.FunctionCall{
+				Name:      call.Function.Name,
+				Arguments: arguments,
+			},
+		})
+	}
+	return result
+}
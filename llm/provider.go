@@ -0,0 +1,165 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/jieliu2000/anyi/llm/anthropic"
+	"github.com/jieliu2000/anyi/llm/azureopenai"
+	"github.com/jieliu2000/anyi/llm/dashscope"
+	"github.com/jieliu2000/anyi/llm/deepseek"
+	"github.com/jieliu2000/anyi/llm/minimax"
+	"github.com/jieliu2000/anyi/llm/ollama"
+	"github.com/jieliu2000/anyi/llm/openai"
+	"github.com/jieliu2000/anyi/llm/siliconcloud"
+	"github.com/jieliu2000/anyi/llm/zhipu"
+)
+
+// ConfigFactory creates the model config of a provider with its default values. The values of the client config are decoded into the returned config, so it must be a pointer.
+type ConfigFactory func() ModelConfig
+
+// ClientFactory creates a client from a model config created by the ConfigFactory of the same provider.
+type ClientFactory func(config ModelConfig) (Client, error)
+
+type provider struct {
+	newConfig  ConfigFactory
+	newClient  ClientFactory
+	configType reflect.Type
+}
+
+var providerRegistry = struct {
+	mu sync.RWMutex
+	// providers indexed by the type used in ClientConfig
+	providers map[string]provider
+	// the provider type of each config type, used by NewClient to find the provider of a model config
+	configTypes map[reflect.Type]string
+}{
+	providers:   map[string]provider{},
+	configTypes: map[reflect.Type]string{},
+}
+
+// RegisterProvider registers a provider so that clients of this type can be created from a ClientConfig, for example in the clients section of the Anyi configuration file.
+// Registering a type which already exists replaces the existing provider, which allows to override the built-in providers. If the replacing provider uses another config type, NewClient no longer uses it for the config type of the replaced provider.
+//
+// A provider for an in-house OpenAI compatible gateway can reuse the config and client of the openai package:
+//
+//	llm.RegisterProvider("mygateway",
+//		func() llm.ModelConfig { return openai.NewConfig("", "", "https://gateway.example.com/v1") },
+//		func(config llm.ModelConfig) (llm.Client, error) { return openai.NewClient(config.(*openai.OpenAIModelConfig)) })
+//
+// Parameters:
+//   - providerType: The value of the type field in the client config
+//   - configFactory: Creates the model config with its default values
+//   - clientFactory: Creates the client from the model config
+//
+// Returns:
+//   - An error if a parameter is empty or the config factory doesn't return a pointer
+func RegisterProvider(providerType string, configFactory ConfigFactory, clientFactory ClientFactory) error {
+	if providerType == "" {
+		return errors.New("provider type cannot be empty")
+	}
+	if configFactory == nil || clientFactory == nil {
+		return errors.New("config factory and client factory cannot be nil")
+	}
+
+	configType := reflect.TypeOf(configFactory())
+	if configType == nil || configType.Kind() != reflect.Pointer {
+		return fmt.Errorf("config factory of provider %s must return a pointer", providerType)
+	}
+
+	providerRegistry.mu.Lock()
+	defer providerRegistry.mu.Unlock()
+
+	replaced, exists := providerRegistry.providers[providerType]
+	providerRegistry.providers[providerType] = provider{newConfig: configFactory, newClient: clientFactory, configType: configType}
+	if exists && replaced.configType != configType && providerRegistry.configTypes[replaced.configType] == providerType {
+		// The config type of the replaced provider now belongs to another provider using it, if there is one
+		delete(providerRegistry.configTypes, replaced.configType)
+		if other, ok := providerWithConfigType(replaced.configType); ok {
+			providerRegistry.configTypes[replaced.configType] = other
+		}
+	}
+	// Providers sharing a config type, like OpenAI compatible gateways, don't replace the provider NewClient uses for that type
+	if _, exists := providerRegistry.configTypes[configType]; !exists {
+		providerRegistry.configTypes[configType] = providerType
+	}
+	return nil
+}
+
+// providerWithConfigType returns the first provider type in alphabetical order whose provider uses the config type. The caller must hold the lock.
+func providerWithConfigType(configType reflect.Type) (string, bool) {
+	types := []string{}
+	for providerType, p := range providerRegistry.providers {
+		if p.configType == configType {
+			types = append(types, providerType)
+		}
+	}
+	if len(types) == 0 {
+		return "", false
+	}
+	sort.Strings(types)
+	return types[0], true
+}
+
+// ProviderTypes returns the registered provider types in alphabetical order.
+func ProviderTypes() []string {
+	providerRegistry.mu.RLock()
+	defer providerRegistry.mu.RUnlock()
+
+	types := make([]string, 0, len(providerRegistry.providers))
+	for providerType := range providerRegistry.providers {
+		types = append(types, providerType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func getProvider(providerType string) (provider, bool) {
+	providerRegistry.mu.RLock()
+	defer providerRegistry.mu.RUnlock()
+
+	p, ok := providerRegistry.providers[providerType]
+	return p, ok
+}
+
+func getProviderForConfig(config ModelConfig) (provider, bool) {
+	providerRegistry.mu.RLock()
+	defer providerRegistry.mu.RUnlock()
+
+	providerType, ok := providerRegistry.configTypes[reflect.TypeOf(config)]
+	if !ok {
+		return provider{}, false
+	}
+	p, ok := providerRegistry.providers[providerType]
+	return p, ok
+}
+
+// clientFactory adapts the typed NewClient function of a provider package to a ClientFactory.
+func clientFactory[C ModelConfig, T Client](newClient func(C) (T, error)) ClientFactory {
+	return func(config ModelConfig) (Client, error) {
+		typedConfig, ok := config.(C)
+		if !ok {
+			return nil, fmt.Errorf("unexpected model config type %T", config)
+		}
+		client, err := newClient(typedConfig)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	}
+}
+
+func init() {
+	RegisterProvider("openai", func() ModelConfig { return openai.DefaultConfig("") }, clientFactory(openai.NewClient))
+	RegisterProvider("azureopenai", func() ModelConfig { return &azureopenai.AzureOpenAIModelConfig{} }, clientFactory(azureopenai.NewClient))
+	RegisterProvider("dashscope", func() ModelConfig { return dashscope.DefaultConfig("", "") }, clientFactory(dashscope.NewClient))
+	RegisterProvider("zhipu", func() ModelConfig { return zhipu.DefaultConfig("", "") }, clientFactory(zhipu.NewClient))
+	RegisterProvider("siliconcloud", func() ModelConfig { return siliconcloud.DefaultConfig("", "") }, clientFactory(siliconcloud.NewClient))
+	RegisterProvider("ollama", func() ModelConfig { return ollama.DefaultConfig("") }, clientFactory(ollama.NewClient))
+	RegisterProvider("anthropic", func() ModelConfig { return anthropic.DefaultConfig("") }, clientFactory(anthropic.NewClient))
+	RegisterProvider("deepseek", func() ModelConfig { return deepseek.DefaultConfig("", deepseek.DefaultModel) }, clientFactory(deepseek.NewClient))
+	RegisterProvider("minimax", func() ModelConfig { return minimax.DefaultConfig("", minimax.DefaultModel) }, clientFactory(minimax.NewClient))
+}
@@ -1,6 +1,7 @@
 package siliconcloud
 
 import (
+	"context"
 	"errors"
 
 	"github.com/jieliu2000/anyi/llm/chat"
@@ -78,6 +79,9 @@ const (
 
 	// Default model - using the latest Qwen3-Max for best performance
 	DefaultModel = "Qwen/Qwen3-Max"
+
+	// DefaultEmbeddingModel is the embedding model used by Embed if EmbeddingModel is not set.
+	DefaultEmbeddingModel = "BAAI/bge-m3"
 )
 
 type SiliconCloudConfig struct {
@@ -85,6 +89,10 @@ type SiliconCloudConfig struct {
 	APIKey  string `json:"apiKey" mapstructure:"apiKey"`
 	BaseUrl string `json:"baseUrl" mapstructure:"baseUrl"`
 	Model   string `json:"model" mapstructure:"model"`
+	// The model used by Embed. Defaults to DefaultEmbeddingModel.
+	EmbeddingModel string `json:"embeddingModel" mapstructure:"embeddingModel"`
+	// The maximum number of texts sent in one embeddings request. Defaults to chat.DefaultEmbeddingBatchSize.
+	EmbeddingBatchSize int `json:"embeddingBatchSize" mapstructure:"embeddingBatchSize"`
 }
 
 type SiliconCloud struct {
@@ -130,7 +138,7 @@ func NewClient(config *SiliconCloudConfig) (*SiliconCloud, error) {
 	// Create a new ZhipuClient using the provided config and the configured client implementation
 	client := &SiliconCloud{
 		Config:     config,
-		clientImpl: impl.NewClientWithConfig(configImpl),
+		clientImpl: openai.NewClientImpl(configImpl),
 	}
 
 	// Return the newly created ZhipuClient and nil error
@@ -138,6 +146,11 @@ func NewClient(config *SiliconCloudConfig) (*SiliconCloud, error) {
 }
 
 func (c *SiliconCloud) ChatWithFunctions(messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
+	return c.ChatWithFunctionsContext(context.Background(), messages, functions, options)
+}
+
+// ChatWithFunctionsContext works like ChatWithFunctions but sends the request with the given context. The request is aborted when the context is cancelled or its deadline expires.
+func (c *SiliconCloud) ChatWithFunctionsContext(ctx context.Context, messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
 	client := c.clientImpl
 
 	// Create a temporary config object compatible with OpenAIModelConfig
@@ -146,10 +159,15 @@ func (c *SiliconCloud) ChatWithFunctions(messages []chat.Message, functions []to
 		Model:            c.Config.Model,
 	}
 
-	return openai.ExecuteChatWithFunctions(client, c.Config.Model, messages, functions, options, openaiConfig)
+	return openai.ExecuteChatWithFunctionsContext(ctx, client, c.Config.Model, messages, functions, options, openaiConfig)
 }
 
 func (c *SiliconCloud) Chat(messages []chat.Message, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
+	return c.ChatContext(context.Background(), messages, options)
+}
+
+// ChatContext works like Chat but sends the request with the given context. The request is aborted when the context is cancelled or its deadline expires.
+func (c *SiliconCloud) ChatContext(ctx context.Context, messages []chat.Message, options *chat.ChatOptions) (*chat.Message, chat.ResponseInfo, error) {
 	client := c.clientImpl
 
 	// Create a temporary config object compatible with OpenAIModelConfig
@@ -158,5 +176,46 @@ func (c *SiliconCloud) Chat(messages []chat.Message, options *chat.ChatOptions)
 		Model:            c.Config.Model,
 	}
 
-	return openai.ExecuteChat(client, c.Config.Model, messages, options, openaiConfig)
+	return openai.ExecuteChatContext(ctx, client, c.Config.Model, messages, options, openaiConfig)
+}
+
+// ChatStream sends the messages to the model and streams the response back through the returned channel.
+func (c *SiliconCloud) ChatStream(ctx context.Context, messages []chat.Message, options *chat.ChatOptions) (<-chan chat.StreamChunk, error) {
+	return c.ChatWithFunctionsStream(ctx, messages, nil, options)
+}
+
+// ChatWithFunctionsStream works like ChatStream but also allows the model to call the given functions.
+func (c *SiliconCloud) ChatWithFunctionsStream(ctx context.Context, messages []chat.Message, functions []tools.FunctionConfig, options *chat.ChatOptions) (<-chan chat.StreamChunk, error) {
+	// Create a temporary config object compatible with OpenAIModelConfig
+	openaiConfig := &openai.OpenAIModelConfig{
+		GeneralLLMConfig: c.Config.GeneralLLMConfig,
+		Model:            c.Config.Model,
+	}
+
+	return openai.ExecuteChatStream(ctx, c.clientImpl, c.Config.Model, messages, functions, options, openaiConfig)
+}
+
+// Embed computes the embeddings of the texts with the EmbeddingModel of the config, or DefaultEmbeddingModel if it's not set.
+func (c *SiliconCloud) Embed(ctx context.Context, texts []string) ([][]float32, chat.ResponseInfo, error) {
+	model := c.Config.EmbeddingModel
+	if model == "" {
+		model = DefaultEmbeddingModel
+	}
+	return openai.ExecuteEmbeddingsContext(ctx, c.clientImpl, model, texts, c.Config.EmbeddingBatchSize)
+}
+
+// ModelName returns the model of the config. It's used to look up the context window of the model.
+func (c *SiliconCloud) ModelName() string {
+	if c.Config == nil {
+		return ""
+	}
+	return c.Config.Model
+}
+
+// MaxTokens returns the max tokens of the config, or 0 if they are not limited. They are reserved for the reply when the context window is checked.
+func (c *SiliconCloud) MaxTokens() int {
+	if c.Config == nil {
+		return 0
+	}
+	return c.Config.MaxTokens
 }
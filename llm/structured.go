@@ -0,0 +1,128 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jieliu2000/anyi/internal/jsonschema"
+	"github.com/jieliu2000/anyi/llm/chat"
+	"github.com/jieliu2000/anyi/llm/tools"
+)
+
+// DefaultStructuredOutputRetries is the number of times ChatInto and ChatWithSchema ask the model again when its reply doesn't conform to the schema.
+const DefaultStructuredOutputRetries = 2
+
+// ChatWithSchema asks the model to reply with JSON conforming to the schema and validates the reply.
+// If the reply isn't valid JSON or violates the schema, the validation error is sent to the model and it's asked to correct its reply, at most retries times.
+// Replies wrapped in markdown code fences are accepted.
+//
+// Parameters:
+//   - ctx: The context of the requests
+//   - client: The client to use
+//   - messages: The messages to send
+//   - schema: The JSON schema of the reply
+//   - options: Optional chat options. The schema replaces the schema of the options.
+//   - retries: The number of retries. Negative values are treated as 0.
+//
+// Returns:
+//   - The reply of the model, with the JSON extracted from code fences
+//   - The response info of the last request
+//   - An error if the request fails or no valid reply is produced
+func ChatWithSchema(ctx context.Context, client Client, messages []chat.Message, schema map[string]any, options *chat.ChatOptions, retries int) (*chat.Message, chat.ResponseInfo, error) {
+	if schema == nil {
+		return nil, chat.ResponseInfo{}, errors.New("schema cannot be nil")
+	}
+
+	if retries < 0 {
+		retries = 0
+	}
+
+	schemaOptions := chat.ChatOptions{}
+	if options != nil {
+		schemaOptions = *options
+	}
+	schemaOptions.Format = "json"
+	schemaOptions.Schema = schema
+
+	conversation := append([]chat.Message{}, messages...)
+	var lastErr error
+	for attempt := 0; attempt <= retries; attempt++ {
+		reply, info, err := ChatContext(ctx, client, conversation, &schemaOptions)
+		if err != nil {
+			return nil, info, err
+		}
+
+		content := extractJSON(reply.Content)
+		lastErr = jsonschema.ValidateJSON(schema, []byte(content))
+		if lastErr == nil {
+			reply.Content = content
+			return reply, info, nil
+		}
+
+		conversation = append(conversation,
+			chat.Message{Role: "assistant", Content: reply.Content},
+			chat.NewUserMessage(fmt.Sprintf("Your reply is not valid: %v. Reply again with only the corrected JSON.", lastErr)),
+		)
+	}
+	return nil, chat.ResponseInfo{}, fmt.Errorf("model didn't produce a valid reply: %w", lastErr)
+}
+
+// ChatInto asks the model to reply with JSON matching the type T and decodes the reply into a value of T.
+// The schema is derived from T with tools.NewSchemaFromType, so the json, description, enum, minimum, maximum and default struct tags are respected.
+// Invalid replies are retried DefaultStructuredOutputRetries times, see ChatWithSchema.
+//
+// Example:
+//
+//	type Answer struct {
+//		City       string `json:"city"`
+//		Population int    `json:"population"`
+//	}
+//
+//	answer, _, err := llm.ChatInto[Answer](ctx, client, messages, nil)
+//
+// Parameters:
+//   - ctx: The context of the requests
+//   - client: The client to use
+//   - messages: The messages to send
+//   - options: Optional chat options
+//
+// Returns:
+//   - The decoded reply
+//   - The response info of the last request
+//   - An error if the schema can't be derived, the request fails or no valid reply is produced
+func ChatInto[T any](ctx context.Context, client Client, messages []chat.Message, options *chat.ChatOptions) (T, chat.ResponseInfo, error) {
+	var result T
+
+	schema, err := tools.NewSchemaFromType(&result)
+	if err != nil {
+		return result, chat.ResponseInfo{}, err
+	}
+
+	reply, info, err := ChatWithSchema(ctx, client, messages, schema, options, DefaultStructuredOutputRetries)
+	if err != nil {
+		return result, info, err
+	}
+
+	if err := json.Unmarshal([]byte(reply.Content), &result); err != nil {
+		return result, info, err
+	}
+	return result, info, nil
+}
+
+// extractJSON removes markdown code fences and surrounding whitespace from a reply.
+func extractJSON(content string) string {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "```") {
+		return content
+	}
+
+	content = strings.TrimPrefix(content, "```")
+	if newline := strings.Index(content, "\n"); newline >= 0 {
+		content = content[newline+1:]
+	}
+	content = strings.TrimSuffix(strings.TrimSpace(content), "```")
+	return strings.TrimSpace(content)
+}
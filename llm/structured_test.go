@@ -0,0 +1,56 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jieliu2000/anyi/internal/test"
+	"github.com/jieliu2000/anyi/llm/chat"
+	"github.com/stretchr/testify/assert"
+)
+
+type cityInfo struct {
+	Name       string   `json:"name"`
+	Population int      `json:"population" minimum:"0"`
+	Landmarks  []string `json:"landmarks,omitempty"`
+}
+
+func TestChatInto(t *testing.T) {
+	client := &test.SequenceClient{Outputs: []string{
+		"```json\n{\"name\": \"Paris\", \"population\": 2100000, \"landmarks\": [\"Eiffel Tower\"]}\n```",
+	}}
+
+	city, _, err := ChatInto[cityInfo](context.Background(), client, []chat.Message{chat.NewUserMessage("Tell me about Paris")}, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, cityInfo{Name: "Paris", Population: 2100000, Landmarks: []string{"Eiffel Tower"}}, city)
+	assert.Equal(t, "json", client.Options[0].Format)
+	assert.Equal(t, []string{"name", "population"}, client.Options[0].Schema["required"])
+}
+
+func TestChatIntoRetriesWithValidationError(t *testing.T) {
+	client := &test.SequenceClient{Outputs: []string{
+		"Paris has about two million inhabitants",
+		`{"name": "Paris", "population": -1}`,
+		`{"name": "Paris", "population": 2100000}`,
+	}}
+
+	city, _, err := ChatInto[cityInfo](context.Background(), client, []chat.Message{chat.NewUserMessage("Tell me about Paris")}, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2100000, city.Population)
+	assert.Len(t, client.Messages, 3)
+	assert.Contains(t, client.Messages[1][2].Content, "invalid JSON")
+	assert.Equal(t, "Paris has about two million inhabitants", client.Messages[1][1].Content)
+	assert.Contains(t, client.Messages[2][4].Content, "$.population: value -1 is less than the minimum 0")
+}
+
+func TestChatWithSchemaFailsAfterRetries(t *testing.T) {
+	client := &test.SequenceClient{Outputs: []string{`{}`, `{}`}}
+	schema := map[string]any{"type": "object", "required": []string{"name"}}
+
+	_, _, err := ChatWithSchema(context.Background(), client, []chat.Message{chat.NewUserMessage("Hi")}, schema, nil, 1)
+
+	assert.EqualError(t, err, `model didn't produce a valid reply: $: missing required property "name"`)
+	assert.Len(t, client.Messages, 2)
+}
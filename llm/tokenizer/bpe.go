@@ -0,0 +1,247 @@
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dlclark/regexp2"
+)
+
+const (
+	// Cl100kBase is the encoding of GPT-4, GPT-3.5 Turbo and the text-embedding-3 models.
+	Cl100kBase = "cl100k_base"
+	// O200kBase is the encoding of GPT-4o, GPT-4.1, GPT-5 and the o-series models.
+	O200kBase = "o200k_base"
+
+	// Cl100kPattern splits texts into the pieces which are encoded separately by cl100k_base.
+	Cl100kPattern = `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`
+	// O200kPattern splits texts into the pieces which are encoded separately by o200k_base.
+	O200kPattern = `[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+(?!\S)|\s+`
+)
+
+// encodingPatterns holds the split patterns of the encodings LoadEncodingFile knows.
+var encodingPatterns = map[string]string{
+	Cl100kBase: Cl100kPattern,
+	O200kBase:  O200kPattern,
+}
+
+// BPE is a byte pair encoding tokenizer compatible with the encodings of OpenAI models (tiktoken).
+// Texts are split into pieces with a regular expression, and the bytes of each piece are merged into tokens in the order of their ranks.
+// A BPE is safe for concurrent use.
+type BPE struct {
+	ranks   map[string]int
+	pattern *regexp2.Regexp
+}
+
+// NewBPE creates a BPE tokenizer.
+//
+// Parameters:
+//   - ranks: Maps the bytes of each token to its rank, which is also its ID. It must contain all 256 single bytes
+//   - pattern: The regular expression splitting texts into pieces, for example Cl100kPattern
+//
+// Returns:
+//   - The tokenizer
+//   - An error if a single byte is missing from the ranks or the pattern is invalid
+func NewBPE(ranks map[string]int, pattern string) (*BPE, error) {
+	for b := 0; b < 256; b++ {
+		if _, ok := ranks[string([]byte{byte(b)})]; !ok {
+			return nil, fmt.Errorf("ranks don't contain the byte %d", b)
+		}
+	}
+	compiled, err := regexp2.Compile(pattern, regexp2.None)
+	if err != nil {
+		return nil, err
+	}
+	return &BPE{ranks: ranks, pattern: compiled}, nil
+}
+
+// Encode returns the IDs of the tokens of the text.
+func (bpe *BPE) Encode(text string) []int {
+	var tokens []int
+	bpe.eachPiece(text, func(piece string) {
+		tokens = append(tokens, bpe.encodePiece(piece)...)
+	})
+	return tokens
+}
+
+// Count returns the number of tokens of the text.
+func (bpe *BPE) Count(text string) int {
+	count := 0
+	bpe.eachPiece(text, func(piece string) {
+		if _, ok := bpe.ranks[piece]; ok {
+			count++
+			return
+		}
+		count += len(bpe.merge(piece))
+	})
+	return count
+}
+
+// eachPiece calls handle for each piece the pattern splits the text into.
+func (bpe *BPE) eachPiece(text string, handle func(piece string)) {
+	match, err := bpe.pattern.FindStringMatch(text)
+	for err == nil && match != nil {
+		handle(match.String())
+		match, err = bpe.pattern.FindNextMatch(match)
+	}
+}
+
+// encodePiece returns the token IDs of a piece.
+func (bpe *BPE) encodePiece(piece string) []int {
+	if rank, ok := bpe.ranks[piece]; ok {
+		return []int{rank}
+	}
+	bounds := bpe.merge(piece)
+	tokens := make([]int, len(bounds))
+	start := 0
+	for i, end := range bounds {
+		tokens[i] = bpe.ranks[piece[start:end]]
+		start = end
+	}
+	return tokens
+}
+
+// merge merges the bytes of the piece, always joining the adjacent pair with the lowest rank, until no pair is a token. It returns the end offsets of the tokens.
+func (bpe *BPE) merge(piece string) []int {
+	// bounds[i] is the start of the i-th part, the last entry is the end of the piece
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	rank := func(i int) int {
+		if i+2 >= len(bounds) {
+			return math.MaxInt
+		}
+		if r, ok := bpe.ranks[piece[bounds[i]:bounds[i+2]]]; ok {
+			return r
+		}
+		return math.MaxInt
+	}
+	ranks := make([]int, len(bounds)-1)
+	for i := range ranks {
+		ranks[i] = rank(i)
+	}
+
+	for len(bounds) > 2 {
+		best := -1
+		for i, r := range ranks {
+			if r != math.MaxInt && (best < 0 || r < ranks[best]) {
+				best = i
+			}
+		}
+		if best < 0 {
+			break
+		}
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+		ranks = append(ranks[:best], ranks[best+1:]...)
+		ranks[best] = rank(best)
+		if best > 0 {
+			ranks[best-1] = rank(best - 1)
+		}
+	}
+	return bounds[1:]
+}
+
+// ParseTiktoken reads ranks in the format of the tiktoken encoding files: one token per line, as base64 followed by a space and its rank.
+//
+// Parameters:
+//   - reader: The content of the file, for example of cl100k_base.tiktoken
+//
+// Returns:
+//   - The ranks
+//   - An error if a line is invalid
+func ParseTiktoken(reader io.Reader) (map[string]int, error) {
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(reader)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		encoded, rankText, found := strings.Cut(text, " ")
+		if !found {
+			return nil, fmt.Errorf("invalid line %d: missing rank", line)
+		}
+		token, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid line %d: %w", line, err)
+		}
+		rank, err := strconv.Atoi(rankText)
+		if err != nil {
+			return nil, fmt.Errorf("invalid line %d: %w", line, err)
+		}
+		ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ranks, nil
+}
+
+var (
+	encodingsMu sync.RWMutex
+	encodings   = map[string]Tokenizer{}
+)
+
+// RegisterEncoding makes a tokenizer available under the name of an encoding, so ForModel uses it for the models with this encoding.
+func RegisterEncoding(name string, tokenizer Tokenizer) error {
+	if name == "" {
+		return errors.New("encoding name cannot be empty")
+	}
+	if tokenizer == nil {
+		return errors.New("tokenizer cannot be nil")
+	}
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+	encodings[name] = tokenizer
+	return nil
+}
+
+// GetEncoding returns the tokenizer registered for an encoding.
+func GetEncoding(name string) (Tokenizer, bool) {
+	encodingsMu.RLock()
+	defer encodingsMu.RUnlock()
+	tokenizer, ok := encodings[name]
+	return tokenizer, ok
+}
+
+// LoadEncodingFile loads a tiktoken encoding file, for example cl100k_base.tiktoken from the tiktoken project, and registers it as a BPE tokenizer.
+// The encoding files are not included in Anyi because of their size. Until an encoding is loaded, ForModel approximates the tokens of its models.
+//
+// Parameters:
+//   - name: The name of the encoding, Cl100kBase or O200kBase
+//   - path: The path of the encoding file
+//
+// Returns:
+//   - An error if the encoding is unknown or the file is invalid
+func LoadEncodingFile(name string, path string) error {
+	pattern, ok := encodingPatterns[name]
+	if !ok {
+		return fmt.Errorf("unknown encoding: %s", name)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	ranks, err := ParseTiktoken(file)
+	if err != nil {
+		return fmt.Errorf("invalid encoding file %s: %w", path, err)
+	}
+	bpe, err := NewBPE(ranks, pattern)
+	if err != nil {
+		return fmt.Errorf("invalid encoding file %s: %w", path, err)
+	}
+	return RegisterEncoding(name, bpe)
+}
@@ -0,0 +1,110 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRanks returns the ranks of all single bytes followed by a few merged tokens.
+func testRanks() map[string]int {
+	ranks := make(map[string]int)
+	for b := 0; b < 256; b++ {
+		ranks[string([]byte{byte(b)})] = b
+	}
+	for i, token := range []string{"he", "ll", "hell", "hello", " w", "or", " wor"} {
+		ranks[token] = 256 + i
+	}
+	return ranks
+}
+
+func pieces(bpe *BPE, text string) []string {
+	var result []string
+	bpe.eachPiece(text, func(piece string) {
+		result = append(result, piece)
+	})
+	return result
+}
+
+func TestBPE_Encode(t *testing.T) {
+	bpe, err := NewBPE(testRanks(), Cl100kPattern)
+	require.NoError(t, err)
+
+	// "hello" is a token, " world" is merged into " wor" and the single bytes of "l" and "d"
+	assert.Equal(t, []int{259, 262, 'l', 'd'}, bpe.Encode("hello world"))
+	assert.Equal(t, 4, bpe.Count("hello world"))
+	// "hel" merges "he" first since it has the lower rank than "el", which is not a token
+	assert.Equal(t, []int{256, 'l'}, bpe.Encode("hel"))
+	assert.Empty(t, bpe.Encode(""))
+}
+
+func TestBPE_Pieces(t *testing.T) {
+	cl100k, err := NewBPE(testRanks(), Cl100kPattern)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"it", "'s", " ", "123", "4", "!", "  ", " next", "\n\n", "line"}, pieces(cl100k, "it's 1234!   next\n\nline"))
+
+	o200k, err := NewBPE(testRanks(), O200kPattern)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Hello", "World's", " path", "/"}, pieces(o200k, "HelloWorld's path/"))
+}
+
+func TestNewBPE_Errors(t *testing.T) {
+	_, err := NewBPE(map[string]int{"a": 0}, Cl100kPattern)
+	assert.Error(t, err)
+
+	_, err = NewBPE(testRanks(), "(")
+	assert.Error(t, err)
+}
+
+func writeTiktoken(t *testing.T, ranks map[string]int) string {
+	lines := make([]string, 0, len(ranks))
+	for token, rank := range ranks {
+		lines = append(lines, fmt.Sprintf("%s %d", base64.StdEncoding.EncodeToString([]byte(token)), rank))
+	}
+	sort.Strings(lines)
+	path := filepath.Join(t.TempDir(), "test.tiktoken")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644))
+	return path
+}
+
+func TestParseTiktoken(t *testing.T) {
+	ranks, err := ParseTiktoken(strings.NewReader("aGVsbG8= 5\n\nIHdvcmxk 6\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"hello": 5, " world": 6}, ranks)
+
+	_, err = ParseTiktoken(strings.NewReader("aGVsbG8=\n"))
+	assert.Error(t, err)
+	_, err = ParseTiktoken(strings.NewReader("not-base64! 1\n"))
+	assert.Error(t, err)
+	_, err = ParseTiktoken(strings.NewReader("aGVsbG8= x\n"))
+	assert.Error(t, err)
+}
+
+func TestLoadEncodingFile(t *testing.T) {
+	path := writeTiktoken(t, testRanks())
+	defer func() {
+		encodingsMu.Lock()
+		delete(encodings, Cl100kBase)
+		encodingsMu.Unlock()
+	}()
+
+	// Without the encoding, GPT-4 is approximated
+	assert.IsType(t, &Approximate{}, ForModel("gpt-4"))
+
+	require.NoError(t, LoadEncodingFile(Cl100kBase, path))
+	tokenizer := ForModel("gpt-4-0613")
+	assert.IsType(t, &BPE{}, tokenizer)
+	assert.Equal(t, 4, tokenizer.Count("hello world"))
+	// Models of another encoding are still approximated
+	assert.IsType(t, &Approximate{}, ForModel("gpt-4o"))
+
+	assert.Error(t, LoadEncodingFile("p50k_base", path))
+	assert.Error(t, LoadEncodingFile(Cl100kBase, filepath.Join(t.TempDir(), "missing.tiktoken")))
+}
@@ -0,0 +1,131 @@
+package tokenizer
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ModelInfo describes how a model counts tokens.
+type ModelInfo struct {
+	// ContextWindow is the maximum number of tokens of the prompt and the reply together.
+	// For models served by Ollama it's the window the model supports. Ollama only uses num_ctx tokens, which is smaller by default.
+	ContextWindow int
+	// Encoding is the name of the BPE encoding of the model, for example Cl100kBase. Empty for models which are approximated.
+	Encoding string
+	// CharsPerToken is used to approximate the tokens if the encoding is not available. Defaults to 4.
+	CharsPerToken float64
+}
+
+var (
+	modelsMu sync.RWMutex
+	// models maps lower case model name prefixes to their info. The longest matching prefix wins.
+	models = map[string]ModelInfo{
+		// OpenAI
+		"gpt-5":                  {ContextWindow: 400000, Encoding: O200kBase},
+		"gpt-4.1":                {ContextWindow: 1047576, Encoding: O200kBase},
+		"gpt-4o":                 {ContextWindow: 128000, Encoding: O200kBase},
+		"o1":                     {ContextWindow: 200000, Encoding: O200kBase},
+		"o3":                     {ContextWindow: 200000, Encoding: O200kBase},
+		"o4-mini":                {ContextWindow: 200000, Encoding: O200kBase},
+		"gpt-4.5":                {ContextWindow: 128000, Encoding: O200kBase},
+		"gpt-4-turbo":            {ContextWindow: 128000, Encoding: Cl100kBase},
+		"gpt-4-0125-preview":     {ContextWindow: 128000, Encoding: Cl100kBase},
+		"gpt-4-1106-preview":     {ContextWindow: 128000, Encoding: Cl100kBase},
+		"gpt-4-vision-preview":   {ContextWindow: 128000, Encoding: Cl100kBase},
+		"gpt-4-32k":              {ContextWindow: 32768, Encoding: Cl100kBase},
+		"gpt-4":                  {ContextWindow: 8192, Encoding: Cl100kBase},
+		"gpt-3.5-turbo":          {ContextWindow: 16385, Encoding: Cl100kBase},
+		"text-embedding-3":       {ContextWindow: 8191, Encoding: Cl100kBase},
+		"text-embedding-ada-002": {ContextWindow: 8191, Encoding: Cl100kBase},
+
+		// Anthropic
+		"claude": {ContextWindow: 200000, CharsPerToken: 3.5},
+
+		// DeepSeek
+		"deepseek-chat":     {ContextWindow: 128000},
+		"deepseek-reasoner": {ContextWindow: 128000},
+		"deepseek-v3":       {ContextWindow: 128000},
+		"deepseek-r1":       {ContextWindow: 128000},
+
+		// Qwen (DashScope, SiliconCloud)
+		"qwen3-max":  {ContextWindow: 262144},
+		"qwen-max":   {ContextWindow: 32768},
+		"qwen-plus":  {ContextWindow: 131072},
+		"qwen-turbo": {ContextWindow: 131072},
+		"qwen2.5":    {ContextWindow: 32768},
+
+		// Zhipu
+		"glm-4":   {ContextWindow: 128000},
+		"glm-4-6": {ContextWindow: 200000},
+		"glm-4.6": {ContextWindow: 200000},
+
+		// MiniMax
+		"minimax-m2": {ContextWindow: 204800},
+
+		// Open models served by Ollama
+		"llama3.1":  {ContextWindow: 131072},
+		"llama3.2":  {ContextWindow: 131072},
+		"llama3":    {ContextWindow: 8192},
+		"mistral":   {ContextWindow: 32768},
+		"gemma2":    {ContextWindow: 8192},
+		"phi3":      {ContextWindow: 4096},
+		"qwen3":     {ContextWindow: 32768},
+		"codellama": {ContextWindow: 16384},
+	}
+)
+
+// RegisterModel sets the info of the models whose name starts with the prefix, ignoring case. It overrides the built-in info of the same prefix.
+func RegisterModel(prefix string, info ModelInfo) error {
+	if prefix == "" {
+		return errors.New("model prefix cannot be empty")
+	}
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	models[strings.ToLower(prefix)] = info
+	return nil
+}
+
+// LookupModel returns the info of a model. The model name is matched against the registered prefixes, ignoring case, and the longest matching prefix wins.
+// Names with an organization, like "Qwen/Qwen3-Max" on SiliconCloud, are also matched without it. Ollama tags, like "llama3.1:8b", match the prefix of their model.
+//
+// Parameters:
+//   - model: The name of the model
+//
+// Returns:
+//   - The info of the model
+//   - false if no prefix matches
+func LookupModel(model string) (ModelInfo, bool) {
+	name := strings.ToLower(strings.TrimSpace(model))
+	if name == "" {
+		return ModelInfo{}, false
+	}
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+
+	candidates := []string{name}
+	if slash := strings.LastIndex(name, "/"); slash >= 0 {
+		candidates = append(candidates, name[slash+1:])
+	}
+	var found ModelInfo
+	longest := 0
+	for _, candidate := range candidates {
+		for prefix, info := range models {
+			if len(prefix) > longest && strings.HasPrefix(candidate, prefix) {
+				found, longest = info, len(prefix)
+			}
+		}
+	}
+	return found, longest > 0
+}
+
+// ForModel returns the tokenizer of a model: the BPE tokenizer of its encoding if the encoding is registered, or an approximation otherwise.
+func ForModel(model string) Tokenizer {
+	info, _ := LookupModel(model)
+	if info.Encoding != "" {
+		if tokenizer, ok := GetEncoding(info.Encoding); ok {
+			return tokenizer
+		}
+	}
+	return &Approximate{CharsPerToken: info.CharsPerToken}
+}
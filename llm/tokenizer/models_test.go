@@ -0,0 +1,53 @@
+package tokenizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupModel(t *testing.T) {
+	info, ok := LookupModel("gpt-4o-mini")
+	assert.True(t, ok)
+	assert.Equal(t, 128000, info.ContextWindow)
+	assert.Equal(t, O200kBase, info.Encoding)
+
+	// The longest prefix wins over "gpt-4"
+	info, _ = LookupModel("GPT-4-Turbo-Preview")
+	assert.Equal(t, 128000, info.ContextWindow)
+	info, _ = LookupModel("gpt-4-0613")
+	assert.Equal(t, 8192, info.ContextWindow)
+	for _, model := range []string{"gpt-4-0125-preview", "gpt-4-1106-preview", "gpt-4-vision-preview", "gpt-4.5-preview"} {
+		info, _ = LookupModel(model)
+		assert.Equal(t, 128000, info.ContextWindow, model)
+	}
+
+	info, ok = LookupModel("Qwen/Qwen3-Max")
+	assert.True(t, ok)
+	assert.Equal(t, 262144, info.ContextWindow)
+
+	info, ok = LookupModel("llama3.1:8b")
+	assert.True(t, ok)
+	assert.Equal(t, 131072, info.ContextWindow)
+
+	_, ok = LookupModel("my-finetune")
+	assert.False(t, ok)
+	_, ok = LookupModel("")
+	assert.False(t, ok)
+}
+
+func TestRegisterModel(t *testing.T) {
+	defer func() {
+		modelsMu.Lock()
+		delete(models, "my-finetune")
+		modelsMu.Unlock()
+	}()
+
+	assert.NoError(t, RegisterModel("My-Finetune", ModelInfo{ContextWindow: 4096, CharsPerToken: 2}))
+	info, ok := LookupModel("my-finetune-v2")
+	assert.True(t, ok)
+	assert.Equal(t, 4096, info.ContextWindow)
+	assert.Equal(t, 5, ForModel("my-finetune-v2").Count("ten chars!"))
+
+	assert.Error(t, RegisterModel("", ModelInfo{}))
+}
@@ -0,0 +1,205 @@
+// Package tokenizer counts the tokens of prompts before they are sent to a model, so prompts which don't fit into the context window of the model can be detected and shortened.
+//
+// OpenAI models are counted exactly with a BPE tokenizer once their encoding is loaded with LoadEncodingFile. Other models, and OpenAI models whose encoding is not loaded, are counted with an approximation which errs on the high side.
+package tokenizer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jieliu2000/anyi/llm/chat"
+)
+
+const (
+	// MessageOverhead is the number of tokens added for each message of a chat, for the role and the markup separating the messages.
+	MessageOverhead = 3
+	// ReplyOverhead is the number of tokens added once per chat for the start of the reply.
+	ReplyOverhead = 3
+)
+
+// ErrPromptTooLong is returned by TruncateMessages if the messages can't be shortened enough.
+var ErrPromptTooLong = errors.New("prompt doesn't fit into the context window")
+
+// Tokenizer counts the tokens of texts.
+type Tokenizer interface {
+	Count(text string) int
+}
+
+// Approximate estimates the number of tokens of texts from their length. It's used for models whose tokenizer is not available.
+// Letters of Chinese, Japanese and Korean text count as one token each, other characters as 1/CharsPerToken tokens. Most tokenizers need fewer tokens, so the estimate is on the safe side for checks of the context window.
+type Approximate struct {
+	// The number of characters of a token. Defaults to 4, which is close for English text.
+	CharsPerToken float64
+}
+
+// Count estimates the number of tokens of the text.
+func (approximate *Approximate) Count(text string) int {
+	charsPerToken := approximate.CharsPerToken
+	if charsPerToken <= 0 {
+		charsPerToken = 4
+	}
+	wide := 0
+	other := 0
+	for _, r := range text {
+		if isWide(r) {
+			wide++
+		} else {
+			other++
+		}
+	}
+	return wide + int(math.Ceil(float64(other)/charsPerToken))
+}
+
+// isWide returns true for letters of scripts which most tokenizers split into about one token per character.
+func isWide(r rune) bool {
+	return r >= 0x2E80 && (unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r))
+}
+
+// CountMessages counts the tokens of a chat: the text of each message, the function calls of the assistant, and the overhead of the messages and the reply.
+// Images are not counted.
+//
+// Parameters:
+//   - tokenizer: The tokenizer of the model
+//   - messages: The messages of the chat
+//
+// Returns:
+//   - The number of tokens of the prompt
+func CountMessages(tokenizer Tokenizer, messages []chat.Message) int {
+	tokens := ReplyOverhead
+	for _, message := range messages {
+		tokens += countMessage(tokenizer, message)
+	}
+	return tokens
+}
+
+func countMessage(tokenizer Tokenizer, message chat.Message) int {
+	tokens := MessageOverhead + tokenizer.Count(message.Content)
+	for _, part := range message.ContentParts {
+		tokens += tokenizer.Count(part.Text)
+	}
+	for _, call := range message.ToolCalls {
+		arguments, _ := json.Marshal(call.Function.Arguments)
+		tokens += MessageOverhead + tokenizer.Count(call.Function.Name) + tokenizer.Count(string(arguments))
+	}
+	return tokens
+}
+
+// Truncate shortens the text to at most maxTokens tokens. The start of the text is kept.
+//
+// Parameters:
+//   - tokenizer: The tokenizer of the model
+//   - text: The text to shorten
+//   - maxTokens: The maximum number of tokens
+//
+// Returns:
+//   - The longest start of the text which has at most maxTokens tokens
+func Truncate(tokenizer Tokenizer, text string, maxTokens int) string {
+	if maxTokens <= 0 {
+		return ""
+	}
+	if tokenizer.Count(text) <= maxTokens {
+		return text
+	}
+	// Binary search over the character boundaries for the longest prefix which fits
+	boundaries := make([]int, 0, utf8.RuneCountInString(text)+1)
+	for i := range text {
+		boundaries = append(boundaries, i)
+	}
+	boundaries = append(boundaries, len(text))
+	low, high := 0, len(boundaries)-1
+	for low < high {
+		middle := (low + high + 1) / 2
+		if tokenizer.Count(text[:boundaries[middle]]) <= maxTokens {
+			low = middle
+		} else {
+			high = middle - 1
+		}
+	}
+	return text[:boundaries[low]]
+}
+
+// TruncateMessages shortens a chat so that its tokens, counted with CountMessages, are at most maxTokens.
+// Leading system messages and the last message are kept. The oldest of the other messages are dropped first, and the kept messages start with a message of the user. If that's not enough, the text of the last message is shortened with Truncate.
+// The messages are not changed, a new slice is returned.
+//
+// Parameters:
+//   - tokenizer: The tokenizer of the model
+//   - messages: The messages of the chat
+//   - maxTokens: The maximum number of tokens of the prompt
+//
+// Returns:
+//   - The shortened messages
+//   - An error wrapping ErrPromptTooLong if the kept messages don't fit even with an empty last message
+func TruncateMessages(tokenizer Tokenizer, messages []chat.Message, maxTokens int) ([]chat.Message, error) {
+	if len(messages) == 0 || CountMessages(tokenizer, messages) <= maxTokens {
+		return messages, nil
+	}
+
+	system := 0
+	for system < len(messages)-1 && messages[system].Role == "system" {
+		system++
+	}
+	last := messages[len(messages)-1]
+	history := messages[system : len(messages)-1]
+
+	fixed := ReplyOverhead + countMessage(tokenizer, last)
+	for _, message := range messages[:system] {
+		fixed += countMessage(tokenizer, message)
+	}
+	historyTokens := 0
+	for _, message := range history {
+		historyTokens += countMessage(tokenizer, message)
+	}
+	for len(history) > 0 && (fixed+historyTokens > maxTokens || history[0].Role != "user") {
+		historyTokens -= countMessage(tokenizer, history[0])
+		history = history[1:]
+	}
+
+	result := make([]chat.Message, 0, system+len(history)+1)
+	result = append(result, messages[:system]...)
+	result = append(result, history...)
+
+	if fixed+historyTokens > maxTokens {
+		lastText := messageText(last)
+		budget := maxTokens - (fixed - tokenizer.Count(lastText)) - historyTokens
+		if budget <= 0 || lastText == "" {
+			return nil, fmt.Errorf("%w: %d tokens are needed without the last message, the limit is %d", ErrPromptTooLong, fixed+historyTokens-tokenizer.Count(lastText), maxTokens)
+		}
+		last = withText(last, Truncate(tokenizer, lastText, budget))
+	}
+	return append(result, last), nil
+}
+
+// messageText returns the content of the message, or the first text of its content parts.
+func messageText(message chat.Message) string {
+	if message.Content != "" || len(message.ContentParts) == 0 {
+		return message.Content
+	}
+	for _, part := range message.ContentParts {
+		if part.Text != "" {
+			return part.Text
+		}
+	}
+	return ""
+}
+
+// withText returns a copy of the message with its text replaced. For messages with content parts, the first text part is replaced.
+func withText(message chat.Message, text string) chat.Message {
+	if message.Content != "" || len(message.ContentParts) == 0 {
+		message.Content = text
+		return message
+	}
+	parts := append([]chat.ContentPart(nil), message.ContentParts...)
+	for i := range parts {
+		if parts[i].Text != "" {
+			parts[i].Text = text
+			break
+		}
+	}
+	message.ContentParts = parts
+	return message
+}
@@ -0,0 +1,81 @@
+package tokenizer
+
+import (
+	"testing"
+
+	"github.com/jieliu2000/anyi/llm/chat"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApproximate_Count(t *testing.T) {
+	approximate := &Approximate{}
+
+	assert.Equal(t, 0, approximate.Count(""))
+	assert.Equal(t, 3, approximate.Count("hello world"))
+	assert.Equal(t, 2, approximate.Count("你好"))
+	assert.Equal(t, 4, approximate.Count("你好, world"))
+	assert.Equal(t, 11, (&Approximate{CharsPerToken: 1}).Count("hello world"))
+}
+
+func TestCountMessages(t *testing.T) {
+	counter := &Approximate{CharsPerToken: 1}
+	messages := []chat.Message{
+		chat.NewSystemMessage("sys"),
+		{Role: "user", ContentParts: []chat.ContentPart{{Text: "look"}, {ImageUrl: "https://example.com/a.png"}}},
+		{Role: "assistant", ToolCalls: []chat.ToolCall{{Function: chat.FunctionCall{Name: "f", Arguments: map[string]any{"a": 1}}}}},
+	}
+
+	// reply + (3 + 3) + (3 + 4) + (3 + 3 + 1 + len(`{"a":1}`))
+	assert.Equal(t, 3+6+7+14, CountMessages(counter, messages))
+	assert.Equal(t, ReplyOverhead, CountMessages(counter, nil))
+}
+
+func TestTruncate(t *testing.T) {
+	approximate := &Approximate{}
+
+	assert.Equal(t, "one two ", Truncate(approximate, "one two three", 2))
+	assert.Equal(t, "one two three", Truncate(approximate, "one two three", 4))
+	assert.Equal(t, "", Truncate(approximate, "one two three", 0))
+	assert.Equal(t, "你好", Truncate(approximate, "你好世界", 2))
+}
+
+func TestTruncateMessages(t *testing.T) {
+	counter := &Approximate{CharsPerToken: 1}
+	messages := []chat.Message{
+		chat.NewSystemMessage("S"),
+		chat.NewUserMessage("aaaa"),
+		chat.NewAssistantMessage("bbbb"),
+		chat.NewUserMessage("cccccccc"),
+	}
+	assert.Equal(t, 32, CountMessages(counter, messages))
+
+	truncated, err := TruncateMessages(counter, messages, 32)
+	assert.NoError(t, err)
+	assert.Equal(t, messages, truncated)
+
+	// Dropping the first user message would start the history with an answer, so both are dropped
+	truncated, err = TruncateMessages(counter, messages, 25)
+	assert.NoError(t, err)
+	assert.Equal(t, []chat.Message{messages[0], messages[3]}, truncated)
+
+	truncated, err = TruncateMessages(counter, messages, 15)
+	assert.NoError(t, err)
+	assert.Equal(t, "ccccc", truncated[1].Content)
+	assert.Equal(t, 15, CountMessages(counter, truncated))
+	assert.Equal(t, "cccccccc", messages[3].Content)
+
+	_, err = TruncateMessages(counter, messages, 10)
+	assert.ErrorIs(t, err, ErrPromptTooLong)
+}
+
+func TestTruncateMessages_ContentParts(t *testing.T) {
+	counter := &Approximate{CharsPerToken: 1}
+	message := chat.Message{Role: "user", ContentParts: []chat.ContentPart{{Text: "describe this image"}, {ImageUrl: "https://example.com/a.png"}}}
+
+	truncated, err := TruncateMessages(counter, []chat.Message{message}, 14)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "describe", truncated[0].ContentParts[0].Text)
+	assert.Equal(t, "https://example.com/a.png", truncated[0].ContentParts[1].ImageUrl)
+	assert.Equal(t, "describe this image", message.ContentParts[0].Text)
+}
@@ -0,0 +1,239 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// NewFunctionConfigFromStruct creates a function config whose parameters are the fields of a struct.
+// This allows to describe the arguments of a function with a Go type and to decode the arguments of a call into the same type.
+//
+// The fields are converted with the following rules:
+//   - The name is taken from the json tag. Fields tagged with json:"-" and unexported fields are skipped, and the fields of embedded structs are promoted.
+//   - Strings, booleans, integers and floats become "string", "boolean", "integer" and "number" parameters. time.Time becomes a "string".
+//   - Slices and arrays become "array" parameters with items, structs and maps become "object" parameters. Nested structs are converted recursively.
+//   - Fields are required unless they are pointers or their json tag has the omitempty option. The tag required:"true" or required:"false" overrides this.
+//   - The tags description, enum (comma separated), minimum, maximum and default set the matching settings of the parameter.
+//
+// Example:
+//
+//	type WeatherArgs struct {
+//		City string `json:"city" description:"The name of the city"`
+//		Unit string `json:"unit,omitempty" enum:"celsius,fahrenheit" default:"celsius"`
+//	}
+//
+//	function, err := tools.NewFunctionConfigFromStruct("get_weather", "Get the weather of a city", WeatherArgs{})
+//
+// Parameters:
+//   - name: The name of the function
+//   - description: The description of the function
+//   - v: A struct value, a pointer to a struct or a reflect.Type of a struct
+//
+// Returns:
+//   - The function config
+//   - An error if v isn't a struct or a field can't be converted
+func NewFunctionConfigFromStruct(name string, description string, v any) (FunctionConfig, error) {
+	if name == "" {
+		return FunctionConfig{}, errors.New("function name cannot be empty")
+	}
+
+	t, ok := v.(reflect.Type)
+	if !ok {
+		t = reflect.TypeOf(v)
+	}
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return FunctionConfig{}, fmt.Errorf("expected a struct, got %v", t)
+	}
+
+	params, err := structParameters(t, map[reflect.Type]bool{})
+	if err != nil {
+		return FunctionConfig{}, err
+	}
+	return FunctionConfig{Name: name, Description: description, Params: params}, nil
+}
+
+// NewSchemaFromType returns the JSON schema of a Go type. The same rules as in NewFunctionConfigFromStruct are applied, so the fields of structs become properties of an object schema.
+//
+// Parameters:
+//   - v: A value of the type, a pointer to it or its reflect.Type
+//
+// Returns:
+//   - The JSON schema
+//   - An error if the type can't be converted
+func NewSchemaFromType(v any) (map[string]any, error) {
+	t, ok := v.(reflect.Type)
+	if !ok {
+		t = reflect.TypeOf(v)
+	}
+	if t == nil {
+		return nil, errors.New("cannot create a schema for a nil value")
+	}
+
+	param, err := typeParameter(t, "", map[reflect.Type]bool{})
+	if err != nil {
+		return nil, err
+	}
+	schema := param.Schema()
+	if param.Type == "object" {
+		if _, ok := schema["properties"]; !ok && t.Kind() != reflect.Map {
+			schema["properties"] = map[string]any{}
+		}
+	}
+	return schema, nil
+}
+
+// structParameters converts the fields of a struct type to parameters. The visiting set detects recursive types.
+func structParameters(t reflect.Type, visiting map[reflect.Type]bool) ([]ParameterConfig, error) {
+	if visiting[t] {
+		return nil, fmt.Errorf("recursive type %v is not supported", t)
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	params := []ParameterConfig{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		jsonTag := field.Tag.Get("json")
+		if jsonTag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(jsonTag, ",")
+
+		fieldType := field.Type
+		if field.Anonymous && name == "" {
+			for fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				embedded, err := structParameters(fieldType, visiting)
+				if err != nil {
+					return nil, err
+				}
+				params = append(params, embedded...)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		param, err := typeParameter(field.Type, field.Tag, visiting)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		param.Name = name
+		param.Required = field.Type.Kind() != reflect.Pointer && !strings.Contains(","+options+",", ",omitempty,")
+		if required, ok := field.Tag.Lookup("required"); ok {
+			param.Required, err = strconv.ParseBool(required)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: invalid required tag: %w", field.Name, err)
+			}
+		}
+		params = append(params, param)
+	}
+	return params, nil
+}
+
+// typeParameter converts a type to a parameter. The tags of the struct field are applied if given.
+func typeParameter(t reflect.Type, tag reflect.StructTag, visiting map[reflect.Type]bool) (ParameterConfig, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	param := ParameterConfig{Description: tag.Get("description")}
+
+	switch {
+	case t == timeType:
+		param.Type = "string"
+	case t.Kind() == reflect.String:
+		param.Type = "string"
+	case t.Kind() == reflect.Bool:
+		param.Type = "boolean"
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		param.Type = "integer"
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		param.Type = "number"
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		param.Type = "array"
+		items, err := typeParameter(t.Elem(), "", visiting)
+		if err != nil {
+			return param, err
+		}
+		param.Items = &items
+	case t.Kind() == reflect.Map:
+		param.Type = "object"
+	case t.Kind() == reflect.Struct:
+		param.Type = "object"
+		properties, err := structParameters(t, visiting)
+		if err != nil {
+			return param, err
+		}
+		param.Properties = properties
+	case t.Kind() == reflect.Interface:
+		// Any value is accepted, so no type is set.
+	default:
+		return param, fmt.Errorf("unsupported type %v", t)
+	}
+
+	if enum := tag.Get("enum"); enum != "" {
+		param.Enum = strings.Split(enum, ",")
+	}
+	for _, bound := range []struct {
+		name   string
+		target **float64
+	}{{"minimum", &param.Minimum}, {"maximum", &param.Maximum}} {
+		value, ok := tag.Lookup(bound.name)
+		if !ok {
+			continue
+		}
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return param, fmt.Errorf("invalid %s tag: %w", bound.name, err)
+		}
+		*bound.target = &number
+	}
+	if value, ok := tag.Lookup("default"); ok {
+		param.Default = parseDefault(param.Type, value)
+	}
+	return param, nil
+}
+
+// parseDefault converts the default tag to the JSON value matching the parameter type. Values which can't be parsed are kept as strings.
+func parseDefault(paramType string, value string) any {
+	switch paramType {
+	case "string", "":
+		return value
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	case "integer":
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+	case "number":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	default:
+		var decoded any
+		if err := json.Unmarshal([]byte(value), &decoded); err == nil {
+			return decoded
+		}
+	}
+	return value
+}
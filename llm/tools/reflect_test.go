@@ -0,0 +1,92 @@
+package tools
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Address struct {
+	Street string `json:"street"`
+	City   string `json:"city" description:"The city"`
+}
+
+type Base struct {
+	ID string `json:"id"`
+}
+
+type OrderArgs struct {
+	Base
+	Customer  string            `json:"customer" description:"The customer name"`
+	Quantity  int               `json:"quantity" minimum:"1" maximum:"100" default:"1"`
+	Priority  string            `json:"priority,omitempty" enum:"low,high" default:"low"`
+	Express   *bool             `json:"express"`
+	Tags      []string          `json:"tags" required:"false"`
+	Address   Address           `json:"address"`
+	Discount  float64           `json:"discount,omitempty"`
+	Delivery  time.Time         `json:"delivery"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Internal  string            `json:"-"`
+	unexposed string
+}
+
+func TestNewFunctionConfigFromStruct(t *testing.T) {
+	function, err := NewFunctionConfigFromStruct("create_order", "Create an order", &OrderArgs{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "create_order", function.Name)
+	assert.Equal(t, "Create an order", function.Description)
+
+	params := map[string]ParameterConfig{}
+	names := []string{}
+	for _, param := range function.Params {
+		params[param.Name] = param
+		names = append(names, param.Name)
+	}
+	assert.Equal(t, []string{"id", "customer", "quantity", "priority", "express", "tags", "address", "discount", "delivery", "metadata"}, names)
+
+	assert.Equal(t, ParameterConfig{Name: "customer", Type: "string", Description: "The customer name", Required: true}, params["customer"])
+
+	quantity := params["quantity"]
+	assert.Equal(t, "integer", quantity.Type)
+	assert.Equal(t, 1.0, *quantity.Minimum)
+	assert.Equal(t, 100.0, *quantity.Maximum)
+	assert.Equal(t, int64(1), quantity.Default)
+
+	assert.Equal(t, []string{"low", "high"}, params["priority"].Enum)
+	assert.False(t, params["priority"].Required)
+	assert.Equal(t, "boolean", params["express"].Type)
+	assert.False(t, params["express"].Required)
+	assert.False(t, params["tags"].Required)
+	assert.Equal(t, "string", params["tags"].Items.Type)
+	assert.Equal(t, "number", params["discount"].Type)
+	assert.Equal(t, "string", params["delivery"].Type)
+	assert.Equal(t, "object", params["metadata"].Type)
+
+	address := params["address"]
+	assert.Equal(t, "object", address.Type)
+	assert.Len(t, address.Properties, 2)
+	assert.Equal(t, "The city", address.Properties[1].Description)
+	assert.True(t, address.Properties[1].Required)
+}
+
+type Node struct {
+	Children []Node `json:"children"`
+}
+
+func TestNewFunctionConfigFromStruct_Errors(t *testing.T) {
+	_, err := NewFunctionConfigFromStruct("", "", OrderArgs{})
+	assert.Error(t, err)
+
+	_, err = NewFunctionConfigFromStruct("f", "", "not a struct")
+	assert.Error(t, err)
+
+	_, err = NewFunctionConfigFromStruct("f", "", Node{})
+	assert.ErrorContains(t, err, "recursive type")
+
+	_, err = NewFunctionConfigFromStruct("f", "", struct {
+		Callback func() `json:"callback"`
+	}{})
+	assert.ErrorContains(t, err, "unsupported type")
+}
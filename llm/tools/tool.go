@@ -0,0 +1,45 @@
+package tools
+
+import (
+	"context"
+	"errors"
+)
+
+// ToolHandler executes a tool call. It receives the arguments chosen by the model and returns the result which is sent back to the model.
+type ToolHandler func(ctx context.Context, arguments map[string]any) (string, error)
+
+// Tool binds a function definition to the Go handler which executes it.
+// The Function is sent to the model, and when the model calls the function the Handler is invoked with the arguments of the call.
+type Tool struct {
+	Function FunctionConfig
+	Handler  ToolHandler
+}
+
+// NewTool creates a new tool from the function definition and its handler.
+func NewTool(function FunctionConfig, handler ToolHandler) *Tool {
+	return &Tool{Function: function, Handler: handler}
+}
+
+// Name returns the name of the tool function.
+func (tool *Tool) Name() string {
+	return tool.Function.Name
+}
+
+// Call invokes the handler of the tool with the given arguments.
+//
+// Parameters:
+//   - ctx: The context of the call
+//   - arguments: The arguments of the call. A nil map is replaced by an empty one.
+//
+// Returns:
+//   - The result of the handler
+//   - An error if the tool has no handler or the handler fails
+func (tool *Tool) Call(ctx context.Context, arguments map[string]any) (string, error) {
+	if tool.Handler == nil {
+		return "", errors.New("no handler set for tool " + tool.Function.Name)
+	}
+	if arguments == nil {
+		arguments = map[string]any{}
+	}
+	return tool.Handler(ctx, arguments)
+}
@@ -6,6 +6,16 @@ type ParameterConfig struct {
 	Description string   `json:"description,omitempty" mapstructure:"description"`
 	Required    bool     `json:"required,omitempty" mapstructure:"required"`
 	Enum        []string `json:"enum,omitempty" mapstructure:"enum"`
+
+	// Properties contains the properties of a parameter of type "object". The Required field of a property marks it as required within the object.
+	Properties []ParameterConfig `json:"properties,omitempty" mapstructure:"properties"`
+	// Items describes the elements of a parameter of type "array". The name of the items is ignored.
+	Items *ParameterConfig `json:"items,omitempty" mapstructure:"items"`
+	// Minimum and Maximum are the inclusive bounds of a numeric parameter.
+	Minimum *float64 `json:"minimum,omitempty" mapstructure:"minimum"`
+	Maximum *float64 `json:"maximum,omitempty" mapstructure:"maximum"`
+	// Default is the value used when the parameter isn't provided.
+	Default any `json:"default,omitempty" mapstructure:"default"`
 }
 
 type FunctionConfig struct {
@@ -56,3 +66,62 @@ func NewOptionalParameter(name string, paramType string, description string) Par
 func NewRequiredParameter(name string, paramType string, description string) ParameterConfig {
 	return NewParameter(name, paramType, description, true, nil)
 }
+
+// Schema returns the JSON schema of the parameter. Nested properties and array items are converted recursively.
+func (param *ParameterConfig) Schema() map[string]any {
+	schema := map[string]any{}
+	if param.Type != "" {
+		schema["type"] = param.Type
+	}
+	if param.Description != "" {
+		schema["description"] = param.Description
+	}
+	if len(param.Enum) > 0 {
+		schema["enum"] = param.Enum
+	}
+	if len(param.Properties) > 0 {
+		properties, required := propertiesSchema(param.Properties)
+		schema["properties"] = properties
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+	}
+	if param.Items != nil {
+		schema["items"] = param.Items.Schema()
+	}
+	if param.Minimum != nil {
+		schema["minimum"] = *param.Minimum
+	}
+	if param.Maximum != nil {
+		schema["maximum"] = *param.Maximum
+	}
+	if param.Default != nil {
+		schema["default"] = param.Default
+	}
+	return schema
+}
+
+// ParametersSchema returns the JSON schema of the function parameters. It's an object schema with one property per parameter and the names of the required parameters in its "required" list.
+func (funcConfig *FunctionConfig) ParametersSchema() map[string]any {
+	properties, required := propertiesSchema(funcConfig.Params)
+	schema := map[string]any{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func propertiesSchema(params []ParameterConfig) (map[string]any, []string) {
+	properties := make(map[string]any, len(params))
+	required := []string{}
+	for i := range params {
+		properties[params[i].Name] = params[i].Schema()
+		if params[i].Required {
+			required = append(required, params[i].Name)
+		}
+	}
+	return properties, required
+}
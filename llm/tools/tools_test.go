@@ -38,3 +38,53 @@ func TestNewParameter(t *testing.T) {
 	})
 
 }
+
+func TestParametersSchema(t *testing.T) {
+	minimum := 1.0
+	function := NewFunctionConfig("create_order", "Create an order",
+		NewRequiredParameter("customer", "string", "The customer"),
+		ParameterConfig{
+			Name:     "items",
+			Type:     "array",
+			Required: true,
+			Items: &ParameterConfig{
+				Type: "object",
+				Properties: []ParameterConfig{
+					NewRequiredParameter("sku", "string", ""),
+					{Name: "quantity", Type: "integer", Minimum: &minimum, Default: 1},
+				},
+			},
+		},
+		NewOptionalParameter("note", "string", "A note"),
+	)
+
+	schema := function.ParametersSchema()
+
+	assert.Equal(t, map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"customer": map[string]any{"type": "string", "description": "The customer"},
+			"items": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"sku":      map[string]any{"type": "string"},
+						"quantity": map[string]any{"type": "integer", "minimum": 1.0, "default": 1},
+					},
+					"required": []string{"sku"},
+				},
+			},
+			"note": map[string]any{"type": "string", "description": "A note"},
+		},
+		"required": []string{"customer", "items"},
+	}, schema)
+}
+
+func TestParametersSchema_NoRequired(t *testing.T) {
+	function := NewFunctionConfig("ping", "Ping")
+
+	schema := function.ParametersSchema()
+
+	assert.Equal(t, map[string]any{"type": "object", "properties": map[string]any{}}, schema)
+}
@@ -0,0 +1,354 @@
+package anyi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jieliu2000/anyi/flow"
+	"github.com/jieliu2000/anyi/internal/expr"
+)
+
+const (
+	// DefaultForEachItemVariable is the name of the variable which receives the current element if ItemVariable is not set.
+	DefaultForEachItemVariable = "item"
+	// DefaultForEachIndexVariable is the name of the variable which receives the index of the current element if IndexVariable is not set.
+	DefaultForEachIndexVariable = "index"
+	// DefaultForEachResultVariable is the name of the variable which receives the outputs if ResultVariable is not set.
+	DefaultForEachResultVariable = "results"
+
+	// DefaultWhileMaxIterations is the maximum number of iterations of a while step if MaxIterations is not set.
+	DefaultWhileMaxIterations = 10
+	// DefaultWhileIterationVariable is the name of the variable which receives the iteration number if IterationVariable is not set.
+	DefaultWhileIterationVariable = "iteration"
+)
+
+// ForEachExecutor is an executor that runs a flow for each element of a list, like a map function.
+// The list is read from the variable named by Items. If Items is empty, the Text of the flow context is parsed as a JSON array.
+//
+// Each run of the flow receives a copy of the flow context in which Text is the element (JSON encoded if it isn't a string), and the variables named by ItemVariable and IndexVariable hold the element and its index.
+// Up to MaxParallelism elements are processed at the same time. The output texts of the runs are stored in order as []string in the variable named by ResultVariable, and Text is set to the same list encoded as a JSON array.
+// If a run fails, the remaining runs are cancelled and the error is returned.
+//
+// Example usage in configuration:
+//
+//	{
+//	  "type": "foreach",
+//	  "withconfig": {
+//	    "flow": "summarize",
+//	    "items": "documents",
+//	    "maxParallelism": 4,
+//	    "resultVariable": "summaries"
+//	  }
+//	}
+type ForEachExecutor struct {
+	// The name of the flow to run for each element
+	Flow string `json:"flow" yaml:"flow" mapstructure:"flow"`
+	// FlowImpl is the flow to run. It's used instead of looking up Flow in the registry.
+	FlowImpl *flow.Flow `json:"-" yaml:"-" mapstructure:"-"`
+
+	// The name of the variable holding the list. The variable can hold a slice, an array or a JSON array string.
+	Items          string `json:"items" yaml:"items" mapstructure:"items"`
+	ItemVariable   string `json:"itemVariable" yaml:"itemVariable" mapstructure:"itemVariable"`
+	IndexVariable  string `json:"indexVariable" yaml:"indexVariable" mapstructure:"indexVariable"`
+	ResultVariable string `json:"resultVariable" yaml:"resultVariable" mapstructure:"resultVariable"`
+	// The maximum number of elements processed at the same time. Values below 1 process the elements one after another.
+	MaxParallelism int `json:"maxParallelism" yaml:"maxParallelism" mapstructure:"maxParallelism"`
+}
+
+// Init checks that a flow is set and applies the default variable names.
+// The flow is looked up when the step runs, so it can be registered after the executor is created.
+func (executor *ForEachExecutor) Init() error {
+	if executor.Flow == "" && executor.FlowImpl == nil {
+		return errors.New("flow is not set")
+	}
+	if executor.ItemVariable == "" {
+		executor.ItemVariable = DefaultForEachItemVariable
+	}
+	if executor.IndexVariable == "" {
+		executor.IndexVariable = DefaultForEachIndexVariable
+	}
+	if executor.ResultVariable == "" {
+		executor.ResultVariable = DefaultForEachResultVariable
+	}
+	if executor.MaxParallelism < 1 {
+		executor.MaxParallelism = 1
+	}
+	return nil
+}
+
+// Run runs the flow for each element. See RunContext for details.
+func (executor *ForEachExecutor) Run(flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
+	return executor.RunContext(context.Background(), flowContext, step)
+}
+
+// RunContext runs the flow for each element with the given context.
+//
+// Parameters:
+//   - ctx: The context of the execution
+//   - flowContext: The flow context containing the list
+//   - step: The current workflow step
+//
+// Returns:
+//   - The flow context with the collected outputs
+//   - An error if the list cannot be read, the flow is not found or a run fails
+func (executor *ForEachExecutor) RunContext(ctx context.Context, flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
+	if executor.MaxParallelism < 1 || executor.ItemVariable == "" || executor.IndexVariable == "" || executor.ResultVariable == "" {
+		if err := executor.Init(); err != nil {
+			return nil, err
+		}
+	}
+	subFlow, err := resolveFlow(executor.Flow, executor.FlowImpl)
+	if err != nil {
+		return nil, err
+	}
+	items, err := executor.items(flowContext)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type itemResult struct {
+		index int
+		text  string
+		err   error
+	}
+
+	results := make([]string, len(items))
+	finished := make(chan itemResult)
+	next, running := 0, 0
+	var firstErr error
+	for next < len(items) || running > 0 {
+		for firstErr == nil && running < executor.MaxParallelism && next < len(items) {
+			input := flowContext
+			input.Variables = copyVariables(flowContext.Variables)
+			input.Variables[executor.ItemVariable] = items[next]
+			input.Variables[executor.IndexVariable] = next
+			// The runs of the flow get their own RunID, so they don't overwrite the checkpoint of this run
+			input.RunID = ""
+			input.Text, err = itemText(items[next])
+			if err != nil {
+				firstErr = err
+				break
+			}
+
+			running++
+			go func(index int, input flow.FlowContext) {
+				// Each run gets its own copy, so concurrent runs don't share the variables of the flow
+				output, err := subFlow.Clone().RunContext(ctx, input)
+				result := itemResult{index: index, err: err}
+				if output != nil {
+					result.text = output.Text
+				}
+				finished <- result
+			}(next, input)
+			next++
+		}
+		if running == 0 {
+			break
+		}
+
+		result := <-finished
+		running--
+		if result.err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("element %d: %w", result.index, result.err)
+			cancel()
+		}
+		results[result.index] = result.text
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	text, err := json.Marshal(results)
+	if err != nil {
+		return nil, err
+	}
+	flowContext.SetVariable(executor.ResultVariable, results)
+	flowContext.Text = string(text)
+	return &flowContext, nil
+}
+
+// items returns the elements of the list variable, or of the JSON array in Text if Items is not set.
+func (executor *ForEachExecutor) items(flowContext flow.FlowContext) ([]any, error) {
+	var value any = flowContext.Text
+	if executor.Items != "" {
+		value = flowContext.GetVariable(executor.Items)
+		if value == nil {
+			return nil, fmt.Errorf("variable %s is not set", executor.Items)
+		}
+	}
+
+	if text, ok := value.(string); ok {
+		var items []any
+		if err := json.Unmarshal([]byte(text), &items); err != nil {
+			return nil, fmt.Errorf("items are not a JSON array: %w", err)
+		}
+		return items, nil
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("variable %s is not a list", executor.Items)
+	}
+	items := make([]any, v.Len())
+	for i := range items {
+		items[i] = v.Index(i).Interface()
+	}
+	return items, nil
+}
+
+// itemText converts an element to the input text of a run. Strings are used as they are, other values are JSON encoded.
+func itemText(item any) (string, error) {
+	if text, ok := item.(string); ok {
+		return text, nil
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// WhileExecutor is an executor that runs a flow repeatedly while a condition is true.
+// The condition is an expression evaluated on the flow context before each iteration, see NewExpressionEnv for the available names. Each iteration receives the output of the previous one, and the number of the iteration, starting with 0, is available in the variable named by IterationVariable.
+// The loop also stops after MaxIterations iterations. Reaching the limit is not an error, the output of the last iteration is returned.
+//
+// Example usage in configuration:
+//
+//	{
+//	  "type": "while",
+//	  "withconfig": {
+//	    "flow": "revise",
+//	    "condition": "Variables.approved != true",
+//	    "maxIterations": 5
+//	  }
+//	}
+type WhileExecutor struct {
+	// The name of the flow to run in each iteration
+	Flow string `json:"flow" yaml:"flow" mapstructure:"flow"`
+	// FlowImpl is the flow to run. It's used instead of looking up Flow in the registry.
+	FlowImpl *flow.Flow `json:"-" yaml:"-" mapstructure:"-"`
+
+	Condition         string `json:"condition" yaml:"condition" mapstructure:"condition"`
+	MaxIterations     int    `json:"maxIterations" yaml:"maxIterations" mapstructure:"maxIterations"`
+	IterationVariable string `json:"iterationVariable" yaml:"iterationVariable" mapstructure:"iterationVariable"`
+
+	condition *expr.Expression
+}
+
+// Init compiles the condition and applies the default settings.
+// The flow is looked up when the step runs, so it can be registered after the executor is created.
+//
+// Returns:
+//   - An error if no flow or condition is set, or the condition is not a valid expression
+func (executor *WhileExecutor) Init() error {
+	if executor.Flow == "" && executor.FlowImpl == nil {
+		return errors.New("flow is not set")
+	}
+	if executor.Condition == "" {
+		return errors.New("condition is not set")
+	}
+	condition, err := expr.Compile(executor.Condition)
+	if err != nil {
+		return fmt.Errorf("invalid condition %q: %w", executor.Condition, err)
+	}
+	executor.condition = condition
+
+	if executor.MaxIterations <= 0 {
+		executor.MaxIterations = DefaultWhileMaxIterations
+	}
+	if executor.IterationVariable == "" {
+		executor.IterationVariable = DefaultWhileIterationVariable
+	}
+	return nil
+}
+
+// Run runs the loop. See RunContext for details.
+func (executor *WhileExecutor) Run(flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
+	return executor.RunContext(context.Background(), flowContext, step)
+}
+
+// RunContext runs the loop with the given context.
+//
+// Parameters:
+//   - ctx: The context of the execution
+//   - flowContext: The flow context the first iteration receives
+//   - step: The current workflow step
+//
+// Returns:
+//   - The flow context after the last iteration, or the unchanged flow context if the condition is false from the start
+//   - An error if the condition cannot be evaluated, the flow is not found or an iteration fails
+func (executor *WhileExecutor) RunContext(ctx context.Context, flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
+	if executor.condition == nil {
+		if err := executor.Init(); err != nil {
+			return nil, err
+		}
+	}
+	subFlow, err := resolveFlow(executor.Flow, executor.FlowImpl)
+	if err != nil {
+		return nil, err
+	}
+
+	parentFlow := flowContext.Flow
+	current := &flowContext
+	for iteration := 0; ; iteration++ {
+		current.SetVariable(executor.IterationVariable, iteration)
+		proceed, err := executor.condition.EvalBool(NewExpressionEnv(*current))
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate condition %q: %w", executor.Condition, err)
+		}
+		if !proceed {
+			break
+		}
+		if iteration >= executor.MaxIterations {
+			log.Warnf("While loop stopped after %d iterations, condition %q is still true", executor.MaxIterations, executor.Condition)
+			break
+		}
+
+		// Each iteration runs a copy of the flow with its own RunID, so the runs change neither the variables of the shared flow nor the checkpoint of this run
+		input := *current
+		input.RunID = ""
+		current, err = subFlow.Clone().RunContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+	}
+	current.Flow = parentFlow
+	current.RunID = flowContext.RunID
+	return current, nil
+}
+
+// NewExpressionEnv returns the names available in condition expressions for a flow context:
+// Text, Variables, Memory, Think and ImageURLs hold the fields of the flow context with the same names.
+func NewExpressionEnv(flowContext flow.FlowContext) map[string]any {
+	return map[string]any{
+		"Text":      flowContext.Text,
+		"Variables": flowContext.Variables,
+		"Memory":    flowContext.Memory,
+		"Think":     flowContext.Think,
+		"ImageURLs": flowContext.ImageURLs,
+	}
+}
+
+// resolveFlow returns the flow if it's set, otherwise the registered flow with the name.
+func resolveFlow(name string, flowImpl *flow.Flow) (*flow.Flow, error) {
+	if flowImpl != nil {
+		return flowImpl, nil
+	}
+	return GetFlow(name)
+}
+
+func copyVariables(variables map[string]any) map[string]any {
+	copied := make(map[string]any, len(variables)+2)
+	for k, v := range variables {
+		copied[k] = v
+	}
+	return copied
+}
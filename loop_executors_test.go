@@ -0,0 +1,275 @@
+package anyi
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jieliu2000/anyi/flow"
+	"github.com/jieliu2000/anyi/llm"
+	"github.com/jieliu2000/anyi/llm/chat"
+	"github.com/jieliu2000/anyi/llm/tools"
+	"github.com/jieliu2000/anyi/rag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// funcExecutor is an executor which runs a function.
+type funcExecutor func(flowContext flow.FlowContext) (*flow.FlowContext, error)
+
+func (f funcExecutor) Init() error { return nil }
+
+func (f funcExecutor) Run(flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
+	return f(flowContext)
+}
+
+// resetRegistry replaces the global registry with an empty one and registers the built-in executors and validators.
+func resetRegistry() {
+	GlobalRegistry = &anyiRegistry{
+		Clients:    make(map[string]llm.Client),
+		Flows:      make(map[string]*flow.Flow),
+		Validators: make(map[string]flow.StepValidator),
+		Executors:  make(map[string]flow.StepExecutor),
+		Formatters: make(map[string]chat.PromptFormatter),
+		Tools:      make(map[string]*tools.Tool),
+
+		ApprovalHandlers: make(map[string]ApprovalHandler),
+		Retrievers:       make(map[string]*rag.Retriever),
+	}
+	Init()
+}
+
+func newFuncFlow(t *testing.T, name string, run funcExecutor) *flow.Flow {
+	f, err := flow.NewFlow(nil, name, *flow.NewStep(run, nil, nil))
+	require.NoError(t, err)
+	return f
+}
+
+func TestForEachExecutor_Variable(t *testing.T) {
+	upper := newFuncFlow(t, "upper", func(flowContext flow.FlowContext) (*flow.FlowContext, error) {
+		flowContext.Text = strings.ToUpper(flowContext.Text) + flowContext.GetVariableString("suffix", "")
+		return &flowContext, nil
+	})
+	executor := &ForEachExecutor{FlowImpl: upper, Items: "docs"}
+	require.NoError(t, executor.Init())
+
+	result, err := executor.Run(flow.FlowContext{Variables: map[string]any{"docs": []string{"a", "b", "c"}, "suffix": "!"}}, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A!", "B!", "C!"}, result.Variables["results"])
+	assert.Equal(t, `["A!","B!","C!"]`, result.Text)
+}
+
+func TestForEachExecutor_JSONTextAndItemVariables(t *testing.T) {
+	describe := newFuncFlow(t, "describe", func(flowContext flow.FlowContext) (*flow.FlowContext, error) {
+		item := flowContext.Variables["task"].(map[string]any)
+		flowContext.Text = item["name"].(string) + "@" + string(rune('0'+flowContext.Variables["i"].(int))) + ":" + flowContext.Text
+		return &flowContext, nil
+	})
+	executor := &ForEachExecutor{FlowImpl: describe, ItemVariable: "task", IndexVariable: "i", ResultVariable: "out"}
+	require.NoError(t, executor.Init())
+
+	result, err := executor.Run(flow.FlowContext{Text: `[{"name":"x"},{"name":"y"}]`}, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{`x@0:{"name":"x"}`, `y@1:{"name":"y"}`}, result.Variables["out"])
+}
+
+func TestForEachExecutor_MaxParallelism(t *testing.T) {
+	var running, maxRunning int32
+	slow := newFuncFlow(t, "slow", func(flowContext flow.FlowContext) (*flow.FlowContext, error) {
+		current := atomic.AddInt32(&running, 1)
+		for {
+			observed := atomic.LoadInt32(&maxRunning)
+			if current <= observed || atomic.CompareAndSwapInt32(&maxRunning, observed, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return &flowContext, nil
+	})
+	executor := &ForEachExecutor{FlowImpl: slow, MaxParallelism: 3}
+	require.NoError(t, executor.Init())
+
+	result, err := executor.Run(flow.FlowContext{Text: `[1, 2, 3, 4, 5, 6]`}, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), maxRunning)
+	assert.Equal(t, []string{"1", "2", "3", "4", "5", "6"}, result.Variables["results"])
+}
+
+func TestForEachExecutor_Errors(t *testing.T) {
+	failing := newFuncFlow(t, "failing", func(flowContext flow.FlowContext) (*flow.FlowContext, error) {
+		if flowContext.Text == "bad" {
+			return nil, errors.New("boom")
+		}
+		return &flowContext, nil
+	})
+
+	executor := &ForEachExecutor{FlowImpl: failing}
+	require.NoError(t, executor.Init())
+	_, err := executor.Run(flow.FlowContext{Text: `["good", "bad"]`}, nil)
+	assert.EqualError(t, err, "element 1: boom")
+
+	_, err = executor.Run(flow.FlowContext{Text: "not json"}, nil)
+	assert.ErrorContains(t, err, "items are not a JSON array")
+
+	executor.Items = "missing"
+	_, err = executor.Run(flow.FlowContext{}, nil)
+	assert.EqualError(t, err, "variable missing is not set")
+
+	assert.EqualError(t, (&ForEachExecutor{}).Init(), "flow is not set")
+}
+
+func TestForEachExecutor_WithoutInit(t *testing.T) {
+	echo := newFuncFlow(t, "echo", func(flowContext flow.FlowContext) (*flow.FlowContext, error) {
+		flowContext.Text += flowContext.GetVariableString("item", "")
+		return &flowContext, nil
+	})
+	executor := &ForEachExecutor{FlowImpl: echo}
+
+	result, err := executor.Run(flow.FlowContext{Text: `["a", "b"]`}, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"aa", "bb"}, result.Variables[DefaultForEachResultVariable])
+}
+
+func TestForEachExecutor_DoesNotShareFlowVariables(t *testing.T) {
+	shared := newFuncFlow(t, "shared", func(flowContext flow.FlowContext) (*flow.FlowContext, error) {
+		time.Sleep(5 * time.Millisecond)
+		flowContext.Text = flowContext.GetVariableString("item", "")
+		return &flowContext, nil
+	})
+	executor := &ForEachExecutor{FlowImpl: shared, MaxParallelism: 4}
+
+	result, err := executor.Run(flow.FlowContext{Text: `["a", "b", "c", "d"]`}, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "d"}, result.Variables["results"])
+	assert.NotContains(t, shared.Variables, "item")
+	assert.NotContains(t, shared.Variables, "index")
+}
+
+func TestForEachExecutor_FromConfig(t *testing.T) {
+	resetRegistry()
+	RegisterFlow("foreach-echo", newFuncFlow(t, "foreach-echo", func(flowContext flow.FlowContext) (*flow.FlowContext, error) {
+		flowContext.Text = "<" + flowContext.Text + ">"
+		return &flowContext, nil
+	}))
+
+	executor, err := NewExecutorFromConfig(&ExecutorConfig{
+		Type:       "map",
+		WithConfig: map[string]interface{}{"flow": "foreach-echo", "items": "list", "maxParallelism": 2},
+	})
+	require.NoError(t, err)
+
+	result, err := executor.Run(flow.FlowContext{Variables: map[string]any{"list": `["a", "b"]`}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"<a>", "<b>"}, result.Variables["results"])
+}
+
+func TestWhileExecutor(t *testing.T) {
+	revise := newFuncFlow(t, "revise", func(flowContext flow.FlowContext) (*flow.FlowContext, error) {
+		flowContext.Text += "+"
+		flowContext.SetVariable("score", flowContext.GetVariableInt("score", 0)+30)
+		return &flowContext, nil
+	})
+	executor := &WhileExecutor{FlowImpl: revise, Condition: "Variables.score < 80"}
+	require.NoError(t, executor.Init())
+
+	parent := &flow.Flow{Name: "parent"}
+	result, err := executor.Run(flow.FlowContext{Text: "draft", Flow: parent, Variables: map[string]any{"score": 0}}, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, "draft+++", result.Text)
+	assert.Equal(t, 90, result.Variables["score"])
+	assert.Equal(t, 3, result.Variables["iteration"])
+	assert.Same(t, parent, result.Flow)
+}
+
+func TestWhileExecutor_MaxIterations(t *testing.T) {
+	runs := 0
+	loop := newFuncFlow(t, "loop", func(flowContext flow.FlowContext) (*flow.FlowContext, error) {
+		runs++
+		return &flowContext, nil
+	})
+	executor := &WhileExecutor{FlowImpl: loop, Condition: "true", MaxIterations: 4}
+	require.NoError(t, executor.Init())
+
+	_, err := executor.Run(flow.FlowContext{}, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, 4, runs)
+}
+
+func TestWhileExecutor_Errors(t *testing.T) {
+	loop := newFuncFlow(t, "loop", func(flowContext flow.FlowContext) (*flow.FlowContext, error) {
+		return nil, errors.New("boom")
+	})
+
+	assert.EqualError(t, (&WhileExecutor{FlowImpl: loop}).Init(), "condition is not set")
+	assert.ErrorContains(t, (&WhileExecutor{FlowImpl: loop, Condition: "a =="}).Init(), `invalid condition "a =="`)
+
+	executor := &WhileExecutor{FlowImpl: loop, Condition: "unknown"}
+	require.NoError(t, executor.Init())
+	_, err := executor.Run(flow.FlowContext{}, nil)
+	assert.EqualError(t, err, `failed to evaluate condition "unknown": unknown identifier unknown`)
+
+	executor = &WhileExecutor{FlowImpl: loop, Condition: "Text == ''"}
+	require.NoError(t, executor.Init())
+	_, err = executor.Run(flow.FlowContext{}, nil)
+	assert.EqualError(t, err, "boom")
+}
+
+func TestWhileExecutor_NestedCheckpoints(t *testing.T) {
+	store := flow.NewMemoryCheckpointStore()
+	failed := false
+	child := newFuncFlow(t, "child", func(flowContext flow.FlowContext) (*flow.FlowContext, error) {
+		if !failed {
+			failed = true
+			return nil, errors.New("boom")
+		}
+		flowContext.Text += "+"
+		return &flowContext, nil
+	})
+	child.Checkpoints = store
+	executor := &WhileExecutor{FlowImpl: child, Condition: "Text == 'draft'"}
+	require.NoError(t, executor.Init())
+	parent, err := flow.NewFlow(nil, "parent", *flow.NewStep(executor, nil, nil))
+	require.NoError(t, err)
+	parent.Checkpoints = store
+
+	_, err = parent.Run(flow.FlowContext{Text: "draft"})
+
+	var runErr *flow.RunError
+	require.ErrorAs(t, err, &runErr)
+	assert.EqualError(t, err, "run "+runErr.RunID+" failed: boom")
+	checkpoint, err := store.Load(runErr.RunID)
+	require.NoError(t, err)
+	assert.Equal(t, "parent", checkpoint.FlowName)
+
+	result, err := parent.Resume(runErr.RunID)
+	require.NoError(t, err)
+	assert.Equal(t, "draft+", result.Text)
+	assert.Equal(t, runErr.RunID, result.RunID)
+}
+
+func TestWhileExecutor_DoesNotShareFlowVariables(t *testing.T) {
+	shared := newFuncFlow(t, "shared", func(flowContext flow.FlowContext) (*flow.FlowContext, error) {
+		flowContext.Text += "+"
+		flowContext.SetVariable("draft", flowContext.Text)
+		return &flowContext, nil
+	})
+	executor := &WhileExecutor{FlowImpl: shared, Condition: "Text != 'a++'"}
+	require.NoError(t, executor.Init())
+
+	result, err := executor.Run(flow.FlowContext{Text: "a"}, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, "a++", result.Variables["draft"])
+	assert.NotContains(t, shared.Variables, "draft")
+	assert.NotContains(t, shared.Variables, "iteration")
+}
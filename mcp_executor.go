@@ -284,47 +284,36 @@ func (executor *MCPExecutor) resolveServerConfig() (*MCPServerConfig, error) {
 		return nil, errors.New("no server configuration provided (use 'preset' for quick setup or 'server' for custom configuration)")
 	}
 
-	// Resolve environment variables in configuration
+	return resolveServerVariables(config), nil
+}
+
+// resolveServerVariables returns a copy of the server configuration with the environment variables in the env, headers and url resolved. The configuration itself is not changed, so it can be shared by concurrent runs.
+func resolveServerVariables(config *MCPServerConfig) *MCPServerConfig {
+	resolved := *config
 	if config.Env != nil {
+		resolved.Env = make(map[string]string, len(config.Env))
 		for key, value := range config.Env {
-			config.Env[key] = resolveEnvironmentVariables(value)
+			resolved.Env[key] = resolveEnvironmentVariables(value)
 		}
 	}
 
 	if config.Headers != nil {
+		resolved.Headers = make(map[string]string, len(config.Headers))
 		for key, value := range config.Headers {
-			config.Headers[key] = resolveEnvironmentVariables(value)
+			resolved.Headers[key] = resolveEnvironmentVariables(value)
 		}
 	}
 
 	if config.URL != "" {
-		config.URL = resolveEnvironmentVariables(config.URL)
+		resolved.URL = resolveEnvironmentVariables(config.URL)
 	}
-
-	return config, nil
+	return &resolved
 }
 
 // validateConfig validates the resolved server configuration
 func (executor *MCPExecutor) validateConfig(config *MCPServerConfig) error {
-	if config == nil {
-		return errors.New("server configuration is required")
-	}
-
-	// Validate transport type
-	if config.Type != TransportHTTP && config.Type != TransportSSE && config.Type != TransportSTDIO {
-		return fmt.Errorf("invalid transport type: %s (must be 'http', 'sse', or 'stdio')", config.Type)
-	}
-
-	// Validate transport-specific configuration
-	switch config.Type {
-	case TransportSTDIO:
-		if config.Command == "" {
-			return errors.New("command is required for stdio transport")
-		}
-	case TransportHTTP, TransportSSE:
-		if config.URL == "" {
-			return errors.New("url is required for http/sse transport")
-		}
+	if err := validateServerConfig(config); err != nil {
+		return err
 	}
 
 	// Validate action if specified
@@ -360,8 +349,44 @@ func (executor *MCPExecutor) validateConfig(config *MCPServerConfig) error {
 	return nil
 }
 
+// validateServerConfig validates the transport settings of a server configuration
+func validateServerConfig(config *MCPServerConfig) error {
+	if config == nil {
+		return errors.New("server configuration is required")
+	}
+
+	// Validate transport type
+	if config.Type != TransportHTTP && config.Type != TransportSSE && config.Type != TransportSTDIO {
+		return fmt.Errorf("invalid transport type: %s (must be 'http', 'sse', or 'stdio')", config.Type)
+	}
+
+	// Validate transport-specific configuration
+	switch config.Type {
+	case TransportSTDIO:
+		if config.Command == "" {
+			return errors.New("command is required for stdio transport")
+		}
+	case TransportHTTP, TransportSSE:
+		if config.URL == "" {
+			return errors.New("url is required for http/sse transport")
+		}
+	}
+
+	return nil
+}
+
 // createClient creates the appropriate MCP client based on transport type
 func (executor *MCPExecutor) createClient(config *MCPServerConfig) (MCPClient, error) {
+	return NewMCPClient(config)
+}
+
+// NewMCPClient creates the MCP client matching the transport of the server configuration.
+// The client isn't connected yet, call Initialize before using it.
+func NewMCPClient(config *MCPServerConfig) (MCPClient, error) {
+	if config == nil {
+		return nil, errors.New("server configuration is required")
+	}
+
 	switch config.Type {
 	case TransportHTTP:
 		apiKey := ""
@@ -407,13 +432,22 @@ func (executor *MCPExecutor) setDefaults() {
 
 // Run executes the MCP operation
 func (executor *MCPExecutor) Run(flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
+	return executor.RunContext(context.Background(), flowContext, step)
+}
+
+// RunContext executes the MCP operation with the given context.
+// The configured Timeout is applied on top of the context, and cancelling the context aborts the running call and any pending retries.
+func (executor *MCPExecutor) RunContext(parent context.Context, flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
 	if !executor.initialized {
 		if err := executor.Init(); err != nil {
 			return &flowContext, err
 		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), executor.Timeout)
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(parent, executor.Timeout)
 	defer cancel()
 
 	// Initialize client if needed
@@ -431,10 +465,17 @@ func (executor *MCPExecutor) Run(flowContext flow.FlowContext, step *flow.Step)
 			break
 		}
 
+		if ctx.Err() != nil {
+			break
+		}
+
 		if attempt < executor.RetryAttempts-1 {
 			log.Printf("MCP operation failed (attempt %d/%d): %v, retrying...",
 				attempt+1, executor.RetryAttempts, err)
-			time.Sleep(time.Duration(attempt+1) * time.Second)
+			select {
+			case <-time.After(time.Duration(attempt+1) * time.Second):
+			case <-ctx.Done():
+			}
 		}
 	}
 
@@ -0,0 +1,241 @@
+package anyi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jieliu2000/anyi/llm/tools"
+)
+
+// MCPToolApprover decides whether a tool call chosen by the model may be sent to an MCP server.
+// It's consulted for servers whose AutoApprove setting is false. Returning false denies the call, and the denial is reported to the model as the result of the call.
+type MCPToolApprover func(ctx context.Context, server string, tool string, arguments map[string]any) bool
+
+// MCPToolInfo describes a tool listed by an MCP server.
+type MCPToolInfo struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"inputSchema,omitempty"`
+}
+
+// ListMCPTools lists the tools of an MCP server.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - client: An initialized MCP client
+//
+// Returns:
+//   - The tools of the server
+//   - An error if the request fails or the server returns an error
+func ListMCPTools(ctx context.Context, client MCPClient) ([]MCPToolInfo, error) {
+	response, err := client.ListTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if response.Error != nil {
+		return nil, fmt.Errorf("MCP error %d: %s", response.Error.Code, response.Error.Message)
+	}
+
+	data, err := json.Marshal(response.Result)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Tools []MCPToolInfo `json:"tools"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse tool list: %w", err)
+	}
+	return result.Tools, nil
+}
+
+// MCPTools returns the tools of an MCP server as tools the model can call.
+// The input schema of every tool is converted to a function definition, and the handler of the returned tools forwards the calls to the server.
+// If the Tools list of the server configuration isn't empty, only the tools in the list are returned.
+// If AutoApprove is false, every call must be approved by the approver. Calls are denied if no approver is given.
+//
+// Parameters:
+//   - ctx: The context used to list the tools
+//   - client: An initialized MCP client
+//   - config: The configuration of the server
+//   - approver: Optional approver for the tool calls
+//
+// Returns:
+//   - The tools of the server
+//   - An error if the tools can't be listed
+func MCPTools(ctx context.Context, client MCPClient, config *MCPServerConfig, approver MCPToolApprover) ([]*tools.Tool, error) {
+	if client == nil {
+		return nil, errors.New("MCP client cannot be nil")
+	}
+	if config == nil {
+		return nil, errors.New("server configuration is required")
+	}
+
+	infos, err := ListMCPTools(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := map[string]bool{}
+	for _, name := range config.Tools {
+		allowed[name] = true
+	}
+
+	result := []*tools.Tool{}
+	for _, info := range infos {
+		if len(allowed) > 0 && !allowed[info.Name] {
+			continue
+		}
+		result = append(result, tools.NewTool(ConvertMCPToolToFunction(info), mcpToolHandler(client, config, info.Name, approver)))
+	}
+	return result, nil
+}
+
+// ConvertMCPToolToFunction converts the description of an MCP tool to a function definition.
+// The properties of the input schema become the parameters of the function, sorted by name. Nested objects and array items are converted recursively.
+func ConvertMCPToolToFunction(info MCPToolInfo) tools.FunctionConfig {
+	return tools.FunctionConfig{
+		Name:        info.Name,
+		Description: info.Description,
+		Params:      schemaProperties(info.InputSchema),
+	}
+}
+
+// schemaProperties converts the properties of an object schema to parameters sorted by name.
+func schemaProperties(schema map[string]any) []tools.ParameterConfig {
+	properties, _ := schema["properties"].(map[string]any)
+	if len(properties) == 0 {
+		return nil
+	}
+
+	required := map[string]bool{}
+	if list, ok := schema["required"].([]any); ok {
+		for _, name := range list {
+			if s, ok := name.(string); ok {
+				required[s] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	params := make([]tools.ParameterConfig, 0, len(names))
+	for _, name := range names {
+		property, _ := properties[name].(map[string]any)
+		param := schemaParameter(property)
+		param.Name = name
+		param.Required = required[name]
+		params = append(params, param)
+	}
+	return params
+}
+
+// schemaParameter converts a JSON schema to a parameter.
+func schemaParameter(schema map[string]any) tools.ParameterConfig {
+	description, _ := schema["description"].(string)
+	param := tools.ParameterConfig{
+		Type:        schemaType(schema),
+		Description: description,
+		Properties:  schemaProperties(schema),
+		Default:     schema["default"],
+	}
+	if values, ok := schema["enum"].([]any); ok {
+		for _, value := range values {
+			param.Enum = append(param.Enum, fmt.Sprint(value))
+		}
+	}
+	if items, ok := schema["items"].(map[string]any); ok {
+		itemsParam := schemaParameter(items)
+		param.Items = &itemsParam
+	}
+	if minimum, ok := schema["minimum"].(float64); ok {
+		param.Minimum = &minimum
+	}
+	if maximum, ok := schema["maximum"].(float64); ok {
+		param.Maximum = &maximum
+	}
+	return param
+}
+
+// schemaType returns the type of a JSON schema. If the type is a list, the first type other than "null" is used.
+func schemaType(schema map[string]any) string {
+	switch t := schema["type"].(type) {
+	case string:
+		return t
+	case []any:
+		for _, item := range t {
+			if s, ok := item.(string); ok && s != "null" {
+				return s
+			}
+		}
+	}
+	if _, ok := schema["properties"]; ok {
+		return "object"
+	}
+	return "string"
+}
+
+// mcpToolHandler creates the handler which forwards the calls of a tool to the MCP server.
+func mcpToolHandler(client MCPClient, config *MCPServerConfig, name string, approver MCPToolApprover) tools.ToolHandler {
+	return func(ctx context.Context, arguments map[string]any) (string, error) {
+		if !config.AutoApprove && (approver == nil || !approver(ctx, config.Name, name, arguments)) {
+			return "", fmt.Errorf("call of MCP tool %s was not approved", name)
+		}
+
+		response, err := client.CallTool(ctx, name, arguments)
+		if err != nil {
+			return "", err
+		}
+		if response.Error != nil {
+			return "", fmt.Errorf("MCP error %d: %s", response.Error.Code, response.Error.Message)
+		}
+		return mcpToolResultText(response.Result)
+	}
+}
+
+// mcpToolResultText extracts the text of a tools/call result. Text content is joined by newlines and other content is encoded as JSON.
+// A result flagged with isError is returned as an error.
+func mcpToolResultText(result any) (string, error) {
+	if text, ok := result.(string); ok {
+		return text, nil
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	var callResult struct {
+		Content []map[string]any `json:"content"`
+		IsError bool             `json:"isError"`
+	}
+	if err := json.Unmarshal(data, &callResult); err != nil || callResult.Content == nil {
+		return string(data), nil
+	}
+
+	parts := []string{}
+	for _, item := range callResult.Content {
+		if text, ok := item["text"].(string); ok && item["type"] == "text" {
+			parts = append(parts, text)
+			continue
+		}
+		encoded, err := json.Marshal(item)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, string(encoded))
+	}
+
+	text := strings.Join(parts, "\n")
+	if callResult.IsError {
+		return "", errors.New(text)
+	}
+	return text, nil
+}
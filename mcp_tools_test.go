@@ -0,0 +1,216 @@
+package anyi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jieliu2000/anyi/flow"
+	"github.com/jieliu2000/anyi/internal/test"
+	"github.com/jieliu2000/anyi/llm/chat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMockToolServer() *test.MockMCPServer {
+	mockServer := test.NewMockMCPServer()
+	mockServer.SetResponse("tools/list", map[string]interface{}{
+		"tools": []map[string]interface{}{
+			{
+				"name":        "search",
+				"description": "Search the web",
+				"inputSchema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"query": map[string]interface{}{"type": "string", "description": "The query"},
+						"limit": map[string]interface{}{"type": []interface{}{"integer", "null"}},
+						"order": map[string]interface{}{"type": "string", "enum": []interface{}{"asc", "desc"}},
+					},
+					"required": []interface{}{"query"},
+				},
+			},
+			{
+				"name":        "delete_everything",
+				"description": "Dangerous",
+				"inputSchema": map[string]interface{}{"type": "object"},
+			},
+		},
+	})
+	return mockServer
+}
+
+func TestMCPTools_ConvertsAndFilters(t *testing.T) {
+	mockServer := newMockToolServer()
+	defer mockServer.Close()
+
+	config := &MCPServerConfig{Name: "web", Type: TransportHTTP, URL: mockServer.URL(), Tools: []string{"search"}, AutoApprove: true}
+	client, err := NewMCPClient(config)
+	require.NoError(t, err)
+
+	serverTools, err := MCPTools(context.Background(), client, config, nil)
+	require.NoError(t, err)
+	require.Len(t, serverTools, 1)
+
+	function := serverTools[0].Function
+	assert.Equal(t, "search", function.Name)
+	assert.Equal(t, "Search the web", function.Description)
+	require.Len(t, function.Params, 3)
+	assert.Equal(t, "limit", function.Params[0].Name)
+	assert.Equal(t, "integer", function.Params[0].Type)
+	assert.False(t, function.Params[0].Required)
+	assert.Equal(t, []string{"asc", "desc"}, function.Params[1].Enum)
+	assert.Equal(t, "query", function.Params[2].Name)
+	assert.True(t, function.Params[2].Required)
+
+	result, err := serverTools[0].Call(context.Background(), map[string]any{"query": "anyi"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Tool executed successfully", result)
+
+	request := mockServer.GetLastRequest()
+	assert.Equal(t, "tools/call", request.Method)
+	params := request.Params.(map[string]interface{})
+	assert.Equal(t, "search", params["name"])
+	assert.Equal(t, map[string]interface{}{"query": "anyi"}, params["arguments"])
+}
+
+func TestMCPTools_Approval(t *testing.T) {
+	mockServer := newMockToolServer()
+	defer mockServer.Close()
+
+	config := &MCPServerConfig{Name: "web", Type: TransportHTTP, URL: mockServer.URL()}
+	client, err := NewMCPClient(config)
+	require.NoError(t, err)
+
+	serverTools, err := MCPTools(context.Background(), client, config, nil)
+	require.NoError(t, err)
+	assert.Len(t, serverTools, 2)
+
+	mockServer.ClearRequests()
+	_, err = serverTools[0].Call(context.Background(), nil)
+	assert.EqualError(t, err, "call of MCP tool search was not approved")
+	assert.Empty(t, mockServer.GetRequests())
+
+	approved := []string{}
+	approver := func(ctx context.Context, server string, tool string, arguments map[string]any) bool {
+		approved = append(approved, server+"/"+tool)
+		return tool == "search"
+	}
+	serverTools, err = MCPTools(context.Background(), client, config, approver)
+	require.NoError(t, err)
+
+	_, err = serverTools[0].Call(context.Background(), nil)
+	assert.NoError(t, err)
+	_, err = serverTools[1].Call(context.Background(), nil)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"web/search", "web/delete_everything"}, approved)
+}
+
+func TestMCPToolResultText(t *testing.T) {
+	text, err := mcpToolResultText(map[string]interface{}{
+		"content": []interface{}{
+			map[string]interface{}{"type": "text", "text": "line 1"},
+			map[string]interface{}{"type": "text", "text": "line 2"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "line 1\nline 2", text)
+
+	_, err = mcpToolResultText(map[string]interface{}{
+		"content": []interface{}{map[string]interface{}{"type": "text", "text": "not found"}},
+		"isError": true,
+	})
+	assert.EqualError(t, err, "not found")
+
+	text, err = mcpToolResultText(map[string]interface{}{"value": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"value":1}`, text)
+}
+
+func TestAgentExecutor_MCPServers(t *testing.T) {
+	mockServer := newMockToolServer()
+	defer mockServer.Close()
+
+	client := &scriptedClient{responses: []*chat.Message{
+		toolCallResponse("call_1", "search", map[string]any{"query": "anyi"}),
+		{Role: "assistant", Content: "Found it"},
+	}}
+	executor := &AgentExecutor{
+		MCPServers: []*MCPServerConfig{
+			{Name: "web", Type: TransportHTTP, URL: mockServer.URL(), Tools: []string{"search"}, AutoApprove: true},
+		},
+	}
+	step := &flow.Step{Executor: executor}
+	step.ClientImpl = client
+
+	result, err := executor.Run(flow.FlowContext{Text: "Search anyi"}, step)
+
+	require.NoError(t, err)
+	assert.Equal(t, "Found it", result.Text)
+	require.Len(t, client.functions[0], 1)
+	assert.Equal(t, "search", client.functions[0][0].Name)
+	assert.Equal(t, "Tool executed successfully", client.messages[1][2].Content)
+}
+
+func TestConvertMCPToolToFunction_NestedSchema(t *testing.T) {
+	info := MCPToolInfo{
+		Name: "create_issue",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"labels": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+				"meta": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"priority": map[string]any{"type": "integer", "minimum": 1.0, "maximum": 5.0, "default": 3.0},
+					},
+					"required": []any{"priority"},
+				},
+			},
+		},
+	}
+
+	function := ConvertMCPToolToFunction(info)
+
+	require.Len(t, function.Params, 2)
+	assert.Equal(t, "string", function.Params[0].Items.Type)
+	meta := function.Params[1]
+	require.Len(t, meta.Properties, 1)
+	priority := meta.Properties[0]
+	assert.True(t, priority.Required)
+	assert.Equal(t, 1.0, *priority.Minimum)
+	assert.Equal(t, 5.0, *priority.Maximum)
+	assert.Equal(t, 3.0, priority.Default)
+	schema := function.ParametersSchema()
+	assert.Equal(t, []string{"priority"}, schema["properties"].(map[string]any)["meta"].(map[string]any)["required"])
+}
+
+func TestAgentExecutor_MCPApprovalHandler(t *testing.T) {
+	resetRegistry()
+	defer resetRegistry()
+	mockServer := newMockToolServer()
+	defer mockServer.Close()
+	t.Setenv("ANYI_TEST_TOKEN", "secret")
+
+	handler, output := newConsoleHandler("y\n")
+	require.NoError(t, RegisterApprovalHandler("console", handler))
+	client := &scriptedClient{responses: []*chat.Message{
+		toolCallResponse("call_1", "search", map[string]any{"query": "anyi"}),
+		{Role: "assistant", Content: "Found it"},
+	}}
+	server := &MCPServerConfig{Name: "web", Type: TransportHTTP, URL: mockServer.URL(), Headers: map[string]string{"Authorization": "Bearer ${ANYI_TEST_TOKEN}"}}
+	executor := &AgentExecutor{MCPServers: []*MCPServerConfig{server}, MCPApprovalHandler: "console"}
+	step := &flow.Step{Executor: executor}
+	step.ClientImpl = client
+
+	result, err := executor.Run(flow.FlowContext{Text: "Search anyi"}, step)
+
+	require.NoError(t, err)
+	assert.Equal(t, "Found it", result.Text)
+	assert.Contains(t, output.String(), "Allow the call of tool search of MCP server web?")
+	assert.Equal(t, "Tool executed successfully", client.messages[1][2].Content)
+	// The variables are resolved in a copy, so concurrent runs don't write to the configuration
+	assert.Equal(t, "Bearer ${ANYI_TEST_TOKEN}", server.Headers["Authorization"])
+
+	executor.MCPApprovalHandler = "unknown"
+	_, err = executor.Run(flow.FlowContext{Text: "Search anyi"}, step)
+	assert.Error(t, err)
+}
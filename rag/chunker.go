@@ -0,0 +1,294 @@
+package rag
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultChunkSize is the maximum number of characters of a chunk if a chunker doesn't set Size.
+const DefaultChunkSize = 1000
+
+// DefaultSeparators are the separators RecursiveChunker tries in order: paragraphs, lines, sentences, words and finally single characters.
+var DefaultSeparators = []string{"\n\n", "\n", ". ", " ", ""}
+
+// Chunker splits documents into chunks which are small enough to be embedded and sent to a model as context.
+type Chunker interface {
+	Split(document Document) []Chunk
+}
+
+// FixedSizeChunker splits documents into chunks of Size characters. Consecutive chunks share Overlap characters.
+type FixedSizeChunker struct {
+	// The number of characters of a chunk. Defaults to DefaultChunkSize.
+	Size int `json:"size" yaml:"size" mapstructure:"size"`
+	// The number of characters at the end of a chunk which are repeated at the start of the next chunk. It's limited to half of Size.
+	Overlap int `json:"overlap" yaml:"overlap" mapstructure:"overlap"`
+}
+
+// Split splits the document into chunks of equal size. Only the last chunk may be shorter.
+func (chunker *FixedSizeChunker) Split(document Document) []Chunk {
+	size, overlap := chunkLimits(chunker.Size, chunker.Overlap)
+	runes := []rune(document.Content)
+
+	var texts []string
+	for start := 0; start < len(runes); start += size - overlap {
+		end := start + size
+		if end > len(runes) {
+			end = len(runes)
+		}
+		texts = append(texts, string(runes[start:end]))
+		if end == len(runes) {
+			break
+		}
+	}
+	return newChunks(document, texts, nil)
+}
+
+// RecursiveChunker splits documents at the first separator which makes the parts small enough, falling back to the next separator for parts which are still too long, and merges small parts up to Size characters.
+// This keeps paragraphs and sentences together where possible. Consecutive chunks share up to Overlap characters of whole parts.
+type RecursiveChunker struct {
+	// The maximum number of characters of a chunk. Defaults to DefaultChunkSize.
+	Size int `json:"size" yaml:"size" mapstructure:"size"`
+	// The maximum number of characters at the end of a chunk which are repeated at the start of the next chunk. It's limited to half of Size.
+	Overlap int `json:"overlap" yaml:"overlap" mapstructure:"overlap"`
+	// The separators to try in order. Defaults to DefaultSeparators. An empty separator splits the text into single characters.
+	Separators []string `json:"separators" yaml:"separators" mapstructure:"separators"`
+}
+
+// Split splits the document into chunks of at most Size characters. Whitespace around the chunks is removed.
+func (chunker *RecursiveChunker) Split(document Document) []Chunk {
+	return newChunks(document, chunker.splitText(document.Content), nil)
+}
+
+// splitText splits a text into chunks of at most Size characters.
+func (chunker *RecursiveChunker) splitText(text string) []string {
+	size, overlap := chunkLimits(chunker.Size, chunker.Overlap)
+	separators := chunker.Separators
+	if len(separators) == 0 {
+		separators = DefaultSeparators
+	}
+	// The last resort of splitting into characters ensures that no part is longer than size
+	if separators[len(separators)-1] != "" {
+		separators = append(append([]string(nil), separators...), "")
+	}
+
+	var texts []string
+	for _, text := range mergeParts(splitRecursive(text, separators, size), size, overlap) {
+		if text = strings.TrimSpace(text); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return texts
+}
+
+// splitRecursive splits the text into parts of at most size characters. The separators stay at the end of the parts, so joining the parts returns the text.
+func splitRecursive(text string, separators []string, size int) []string {
+	if utf8.RuneCountInString(text) <= size {
+		return []string{text}
+	}
+	separator, rest := "", []string(nil)
+	for i, candidate := range separators {
+		if candidate == "" || strings.Contains(text, candidate) {
+			separator, rest = candidate, separators[i+1:]
+			break
+		}
+	}
+	if separator == "" {
+		parts := make([]string, 0, len(text))
+		for _, r := range text {
+			parts = append(parts, string(r))
+		}
+		return parts
+	}
+
+	var parts []string
+	for _, part := range strings.SplitAfter(text, separator) {
+		if part == "" {
+			continue
+		}
+		if utf8.RuneCountInString(part) > size {
+			parts = append(parts, splitRecursive(part, rest, size)...)
+		} else {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// mergeParts joins consecutive parts into texts of at most size characters. Each text starts with the last parts of the previous text which fit into overlap characters.
+func mergeParts(parts []string, size int, overlap int) []string {
+	var texts []string
+	var current []string
+	currentSize := 0
+	for _, part := range parts {
+		partSize := utf8.RuneCountInString(part)
+		if currentSize+partSize > size && len(current) > 0 {
+			texts = append(texts, strings.Join(current, ""))
+			for len(current) > 0 && (currentSize > overlap || currentSize+partSize > size) {
+				currentSize -= utf8.RuneCountInString(current[0])
+				current = current[1:]
+			}
+		}
+		current = append(current, part)
+		currentSize += partSize
+	}
+	if len(current) > 0 {
+		texts = append(texts, strings.Join(current, ""))
+	}
+	return texts
+}
+
+// HeadingChunker splits Markdown documents into one chunk per section. The heading path of a section, for example "Setup > Installation", is added to the metadata of its chunks as "heading".
+// Sections longer than MaxSize characters are split further with a RecursiveChunker.
+type HeadingChunker struct {
+	// The deepest heading level which starts a new section. Deeper headings stay in the section of their parent. Defaults to 6.
+	MaxLevel int `json:"maxLevel" yaml:"maxLevel" mapstructure:"maxLevel"`
+	// The maximum number of characters of a chunk. Zero means sections are never split.
+	MaxSize int `json:"maxSize" yaml:"maxSize" mapstructure:"maxSize"`
+	// The overlap of the chunks of a split section, see RecursiveChunker.
+	Overlap int `json:"overlap" yaml:"overlap" mapstructure:"overlap"`
+}
+
+// Split splits the document at its headings. The heading line is kept at the start of the chunk of its section.
+func (chunker *HeadingChunker) Split(document Document) []Chunk {
+	maxLevel := chunker.MaxLevel
+	if maxLevel <= 0 || maxLevel > 6 {
+		maxLevel = 6
+	}
+
+	var texts []string
+	var headings []string
+	for _, section := range markdownSections(document.Content, maxLevel) {
+		parts := []string{strings.TrimSpace(section.text)}
+		if chunker.MaxSize > 0 {
+			parts = (&RecursiveChunker{Size: chunker.MaxSize, Overlap: chunker.Overlap}).splitText(section.text)
+		}
+		for _, part := range parts {
+			if part == "" {
+				continue
+			}
+			texts = append(texts, part)
+			headings = append(headings, strings.Join(section.path, " > "))
+		}
+	}
+	return newChunks(document, texts, func(i int, metadata map[string]any) {
+		if headings[i] != "" {
+			metadata["heading"] = headings[i]
+		}
+	})
+}
+
+// markdownSection is the text between two headings of a Markdown document.
+type markdownSection struct {
+	title string
+	// path holds the titles of the heading and its parents
+	path []string
+	text string
+}
+
+// markdownSections splits Markdown content at headings up to maxLevel. Headings in fenced code blocks are ignored. Text before the first heading becomes a section without title.
+func markdownSections(content string, maxLevel int) []markdownSection {
+	var sections []markdownSection
+	var stack [7]string
+	current := markdownSection{}
+	var lines []string
+	fence := ""
+
+	for _, line := range strings.SplitAfter(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			lines = append(lines, line)
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			lines = append(lines, line)
+			continue
+		}
+
+		level, title, ok := parseHeading(line)
+		if !ok || level > maxLevel {
+			lines = append(lines, line)
+			continue
+		}
+		current.text = strings.Join(lines, "")
+		if current.title != "" || strings.TrimSpace(current.text) != "" {
+			sections = append(sections, current)
+		}
+
+		stack[level] = title
+		for i := level + 1; i < len(stack); i++ {
+			stack[i] = ""
+		}
+		var path []string
+		for i := 1; i <= level; i++ {
+			if stack[i] != "" {
+				path = append(path, stack[i])
+			}
+		}
+		current = markdownSection{title: title, path: path}
+		lines = []string{line}
+	}
+	current.text = strings.Join(lines, "")
+	if current.title != "" || strings.TrimSpace(current.text) != "" {
+		sections = append(sections, current)
+	}
+	return sections
+}
+
+// parseHeading parses an ATX heading such as "## Installation".
+func parseHeading(line string) (level int, title string, ok bool) {
+	line = strings.TrimRight(line, "\r\n")
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return 0, "", false
+	}
+	for level < len(trimmed) && trimmed[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 {
+		return 0, "", false
+	}
+	rest := trimmed[level:]
+	if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+		return 0, "", false
+	}
+	title = strings.TrimSpace(strings.TrimRight(strings.TrimSpace(rest), "#"))
+	return level, title, true
+}
+
+// chunkLimits applies the defaults of the size and the limit of the overlap.
+func chunkLimits(size int, overlap int) (int, int) {
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	if overlap < 0 {
+		overlap = 0
+	}
+	if overlap > size/2 {
+		overlap = size / 2
+	}
+	return size, overlap
+}
+
+// newChunks creates the chunks of a document from their texts. setMetadata can add entries to the metadata of each chunk.
+func newChunks(document Document, texts []string, setMetadata func(i int, metadata map[string]any)) []Chunk {
+	chunks := make([]Chunk, 0, len(texts))
+	for i, text := range texts {
+		metadata := copyMetadata(document.Metadata)
+		metadata["chunk"] = i
+		if setMetadata != nil {
+			setMetadata(i, metadata)
+		}
+		chunks = append(chunks, Chunk{
+			ID:         fmt.Sprintf("%s#%d", document.ID, i),
+			DocumentID: document.ID,
+			Content:    text,
+			Metadata:   metadata,
+		})
+	}
+	return chunks
+}
@@ -0,0 +1,116 @@
+package rag
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func contents(chunks []Chunk) []string {
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Content
+	}
+	return texts
+}
+
+func TestFixedSizeChunker(t *testing.T) {
+	document := Document{ID: "doc", Content: "abcdefghij", Metadata: map[string]any{"source": "doc.txt"}}
+
+	chunks := (&FixedSizeChunker{Size: 4, Overlap: 1}).Split(document)
+
+	assert.Equal(t, []string{"abcd", "defg", "ghij"}, contents(chunks))
+	assert.Equal(t, "doc#1", chunks[1].ID)
+	assert.Equal(t, "doc", chunks[1].DocumentID)
+	assert.Equal(t, "doc.txt", chunks[1].Metadata["source"])
+	assert.Equal(t, 1, chunks[1].Metadata["chunk"])
+	// The metadata of the document is copied, not shared
+	assert.NotContains(t, document.Metadata, "chunk")
+}
+
+func TestFixedSizeChunker_Runes(t *testing.T) {
+	chunks := (&FixedSizeChunker{Size: 2}).Split(Document{ID: "doc", Content: "你好世界!"})
+	assert.Equal(t, []string{"你好", "世界", "!"}, contents(chunks))
+
+	assert.Empty(t, (&FixedSizeChunker{}).Split(Document{ID: "empty"}))
+}
+
+func TestRecursiveChunker(t *testing.T) {
+	content := "First paragraph is short.\n\nSecond paragraph has two sentences. It is longer than the limit.\n\nThird."
+
+	chunks := (&RecursiveChunker{Size: 40}).Split(Document{ID: "doc", Content: content})
+
+	assert.Equal(t, []string{
+		"First paragraph is short.",
+		"Second paragraph has two sentences.",
+		"It is longer than the limit.\n\nThird.",
+	}, contents(chunks))
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, utf8.RuneCountInString(chunk.Content), 40)
+	}
+}
+
+func TestRecursiveChunker_Overlap(t *testing.T) {
+	content := "one two three four five six seven eight nine ten"
+
+	chunks := (&RecursiveChunker{Size: 20, Overlap: 10}).Split(Document{ID: "doc", Content: content})
+
+	// The separators count, so "three four " with 11 characters doesn't fit into the overlap
+	assert.Equal(t, []string{
+		"one two three four",
+		"four five six seven",
+		"six seven eight",
+		"eight nine ten",
+	}, contents(chunks))
+}
+
+func TestRecursiveChunker_LongWord(t *testing.T) {
+	chunks := (&RecursiveChunker{Size: 5, Separators: []string{" "}}).Split(Document{ID: "doc", Content: "tiny " + strings.Repeat("x", 12)})
+
+	assert.Equal(t, []string{"tiny", "xxxxx", "xxxxx", "xx"}, contents(chunks))
+}
+
+func TestHeadingChunker(t *testing.T) {
+	content := "Intro text.\n\n# Setup\nSetup text.\n\n## Install\nRun it.\n```\n# not a heading\n```\n### Details\nMore.\n# Usage\nUse it.\n"
+
+	chunks := (&HeadingChunker{MaxLevel: 2}).Split(Document{ID: "doc", Content: content})
+
+	assert.Equal(t, []string{
+		"Intro text.",
+		"# Setup\nSetup text.",
+		"## Install\nRun it.\n```\n# not a heading\n```\n### Details\nMore.",
+		"# Usage\nUse it.",
+	}, contents(chunks))
+	assert.NotContains(t, chunks[0].Metadata, "heading")
+	assert.Equal(t, "Setup", chunks[1].Metadata["heading"])
+	assert.Equal(t, "Setup > Install", chunks[2].Metadata["heading"])
+	assert.Equal(t, "Usage", chunks[3].Metadata["heading"])
+}
+
+func TestHeadingChunker_MaxSize(t *testing.T) {
+	content := "# Long\n" + strings.Repeat("word ", 10) + "\n# Short\nEnd."
+
+	chunks := (&HeadingChunker{MaxSize: 30}).Split(Document{ID: "doc", Content: content})
+
+	assert.Len(t, chunks, 3)
+	assert.Equal(t, "Long", chunks[0].Metadata["heading"])
+	assert.Equal(t, "Long", chunks[1].Metadata["heading"])
+	assert.Equal(t, "# Short\nEnd.", chunks[2].Content)
+	assert.Equal(t, 2, chunks[2].Metadata["chunk"])
+}
+
+func TestParseHeading(t *testing.T) {
+	level, title, ok := parseHeading("## Title ##\n")
+	assert.True(t, ok)
+	assert.Equal(t, 2, level)
+	assert.Equal(t, "Title", title)
+
+	_, _, ok = parseHeading("#hashtag")
+	assert.False(t, ok)
+	_, _, ok = parseHeading("    # indented code")
+	assert.False(t, ok)
+	_, _, ok = parseHeading("####### too deep")
+	assert.False(t, ok)
+}
@@ -0,0 +1,42 @@
+// Package rag implements retrieval-augmented generation: loading documents, splitting them into chunks, indexing the chunks with embeddings and retrieving the chunks which are most similar to a query.
+//
+// A typical setup loads and indexes documents once:
+//
+//	documents, _ := rag.LoadDir("./docs")
+//	index, _ := rag.OpenIndex("./docs.index.json")
+//	retriever := rag.NewRetriever(embedder, index)
+//	retriever.AddDocuments(ctx, documents...)
+//
+// and then retrieves chunks for every question, usually with the "retrieve" executor of a flow.
+package rag
+
+// Document is a text loaded from a file or another source.
+type Document struct {
+	// ID identifies the document. Loaders use the path of the file.
+	ID string `json:"id"`
+	// Content is the text of the document.
+	Content string `json:"content"`
+	// Metadata holds information about the document such as its source and title. It's copied to the chunks of the document and can be used to filter search results.
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// Chunk is a part of a document which is embedded and indexed on its own.
+type Chunk struct {
+	// ID identifies the chunk. Chunkers use the document ID followed by "#" and the number of the chunk.
+	ID string `json:"id"`
+	// DocumentID is the ID of the document the chunk belongs to.
+	DocumentID string `json:"documentId"`
+	// Content is the text of the chunk.
+	Content string `json:"content"`
+	// Metadata holds the metadata of the document and the chunk, for example the heading of the section for chunks created by HeadingChunker.
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// copyMetadata returns a copy of the metadata with room for extra entries.
+func copyMetadata(metadata map[string]any) map[string]any {
+	copied := make(map[string]any, len(metadata)+2)
+	for k, v := range metadata {
+		copied[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,393 @@
+package rag
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Result is a chunk found by a search and its cosine similarity to the query, between -1 and 1.
+type Result struct {
+	Chunk Chunk   `json:"chunk"`
+	Score float32 `json:"score"`
+}
+
+// Filter restricts a search to chunks whose metadata has the given values. A chunk matches if each key of the filter has an equal value in the metadata of the chunk.
+// A slice value matches any of its elements, for example {"source": ["a.md", "b.md"]}. Numbers are compared by value, so 1 matches 1.0.
+type Filter map[string]any
+
+// Matches returns true if the metadata matches all entries of the filter.
+func (filter Filter) Matches(metadata map[string]any) bool {
+	for key, expected := range filter {
+		actual, ok := metadata[key]
+		if !ok || !matchesValue(actual, expected) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesValue compares a metadata value with a filter value, which can be a list of allowed values.
+func matchesValue(actual any, expected any) bool {
+	if expected != nil {
+		value := reflect.ValueOf(expected)
+		if value.Kind() == reflect.Slice && !isSlice(actual) {
+			for i := 0; i < value.Len(); i++ {
+				if equalValues(actual, value.Index(i).Interface()) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return equalValues(actual, expected)
+}
+
+func isSlice(value any) bool {
+	return value != nil && reflect.ValueOf(value).Kind() == reflect.Slice
+}
+
+// equalValues compares two values, treating all numbers as float64 since metadata loaded from JSON only has float64 numbers.
+func equalValues(a any, b any) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toFloat(value any) (float64, bool) {
+	if value == nil {
+		return 0, false
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// CosineSimilarity returns the cosine of the angle between two vectors: 1 for vectors pointing in the same direction, 0 for orthogonal vectors. It returns 0 if the vectors have different lengths or one of them is zero.
+func CosineSimilarity(a []float32, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	return cosine(a, norm(a), b, norm(b))
+}
+
+func norm(vector []float32) float64 {
+	sum := 0.0
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	return math.Sqrt(sum)
+}
+
+func cosine(a []float32, normA float64, b []float32, normB float64) float32 {
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	dot := 0.0
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return float32(dot / (normA * normB))
+}
+
+// indexEntry is a chunk of the index with its embedding.
+type indexEntry struct {
+	Chunk  Chunk     `json:"chunk"`
+	Vector []float32 `json:"vector"`
+	norm   float64
+}
+
+// indexFile is the content of an index file.
+type indexFile struct {
+	Dimensions int          `json:"dimensions"`
+	Entries    []indexEntry `json:"entries"`
+}
+
+// Index is a vector index which finds the chunks most similar to a query vector with an exact search by cosine similarity.
+// It holds all vectors in memory. If Path is set, the index is saved to that JSON file after every change, see OpenIndex.
+// An Index is safe for concurrent use.
+type Index struct {
+	// Path is the file the index is saved to. An empty path keeps the index in memory only.
+	Path string
+
+	mu         sync.RWMutex
+	dimensions int
+	entries    []indexEntry
+	positions  map[string]int
+}
+
+// NewIndex creates an empty index which is kept in memory.
+func NewIndex() *Index {
+	return &Index{positions: make(map[string]int)}
+}
+
+// OpenIndex creates an index which is saved to a JSON file. If the file exists, the index is loaded from it.
+//
+// Parameters:
+//   - path: The path of the index file
+//
+// Returns:
+//   - The index
+//   - An error if the file exists but can't be read
+func OpenIndex(path string) (*Index, error) {
+	if path == "" {
+		return nil, errors.New("index path cannot be empty")
+	}
+	index := NewIndex()
+	index.Path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file indexFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid index %s: %w", path, err)
+	}
+	index.dimensions = file.Dimensions
+	for _, entry := range file.Entries {
+		if len(entry.Vector) != file.Dimensions {
+			return nil, fmt.Errorf("invalid index %s: chunk %s has %d dimensions instead of %d", path, entry.Chunk.ID, len(entry.Vector), file.Dimensions)
+		}
+		index.put(entry)
+	}
+	return index, nil
+}
+
+// Len returns the number of chunks in the index.
+func (index *Index) Len() int {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+	return len(index.entries)
+}
+
+// Add adds chunks with their embeddings to the index. A chunk with the ID of a chunk in the index replaces it.
+// All vectors of an index must have the same number of dimensions.
+//
+// Parameters:
+//   - chunks: The chunks to add
+//   - vectors: The embedding of each chunk
+//
+// Returns:
+//   - An error if the numbers of chunks and vectors differ, a vector has the wrong number of dimensions or the index can't be saved
+func (index *Index) Add(chunks []Chunk, vectors [][]float32) error {
+	if len(chunks) != len(vectors) {
+		return fmt.Errorf("got %d chunks but %d vectors", len(chunks), len(vectors))
+	}
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	dimensions := index.dimensions
+	if len(index.entries) == 0 && len(vectors) > 0 {
+		dimensions = len(vectors[0])
+	}
+	for i, vector := range vectors {
+		if len(vector) == 0 || len(vector) != dimensions {
+			return fmt.Errorf("chunk %s has %d dimensions instead of %d", chunks[i].ID, len(vector), dimensions)
+		}
+	}
+	// Add to a copy, so the index is unchanged if it can't be saved
+	next := &Index{
+		entries:   make([]indexEntry, len(index.entries), len(index.entries)+len(chunks)),
+		positions: make(map[string]int, len(index.entries)+len(chunks)),
+	}
+	copy(next.entries, index.entries)
+	for id, position := range index.positions {
+		next.positions[id] = position
+	}
+	for i, chunk := range chunks {
+		next.put(indexEntry{Chunk: chunk, Vector: vectors[i]})
+	}
+	return index.swap(dimensions, next)
+}
+
+// put adds or replaces an entry. The caller must hold the lock.
+func (index *Index) put(entry indexEntry) {
+	if index.positions == nil {
+		index.positions = make(map[string]int)
+	}
+	entry.norm = norm(entry.Vector)
+	if position, ok := index.positions[entry.Chunk.ID]; ok {
+		index.entries[position] = entry
+		return
+	}
+	index.positions[entry.Chunk.ID] = len(index.entries)
+	index.entries = append(index.entries, entry)
+}
+
+// ReplaceDocument replaces all chunks of a document in the index with new chunks. The index is saved once, and the old chunks are kept if the new ones are rejected or the index can't be saved.
+// Chunks without a DocumentID are assigned to the document.
+//
+// Parameters:
+//   - documentID: The ID of the document
+//   - chunks: The new chunks of the document. No chunks remove the document from the index
+//   - vectors: The embedding of each chunk
+//
+// Returns:
+//   - An error if the numbers of chunks and vectors differ, a chunk belongs to another document, a vector has the wrong number of dimensions or the index can't be saved
+func (index *Index) ReplaceDocument(documentID string, chunks []Chunk, vectors [][]float32) error {
+	if len(chunks) != len(vectors) {
+		return fmt.Errorf("got %d chunks but %d vectors", len(chunks), len(vectors))
+	}
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	// Build the new entries aside, so the index is unchanged if anything fails
+	next := &Index{positions: make(map[string]int, len(index.entries)+len(chunks))}
+	for _, entry := range index.entries {
+		if entry.Chunk.DocumentID != documentID {
+			next.put(entry)
+		}
+	}
+	dimensions := index.dimensions
+	if len(next.entries) == 0 && len(vectors) > 0 {
+		dimensions = len(vectors[0])
+	}
+	for i, chunk := range chunks {
+		if chunk.DocumentID == "" {
+			chunk.DocumentID = documentID
+		}
+		if chunk.DocumentID != documentID {
+			return fmt.Errorf("chunk %s belongs to document %s instead of %s", chunk.ID, chunk.DocumentID, documentID)
+		}
+		if len(vectors[i]) == 0 || len(vectors[i]) != dimensions {
+			return fmt.Errorf("chunk %s has %d dimensions instead of %d", chunk.ID, len(vectors[i]), dimensions)
+		}
+		next.put(indexEntry{Chunk: chunk, Vector: vectors[i]})
+	}
+	if len(next.entries) == len(index.entries) && len(chunks) == 0 {
+		// The document wasn't in the index
+		return nil
+	}
+
+	return index.swap(dimensions, next)
+}
+
+// DeleteDocument removes all chunks of a document from the index. The chunks are kept if the index can't be saved.
+func (index *Index) DeleteDocument(documentID string) error {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	next := &Index{positions: make(map[string]int, len(index.entries))}
+	for _, entry := range index.entries {
+		if entry.Chunk.DocumentID != documentID {
+			next.put(entry)
+		}
+	}
+	if len(next.entries) == len(index.entries) {
+		return nil
+	}
+	return index.swap(index.dimensions, next)
+}
+
+// swap saves the entries of next and then makes them the entries of the index. The caller must hold the lock.
+func (index *Index) swap(dimensions int, next *Index) error {
+	if err := writeIndex(index.Path, dimensions, next.entries); err != nil {
+		return err
+	}
+	index.dimensions = dimensions
+	index.entries = next.entries
+	index.positions = next.positions
+	return nil
+}
+
+// Search returns the topK chunks most similar to the vector which match the filter, most similar first.
+//
+// Parameters:
+//   - vector: The embedding of the query
+//   - topK: The maximum number of results
+//   - filter: The metadata the chunks must have. A nil filter matches all chunks
+//
+// Returns:
+//   - The results, ordered by descending score
+//   - An error if the vector has the wrong number of dimensions
+func (index *Index) Search(vector []float32, topK int, filter Filter) ([]Result, error) {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	if len(index.entries) == 0 || topK <= 0 {
+		return nil, nil
+	}
+	if len(vector) != index.dimensions {
+		return nil, fmt.Errorf("query has %d dimensions but the index has %d", len(vector), index.dimensions)
+	}
+
+	queryNorm := norm(vector)
+	var results []Result
+	for _, entry := range index.entries {
+		if !filter.Matches(entry.Chunk.Metadata) {
+			continue
+		}
+		results = append(results, Result{Chunk: entry.Chunk, Score: cosine(vector, queryNorm, entry.Vector, entry.norm)})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > topK {
+		results = results[:topK]
+	}
+	return results, nil
+}
+
+// Save writes the index to Path. It's called by Add, ReplaceDocument and DeleteDocument, and does nothing if Path is empty.
+func (index *Index) Save() error {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+	return index.save()
+}
+
+// save writes the index file. The caller must hold the lock.
+func (index *Index) save() error {
+	return writeIndex(index.Path, index.dimensions, index.entries)
+}
+
+// writeIndex writes the entries to an index file. A temporary file is written first so a crash doesn't corrupt the index. Nothing is written if the path is empty.
+func writeIndex(path string, dimensions int, entries []indexEntry) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(indexFile{Dimensions: dimensions, Entries: entries})
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return nil
+}
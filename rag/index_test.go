@@ -0,0 +1,191 @@
+package rag
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newChunk(id string, documentID string, metadata map[string]any) Chunk {
+	return Chunk{ID: id, DocumentID: documentID, Content: "content of " + id, Metadata: metadata}
+}
+
+func chunkIDs(results []Result) []string {
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.Chunk.ID
+	}
+	return ids
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	assert.InDelta(t, 1, CosineSimilarity([]float32{1, 2}, []float32{2, 4}), 1e-6)
+	assert.InDelta(t, 0, CosineSimilarity([]float32{1, 0}, []float32{0, 3}), 1e-6)
+	assert.InDelta(t, -1, CosineSimilarity([]float32{1, 1}, []float32{-1, -1}), 1e-6)
+	assert.Equal(t, float32(0), CosineSimilarity([]float32{0, 0}, []float32{1, 1}))
+	assert.Equal(t, float32(0), CosineSimilarity([]float32{1}, []float32{1, 1}))
+}
+
+func TestIndex_Search(t *testing.T) {
+	index := NewIndex()
+	err := index.Add([]Chunk{
+		newChunk("a", "doc1", map[string]any{"lang": "en"}),
+		newChunk("b", "doc1", map[string]any{"lang": "de"}),
+		newChunk("c", "doc2", map[string]any{"lang": "en"}),
+	}, [][]float32{{1, 0}, {0.9, 0.1}, {0, 1}})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, index.Len())
+
+	results, err := index.Search([]float32{1, 0}, 2, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, chunkIDs(results))
+	assert.Greater(t, results[0].Score, results[1].Score)
+
+	results, err = index.Search([]float32{1, 0}, 5, Filter{"lang": "en"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "c"}, chunkIDs(results))
+
+	_, err = index.Search([]float32{1, 0, 0}, 2, nil)
+	assert.Error(t, err)
+}
+
+func TestIndex_AddReplacesAndChecksDimensions(t *testing.T) {
+	index := NewIndex()
+	assert.NoError(t, index.Add([]Chunk{newChunk("a", "doc", nil)}, [][]float32{{1, 0}}))
+	assert.NoError(t, index.Add([]Chunk{newChunk("a", "doc", map[string]any{"version": 2})}, [][]float32{{0, 1}}))
+	assert.Equal(t, 1, index.Len())
+
+	results, err := index.Search([]float32{0, 1}, 1, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, results[0].Chunk.Metadata["version"])
+	assert.InDelta(t, 1, results[0].Score, 1e-6)
+
+	assert.Error(t, index.Add([]Chunk{newChunk("b", "doc", nil)}, [][]float32{{1, 0, 0}}))
+	assert.Error(t, index.Add([]Chunk{newChunk("b", "doc", nil)}, nil))
+
+	// A failed save keeps the old chunks
+	blocker := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, os.WriteFile(blocker, nil, 0o644))
+	index.Path = filepath.Join(blocker, "docs.json")
+	assert.Error(t, index.Add([]Chunk{newChunk("a", "doc", nil), newChunk("b", "doc", nil)}, [][]float32{{1, 0}, {1, 0}}))
+	assert.Equal(t, 1, index.Len())
+	results, err = index.Search([]float32{0, 1}, 1, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, results[0].Chunk.Metadata["version"])
+}
+
+func TestIndex_DeleteDocument(t *testing.T) {
+	index := NewIndex()
+	assert.NoError(t, index.Add([]Chunk{
+		newChunk("a", "doc1", nil),
+		newChunk("b", "doc2", nil),
+		newChunk("c", "doc1", nil),
+	}, [][]float32{{1, 0}, {0, 1}, {1, 1}}))
+
+	assert.NoError(t, index.DeleteDocument("doc1"))
+	assert.NoError(t, index.DeleteDocument("unknown"))
+
+	results, err := index.Search([]float32{1, 0}, 5, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, chunkIDs(results))
+
+	// Replacing a chunk after the deletion uses the updated positions
+	assert.NoError(t, index.Add([]Chunk{newChunk("b", "doc2", map[string]any{"new": true})}, [][]float32{{0, 1}}))
+	assert.Equal(t, 1, index.Len())
+
+	// A failed save keeps the chunks
+	blocker := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, os.WriteFile(blocker, nil, 0o644))
+	index.Path = filepath.Join(blocker, "docs.json")
+	assert.Error(t, index.DeleteDocument("doc2"))
+	assert.Equal(t, 1, index.Len())
+}
+
+func TestIndex_ReplaceDocument(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "docs.json")
+	index, err := OpenIndex(path)
+	assert.NoError(t, err)
+	assert.NoError(t, index.Add([]Chunk{
+		newChunk("a", "doc1", nil),
+		newChunk("b", "doc2", nil),
+		newChunk("c", "doc1", nil),
+	}, [][]float32{{1, 0}, {0, 1}, {1, 1}}))
+
+	assert.NoError(t, index.ReplaceDocument("doc1", []Chunk{{ID: "d", Content: "new"}}, [][]float32{{1, 0}}))
+	results, err := index.Search([]float32{1, 0}, 5, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"d", "b"}, chunkIDs(results))
+	assert.Equal(t, "doc1", results[0].Chunk.DocumentID)
+	reopened, err := OpenIndex(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, reopened.Len())
+
+	// Rejected chunks keep the old ones
+	assert.Error(t, index.ReplaceDocument("doc1", []Chunk{newChunk("e", "doc1", nil)}, [][]float32{{1, 0, 0}}))
+	assert.Error(t, index.ReplaceDocument("doc1", []Chunk{newChunk("e", "doc2", nil)}, [][]float32{{1, 0}}))
+	assert.Error(t, index.ReplaceDocument("doc1", []Chunk{newChunk("e", "doc1", nil)}, nil))
+	assert.Equal(t, 2, index.Len())
+
+	// A failed save keeps the old chunks too
+	blocker := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, os.WriteFile(blocker, nil, 0o644))
+	index.Path = filepath.Join(blocker, "docs.json")
+	assert.Error(t, index.ReplaceDocument("doc1", []Chunk{newChunk("e", "doc1", nil)}, [][]float32{{1, 0}}))
+	results, err = index.Search([]float32{1, 0}, 5, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"d", "b"}, chunkIDs(results))
+
+	// The only document of the index can change the dimensions
+	index = NewIndex()
+	assert.NoError(t, index.Add([]Chunk{newChunk("a", "doc1", nil)}, [][]float32{{1, 0}}))
+	assert.NoError(t, index.ReplaceDocument("doc1", []Chunk{newChunk("a", "doc1", nil)}, [][]float32{{1, 0, 0}}))
+	assert.NoError(t, index.ReplaceDocument("doc1", nil, nil))
+	assert.Equal(t, 0, index.Len())
+}
+
+func TestOpenIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "indexes", "docs.json")
+
+	index, err := OpenIndex(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, index.Len())
+	assert.NoError(t, index.Add([]Chunk{
+		newChunk("a", "doc1", map[string]any{"chunk": 0, "tags": "faq"}),
+		newChunk("b", "doc2", map[string]any{"chunk": 1}),
+	}, [][]float32{{1, 0}, {0, 1}}))
+	assert.FileExists(t, path)
+
+	reopened, err := OpenIndex(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, reopened.Len())
+	// Numbers loaded from JSON are float64 but still match integer filters
+	results, err := reopened.Search([]float32{1, 0}, 5, Filter{"chunk": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, chunkIDs(results))
+
+	assert.NoError(t, reopened.DeleteDocument("doc2"))
+	reopened, err = OpenIndex(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, reopened.Len())
+
+	assert.NoError(t, os.WriteFile(path, []byte("not json"), 0o644))
+	_, err = OpenIndex(path)
+	assert.Error(t, err)
+	_, err = OpenIndex("")
+	assert.Error(t, err)
+}
+
+func TestFilter_Matches(t *testing.T) {
+	metadata := map[string]any{"source": "a.md", "chunk": 2, "public": true}
+
+	assert.True(t, Filter(nil).Matches(metadata))
+	assert.True(t, Filter{"source": "a.md", "public": true}.Matches(metadata))
+	assert.True(t, Filter{"source": []any{"b.md", "a.md"}}.Matches(metadata))
+	assert.True(t, Filter{"chunk": 2.0}.Matches(metadata))
+	assert.False(t, Filter{"source": "b.md"}.Matches(metadata))
+	assert.False(t, Filter{"source": []string{"b.md"}}.Matches(metadata))
+	assert.False(t, Filter{"missing": "x"}.Matches(metadata))
+	assert.False(t, Filter{"chunk": "2"}.Matches(metadata))
+}
@@ -0,0 +1,209 @@
+package rag
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Loader reads the documents of a file.
+type Loader interface {
+	Load(path string) ([]Document, error)
+}
+
+// TextLoader loads a plain text file as one document. The metadata of the document holds the path of the file as "source".
+type TextLoader struct {
+}
+
+// Load reads the file. It fails if the file is not valid UTF-8 text.
+func (loader *TextLoader) Load(path string) ([]Document, error) {
+	content, err := readText(path)
+	if err != nil {
+		return nil, err
+	}
+	return []Document{{
+		ID:       path,
+		Content:  content,
+		Metadata: map[string]any{"source": path},
+	}}, nil
+}
+
+// MarkdownLoader loads a Markdown file as one document.
+// A front matter block between "---" lines at the start of the file is removed from the content, and its "key: value" lines are added to the metadata. The title is taken from the front matter, or else from the first heading.
+type MarkdownLoader struct {
+}
+
+// Load reads the file. It fails if the file is not valid UTF-8 text.
+func (loader *MarkdownLoader) Load(path string) ([]Document, error) {
+	content, err := readText(path)
+	if err != nil {
+		return nil, err
+	}
+	metadata := map[string]any{"source": path}
+	content = parseFrontMatter(content, metadata)
+	if _, ok := metadata["title"]; !ok {
+		if title := firstHeading(content); title != "" {
+			metadata["title"] = title
+		}
+	}
+	return []Document{{
+		ID:       path,
+		Content:  content,
+		Metadata: metadata,
+	}}, nil
+}
+
+// readText reads a file and checks that it contains text.
+func readText(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("%s is not a UTF-8 text file", path)
+	}
+	return strings.TrimPrefix(string(data), "\ufeff"), nil
+}
+
+// parseFrontMatter removes the front matter from the content and adds its simple "key: value" entries to the metadata.
+func parseFrontMatter(content string, metadata map[string]any) string {
+	normalized := strings.ReplaceAll(content, "\r\n", "\n")
+	if !strings.HasPrefix(normalized, "---\n") {
+		return content
+	}
+	end := strings.Index(normalized[4:], "\n---")
+	if end < 0 {
+		return content
+	}
+	block := normalized[4 : 4+end]
+	rest := normalized[4+end+4:]
+	// Skip the rest of the closing line
+	if newline := strings.IndexByte(rest, '\n'); newline >= 0 {
+		rest = rest[newline+1:]
+	} else {
+		rest = ""
+	}
+
+	for _, line := range strings.Split(block, "\n") {
+		key, value, found := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		if !found || key == "" || strings.HasPrefix(line, " ") || strings.HasPrefix(key, "#") {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		if value != "" {
+			metadata[key] = value
+		}
+	}
+	return rest
+}
+
+// firstHeading returns the text of the first Markdown heading of the content.
+func firstHeading(content string) string {
+	for _, section := range markdownSections(content, 6) {
+		if section.title != "" {
+			return section.title
+		}
+	}
+	return ""
+}
+
+var (
+	loadersMu sync.RWMutex
+	loaders   = map[string]Loader{
+		".txt":      &TextLoader{},
+		".text":     &TextLoader{},
+		".log":      &TextLoader{},
+		".csv":      &TextLoader{},
+		".tsv":      &TextLoader{},
+		".json":     &TextLoader{},
+		".jsonl":    &TextLoader{},
+		".yaml":     &TextLoader{},
+		".yml":      &TextLoader{},
+		".toml":     &TextLoader{},
+		".xml":      &TextLoader{},
+		".rst":      &TextLoader{},
+		".md":       &MarkdownLoader{},
+		".markdown": &MarkdownLoader{},
+	}
+)
+
+// RegisterLoader sets the loader used by LoadFile and LoadDir for files with the extension, for example ".html".
+func RegisterLoader(extension string, loader Loader) error {
+	if extension == "" {
+		return errors.New("extension cannot be empty")
+	}
+	if loader == nil {
+		return errors.New("loader cannot be nil")
+	}
+	if !strings.HasPrefix(extension, ".") {
+		extension = "." + extension
+	}
+	loadersMu.Lock()
+	defer loadersMu.Unlock()
+	loaders[strings.ToLower(extension)] = loader
+	return nil
+}
+
+// loaderFor returns the loader for the extension of the path.
+func loaderFor(path string) (Loader, bool) {
+	loadersMu.RLock()
+	defer loadersMu.RUnlock()
+	loader, ok := loaders[strings.ToLower(filepath.Ext(path))]
+	return loader, ok
+}
+
+// LoadFile loads the documents of a file with the loader registered for its extension.
+// Text formats such as .txt, .csv, .json and .yaml are loaded with TextLoader, .md and .markdown files with MarkdownLoader.
+//
+// Parameters:
+//   - path: The path of the file
+//
+// Returns:
+//   - The documents of the file
+//   - An error if there is no loader for the extension or the file can't be read
+func LoadFile(path string) ([]Document, error) {
+	loader, ok := loaderFor(path)
+	if !ok {
+		return nil, fmt.Errorf("no loader registered for %s", path)
+	}
+	return loader.Load(path)
+}
+
+// LoadDir loads all files below a directory which have a registered loader. Other files are skipped.
+//
+// Parameters:
+//   - dir: The directory to load
+//
+// Returns:
+//   - The documents, ordered by path
+//   - An error if the directory can't be read or a file fails to load
+func LoadDir(dir string) ([]Document, error) {
+	var documents []Document
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		if _, ok := loaderFor(path); !ok {
+			return nil
+		}
+		loaded, err := LoadFile(path)
+		if err != nil {
+			return err
+		}
+		documents = append(documents, loaded...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
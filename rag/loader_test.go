@@ -0,0 +1,91 @@
+package rag
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestLoadFile_Text(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	writeFile(t, path, "Plain notes")
+
+	documents, err := LoadFile(path)
+
+	assert.NoError(t, err)
+	assert.Len(t, documents, 1)
+	assert.Equal(t, path, documents[0].ID)
+	assert.Equal(t, "Plain notes", documents[0].Content)
+	assert.Equal(t, path, documents[0].Metadata["source"])
+}
+
+func TestLoadFile_Markdown(t *testing.T) {
+	dir := t.TempDir()
+	withFrontMatter := filepath.Join(dir, "guide.md")
+	writeFile(t, withFrontMatter, "---\ntitle: \"User Guide\"\ncategory: manual\n---\n# Introduction\nWelcome.\n")
+	withHeading := filepath.Join(dir, "faq.markdown")
+	writeFile(t, withHeading, "Some text\n\n## Frequent questions\nAnswers.\n")
+
+	documents, err := LoadFile(withFrontMatter)
+	assert.NoError(t, err)
+	assert.Equal(t, "# Introduction\nWelcome.\n", documents[0].Content)
+	assert.Equal(t, "User Guide", documents[0].Metadata["title"])
+	assert.Equal(t, "manual", documents[0].Metadata["category"])
+
+	documents, err = LoadFile(withHeading)
+	assert.NoError(t, err)
+	assert.Equal(t, "Frequent questions", documents[0].Metadata["title"])
+}
+
+func TestLoadFile_Errors(t *testing.T) {
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "data.txt")
+	assert.NoError(t, os.WriteFile(binary, []byte{0xff, 0xfe, 0x00}, 0o644))
+	_, err := LoadFile(binary)
+	assert.Error(t, err)
+
+	_, err = LoadFile(filepath.Join(dir, "report.pdf"))
+	assert.ErrorContains(t, err, "no loader registered")
+
+	_, err = LoadFile(filepath.Join(dir, "missing.txt"))
+	assert.Error(t, err)
+}
+
+type upperLoader struct{}
+
+func (loader *upperLoader) Load(path string) ([]Document, error) {
+	return []Document{{ID: path, Content: "LOADED"}}, nil
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.txt"), "A")
+	writeFile(t, filepath.Join(dir, "sub", "b.md"), "# B")
+	writeFile(t, filepath.Join(dir, "image.png"), "not loaded")
+	writeFile(t, filepath.Join(dir, "page.custom"), "<p>custom</p>")
+
+	documents, err := LoadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, documents, 2)
+	assert.Equal(t, "A", documents[0].Content)
+	assert.Equal(t, "# B", documents[1].Content)
+
+	assert.NoError(t, RegisterLoader("custom", &upperLoader{}))
+	defer func() {
+		loadersMu.Lock()
+		delete(loaders, ".custom")
+		loadersMu.Unlock()
+	}()
+	documents, err = LoadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, documents, 3)
+	assert.Equal(t, "LOADED", documents[1].Content)
+}
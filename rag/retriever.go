@@ -0,0 +1,111 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jieliu2000/anyi/llm"
+)
+
+// DefaultTopK is the number of chunks Retrieve returns if topK is not set.
+const DefaultTopK = 4
+
+// Retriever indexes documents and retrieves the chunks most relevant to a query. It uses the same embedder for the chunks and the queries, so the vectors are comparable.
+type Retriever struct {
+	// Index holds the embeddings of the chunks.
+	Index *Index
+	// Embedder computes the embeddings, usually an llm client such as an OpenAI or Ollama client.
+	Embedder llm.Embedder
+	// Chunker splits the documents added with AddDocuments. Defaults to a RecursiveChunker with DefaultChunkSize and an overlap of 100 characters.
+	Chunker Chunker
+}
+
+// NewRetriever creates a retriever which splits documents with the default chunker.
+//
+// Parameters:
+//   - embedder: The embedder of chunks and queries
+//   - index: The index of the chunks. Use NewIndex for an index in memory or OpenIndex for an index saved to a file
+//
+// Returns:
+//   - The retriever
+func NewRetriever(embedder llm.Embedder, index *Index) *Retriever {
+	return &Retriever{Index: index, Embedder: embedder}
+}
+
+// AddDocuments splits the documents into chunks, computes their embeddings and adds them to the index.
+// Chunks which were added for a document with the same ID before are replaced, so changed files can be indexed again. They are kept if the new chunks can't be embedded or indexed.
+//
+// Parameters:
+//   - ctx: The context of the embedding requests
+//   - documents: The documents to add
+//
+// Returns:
+//   - An error if the embeddings can't be computed or the index can't be saved
+func (retriever *Retriever) AddDocuments(ctx context.Context, documents ...Document) error {
+	if err := retriever.check(); err != nil {
+		return err
+	}
+	chunker := retriever.Chunker
+	if chunker == nil {
+		chunker = &RecursiveChunker{Overlap: 100}
+	}
+
+	for _, document := range documents {
+		chunks := chunker.Split(document)
+		texts := make([]string, len(chunks))
+		for i, chunk := range chunks {
+			texts[i] = chunk.Content
+		}
+		var vectors [][]float32
+		if len(texts) > 0 {
+			var err error
+			vectors, _, err = retriever.Embedder.Embed(ctx, texts)
+			if err != nil {
+				return fmt.Errorf("failed to embed document %s: %w", document.ID, err)
+			}
+		}
+		if err := retriever.Index.ReplaceDocument(document.ID, chunks, vectors); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Retrieve returns the chunks most similar to the query.
+//
+// Parameters:
+//   - ctx: The context of the embedding request
+//   - query: The text to search for, for example the question of a user
+//   - topK: The maximum number of chunks. Defaults to DefaultTopK if it's not positive
+//   - filter: The metadata the chunks must have, or nil
+//
+// Returns:
+//   - The chunks, most similar first
+//   - An error if the query can't be embedded
+func (retriever *Retriever) Retrieve(ctx context.Context, query string, topK int, filter Filter) ([]Result, error) {
+	if err := retriever.check(); err != nil {
+		return nil, err
+	}
+	if topK <= 0 {
+		topK = DefaultTopK
+	}
+	vectors, _, err := retriever.Embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed the query: %w", err)
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("expected 1 embedding for the query, got %d", len(vectors))
+	}
+	return retriever.Index.Search(vectors[0], topK, filter)
+}
+
+func (retriever *Retriever) check() error {
+	if retriever.Index == nil {
+		return errors.New("retriever has no index")
+	}
+	if retriever.Embedder == nil {
+		return errors.New("retriever has no embedder")
+	}
+	return nil
+}
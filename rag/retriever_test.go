@@ -0,0 +1,73 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jieliu2000/anyi/internal/test"
+	"github.com/jieliu2000/anyi/llm/chat"
+	"github.com/stretchr/testify/assert"
+)
+
+func newEmbedder() *test.EmbeddingClient {
+	return &test.EmbeddingClient{Vocabulary: []string{"cat", "dog", "fish", "food", "walk"}}
+}
+
+func TestRetriever(t *testing.T) {
+	embedder := newEmbedder()
+	retriever := NewRetriever(embedder, NewIndex())
+	retriever.Chunker = &HeadingChunker{}
+
+	err := retriever.AddDocuments(context.Background(),
+		Document{ID: "pets.md", Content: "# Cats\nA cat eats cat food.\n# Dogs\nA dog needs a walk every day.", Metadata: map[string]any{"topic": "pets"}},
+		Document{ID: "aquarium.md", Content: "# Fish\nFish food for fish.", Metadata: map[string]any{"topic": "aquarium"}},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, retriever.Index.Len())
+	assert.Len(t, embedder.Embedded, 2)
+
+	results, err := retriever.Retrieve(context.Background(), "When should I walk my dog?", 1, nil)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, "pets.md#1", results[0].Chunk.ID)
+	assert.Equal(t, "Dogs", results[0].Chunk.Metadata["heading"])
+
+	results, err = retriever.Retrieve(context.Background(), "food", 0, Filter{"topic": "aquarium"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"aquarium.md#0"}, chunkIDs(results))
+}
+
+func TestRetriever_AddDocumentsReplacesChunks(t *testing.T) {
+	retriever := NewRetriever(newEmbedder(), NewIndex())
+	retriever.Chunker = &FixedSizeChunker{Size: 10}
+
+	assert.NoError(t, retriever.AddDocuments(context.Background(), Document{ID: "doc", Content: "cat food and dog walk"}))
+	assert.Equal(t, 3, retriever.Index.Len())
+
+	assert.NoError(t, retriever.AddDocuments(context.Background(), Document{ID: "doc", Content: "fish"}))
+	assert.Equal(t, 1, retriever.Index.Len())
+
+	// The chunks are kept if the new version can't be embedded
+	retriever.Embedder = &failingEmbedder{}
+	assert.Error(t, retriever.AddDocuments(context.Background(), Document{ID: "doc", Content: "cat food"}))
+	assert.Equal(t, 1, retriever.Index.Len())
+}
+
+type failingEmbedder struct{}
+
+func (embedder *failingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, chat.ResponseInfo, error) {
+	return nil, chat.ResponseInfo{}, errors.New("embedding failed")
+}
+
+func TestRetriever_Errors(t *testing.T) {
+	retriever := NewRetriever(&failingEmbedder{}, NewIndex())
+	assert.ErrorContains(t, retriever.AddDocuments(context.Background(), Document{ID: "doc", Content: "text"}), "embedding failed")
+	_, err := retriever.Retrieve(context.Background(), "query", 1, nil)
+	assert.ErrorContains(t, err, "embedding failed")
+
+	_, err = (&Retriever{Index: NewIndex()}).Retrieve(context.Background(), "query", 1, nil)
+	assert.Error(t, err)
+	_, err = (&Retriever{Embedder: newEmbedder()}).Retrieve(context.Background(), "query", 1, nil)
+	assert.Error(t, err)
+}
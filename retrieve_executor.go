@@ -0,0 +1,159 @@
+package anyi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jieliu2000/anyi/flow"
+	"github.com/jieliu2000/anyi/llm"
+	"github.com/jieliu2000/anyi/rag"
+)
+
+const (
+	// DefaultRetrieveVariable is the variable RetrieveExecutor stores the text of the retrieved chunks in if Variable is not set.
+	DefaultRetrieveVariable = "context"
+	// DefaultRetrieveResultsVariable is the variable RetrieveExecutor stores the retrieved results in if ResultsVariable is not set.
+	DefaultRetrieveResultsVariable = "chunks"
+)
+
+// RetrieveExecutor is an executor that searches a vector index with the Text of the flow context and stores the most similar chunks in variables, so the next step can use them in its prompt.
+// The Text of the flow context is not changed.
+//
+// The retriever is either registered with RegisterRetriever and referenced by name, or opened from an index file created with rag.OpenIndex and a client implementing llm.Embedder. The client must use the same embedding model which was used to build the index.
+//
+// Example usage in configuration:
+//
+//	steps:
+//	  - executor:
+//	      type: "retrieve"
+//	      withconfig:
+//	        indexPath: "./docs.index.json"
+//	        clientName: "openai"
+//	        topK: 3
+//	        filter: {category: "manual"}
+//	  - executor:
+//	      type: "llm"
+//	      withconfig:
+//	        template: "Answer with the documentation below.\n\n{{.Variables.context}}\n\nQuestion: {{.Text}}"
+type RetrieveExecutor struct {
+	// The name of a retriever registered with RegisterRetriever. It's used instead of IndexPath if both are set.
+	Retriever string `json:"retriever" yaml:"retriever" mapstructure:"retriever"`
+	// RetrieverImpl is the retriever to use. It's used instead of Retriever and IndexPath.
+	RetrieverImpl *rag.Retriever `json:"-" yaml:"-" mapstructure:"-"`
+
+	// The path of the index file, see rag.OpenIndex.
+	IndexPath string `json:"indexPath" yaml:"indexPath" mapstructure:"indexPath"`
+	// The name of the client computing the embedding of the query. Defaults to the default client. Only used with IndexPath.
+	ClientName string `json:"clientName" yaml:"clientName" mapstructure:"clientName"`
+
+	// The maximum number of chunks. Defaults to rag.DefaultTopK.
+	TopK int `json:"topK" yaml:"topK" mapstructure:"topK"`
+	// The minimum cosine similarity of a chunk. Chunks with a lower score are dropped. Zero keeps all chunks.
+	MinScore float32 `json:"minScore" yaml:"minScore" mapstructure:"minScore"`
+	// The metadata the chunks must have, see rag.Filter.
+	Filter map[string]any `json:"filter" yaml:"filter" mapstructure:"filter"`
+
+	// The variable holding the contents of the chunks, joined by Separator. Defaults to DefaultRetrieveVariable.
+	Variable string `json:"variable" yaml:"variable" mapstructure:"variable"`
+	// The variable holding the retrieved []rag.Result with the chunks, their metadata and scores. Defaults to DefaultRetrieveResultsVariable.
+	ResultsVariable string `json:"resultsVariable" yaml:"resultsVariable" mapstructure:"resultsVariable"`
+	// The text between two chunks in Variable. Defaults to an empty line.
+	Separator string `json:"separator" yaml:"separator" mapstructure:"separator"`
+}
+
+// Init sets the defaults and opens the index file if IndexPath is set.
+// A registered retriever is looked up when the step runs, so it can be registered after the executor is created.
+func (executor *RetrieveExecutor) Init() error {
+	if executor.Variable == "" {
+		executor.Variable = DefaultRetrieveVariable
+	}
+	if executor.ResultsVariable == "" {
+		executor.ResultsVariable = DefaultRetrieveResultsVariable
+	}
+	if executor.Separator == "" {
+		executor.Separator = "\n\n"
+	}
+	if executor.RetrieverImpl != nil || executor.Retriever != "" {
+		return nil
+	}
+	if executor.IndexPath == "" {
+		return errors.New("retriever or indexPath must be set")
+	}
+
+	index, err := rag.OpenIndex(executor.IndexPath)
+	if err != nil {
+		return err
+	}
+	var client llm.Client
+	if executor.ClientName != "" {
+		client, err = GetClient(executor.ClientName)
+	} else {
+		client, err = GetDefaultClient()
+	}
+	if err != nil {
+		return err
+	}
+	embedder, ok := client.(llm.Embedder)
+	if !ok {
+		return fmt.Errorf("client of type %T doesn't support embeddings", client)
+	}
+	executor.RetrieverImpl = rag.NewRetriever(embedder, index)
+	return nil
+}
+
+// Run retrieves the chunks. See RunContext.
+func (executor *RetrieveExecutor) Run(flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
+	return executor.RunContext(context.Background(), flowContext, step)
+}
+
+// RunContext retrieves the chunks most similar to the Text of the flow context and stores them in Variable and ResultsVariable.
+//
+// Parameters:
+//   - ctx: The context of the embedding request
+//   - flowContext: The current flow context
+//   - step: The current workflow step
+//
+// Returns:
+//   - The flow context with the retrieved chunks in its variables
+//   - An error if the retriever is not found or the search fails
+func (executor *RetrieveExecutor) RunContext(ctx context.Context, flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
+	retriever, err := executor.retriever()
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := retriever.Retrieve(ctx, flowContext.Text, executor.TopK, rag.Filter(executor.Filter))
+	if err != nil {
+		return nil, err
+	}
+	kept := make([]rag.Result, 0, len(results))
+	contents := make([]string, 0, len(results))
+	for _, result := range results {
+		if executor.MinScore != 0 && result.Score < executor.MinScore {
+			continue
+		}
+		kept = append(kept, result)
+		contents = append(contents, result.Chunk.Content)
+	}
+
+	// The variables are copied so the flow context of the previous step is not changed
+	flowContext.Variables = copyVariables(flowContext.Variables)
+	flowContext.Variables[executor.Variable] = strings.Join(contents, executor.Separator)
+	flowContext.Variables[executor.ResultsVariable] = kept
+	return &flowContext, nil
+}
+
+// retriever returns the retriever of the executor, initializing the executor on first use.
+func (executor *RetrieveExecutor) retriever() (*rag.Retriever, error) {
+	if executor.Variable == "" || (executor.RetrieverImpl == nil && executor.Retriever == "") {
+		if err := executor.Init(); err != nil {
+			return nil, err
+		}
+	}
+	if executor.RetrieverImpl != nil {
+		return executor.RetrieverImpl, nil
+	}
+	return GetRetriever(executor.Retriever)
+}
@@ -0,0 +1,112 @@
+package anyi
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jieliu2000/anyi/flow"
+	"github.com/jieliu2000/anyi/internal/test"
+	"github.com/jieliu2000/anyi/rag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPetsRetriever(t *testing.T, embedder *test.EmbeddingClient, index *rag.Index) *rag.Retriever {
+	retriever := rag.NewRetriever(embedder, index)
+	retriever.Chunker = &rag.HeadingChunker{}
+	require.NoError(t, retriever.AddDocuments(context.Background(),
+		rag.Document{ID: "cats.md", Content: "# Cats\nCats like fish.", Metadata: map[string]any{"animal": "cat"}},
+		rag.Document{ID: "dogs.md", Content: "# Dogs\nDogs need a walk.\n# Food\nDogs eat dog food.", Metadata: map[string]any{"animal": "dog"}},
+	))
+	return retriever
+}
+
+func TestRetrieveExecutor_IndexPathInFlowConfig(t *testing.T) {
+	resetRegistry()
+	path := filepath.Join(t.TempDir(), "pets.json")
+	index, err := rag.OpenIndex(path)
+	require.NoError(t, err)
+	client := &test.EmbeddingClient{
+		SequenceClient: test.SequenceClient{Outputs: []string{"Take it for a walk."}},
+		Vocabulary:     []string{"cat", "cats", "dog", "dogs", "fish", "food", "walk"},
+	}
+	newPetsRetriever(t, client, index)
+	require.NoError(t, RegisterClient("pets", client))
+
+	f, err := NewFlowFromConfig(&FlowConfig{
+		Name:       "pets",
+		ClientName: "pets",
+		Steps: []StepConfig{
+			{Executor: &ExecutorConfig{Type: "retrieve", WithConfig: map[string]interface{}{
+				"indexPath":  path,
+				"clientName": "pets",
+				"topK":       1,
+			}}},
+			{Executor: &ExecutorConfig{Type: "llm", WithConfig: map[string]interface{}{
+				"template": "Context: {{.Variables.context}}\nQuestion: {{.Text}}",
+			}}},
+		},
+	})
+	require.NoError(t, err)
+
+	result, err := f.RunWithInput("When should I walk my dogs?")
+
+	require.NoError(t, err)
+	assert.Equal(t, "Take it for a walk.", result.Text)
+	assert.Equal(t, "# Dogs\nDogs need a walk.", result.Variables["context"])
+	messages := client.Messages[len(client.Messages)-1]
+	assert.Equal(t, "Context: # Dogs\nDogs need a walk.\nQuestion: When should I walk my dogs?", messages[len(messages)-1].Content)
+}
+
+func TestRetrieveExecutor_RegisteredRetriever(t *testing.T) {
+	resetRegistry()
+	embedder := &test.EmbeddingClient{Vocabulary: []string{"cats", "dogs", "fish", "food", "walk"}}
+	require.NoError(t, RegisterRetriever("pets", newPetsRetriever(t, embedder, rag.NewIndex())))
+
+	executor := &RetrieveExecutor{
+		Retriever:       "pets",
+		TopK:            5,
+		MinScore:        0.1,
+		Filter:          map[string]any{"animal": "dog"},
+		Variable:        "docs",
+		ResultsVariable: "hits",
+		Separator:       "\n---\n",
+	}
+	require.NoError(t, executor.Init())
+
+	input := flow.FlowContext{Text: "dogs food", Variables: map[string]any{"kept": true}}
+	result, err := executor.Run(input, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, "dogs food", result.Text)
+	assert.Equal(t, "# Food\nDogs eat dog food.\n---\n# Dogs\nDogs need a walk.", result.Variables["docs"])
+	hits := result.Variables["hits"].([]rag.Result)
+	assert.Len(t, hits, 2)
+	assert.Equal(t, "Food", hits[0].Chunk.Metadata["heading"])
+	assert.Equal(t, true, result.Variables["kept"])
+	assert.NotContains(t, input.Variables, "docs")
+}
+
+func TestRetrieveExecutor_NoMatches(t *testing.T) {
+	embedder := &test.EmbeddingClient{Vocabulary: []string{"cats", "dogs", "fish", "food", "walk"}}
+	executor := &RetrieveExecutor{RetrieverImpl: newPetsRetriever(t, embedder, rag.NewIndex()), MinScore: 0.5}
+
+	result, err := executor.Run(flow.FlowContext{Text: "an unrelated question"}, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, "", result.Variables[DefaultRetrieveVariable])
+	assert.Empty(t, result.Variables[DefaultRetrieveResultsVariable])
+}
+
+func TestRetrieveExecutor_Errors(t *testing.T) {
+	resetRegistry()
+	require.NoError(t, RegisterClient("chat-only", &test.SequenceClient{}))
+
+	assert.Error(t, (&RetrieveExecutor{}).Init())
+	assert.ErrorContains(t, (&RetrieveExecutor{IndexPath: filepath.Join(t.TempDir(), "index.json"), ClientName: "chat-only"}).Init(), "doesn't support embeddings")
+	assert.Error(t, (&RetrieveExecutor{IndexPath: filepath.Join(t.TempDir(), "index.json"), ClientName: "missing"}).Init())
+
+	_, err := (&RetrieveExecutor{Retriever: "missing"}).Run(flow.FlowContext{Text: "question"}, nil)
+	assert.ErrorContains(t, err, "no retriever found")
+}
@@ -0,0 +1,205 @@
+package anyi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jieliu2000/anyi/flow"
+	"github.com/jieliu2000/anyi/internal/expr"
+)
+
+// SubFlowExecutor is an executor that runs another flow as a step and maps values between the two flows.
+//
+// The sub-flow runs in isolation: it only receives the variables mapped by Inputs (or a copy of all variables if InheritVariables is set), and its variable writes change neither the variables of the calling flow nor the Variables of the registered sub-flow. Only the values mapped by Outputs are copied back.
+//
+// Inputs, Outputs, Input and Output are expressions, see NewExpressionEnv for the names they can use. Inputs and Input are evaluated on the flow context of the calling step, Outputs and Output on the result of the sub-flow.
+//
+// Example usage in configuration:
+//
+//	{
+//	  "type": "flow",
+//	  "withconfig": {
+//	    "flow": "translate",
+//	    "input": "Variables.draft",
+//	    "inputs": {"language": "Variables.customer.language"},
+//	    "outputs": {"translation": "Text", "detected": "Variables.sourceLanguage"},
+//	    "keepText": true
+//	  }
+//	}
+type SubFlowExecutor struct {
+	// The name of the flow to run
+	Flow string `json:"flow" yaml:"flow" mapstructure:"flow"`
+	// FlowImpl is the flow to run. It's used instead of looking up Flow in the registry.
+	FlowImpl *flow.Flow `json:"-" yaml:"-" mapstructure:"-"`
+
+	// The expression whose value becomes the Text of the sub-flow. Defaults to "Text". Values which aren't strings are JSON encoded, nil becomes an empty text.
+	Input string `json:"input" yaml:"input" mapstructure:"input"`
+	// Maps variable names of the sub-flow to expressions evaluated on the calling flow context.
+	Inputs map[string]string `json:"inputs" yaml:"inputs" mapstructure:"inputs"`
+	// If true, the sub-flow starts with a copy of all variables of the calling flow context. Inputs are applied on top.
+	InheritVariables bool `json:"inheritVariables" yaml:"inheritVariables" mapstructure:"inheritVariables"`
+
+	// The expression evaluated on the result of the sub-flow whose value becomes the Text of the step result. Defaults to "Text".
+	Output string `json:"output" yaml:"output" mapstructure:"output"`
+	// Maps variable names of the calling flow to expressions evaluated on the result of the sub-flow.
+	Outputs map[string]string `json:"outputs" yaml:"outputs" mapstructure:"outputs"`
+	// If true, the Text of the calling flow context is kept and Output is ignored.
+	KeepText bool `json:"keepText" yaml:"keepText" mapstructure:"keepText"`
+
+	input   *expr.Expression
+	output  *expr.Expression
+	inputs  map[string]*expr.Expression
+	outputs map[string]*expr.Expression
+}
+
+// Init checks that a flow is set and compiles the mapping expressions.
+// The flow is looked up when the step runs, so it can be registered after the executor is created.
+func (executor *SubFlowExecutor) Init() error {
+	if executor.Flow == "" && executor.FlowImpl == nil {
+		return errors.New("flow is not set")
+	}
+	if executor.Input == "" {
+		executor.Input = "Text"
+	}
+	if executor.Output == "" {
+		executor.Output = "Text"
+	}
+
+	var err error
+	if executor.input, err = compileMapping("input", executor.Input); err != nil {
+		return err
+	}
+	if executor.output, err = compileMapping("output", executor.Output); err != nil {
+		return err
+	}
+	if executor.inputs, err = compileMappings("input", executor.Inputs); err != nil {
+		return err
+	}
+	if executor.outputs, err = compileMappings("output", executor.Outputs); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Run runs the sub-flow. See RunContext for details.
+func (executor *SubFlowExecutor) Run(flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
+	return executor.RunContext(context.Background(), flowContext, step)
+}
+
+// RunContext runs the sub-flow with the mapped inputs and copies the mapped outputs back.
+//
+// Parameters:
+//   - ctx: The context of the execution
+//   - flowContext: The flow context of the calling step
+//   - step: The current workflow step
+//
+// Returns:
+//   - The flow context with the mapped outputs
+//   - An error if the flow is not found, a mapping cannot be evaluated or the sub-flow fails
+func (executor *SubFlowExecutor) RunContext(ctx context.Context, flowContext flow.FlowContext, step *flow.Step) (*flow.FlowContext, error) {
+	if executor.input == nil || executor.output == nil {
+		if err := executor.Init(); err != nil {
+			return nil, err
+		}
+	}
+	subFlow, err := resolveFlow(executor.Flow, executor.FlowImpl)
+	if err != nil {
+		return nil, err
+	}
+
+	input, err := executor.childContext(flowContext)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := subFlow.Clone().RunContext(ctx, *input)
+	if err != nil {
+		var pause *flow.PauseError
+		if errors.As(err, &pause) {
+			// The paused run of the sub-flow can't be resumed through the calling flow
+			return nil, fmt.Errorf("flow %s paused, which is not supported in sub-flows: %v", subFlow.Name, err)
+		}
+		return nil, fmt.Errorf("flow %s failed: %w", subFlow.Name, err)
+	}
+
+	env := NewExpressionEnv(*output)
+	flowContext.Variables = copyVariables(flowContext.Variables)
+	for name, expression := range executor.outputs {
+		value, err := expression.Eval(env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate output %s: %w", name, err)
+		}
+		flowContext.SetVariable(name, value)
+	}
+	if !executor.KeepText {
+		value, err := executor.output.Eval(env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate output %q: %w", executor.Output, err)
+		}
+		if flowContext.Text, err = mappedText(value); err != nil {
+			return nil, err
+		}
+	}
+	return &flowContext, nil
+}
+
+// childContext builds the flow context the sub-flow starts with.
+func (executor *SubFlowExecutor) childContext(flowContext flow.FlowContext) (*flow.FlowContext, error) {
+	env := NewExpressionEnv(flowContext)
+
+	child := &flow.FlowContext{
+		Memory:    flowContext.Memory,
+		ImageURLs: flowContext.ImageURLs,
+		Variables: make(map[string]any),
+	}
+	if executor.InheritVariables {
+		child.Variables = copyVariables(flowContext.Variables)
+	}
+	for name, expression := range executor.inputs {
+		value, err := expression.Eval(env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate input %s: %w", name, err)
+		}
+		child.Variables[name] = value
+	}
+
+	value, err := executor.input.Eval(env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate input %q: %w", executor.Input, err)
+	}
+	if child.Text, err = mappedText(value); err != nil {
+		return nil, err
+	}
+	return child, nil
+}
+
+// mappedText converts the value of a text mapping to text. Missing values are empty, values which aren't strings are JSON encoded.
+func mappedText(value any) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	return itemText(value)
+}
+
+// compileMapping compiles the expression of a mapping.
+func compileMapping(kind string, source string) (*expr.Expression, error) {
+	expression, err := expr.Compile(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %w", kind, source, err)
+	}
+	return expression, nil
+}
+
+// compileMappings compiles the expressions of a map of mappings.
+func compileMappings(kind string, sources map[string]string) (map[string]*expr.Expression, error) {
+	expressions := make(map[string]*expr.Expression, len(sources))
+	for name, source := range sources {
+		expression, err := compileMapping(kind+" "+name, source)
+		if err != nil {
+			return nil, err
+		}
+		expressions[name] = expression
+	}
+	return expressions, nil
+}
@@ -0,0 +1,80 @@
+package anyi
+
+import (
+	"testing"
+
+	"github.com/jieliu2000/anyi/flow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubFlowExecutor_MapsInputsAndOutputs(t *testing.T) {
+	var received map[string]any
+	translate := newFuncFlow(t, "translate", func(flowContext flow.FlowContext) (*flow.FlowContext, error) {
+		received = copyVariables(flowContext.Variables)
+		flowContext.Text = flowContext.GetVariableString("language", "") + ": " + flowContext.Text
+		flowContext.SetVariable("detected", "en")
+		flowContext.SetVariable("secret", "child only")
+		return &flowContext, nil
+	})
+	translate.Variables = map[string]any{"style": "formal"}
+	executor := &SubFlowExecutor{
+		FlowImpl: translate,
+		Input:    "Variables.draft",
+		Inputs:   map[string]string{"language": "Variables.customer.language"},
+		Outputs:  map[string]string{"translation": "Text", "source": "Variables.detected"},
+		KeepText: true,
+	}
+	require.NoError(t, executor.Init())
+
+	flowContext := flow.NewFlowContext("parent text", nil)
+	flowContext.SetVariable("draft", "Hello")
+	flowContext.SetVariable("customer", map[string]any{"language": "fr"})
+	result, err := executor.Run(*flowContext, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, "parent text", result.Text)
+	assert.Equal(t, "fr: Hello", result.Variables["translation"])
+	assert.Equal(t, "en", result.Variables["source"])
+	assert.NotContains(t, result.Variables, "secret")
+	assert.NotContains(t, flowContext.Variables, "translation")
+
+	// The sub-flow only sees the mapped variables and its own defaults
+	assert.Equal(t, map[string]any{"language": "fr", "style": "formal"}, received)
+
+	// Writes of the sub-flow don't leak into the registered flow
+	assert.Equal(t, map[string]any{"style": "formal"}, translate.Variables)
+}
+
+func TestSubFlowExecutor_Defaults(t *testing.T) {
+	resetRegistry()
+	upper := newFuncFlow(t, "shout", func(flowContext flow.FlowContext) (*flow.FlowContext, error) {
+		flowContext.Text = flowContext.Text + flowContext.GetVariableString("suffix", "?")
+		return &flowContext, nil
+	})
+	require.NoError(t, RegisterFlow("shout", upper))
+
+	executor, err := NewExecutorFromConfig(&ExecutorConfig{Type: "flow", WithConfig: map[string]any{"flow": "shout", "inheritVariables": true}})
+	require.NoError(t, err)
+	flowContext := flow.NewFlowContext("hey", nil)
+	flowContext.SetVariable("suffix", "!")
+
+	result, err := executor.Run(*flowContext, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, "hey!", result.Text)
+	assert.Equal(t, map[string]any{"suffix": "!"}, result.Variables)
+}
+
+func TestSubFlowExecutor_Errors(t *testing.T) {
+	assert.EqualError(t, (&SubFlowExecutor{}).Init(), "flow is not set")
+	assert.ErrorContains(t, (&SubFlowExecutor{Flow: "x", Inputs: map[string]string{"a": "Text =="}}).Init(), `invalid input a "Text =="`)
+
+	failing := newFuncFlow(t, "failing", func(flowContext flow.FlowContext) (*flow.FlowContext, error) {
+		return nil, assert.AnError
+	})
+	executor := &SubFlowExecutor{FlowImpl: failing}
+	_, err := executor.Run(*flow.NewFlowContext("", nil), nil)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.ErrorContains(t, err, "flow failing failed")
+}